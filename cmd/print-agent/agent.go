@@ -6,27 +6,52 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"queue-system/internal/printer"
 )
 
+// statusInterval is how often the agent reports its printer's status
+const statusInterval = 30 * time.Second
+
+// heartbeatInterval is how often the agent tells the server it is alive
+const heartbeatInterval = 15 * time.Second
+
 type PrintAgent struct {
-	config  *AgentConfig
-	printer *printer.Printer
-	client  *http.Client
+	config *AgentConfig
+	client *http.Client
+
+	// The printer and ticket design overrides change when the server sends
+	// new settings
+	mu          sync.RWMutex
+	printer     *printer.Printer
+	printerName string
+	template    json.RawMessage
+
+	// spool holds leased numbers and offline tickets; nil unless offline
+	// ticketing is enabled
+	spool  *Spool
+	online atomic.Bool
 }
 
 type PrintJobResponse struct {
-	ID           int64  `json:"id"`
-	QueueNumber  string `json:"queue_number"`
-	TypeName     string `json:"type_name"`
-	DateTime     string `json:"date_time"`
-	TemplateJSON string `json:"template_json"`
-	Status       string `json:"status"`
+	ID            int64  `json:"id"`
+	QueueNumber   string `json:"queue_number"`
+	TypeName      string `json:"type_name"`
+	DateTime      string `json:"date_time"`
+	TemplateJSON  string `json:"template_json"`
+	Priority      int    `json:"priority"`
+	Position      int    `json:"position"`
+	EstimatedWait int    `json:"estimated_wait_minutes"`
+	StatusURL     string `json:"status_url"`
+	Counter       string `json:"counter"`
+	Status        string `json:"status"`
 }
 
 type SSEEvent struct {
@@ -40,39 +65,46 @@ type PrintJobEvent struct {
 }
 
 func NewPrintAgent(cfg *AgentConfig) *PrintAgent {
-	return &PrintAgent{
-		config: cfg,
-		printer: printer.New(printer.PrinterConfig{
-			Enabled:     true,
-			PrinterName: cfg.PrinterName,
-		}),
-		client: &http.Client{Timeout: 30 * time.Second},
+	a := &PrintAgent{
+		config:      cfg,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		printerName: cfg.PrinterName,
 	}
+	a.printer = printer.New(a.printerConfig(nil))
+	return a
 }
 
 // Run starts the agent loop: catch up pending jobs, then subscribe to SSE.
 // On disconnection, it waits and retries.
 func (a *PrintAgent) Run(stop <-chan struct{}) {
+	go a.reportStatusLoop(stop)
+	go a.heartbeatLoop(stop)
+	if a.spool != nil {
+		go a.serveLocal(stop)
+	}
+
 	for {
-		log.Println("Catching up pending jobs...")
+		a.loadRemoteConfig()
+
+		debugf("Catching up pending jobs...")
 		a.catchUpPendingJobs()
 
-		log.Printf("Connecting to SSE at %s...", a.config.ServerURL)
+		debugf("Connecting to SSE at %s...", a.config.ServerURL)
 		err := a.subscribeSSE(stop)
 		if err != nil {
-			log.Printf("SSE connection lost: %v", err)
+			warnf("SSE connection lost: %v", err)
 		}
 
 		// Check if we should stop
 		select {
 		case <-stop:
-			log.Println("Agent stopping...")
+			infof("Agent stopping...")
 			return
 		default:
 		}
 
 		delay := time.Duration(a.config.RetryDelay) * time.Second
-		log.Printf("Reconnecting in %v...", delay)
+		debugf("Reconnecting in %v...", delay)
 		select {
 		case <-time.After(delay):
 		case <-stop:
@@ -81,38 +113,76 @@ func (a *PrintAgent) Run(stop <-chan struct{}) {
 	}
 }
 
+// newRequest builds a request to the server carrying the agent's API token.
+func (a *PrintAgent) newRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.config.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// post sends a JSON body to the server with the agent's API token.
+func (a *PrintAgent) post(url string, body io.Reader) (*http.Response, error) {
+	req, err := a.newRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	return a.client.Do(req)
+}
+
+// identity returns the query naming this agent to the server. Its group
+// comes from the API token.
+func (a *PrintAgent) identity() string {
+	return url.Values{"agent_id": {a.config.AgentID}}.Encode()
+}
+
 func (a *PrintAgent) catchUpPendingJobs() {
-	url := fmt.Sprintf("%s/api/print-agent/jobs/pending", a.config.ServerURL)
-	resp, err := a.client.Get(url)
+	url := fmt.Sprintf("%s/api/print-agent/jobs/pending?%s", a.config.ServerURL, a.identity())
+	req, err := a.newRequest(http.MethodGet, url, nil)
+	if err != nil {
+		warnf("Failed to build pending jobs request: %v", err)
+		return
+	}
+	resp, err := a.client.Do(req)
 	if err != nil {
-		log.Printf("Failed to fetch pending jobs: %v", err)
+		warnf("Failed to fetch pending jobs: %v", err)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Pending jobs returned status %d", resp.StatusCode)
+		warnf("Pending jobs returned status %d", resp.StatusCode)
 		return
 	}
 
 	var jobs []PrintJobResponse
 	if err := json.NewDecoder(resp.Body).Decode(&jobs); err != nil {
-		log.Printf("Failed to decode pending jobs: %v", err)
+		warnf("Failed to decode pending jobs: %v", err)
 		return
 	}
 
-	log.Printf("Found %d pending jobs", len(jobs))
+	debugf("Found %d pending jobs", len(jobs))
+	// The server only lists the jobs routed to this agent or its group
 	for _, job := range jobs {
 		a.processJob(job.ID)
 	}
 }
 
 func (a *PrintAgent) subscribeSSE(stop <-chan struct{}) error {
-	url := fmt.Sprintf("%s/api/print-agent/sse?agent_id=%s", a.config.ServerURL, a.config.AgentID)
+	url := fmt.Sprintf("%s/api/print-agent/sse?%s", a.config.ServerURL, a.identity())
 
 	// Use a client without timeout for SSE (long-lived connection)
 	sseClient := &http.Client{}
-	resp, err := sseClient.Get(url)
+	req, err := a.newRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build SSE request: %w", err)
+	}
+	resp, err := sseClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to connect SSE: %w", err)
 	}
@@ -122,7 +192,7 @@ func (a *PrintAgent) subscribeSSE(stop <-chan struct{}) error {
 		return fmt.Errorf("SSE returned status %d", resp.StatusCode)
 	}
 
-	log.Println("SSE connected, waiting for print jobs...")
+	infof("SSE connected, waiting for print jobs...")
 
 	scanner := bufio.NewScanner(resp.Body)
 	// Increase buffer for large messages
@@ -172,7 +242,7 @@ func (a *PrintAgent) subscribeSSE(stop <-chan struct{}) error {
 func (a *PrintAgent) handleSSEMessage(data string) {
 	var event SSEEvent
 	if err := json.Unmarshal([]byte(data), &event); err != nil {
-		log.Printf("Failed to parse SSE message: %v", err)
+		warnf("Failed to parse SSE message: %v", err)
 		return
 	}
 
@@ -180,11 +250,27 @@ func (a *PrintAgent) handleSSEMessage(data string) {
 	case "print_job":
 		var pjEvent PrintJobEvent
 		if err := json.Unmarshal(event.Data, &pjEvent); err != nil {
-			log.Printf("Failed to parse print_job event: %v", err)
+			warnf("Failed to parse print_job event: %v", err)
 			return
 		}
-		log.Printf("Received print job #%d for %s", pjEvent.JobID, pjEvent.QueueNumber)
+		debugf("Received print job #%d for %s", pjEvent.JobID, pjEvent.QueueNumber)
 		go a.processJob(pjEvent.JobID)
+	case "config_updated":
+		infof("Settings changed on the server, reloading")
+		go a.loadRemoteConfig()
+	case "numbers_reset":
+		if a.spool == nil {
+			return
+		}
+		var reset struct {
+			QueueType string `json:"queue_type"`
+		}
+		json.Unmarshal(event.Data, &reset)
+		if err := a.spool.DropBlocks(reset.QueueType); err != nil {
+			warnf("Failed to update spool: %v", err)
+		}
+		// New blocks are leased with the next heartbeat
+		infof("Queues were reset on the server, dropped the offline numbers leased before")
 	}
 }
 
@@ -192,43 +278,56 @@ func (a *PrintAgent) processJob(jobID int64) {
 	// 1. Claim the job
 	claimed, err := a.claimJob(jobID)
 	if err != nil {
-		log.Printf("Failed to claim job #%d: %v (likely already claimed)", jobID, err)
+		warnf("Failed to claim job #%d: %v (likely already claimed)", jobID, err)
 		return
 	}
 
-	log.Printf("Claimed job #%d: %s", jobID, claimed.QueueNumber)
+	debugf("Claimed job #%d: %s", jobID, claimed.QueueNumber)
+	if a.spool != nil {
+		if err := a.spool.SetTemplate(claimed.TemplateJSON); err != nil {
+			warnf("Failed to spool ticket template: %v", err)
+		}
+	}
 
 	// 2. Parse template from JSON
-	var tmpl printer.TicketTemplate
-	if err := json.Unmarshal([]byte(claimed.TemplateJSON), &tmpl); err != nil {
-		log.Printf("Failed to parse template for job #%d: %v", jobID, err)
+	tmpl, err := a.ticketTemplate(claimed.TemplateJSON)
+	if err != nil {
+		errorf("Failed to parse template for job #%d: %v", jobID, err)
 		a.failJob(jobID, "failed to parse template: "+err.Error())
 		return
 	}
 
 	// 3. Print the ticket
-	err = a.printer.PrintTicket(printer.TicketData{
-		QueueNumber: claimed.QueueNumber,
-		TypeName:    claimed.TypeName,
-		DateTime:    claimed.DateTime,
+	err = a.currentPrinter().PrintTicket(printer.TicketData{
+		QueueNumber:   claimed.QueueNumber,
+		TypeName:      claimed.TypeName,
+		DateTime:      claimed.DateTime,
+		Priority:      claimed.Priority > 0,
+		Position:      claimed.Position,
+		EstimatedWait: claimed.EstimatedWait,
+		StatusURL:     claimed.StatusURL,
+		Counter:       claimed.Counter,
 	}, tmpl)
 
+	// A job is a good moment to notice a paper or cover problem
+	defer a.reportStatus()
+
 	if err != nil {
-		log.Printf("Print failed for job #%d: %v", jobID, err)
+		errorf("Print failed for job #%d: %v", jobID, err)
 		a.failJob(jobID, err.Error())
 		return
 	}
 
 	// 4. Mark as completed
 	a.completeJob(jobID)
-	log.Printf("Job #%d printed successfully: %s", jobID, claimed.QueueNumber)
+	infof("Job #%d printed successfully: %s", jobID, claimed.QueueNumber)
 }
 
 func (a *PrintAgent) claimJob(jobID int64) (*PrintJobResponse, error) {
 	url := fmt.Sprintf("%s/api/print-agent/job/%d/claim", a.config.ServerURL, jobID)
 	body, _ := json.Marshal(map[string]string{"agent_id": a.config.AgentID})
 
-	resp, err := a.client.Post(url, "application/json", bytes.NewReader(body))
+	resp, err := a.post(url, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -248,21 +347,137 @@ func (a *PrintAgent) claimJob(jobID int64) (*PrintJobResponse, error) {
 
 func (a *PrintAgent) completeJob(jobID int64) {
 	url := fmt.Sprintf("%s/api/print-agent/job/%d/complete", a.config.ServerURL, jobID)
-	resp, err := a.client.Post(url, "application/json", strings.NewReader("{}"))
+	body, _ := json.Marshal(map[string]string{"agent_id": a.config.AgentID})
+	resp, err := a.post(url, bytes.NewReader(body))
 	if err != nil {
-		log.Printf("Failed to mark job #%d complete: %v", jobID, err)
+		warnf("Failed to mark job #%d complete: %v", jobID, err)
 		return
 	}
-	resp.Body.Close()
+	defer resp.Body.Close()
+
+	// A conflict means the lease ran out and the job was taken back
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		warnf("Server did not accept completion of job #%d: %d %s", jobID, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
 }
 
 func (a *PrintAgent) failJob(jobID int64, errMsg string) {
 	url := fmt.Sprintf("%s/api/print-agent/job/%d/fail", a.config.ServerURL, jobID)
-	body, _ := json.Marshal(map[string]string{"error": errMsg})
-	resp, err := a.client.Post(url, "application/json", bytes.NewReader(body))
+	body, _ := json.Marshal(map[string]string{"agent_id": a.config.AgentID, "error": errMsg})
+	resp, err := a.post(url, bytes.NewReader(body))
+	if err != nil {
+		warnf("Failed to mark job #%d failed: %v", jobID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	// The server retries the job later, or gives up on it after too many
+	// attempts; a conflict means the lease ran out and it was taken back.
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		warnf("Server did not accept failure of job #%d: %d %s", jobID, resp.StatusCode, strings.TrimSpace(string(respBody)))
+		return
+	}
+	var result struct {
+		Status   string `json:"status"`
+		Attempts int    `json:"attempts"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&result) == nil && result.Status == "dead" {
+		errorf("Job #%d gave up after %d attempts; reissue it from the admin page", jobID, result.Attempts)
+	}
+}
+
+// reportStatusLoop reports the printer status every statusInterval until
+// stop is closed.
+func (a *PrintAgent) reportStatusLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+
+	a.reportStatus()
+	for {
+		select {
+		case <-ticker.C:
+			a.reportStatus()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reportStatus queries the printer and sends the result to the server, so
+// the admin panel shows paper and cover problems at this kiosk.
+func (a *PrintAgent) reportStatus() {
+	p := a.currentPrinter()
+	report := map[string]interface{}{
+		"agent_id": a.config.AgentID,
+		"printer":  p.Describe(),
+	}
+	status, err := p.Status()
 	if err != nil {
-		log.Printf("Failed to mark job #%d failed: %v", jobID, err)
+		report["error"] = err.Error()
+	} else {
+		report["status"] = status
+		if !status.Online || status.PaperOut || status.CoverOpen {
+			errorf("Printer needs attention: %+v", *status)
+		}
+	}
+
+	url := fmt.Sprintf("%s/api/print-agent/status", a.config.ServerURL)
+	body, _ := json.Marshal(report)
+	resp, err := a.post(url, bytes.NewReader(body))
+	if err != nil {
+		warnf("Failed to report printer status: %v", err)
 		return
 	}
 	resp.Body.Close()
 }
+
+// heartbeatLoop sends a heartbeat every heartbeatInterval until stop is
+// closed. The server lists the agent as offline once they stop. While the
+// server answers, offline tickets are synced and numbers topped up.
+func (a *PrintAgent) heartbeatLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		ok := a.sendHeartbeat()
+		wasOnline := a.online.Swap(ok)
+		if a.spool != nil {
+			if ok {
+				a.syncOffline()
+			} else if wasOnline {
+				warnf("Server unreachable, kiosk tickets are issued offline")
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// sendHeartbeat reports whether the server accepted the heartbeat.
+func (a *PrintAgent) sendHeartbeat() bool {
+	hostname, _ := os.Hostname()
+	a.mu.RLock()
+	body, _ := json.Marshal(map[string]string{
+		"agent_id": a.config.AgentID,
+		"hostname": hostname,
+		"version":  Version,
+		"printer":  a.printerName,
+		"backend":  a.printer.Describe(),
+	})
+	a.mu.RUnlock()
+
+	url := fmt.Sprintf("%s/api/print-agent/heartbeat", a.config.ServerURL)
+	resp, err := a.post(url, bytes.NewReader(body))
+	if err != nil {
+		warnf("Failed to send heartbeat: %v", err)
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
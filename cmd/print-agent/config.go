@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -10,8 +13,24 @@ import (
 type AgentConfig struct {
 	AgentID     string `yaml:"agent_id"`
 	ServerURL   string `yaml:"server_url"`
+	Token       string `yaml:"token"`
 	PrinterName string `yaml:"printer_name"`
+	Backend     string `yaml:"backend"`
+	Address     string `yaml:"address"`
+	PaperWidth  int    `yaml:"paper_width"`
+	Columns     int    `yaml:"columns"`
+	Codepage    string `yaml:"codepage"`
 	RetryDelay  int    `yaml:"retry_delay"`
+	LogLevel    string `yaml:"log_level"`
+
+	// Offline ticketing: numbers leased for these queue types are issued
+	// from local_listen while the server is unreachable, to callers that
+	// send local_secret
+	SpoolDir          string   `yaml:"spool_dir"`
+	LocalListen       string   `yaml:"local_listen"`
+	LocalSecret       string   `yaml:"local_secret"`
+	KioskOrigin       string   `yaml:"kiosk_origin"`
+	OfflineQueueTypes []string `yaml:"offline_queue_types"`
 }
 
 func DefaultAgentConfig() *AgentConfig {
@@ -20,6 +39,7 @@ func DefaultAgentConfig() *AgentConfig {
 		ServerURL:   "http://localhost:8080",
 		PrinterName: "ECO80",
 		RetryDelay:  5,
+		SpoolDir:    "spool",
 	}
 }
 
@@ -41,6 +61,38 @@ func LoadAgentConfig(path string) (*AgentConfig, error) {
 	if cfg.ServerURL == "" {
 		return nil, fmt.Errorf("server_url is required in config")
 	}
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("token is required in config (create one in the admin panel with the print-agent scope)")
+	}
+
+	if _, ok := logLevels[cfg.LogLevel]; cfg.LogLevel != "" && !ok {
+		return nil, fmt.Errorf("unknown log_level %q (use debug, info, warn or error)", cfg.LogLevel)
+	}
+	if cfg.LocalListen != "" {
+		if len(cfg.OfflineQueueTypes) == 0 {
+			return nil, fmt.Errorf("offline_queue_types is required when local_listen is set")
+		}
+		if cfg.LocalSecret == "" {
+			return nil, fmt.Errorf("local_secret is required when local_listen is set")
+		}
+		// A port alone listens on this machine only
+		host, port, err := net.SplitHostPort(cfg.LocalListen)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local_listen %q: %w", cfg.LocalListen, err)
+		}
+		if host == "" {
+			cfg.LocalListen = net.JoinHostPort("127.0.0.1", port)
+		}
+		if cfg.KioskOrigin == "" {
+			// The kiosk page is served by the queue server
+			u, err := url.Parse(cfg.ServerURL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid server_url: %w", err)
+			}
+			cfg.KioskOrigin = u.Scheme + "://" + u.Host
+		}
+		cfg.KioskOrigin = strings.TrimSuffix(cfg.KioskOrigin, "/")
+	}
 
 	return cfg, nil
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"queue-system/internal/models"
+	"queue-system/internal/printer"
+)
+
+// localSecretHeader carries local_secret on requests to the local endpoint
+const localSecretHeader = "X-Agent-Secret"
+
+// serveLocal runs the local endpoint the kiosk on this machine takes
+// tickets from while the server is unreachable, until stop is closed.
+func (a *PrintAgent) serveLocal(stop <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/queues/take", a.handleLocalTake)
+	mux.HandleFunc("/status", a.handleLocalStatus)
+
+	srv := &http.Server{
+		Addr:              a.config.LocalListen,
+		Handler:           a.localCORS(a.localAuth(mux)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-stop
+		srv.Close()
+	}()
+
+	infof("Offline tickets on http://%s", a.config.LocalListen)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		warnf("Local endpoint stopped: %v", err)
+	}
+}
+
+// localCORS lets the kiosk page, served by the queue server, call the
+// agent. Pages from any other origin are not let in.
+func (a *PrintAgent) localCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		if r.Header.Get("Origin") == a.config.KioskOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", a.config.KioskOrigin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", localSecretHeader)
+			// Chrome asks before a page on the network calls this machine
+			if r.Header.Get("Access-Control-Request-Private-Network") == "true" {
+				w.Header().Set("Access-Control-Allow-Private-Network", "true")
+			}
+		}
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// localAuth refuses requests without local_secret, so only the kiosk can
+// use up the leased numbers.
+func (a *PrintAgent) localAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := r.Header.Get(localSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(a.config.LocalSecret)) != 1 {
+			localJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid or missing " + localSecretHeader})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func localJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// handleLocalTake issues a provisional ticket from the leased numbers and
+// prints it here. It answers like the server's take endpoint, so the kiosk
+// shows it the same way.
+func (a *PrintAgent) handleLocalTake(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		localJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	queueType := r.URL.Query().Get("type")
+	if queueType == "" {
+		queueType = "general"
+	}
+	priority := models.PriorityNormal
+	if val := r.URL.Query().Get("priority"); val != "" {
+		p, err := strconv.Atoi(val)
+		if err != nil || !models.QueuePriority(p).IsValid() {
+			localJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid priority"})
+			return
+		}
+		priority = models.QueuePriority(p)
+	}
+
+	ticket, typeName, err := a.spool.Issue(queueType, priority)
+	if err == errNoNumbers {
+		localJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "No offline numbers left for this queue type"})
+		return
+	}
+	if err != nil {
+		warnf("Failed to issue offline ticket: %v", err)
+		localJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to issue ticket"})
+		return
+	}
+	infof("Issued offline ticket %s", ticket.QueueNumber)
+
+	tmpl, err := a.ticketTemplate(a.spool.Template())
+	if err != nil {
+		warnf("Spooled ticket template is unreadable, using the default: %v", err)
+		tmpl, _ = a.ticketTemplate("")
+	}
+	printErr := a.currentPrinter().PrintTicket(printer.TicketData{
+		QueueNumber: ticket.QueueNumber,
+		TypeName:    typeName,
+		DateTime:    ticket.IssuedAt.Format("02/01/2006, 15:04:05"),
+		Priority:    priority > 0,
+	}, tmpl)
+
+	resp := map[string]interface{}{
+		"queue_number": ticket.QueueNumber,
+		"queue_type":   queueType,
+		"type_name":    typeName,
+		"priority":     priority,
+		"status":       models.StatusWaiting,
+		"created_at":   ticket.IssuedAt,
+		"provisional":  true,
+		"printed":      printErr == nil,
+	}
+	if printErr != nil {
+		errorf("Print failed for offline ticket %s: %v", ticket.QueueNumber, printErr)
+		resp["print_error"] = printErr.Error()
+	}
+	localJSON(w, http.StatusOK, resp)
+}
+
+// handleLocalStatus tells whether the server is reachable and how many
+// offline numbers and unsynced tickets the agent holds.
+func (a *PrintAgent) handleLocalStatus(w http.ResponseWriter, r *http.Request) {
+	remaining := make(map[string]int)
+	for _, queueType := range a.config.OfflineQueueTypes {
+		remaining[queueType] = a.spool.Remaining(queueType)
+	}
+	localJSON(w, http.StatusOK, map[string]interface{}{
+		"agent_id":  a.config.AgentID,
+		"online":    a.online.Load(),
+		"remaining": remaining,
+		"unsynced":  len(a.spool.Tickets()),
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocalEndpointAccess(t *testing.T) {
+	const kiosk = "http://antrian.local:8080"
+	a := &PrintAgent{config: &AgentConfig{LocalSecret: "s3cret", KioskOrigin: kiosk}}
+	handler := a.localCORS(a.localAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		secret      string
+		wantStatus  int
+		wantAllowed bool
+	}{
+		{"kiosk with secret", http.MethodPost, kiosk, "s3cret", http.StatusOK, true},
+		{"kiosk without secret", http.MethodPost, kiosk, "", http.StatusUnauthorized, true},
+		{"kiosk with wrong secret", http.MethodPost, kiosk, "guess", http.StatusUnauthorized, true},
+		{"kiosk preflight", http.MethodOptions, kiosk, "", http.StatusNoContent, true},
+		{"other page with secret", http.MethodPost, "http://evil.example", "s3cret", http.StatusOK, false},
+		{"other page preflight", http.MethodOptions, "http://evil.example", "", http.StatusNoContent, false},
+		{"no origin without secret", http.MethodGet, "", "", http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/queues/take", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.secret != "" {
+				req.Header.Set(localSecretHeader, tt.secret)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			allowed := rec.Header().Get("Access-Control-Allow-Origin") == kiosk
+			if allowed != tt.wantAllowed {
+				t.Errorf("origin allowed = %v, want %v", allowed, tt.wantAllowed)
+			}
+		})
+	}
+}
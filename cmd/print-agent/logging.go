@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// Log levels, set by log_level in config.yaml or from the server. Startup
+// messages are always logged.
+const (
+	levelDebug int32 = iota - 1
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevels = map[string]int32{
+	"debug": levelDebug,
+	"info":  levelInfo,
+	"warn":  levelWarn,
+	"error": levelError,
+}
+
+// logLevel is the lowest level logged; the zero value is levelInfo
+var logLevel atomic.Int32
+
+// setLogLevel changes the lowest level logged; "" means info.
+func setLogLevel(name string) error {
+	if name == "" {
+		name = "info"
+	}
+	level, ok := logLevels[name]
+	if !ok {
+		return fmt.Errorf("unknown log level %q (use debug, info, warn or error)", name)
+	}
+	logLevel.Store(level)
+	return nil
+}
+
+func logAt(level int32, format string, args ...interface{}) {
+	if level >= logLevel.Load() {
+		log.Output(3, fmt.Sprintf(format, args...))
+	}
+}
+
+func debugf(format string, args ...interface{}) { logAt(levelDebug, format, args...) }
+func infof(format string, args ...interface{})  { logAt(levelInfo, format, args...) }
+func warnf(format string, args ...interface{})  { logAt(levelWarn, format, args...) }
+func errorf(format string, args ...interface{}) { logAt(levelError, format, args...) }
@@ -2,30 +2,55 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 )
 
+// Version is set at build time with -ldflags "-X main.Version=..."
+var Version = "dev"
+
 func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "install" || os.Args[1] == "uninstall") {
+		if err := runService(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", os.Args[1], err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	configPath := flag.String("config", "config.yaml", "Path to agent config file")
 	flag.Parse()
 
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	log.Println("Starting Print Agent...")
+	log.Printf("Starting Print Agent %s...", Version)
 
 	cfg, err := LoadAgentConfig(*configPath)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	setLogLevel(cfg.LogLevel)
+
 	log.Printf("Agent ID:     %s", cfg.AgentID)
 	log.Printf("Server URL:   %s", cfg.ServerURL)
-	log.Printf("Printer Name: %s", cfg.PrinterName)
 	log.Printf("Retry Delay:  %ds", cfg.RetryDelay)
 
 	agent := NewPrintAgent(cfg)
+	if err := agent.printer.Err(); err != nil {
+		log.Fatalf("Invalid printer config: %v", err)
+	}
+	log.Printf("Printer:      %s", agent.printer.Describe())
+
+	if cfg.LocalListen != "" {
+		agent.spool, err = OpenSpool(cfg.SpoolDir)
+		if err != nil {
+			log.Fatalf("Failed to open spool: %v", err)
+		}
+		log.Printf("Spool:        %s (%d unsynced tickets)", cfg.SpoolDir, len(agent.spool.Tickets()))
+	}
 
 	stop := make(chan struct{})
 
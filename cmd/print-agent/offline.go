@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"queue-system/internal/models"
+)
+
+// syncOffline runs after each heartbeat the server answered: it sends the
+// tickets issued offline, then tops up the number blocks.
+func (a *PrintAgent) syncOffline() {
+	a.uploadOfflineTickets()
+	for _, queueType := range a.config.OfflineQueueTypes {
+		a.topUpNumbers(queueType)
+	}
+}
+
+// uploadOfflineTickets sends the spooled tickets to the server and drops the
+// ones it took. Tickets that failed on the server stay for the next round.
+func (a *PrintAgent) uploadOfflineTickets() {
+	tickets := a.spool.Tickets()
+	if len(tickets) == 0 {
+		return
+	}
+
+	url := fmt.Sprintf("%s/api/print-agent/offline-tickets", a.config.ServerURL)
+	body, _ := json.Marshal(map[string]interface{}{"agent_id": a.config.AgentID, "tickets": tickets})
+	resp, err := a.post(url, bytes.NewReader(body))
+	if err != nil {
+		warnf("Failed to sync offline tickets: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		warnf("Offline ticket sync returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+		return
+	}
+	var result struct {
+		Results []struct {
+			BlockID     int64  `json:"block_id"`
+			QueueNumber string `json:"queue_number"`
+			Status      string `json:"status"`
+			Error       string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		warnf("Failed to decode offline ticket sync: %v", err)
+		return
+	}
+
+	done := make(map[ticketKey]bool)
+	synced := 0
+	for _, r := range result.Results {
+		key := ticketKey{r.BlockID, r.QueueNumber}
+		switch r.Status {
+		case "synced":
+			synced++
+			done[key] = true
+		case "duplicate":
+			done[key] = true
+		case "rejected":
+			warnf("Server rejected offline ticket %s: %s", r.QueueNumber, r.Error)
+			done[key] = true
+		}
+	}
+	if err := a.spool.RemoveTickets(done); err != nil {
+		warnf("Failed to update spool: %v", err)
+	}
+	if synced > 0 {
+		infof("Synced %d offline tickets", synced)
+	}
+}
+
+// topUpNumbers leases a new number block for a queue type once fewer than
+// half a block is left, keeping the ticket design along with it.
+func (a *PrintAgent) topUpNumbers(queueType string) {
+	if !a.spool.RunningLow(queueType) {
+		return
+	}
+
+	url := fmt.Sprintf("%s/api/print-agent/number-blocks", a.config.ServerURL)
+	body, _ := json.Marshal(map[string]string{"agent_id": a.config.AgentID, "queue_type": queueType})
+	resp, err := a.post(url, bytes.NewReader(body))
+	if err != nil {
+		warnf("Failed to lease numbers for %s: %v", queueType, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		warnf("Number lease for %s returned %d: %s", queueType, resp.StatusCode, strings.TrimSpace(string(respBody)))
+		return
+	}
+	var lease struct {
+		Block        models.NumberBlock `json:"block"`
+		TemplateJSON string             `json:"template_json"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&lease); err != nil {
+		warnf("Failed to decode number lease: %v", err)
+		return
+	}
+
+	b := lease.Block
+	if err := a.spool.AddBlock(b); err != nil {
+		warnf("Failed to spool number block: %v", err)
+		return
+	}
+	if err := a.spool.SetTemplate(lease.TemplateJSON); err != nil {
+		warnf("Failed to spool ticket template: %v", err)
+	}
+	infof("Leased offline numbers %s-%s", models.FormatQueueNumber(b.Prefix, b.FirstNumber),
+		models.FormatQueueNumber(b.Prefix, b.LastNumber))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"queue-system/internal/models"
+	"queue-system/internal/printer"
+)
+
+// loadRemoteConfig pulls the agent's settings from the server and applies
+// them. It runs on every connect and on a config_updated event; while the
+// server is unreachable the agent keeps what it has.
+func (a *PrintAgent) loadRemoteConfig() {
+	url := fmt.Sprintf("%s/api/print-agent/config?%s", a.config.ServerURL, a.identity())
+	req, err := a.newRequest(http.MethodGet, url, nil)
+	if err != nil {
+		warnf("Failed to build config request: %v", err)
+		return
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		warnf("Failed to fetch config: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		// The server predates remote settings
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		warnf("Config returned status %d", resp.StatusCode)
+		return
+	}
+	var remote models.PrintAgentConfig
+	if err := json.NewDecoder(resp.Body).Decode(&remote); err != nil {
+		warnf("Failed to decode config: %v", err)
+		return
+	}
+	a.applyConfig(&remote)
+}
+
+// applyConfig applies the server's settings over config.yaml. A printer
+// setting that cannot be used is refused as a whole, keeping the printer
+// the agent has; the other settings still apply.
+func (a *PrintAgent) applyConfig(remote *models.PrintAgentConfig) {
+	if err := setLogLevel(firstNonEmpty(remote.LogLevel, a.config.LogLevel)); err != nil {
+		warnf("Ignoring log level from the server: %v", err)
+	}
+
+	p := printer.New(a.printerConfig(remote))
+	if err := p.Err(); err != nil {
+		errorf("Ignoring printer settings from the server: %v", err)
+		p = nil
+	}
+
+	a.mu.Lock()
+	changed := p != nil && p.Describe() != a.printer.Describe()
+	if p != nil {
+		a.printer = p
+		a.printerName = firstNonEmpty(remote.PrinterName, a.config.PrinterName)
+	}
+	a.template = remote.Template
+	a.mu.Unlock()
+
+	if changed {
+		infof("Printer: %s", p.Describe())
+		a.reportStatus()
+	}
+	if remote.UpdatedAt != nil {
+		debugf("Applied settings from the server, updated %s", remote.UpdatedAt.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// printerConfig returns the printer settings of config.yaml, overridden by
+// the ones set on the server.
+func (a *PrintAgent) printerConfig(remote *models.PrintAgentConfig) printer.PrinterConfig {
+	cfg := printer.PrinterConfig{
+		Enabled:     true,
+		PrinterName: a.config.PrinterName,
+		Backend:     a.config.Backend,
+		Address:     a.config.Address,
+		PaperWidth:  a.config.PaperWidth,
+		Columns:     a.config.Columns,
+		Codepage:    a.config.Codepage,
+	}
+	if remote == nil {
+		return cfg
+	}
+	if remote.Backend != "" {
+		// An address only means something to the backend it was set for
+		cfg.Backend, cfg.Address = remote.Backend, remote.Address
+	}
+	cfg.PrinterName = firstNonEmpty(remote.PrinterName, cfg.PrinterName)
+	cfg.Address = firstNonEmpty(remote.Address, cfg.Address)
+	if remote.PaperWidth > 0 {
+		cfg.PaperWidth = remote.PaperWidth
+	}
+	if remote.Columns > 0 {
+		cfg.Columns = remote.Columns
+	}
+	cfg.Codepage = firstNonEmpty(remote.Codepage, cfg.Codepage)
+	return cfg
+}
+
+// currentPrinter returns the printer the agent prints with now.
+func (a *PrintAgent) currentPrinter() *printer.Printer {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.printer
+}
+
+// ticketTemplate parses a job's ticket design and applies this agent's
+// overrides from the server. An empty design means the default one.
+func (a *PrintAgent) ticketTemplate(templateJSON string) (printer.TicketTemplate, error) {
+	tmpl := printer.DefaultTemplate()
+	if templateJSON != "" {
+		if err := json.Unmarshal([]byte(templateJSON), &tmpl); err != nil {
+			return tmpl, err
+		}
+	}
+
+	a.mu.RLock()
+	override := a.template
+	a.mu.RUnlock()
+	if len(override) > 0 {
+		if err := json.Unmarshal(override, &tmpl); err != nil {
+			warnf("Ignoring template override from the server: %v", err)
+		}
+	}
+	return tmpl, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
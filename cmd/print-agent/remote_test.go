@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"queue-system/internal/models"
+	"queue-system/internal/printer"
+)
+
+func TestPrinterConfig(t *testing.T) {
+	a := &PrintAgent{config: &AgentConfig{
+		PrinterName: "EPSON", Backend: "tcp", Address: "10.0.0.5:9100",
+		PaperWidth: 576, Columns: 48, Codepage: "pc437",
+	}}
+	local := printer.PrinterConfig{
+		Enabled: true, PrinterName: "EPSON", Backend: "tcp", Address: "10.0.0.5:9100",
+		PaperWidth: 576, Columns: 48, Codepage: "pc437",
+	}
+
+	tests := []struct {
+		name   string
+		remote *models.PrintAgentConfig
+		want   func(*printer.PrinterConfig)
+	}{
+		{"no settings on the server", nil, func(*printer.PrinterConfig) {}},
+		{"empty settings", &models.PrintAgentConfig{}, func(*printer.PrinterConfig) {}},
+		{"other backend drops the local address", &models.PrintAgentConfig{Backend: "device"},
+			func(c *printer.PrinterConfig) { c.Backend, c.Address = "device", "" }},
+		{"other backend with its address", &models.PrintAgentConfig{Backend: "device", Address: "/dev/usb/lp0"},
+			func(c *printer.PrinterConfig) { c.Backend, c.Address = "device", "/dev/usb/lp0" }},
+		{"address of the local backend", &models.PrintAgentConfig{Address: "10.0.0.6:9100"},
+			func(c *printer.PrinterConfig) { c.Address = "10.0.0.6:9100" }},
+		{"paper and code page", &models.PrintAgentConfig{PaperWidth: 384, Columns: 32, Codepage: "pc858"},
+			func(c *printer.PrinterConfig) { c.PaperWidth, c.Columns, c.Codepage = 384, 32, "pc858" }},
+		{"printer name", &models.PrintAgentConfig{PrinterName: "Loket"},
+			func(c *printer.PrinterConfig) { c.PrinterName = "Loket" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := local
+			tt.want(&want)
+			if got := a.printerConfig(tt.remote); got != want {
+				t.Errorf("printerConfig = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestTicketTemplate(t *testing.T) {
+	tests := []struct {
+		name       string
+		design     string
+		override   string
+		wantHeader string
+		wantTitle  string
+		wantErr    bool
+	}{
+		{"default design", "", "", "SISTEM ANTRIAN", "NOMOR ANTRIAN ANDA", false},
+		{"job design", `{"Header":"RS SEHAT"}`, "", "RS SEHAT", "NOMOR ANTRIAN ANDA", false},
+		{"override on the job design", `{"Header":"RS SEHAT","Title":"NOMOR"}`, `{"Header":"GEDUNG A"}`, "GEDUNG A", "NOMOR", false},
+		{"unreadable override is ignored", `{"Header":"RS SEHAT"}`, `["GEDUNG A"]`, "RS SEHAT", "NOMOR ANTRIAN ANDA", false},
+		{"unreadable design", `{`, "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &PrintAgent{config: &AgentConfig{}}
+			if tt.override != "" {
+				a.template = json.RawMessage(tt.override)
+			}
+			tmpl, err := a.ticketTemplate(tt.design)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ticketTemplate error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tmpl.Header != tt.wantHeader || tmpl.Title != tt.wantTitle {
+				t.Errorf("header %q, title %q; want %q, %q", tmpl.Header, tmpl.Title, tt.wantHeader, tt.wantTitle)
+			}
+		})
+	}
+}
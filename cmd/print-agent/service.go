@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+// defaultServiceName is the systemd unit the agent installs itself as
+const defaultServiceName = "queue-print-agent"
+
+// serviceUnit is modelled on scripts/queue-system.service
+var serviceUnit = template.Must(template.New("unit").Parse(`[Unit]
+Description=Queue System Print Agent ({{.AgentID}})
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+{{- if .User}}
+User={{.User}}
+{{- end}}
+WorkingDirectory={{.Dir}}
+ExecStart={{.Exec}} -config {{.Config}}
+Restart=always
+RestartSec=5
+StandardOutput=journal
+StandardError=journal
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// runService handles the install and uninstall subcommands.
+func runService(command string, args []string) error {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "Path to agent config file")
+	name := fs.String("name", defaultServiceName, "Name of the systemd service")
+	user := fs.String("user", "", "User the service runs as (default root)")
+	unitDir := fs.String("unit-dir", "/etc/systemd/system", "Directory the unit file is written to")
+	unitOnly := fs.Bool("unit-only", false, "Only write or remove the unit file, without running systemctl")
+	fs.Parse(args)
+
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("%s needs Linux with systemd; on Windows run print-agent.exe with a service wrapper such as NSSM", command)
+	}
+	unitPath := filepath.Join(*unitDir, *name+".service")
+
+	if command == "uninstall" {
+		if !*unitOnly {
+			// The service may already be stopped or disabled
+			systemctl("disable", "--now", *name)
+		}
+		if err := os.Remove(unitPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		fmt.Printf("Removed %s\n", unitPath)
+		if *unitOnly {
+			return nil
+		}
+		return systemctl("daemon-reload")
+	}
+
+	// Refuse a config the service would fail to start with
+	config, err := filepath.Abs(*configPath)
+	if err != nil {
+		return err
+	}
+	cfg, err := LoadAgentConfig(config)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	var unit bytes.Buffer
+	err = serviceUnit.Execute(&unit, map[string]string{
+		"AgentID": cfg.AgentID,
+		"User":    *user,
+		"Dir":     filepath.Dir(config),
+		"Exec":    systemdQuote(exe),
+		"Config":  systemdQuote(config),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render the service unit: %w", err)
+	}
+	if err := os.WriteFile(unitPath, unit.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", unitPath, err)
+	}
+	fmt.Printf("Wrote %s\n", unitPath)
+	if *unitOnly {
+		return nil
+	}
+
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if err := systemctl("enable", "--now", *name); err != nil {
+		return err
+	}
+	fmt.Printf("Service %s is running; see its log with journalctl -u %s\n", *name, *name)
+	return nil
+}
+
+func systemctl(args ...string) error {
+	cmd := exec.Command("systemctl", args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// systemdQuote quotes a path for ExecStart if it contains spaces.
+func systemdQuote(s string) string {
+	if !strings.ContainsAny(s, " \t\"\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSystemdQuote(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/usr/local/bin/print-agent", "/usr/local/bin/print-agent"},
+		{"/opt/print agent/config.yaml", `"/opt/print agent/config.yaml"`},
+		{`/opt/a"b`, `"/opt/a\"b"`},
+		{`/opt/a\b c`, `"/opt/a\\b c"`},
+	}
+	for _, tt := range tests {
+		if got := systemdQuote(tt.path); got != tt.want {
+			t.Errorf("systemdQuote(%q) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestServiceUnit(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    string
+		want    []string
+		notWant []string
+	}{
+		{"as root", "", []string{"ExecStart=/opt/agent/print-agent -config /opt/agent/config.yaml", "WorkingDirectory=/opt/agent"}, []string{"User="}},
+		{"as a user", "antrian", []string{"User=antrian\n"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var unit strings.Builder
+			err := serviceUnit.Execute(&unit, map[string]string{
+				"AgentID": "printer-lobi",
+				"User":    tt.user,
+				"Dir":     "/opt/agent",
+				"Exec":    "/opt/agent/print-agent",
+				"Config":  "/opt/agent/config.yaml",
+			})
+			if err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			for _, s := range append(tt.want, "Description=Queue System Print Agent (printer-lobi)") {
+				if !strings.Contains(unit.String(), s) {
+					t.Errorf("unit lacks %q:\n%s", s, unit.String())
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(unit.String(), s) {
+					t.Errorf("unit has %q:\n%s", s, unit.String())
+				}
+			}
+		})
+	}
+}
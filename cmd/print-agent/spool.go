@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+// errNoNumbers is returned when no leased number is left for a queue type
+var errNoNumbers = errors.New("no leased ticket numbers left")
+
+// ticketKey identifies a ticket issued offline. Numbering restarts after
+// the server resets its queues, so a number alone may be handed out twice
+// in a day, each time from a different block.
+type ticketKey struct {
+	BlockID     int64
+	QueueNumber string
+}
+
+// spoolBlock is a number block leased from the server, with the next
+// number to hand out
+type spoolBlock struct {
+	models.NumberBlock
+	Next int `json:"next"`
+}
+
+// Spool keeps what the agent needs to issue tickets while the server is
+// unreachable on disk, so it survives a restart: the leased number blocks,
+// the tickets issued offline and not yet synced, and the ticket design.
+type Spool struct {
+	dir string
+
+	mu       sync.Mutex
+	blocks   []*spoolBlock
+	tickets  []*models.OfflineTicket
+	template string
+}
+
+const (
+	spoolBlocksFile   = "blocks.json"
+	spoolTicketsFile  = "tickets.json"
+	spoolTemplateFile = "template.json"
+)
+
+// OpenSpool opens the spool in dir, creating the directory if needed.
+func OpenSpool(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	s := &Spool{dir: dir}
+	if err := s.read(spoolBlocksFile, &s.blocks); err != nil {
+		return nil, err
+	}
+	if err := s.read(spoolTicketsFile, &s.tickets); err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, spoolTemplateFile)); err == nil {
+		s.template = string(data)
+	}
+	return s, nil
+}
+
+func (s *Spool) read(name string, v interface{}) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to read spool file %s: %w", name, err)
+	}
+	return nil
+}
+
+// write replaces a spool file atomically, so a crash never leaves half of
+// it behind.
+func (s *Spool) write(name string, data []byte) error {
+	tmp := filepath.Join(s.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, name))
+}
+
+func (s *Spool) writeJSON(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.write(name, data)
+}
+
+// AddBlock stores a newly leased number block, dropping blocks of past
+// days and used-up ones.
+func (s *Spool) AddBlock(b models.NumberBlock) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	today := time.Now().Format("2006-01-02")
+	blocks := []*spoolBlock{}
+	for _, old := range s.blocks {
+		if old.Day == today && old.Next <= old.LastNumber {
+			blocks = append(blocks, old)
+		}
+	}
+	blocks = append(blocks, &spoolBlock{NumberBlock: b, Next: b.FirstNumber})
+	if err := s.writeJSON(spoolBlocksFile, blocks); err != nil {
+		return err
+	}
+	s.blocks = blocks
+	return nil
+}
+
+// DropBlocks drops the leased blocks of a queue type, or of all types if
+// empty, once the server has reset its numbering.
+func (s *Spool) DropBlocks(queueType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	blocks := []*spoolBlock{}
+	for _, b := range s.blocks {
+		if queueType != "" && b.QueueType != queueType {
+			blocks = append(blocks, b)
+		}
+	}
+	if err := s.writeJSON(spoolBlocksFile, blocks); err != nil {
+		return err
+	}
+	s.blocks = blocks
+	return nil
+}
+
+// Remaining returns how many numbers of today are left for a queue type.
+func (s *Spool) Remaining(queueType string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	today := time.Now().Format("2006-01-02")
+	n := 0
+	for _, b := range s.blocks {
+		if b.QueueType == queueType && b.Day == today {
+			n += b.LastNumber - b.Next + 1
+		}
+	}
+	return n
+}
+
+// RunningLow reports whether fewer than half of the last leased block's
+// numbers are left for a queue type today, so a new block should be leased.
+func (s *Spool) RunningLow(queueType string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	today := time.Now().Format("2006-01-02")
+	size, left := 0, 0
+	for _, b := range s.blocks {
+		if b.QueueType == queueType && b.Day == today {
+			size = b.LastNumber - b.FirstNumber + 1
+			left += b.LastNumber - b.Next + 1
+		}
+	}
+	return size == 0 || left < (size+1)/2
+}
+
+// Issue hands out the next leased number of a queue type as a ticket and
+// keeps it until it is synced. It returns the ticket and the name of its
+// queue type, or errNoNumbers.
+func (s *Spool) Issue(queueType string, priority models.QueuePriority) (*models.OfflineTicket, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	today := now.Format("2006-01-02")
+	for i, b := range s.blocks {
+		if b.QueueType != queueType || b.Day != today || b.Next > b.LastNumber {
+			continue
+		}
+		t := &models.OfflineTicket{
+			QueueNumber: models.FormatQueueNumber(b.Prefix, b.Next),
+			QueueType:   queueType,
+			Priority:    priority,
+			IssuedAt:    now,
+			BlockID:     b.ID,
+		}
+		used := *b
+		used.Next++
+		blocks := slices.Clone(s.blocks)
+		blocks[i] = &used
+		tickets := append(slices.Clone(s.tickets), t)
+
+		// Save the used number first: a crash in between may waste a
+		// number, but never hands it out twice. The spool only moves on
+		// once both are on disk, so a failed write hands out nothing.
+		if err := s.writeJSON(spoolBlocksFile, blocks); err != nil {
+			return nil, "", err
+		}
+		if err := s.writeJSON(spoolTicketsFile, tickets); err != nil {
+			return nil, "", err
+		}
+		s.blocks, s.tickets = blocks, tickets
+		return t, b.TypeName, nil
+	}
+	return nil, "", errNoNumbers
+}
+
+// Tickets returns the tickets waiting to be synced, oldest first.
+func (s *Spool) Tickets() []*models.OfflineTicket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*models.OfflineTicket(nil), s.tickets...)
+}
+
+// RemoveTickets drops tickets the server has taken, or refused for good.
+func (s *Spool) RemoveTickets(done map[ticketKey]bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := []*models.OfflineTicket{}
+	for _, t := range s.tickets {
+		if !done[ticketKey{t.BlockID, t.QueueNumber}] {
+			kept = append(kept, t)
+		}
+	}
+	if err := s.writeJSON(spoolTicketsFile, kept); err != nil {
+		return err
+	}
+	s.tickets = kept
+	return nil
+}
+
+// SetTemplate stores the ticket design tickets issued offline are printed
+// with.
+func (s *Spool) SetTemplate(templateJSON string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if templateJSON == s.template {
+		return nil
+	}
+	if err := s.write(spoolTemplateFile, []byte(templateJSON)); err != nil {
+		return err
+	}
+	s.template = templateJSON
+	return nil
+}
+
+// Template returns the stored ticket design, or "" if there is none yet.
+func (s *Spool) Template() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.template
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+func testBlock(id int64, queueType string, first, last int) models.NumberBlock {
+	return models.NumberBlock{
+		ID: id, AgentID: "printer-1", QueueType: queueType, TypeName: "Umum", Prefix: queueType + "X",
+		Day: time.Now().Format("2006-01-02"), FirstNumber: first, LastNumber: last,
+	}
+}
+
+func TestSpoolIssue(t *testing.T) {
+	s, err := OpenSpool(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	for _, b := range []models.NumberBlock{testBlock(1, "A", 1, 2), testBlock(2, "A", 5, 6), testBlock(3, "B", 1, 1)} {
+		if err := s.AddBlock(b); err != nil {
+			t.Fatalf("AddBlock: %v", err)
+		}
+	}
+
+	tests := []struct {
+		queueType string
+		want      string
+		wantBlock int64
+		wantErr   error
+	}{
+		{"A", "AX001", 1, nil},
+		{"A", "AX002", 1, nil},
+		{"B", "BX001", 3, nil},
+		{"A", "AX005", 2, nil},
+		{"B", "", 0, errNoNumbers},
+		{"A", "AX006", 2, nil},
+		{"A", "", 0, errNoNumbers},
+		{"C", "", 0, errNoNumbers},
+	}
+	for _, tt := range tests {
+		ticket, _, err := s.Issue(tt.queueType, models.PriorityNormal)
+		if err != tt.wantErr {
+			t.Fatalf("Issue(%s) error = %v, want %v", tt.queueType, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		if ticket.QueueNumber != tt.want || ticket.BlockID != tt.wantBlock {
+			t.Errorf("Issue(%s) = %s from block %d, want %s from block %d",
+				tt.queueType, ticket.QueueNumber, ticket.BlockID, tt.want, tt.wantBlock)
+		}
+	}
+	if n := len(s.Tickets()); n != 5 {
+		t.Errorf("%d tickets to sync, want 5", n)
+	}
+}
+
+func TestSpoolSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenSpool(dir)
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	if err := s.AddBlock(testBlock(1, "A", 1, 10)); err != nil {
+		t.Fatalf("AddBlock: %v", err)
+	}
+	for range 3 {
+		if _, _, err := s.Issue("A", models.PriorityNormal); err != nil {
+			t.Fatalf("Issue: %v", err)
+		}
+	}
+	if err := s.RemoveTickets(map[ticketKey]bool{{1, "AX001"}: true}); err != nil {
+		t.Fatalf("RemoveTickets: %v", err)
+	}
+	if err := s.SetTemplate(`{"title":"Antrian"}`); err != nil {
+		t.Fatalf("SetTemplate: %v", err)
+	}
+
+	// A number handed out before the restart is never handed out again
+	s, err = OpenSpool(dir)
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	ticket, _, err := s.Issue("A", models.PriorityNormal)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if ticket.QueueNumber != "AX004" {
+		t.Errorf("Issue after restart = %s, want AX004", ticket.QueueNumber)
+	}
+	var numbers []string
+	for _, t := range s.Tickets() {
+		numbers = append(numbers, t.QueueNumber)
+	}
+	if len(numbers) != 3 || numbers[0] != "AX002" || numbers[2] != "AX004" {
+		t.Errorf("tickets to sync %v, want [AX002 AX003 AX004]", numbers)
+	}
+	if s.Template() != `{"title":"Antrian"}` {
+		t.Errorf("template %q not kept", s.Template())
+	}
+}
+
+func TestSpoolFailedWrite(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenSpool(dir)
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	if err := s.AddBlock(testBlock(1, "A", 1, 10)); err != nil {
+		t.Fatalf("AddBlock: %v", err)
+	}
+
+	// A directory in the way of the temporary file makes saving fail
+	blocker := filepath.Join(dir, spoolTicketsFile+".tmp")
+	if err := os.Mkdir(blocker, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Issue("A", models.PriorityNormal); err == nil {
+		t.Fatal("Issue succeeded although the ticket could not be saved")
+	}
+	if n := len(s.Tickets()); n != 0 {
+		t.Errorf("%d tickets to sync after a failed issue, want 0", n)
+	}
+	if n := s.Remaining("A"); n != 10 {
+		t.Errorf("Remaining = %d after a failed issue, want 10", n)
+	}
+
+	os.Remove(blocker)
+	ticket, _, err := s.Issue("A", models.PriorityNormal)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if ticket.QueueNumber != "AX001" {
+		t.Errorf("Issue = %s, want AX001, which was never handed out", ticket.QueueNumber)
+	}
+}
+
+func TestSpoolRemoveTickets(t *testing.T) {
+	s, err := OpenSpool(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	// After a reset on the server the same numbers are leased again
+	for _, b := range []models.NumberBlock{testBlock(1, "A", 1, 1), testBlock(2, "A", 1, 1)} {
+		if err := s.AddBlock(b); err != nil {
+			t.Fatalf("AddBlock: %v", err)
+		}
+		if _, _, err := s.Issue("A", models.PriorityNormal); err != nil {
+			t.Fatalf("Issue: %v", err)
+		}
+	}
+
+	if err := s.RemoveTickets(map[ticketKey]bool{{1, "AX001"}: true}); err != nil {
+		t.Fatalf("RemoveTickets: %v", err)
+	}
+	tickets := s.Tickets()
+	if len(tickets) != 1 || tickets[0].BlockID != 2 || tickets[0].QueueNumber != "AX001" {
+		t.Errorf("tickets to sync %+v, want AX001 of block 2 only", tickets)
+	}
+}
+
+func TestSpoolBlocks(t *testing.T) {
+	yesterday := testBlock(9, "A", 1, 100)
+	yesterday.Day = time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+
+	tests := []struct {
+		name          string
+		blocks        []models.NumberBlock
+		issue         int // tickets of type A issued after adding the blocks
+		drop          *string
+		wantRemaining int
+		wantLow       bool
+	}{
+		{"no blocks", nil, 0, nil, 0, true},
+		{"fresh block", []models.NumberBlock{testBlock(1, "A", 1, 10)}, 0, nil, 10, false},
+		{"half used", []models.NumberBlock{testBlock(1, "A", 1, 10)}, 5, nil, 5, false},
+		{"more than half used", []models.NumberBlock{testBlock(1, "A", 1, 10)}, 6, nil, 4, true},
+		{"two blocks", []models.NumberBlock{testBlock(1, "A", 1, 10), testBlock(2, "A", 11, 20)}, 6, nil, 14, false},
+		{"past days do not count", []models.NumberBlock{yesterday}, 0, nil, 0, true},
+		{"other types do not count", []models.NumberBlock{testBlock(1, "B", 1, 10)}, 0, nil, 0, true},
+		{"dropped by type", []models.NumberBlock{testBlock(1, "A", 1, 10)}, 0, strPtr("A"), 0, true},
+		{"other type dropped", []models.NumberBlock{testBlock(1, "A", 1, 10)}, 0, strPtr("B"), 10, false},
+		{"all dropped", []models.NumberBlock{testBlock(1, "A", 1, 10)}, 0, strPtr(""), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := OpenSpool(t.TempDir())
+			if err != nil {
+				t.Fatalf("OpenSpool: %v", err)
+			}
+			for _, b := range tt.blocks {
+				if err := s.AddBlock(b); err != nil {
+					t.Fatalf("AddBlock: %v", err)
+				}
+			}
+			for range tt.issue {
+				if _, _, err := s.Issue("A", models.PriorityNormal); err != nil {
+					t.Fatalf("Issue: %v", err)
+				}
+			}
+			if tt.drop != nil {
+				if err := s.DropBlocks(*tt.drop); err != nil {
+					t.Fatalf("DropBlocks: %v", err)
+				}
+			}
+			if got := s.Remaining("A"); got != tt.wantRemaining {
+				t.Errorf("Remaining = %d, want %d", got, tt.wantRemaining)
+			}
+			if got := s.RunningLow("A"); got != tt.wantLow {
+				t.Errorf("RunningLow = %v, want %v", got, tt.wantLow)
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string { return &s }
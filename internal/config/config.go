@@ -20,9 +20,47 @@ type Config struct {
 }
 
 type PrinterConfig struct {
-	Enabled       bool   `yaml:"enabled"`
-	PrinterName   string `yaml:"printer_name"`
+	Enabled     bool   `yaml:"enabled"`
+	PrinterName string `yaml:"printer_name"`
+	// Backend: windows, tcp, cups, device, file, png atau pdf (kosong =
+	// windows di Windows, cups di sistem lain). png dan pdf menyimpan
+	// gambar hasil cetak, bukan perintah printer
+	Backend string `yaml:"backend"`
+	// Address: host[:port] untuk tcp, path perangkat untuk device,
+	// direktori untuk file/png/pdf; nama antrian untuk windows/cups jika
+	// berbeda dari printer_name
+	Address string `yaml:"address"`
+	// PaperWidth (dot: 576 = 80 mm, 384 = 58 mm), Columns dan Codepage
+	// printer ini; kosong = mengikuti desain tiket di panel admin
+	PaperWidth    int    `yaml:"paper_width"`
+	Columns       int    `yaml:"columns"`
+	Codepage      string `yaml:"codepage"`
 	RemoteEnabled bool   `yaml:"remote_enabled"`
+	// JobLease: batas waktu print agent melaporkan hasil cetak sebuah job;
+	// lewat dari itu job dikembalikan ke antrian cetak
+	JobLease time.Duration `yaml:"job_lease"`
+	// JobMaxAttempts: jumlah percobaan cetak sebuah job sebelum dipindah
+	// ke daftar job gagal (dead letter)
+	JobMaxAttempts int `yaml:"job_max_attempts"`
+	// Routing: print agent yang mencetak tiket dari kiosk atau jenis
+	// antrian tertentu; tanpa pemetaan tiket dicetak agent mana pun
+	Routing PrintRouting `yaml:"routing"`
+	// OfflineBlockSize: jumlah nomor antrian yang dipinjamkan ke print
+	// agent sekaligus, untuk tiket sementara saat server tidak terjangkau
+	OfflineBlockSize int `yaml:"offline_block_size"`
+	// OfflinePrefix: ditambahkan di belakang prefix jenis antrian untuk
+	// nomor tiket offline (mis. A menjadi AX001), agar nomor yang dipinjamkan
+	// tidak memotong penomoran biasa
+	OfflinePrefix string `yaml:"offline_prefix"`
+}
+
+// PrintRouting memetakan kiosk dan jenis antrian ke agent_id atau group
+// print agent. Kiosk dikenali dari username akun kiosk, nama token API,
+// atau parameter ?kiosk= pada halaman /ticket. Pemetaan kiosk didahulukan
+// dari pemetaan jenis antrian.
+type PrintRouting struct {
+	Kiosks     map[string]string `yaml:"kiosks"`
+	QueueTypes map[string]string `yaml:"queue_types"`
 }
 
 type ServerConfig struct {
@@ -30,6 +68,10 @@ type ServerConfig struct {
 	Host         string        `yaml:"host"`
 	ReadTimeout  time.Duration `yaml:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// PublicURL: alamat server yang dibuka ponsel pengunjung dari QR
+	// tiket, mis. http://192.168.1.10:8080 (kosong = alamat yang dipakai
+	// kiosk)
+	PublicURL string `yaml:"public_url"`
 }
 
 type DatabaseConfig struct {
@@ -49,6 +91,15 @@ type QueueConfig struct {
 	StartNumber     int    `yaml:"start_number"`
 	ResetDaily      bool   `yaml:"reset_daily"`
 	AutoCancelHours int    `yaml:"auto_cancel_hours"`
+	// PriorityAgingMinutes: antrian biasa yang sudah menunggu selama ini
+	// diperlakukan setara antrian prioritas (0 = nonaktif)
+	PriorityAgingMinutes int `yaml:"priority_aging_minutes"`
+	// NoShowGraceRecalls: berapa kali tiket yang tidak hadir boleh
+	// dikembalikan ke antrian
+	NoShowGraceRecalls int `yaml:"no_show_grace_recalls"`
+	// DefaultServiceMinutes: perkiraan lama layanan per tiket selama belum
+	// ada tiket selesai untuk menghitung rata-rata
+	DefaultServiceMinutes int `yaml:"default_service_minutes"`
 }
 
 type AudioConfig struct {
@@ -59,6 +110,9 @@ type AudioConfig struct {
 type SecurityConfig struct {
 	AdminPassword  string `yaml:"admin_password"`
 	SessionTimeout int    `yaml:"session_timeout"`
+	// KioskAuth mewajibkan sesi kiosk atau token API ber-scope kiosk untuk
+	// mengambil tiket. Jika false, endpoint kiosk tetap terbuka untuk LAN.
+	KioskAuth bool `yaml:"kiosk_auth"`
 }
 
 func DefaultConfig() *Config {
@@ -80,10 +134,12 @@ func DefaultConfig() *Config {
 			FilePath: "./data/logs/app.log",
 		},
 		Queue: QueueConfig{
-			Prefix:          "A",
-			StartNumber:     1,
-			ResetDaily:      true,
-			AutoCancelHours: 24,
+			Prefix:                "A",
+			StartNumber:           1,
+			ResetDaily:            true,
+			AutoCancelHours:       24,
+			NoShowGraceRecalls:    2,
+			DefaultServiceMinutes: 5,
 		},
 		Audio: AudioConfig{
 			Enabled:  true,
@@ -94,8 +150,12 @@ func DefaultConfig() *Config {
 			SessionTimeout: 3600,
 		},
 		Printer: PrinterConfig{
-			Enabled:     true,
-			PrinterName: "ECO80",
+			Enabled:          true,
+			PrinterName:      "ECO80",
+			JobLease:         2 * time.Minute,
+			JobMaxAttempts:   5,
+			OfflineBlockSize: 20,
+			OfflinePrefix:    "X",
 		},
 	}
 }
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"strings"
+
+	"queue-system/internal/models"
+)
+
+// Audit log operations. The table is append-only: triggers reject UPDATE
+// and DELETE, so there is deliberately no way to edit or prune entries here.
+
+func (d *DB) AddAuditEntry(e *models.AuditEntry) error {
+	var before, after interface{}
+	if len(e.Before) > 0 {
+		before = string(e.Before)
+	}
+	if len(e.After) > 0 {
+		after = string(e.After)
+	}
+
+	result, err := d.Exec(`
+		INSERT INTO audit_log (timestamp, actor_id, actor, actor_role, ip, action, target_type, target_id, before_json, after_json)
+		VALUES (datetime('now', 'localtime'), ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.ActorID, e.Actor, e.ActorRole, e.IP, e.Action, e.TargetType, e.TargetID, before, after)
+	if err != nil {
+		return err
+	}
+	e.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// ListAuditLog returns audit entries, newest first. Action matches exactly or
+// as a prefix ("counter" matches "counter.update"); From and To accept a date
+// (YYYY-MM-DD, inclusive) or a date and time.
+func (d *DB) ListAuditLog(f models.AuditFilter, page, perPage int) (*models.PaginatedAudit, error) {
+	where := []string{}
+	args := []interface{}{}
+
+	if f.Actor != "" {
+		where = append(where, "actor = ?")
+		args = append(args, f.Actor)
+	}
+	if f.Action != "" {
+		where = append(where, "(action = ? OR action LIKE ? || '.%')")
+		args = append(args, f.Action, f.Action)
+	}
+	if f.TargetType != "" {
+		where = append(where, "target_type = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		where = append(where, "target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if f.From != "" {
+		where = append(where, "timestamp >= datetime(?)")
+		args = append(args, strings.Replace(f.From, "T", " ", 1))
+	}
+	if f.To != "" {
+		to := strings.Replace(f.To, "T", " ", 1)
+		if len(to) == len("2006-01-02") {
+			where = append(where, "DATE(timestamp) <= DATE(?)")
+		} else {
+			where = append(where, "timestamp <= datetime(?)")
+		}
+		args = append(args, to)
+	}
+
+	whereClause := ""
+	if len(where) > 0 {
+		whereClause = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := d.QueryRow("SELECT COUNT(*) FROM audit_log"+whereClause, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	totalPages := (total + perPage - 1) / perPage
+	if page > totalPages && totalPages > 0 {
+		page = totalPages
+	}
+	offset := (page - 1) * perPage
+
+	query := `SELECT id, timestamp, actor_id, actor, actor_role, ip, action, target_type, target_id,
+		COALESCE(before_json, ''), COALESCE(after_json, '')
+		FROM audit_log` + whereClause + ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	args = append(args, perPage, offset)
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*models.AuditEntry{}
+	for rows.Next() {
+		e := &models.AuditEntry{}
+		var before, after string
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.ActorID, &e.Actor, &e.ActorRole, &e.IP, &e.Action,
+			&e.TargetType, &e.TargetID, &before, &after); err != nil {
+			return nil, err
+		}
+		if before != "" {
+			e.Before = []byte(before)
+		}
+		if after != "" {
+			e.After = []byte(after)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &models.PaginatedAudit{
+		Entries:    entries,
+		Total:      total,
+		Page:       page,
+		PerPage:    perPage,
+		TotalPages: totalPages,
+	}, nil
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+func TestListAuditLogFilters(t *testing.T) {
+	d := newTestDB(t)
+
+	entries := []models.AuditEntry{
+		{Actor: "admin", Action: "counter.create", TargetType: "counter", TargetID: "1"},
+		{Actor: "admin", Action: "counter.update", TargetType: "counter", TargetID: "1"},
+		{Actor: "sari", Action: "counter.delete", TargetType: "counter", TargetID: "2"},
+		{Actor: "sari", Action: "counters.export"},
+		{Actor: "admin", Action: "queue.reset", TargetType: "queue"},
+	}
+	for i := range entries {
+		if err := d.AddAuditEntry(&entries[i]); err != nil {
+			t.Fatalf("AddAuditEntry: %v", err)
+		}
+	}
+
+	today := time.Now().Format("2006-01-02")
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	tests := []struct {
+		name   string
+		filter models.AuditFilter
+		want   int
+	}{
+		{"no filter", models.AuditFilter{}, 5},
+		{"actor", models.AuditFilter{Actor: "sari"}, 2},
+		{"exact action", models.AuditFilter{Action: "counter.update"}, 1},
+		{"action prefix", models.AuditFilter{Action: "counter"}, 3},
+		{"partial prefix", models.AuditFilter{Action: "count"}, 0},
+		{"target", models.AuditFilter{TargetType: "counter", TargetID: "1"}, 2},
+		{"actor and action", models.AuditFilter{Actor: "admin", Action: "counter"}, 2},
+		{"to today", models.AuditFilter{To: today}, 5},
+		{"from tomorrow", models.AuditFilter{From: tomorrow}, 0},
+		{"from today with time", models.AuditFilter{From: today + "T00:00"}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.ListAuditLog(tt.filter, 1, 50)
+			if err != nil {
+				t.Fatalf("ListAuditLog: %v", err)
+			}
+			if got.Total != tt.want || len(got.Entries) != tt.want {
+				t.Errorf("got %d entries (total %d), want %d", len(got.Entries), got.Total, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditLogAppendOnly(t *testing.T) {
+	d := newTestDB(t)
+	counter := mustCreateCounter(t, d, "1")
+
+	// Two resets, each audited with the tickets it cleared
+	for range 2 {
+		if _, err := d.CreateQueue("A", models.PriorityNormal); err != nil {
+			t.Fatalf("CreateQueue: %v", err)
+		}
+		if _, err := d.CallNextQueue(counter.ID, ""); err != nil {
+			t.Fatalf("CallNextQueue: %v", err)
+		}
+		reset, err := d.ResetQueuesToday("")
+		if err != nil {
+			t.Fatalf("ResetQueuesToday: %v", err)
+		}
+		before, _ := json.Marshal(reset)
+		if err := d.AddAuditEntry(&models.AuditEntry{Actor: "admin", Action: "queue.reset", Before: before}); err != nil {
+			t.Fatalf("AddAuditEntry: %v", err)
+		}
+	}
+
+	resets, err := d.ListAuditLog(models.AuditFilter{Action: "queue.reset"}, 1, 50)
+	if err != nil {
+		t.Fatalf("ListAuditLog: %v", err)
+	}
+	if resets.Total != 2 {
+		t.Fatalf("%d reset entries, want 2", resets.Total)
+	}
+	for _, e := range resets.Entries {
+		var queues []models.Queue
+		if err := json.Unmarshal(e.Before, &queues); err != nil || len(queues) != 1 {
+			t.Errorf("entry %d before = %s, want one ticket", e.ID, e.Before)
+		}
+	}
+
+	for _, stmt := range []string{
+		`UPDATE audit_log SET actor = 'someone'`,
+		`DELETE FROM audit_log`,
+	} {
+		if _, err := d.Exec(stmt); err == nil {
+			t.Errorf("%s succeeded, want it rejected", stmt)
+		}
+	}
+	if after, _ := d.ListAuditLog(models.AuditFilter{}, 1, 50); after.Total != 2 {
+		t.Errorf("%d entries after tampering, want 2", after.Total)
+	}
+}
+
+func TestResetQueuesToday(t *testing.T) {
+	d := newTestDB(t)
+	counter := mustCreateCounter(t, d, "1")
+	mustExec(t, d, `INSERT INTO queue_types (code, name, prefix, is_active, sort_order) VALUES ('B', 'Bayar', 'B', 1, 2)`)
+
+	var tickets []*models.Queue
+	for _, code := range []string{"A", "A", "A", "B"} {
+		q, err := d.CreateQueue(code, models.PriorityNormal)
+		if err != nil {
+			t.Fatalf("CreateQueue: %v", err)
+		}
+		tickets = append(tickets, q)
+	}
+	// A001 completed, A002 at the counter, A003 and B001 waiting
+	if _, err := d.CallNextQueue(counter.ID, "A"); err != nil {
+		t.Fatalf("CallNextQueue: %v", err)
+	}
+	if err := d.UpdateQueueStatus(tickets[0].ID, models.StatusCompleted, nil); err != nil {
+		t.Fatalf("UpdateQueueStatus: %v", err)
+	}
+	if _, err := d.CallNextQueue(counter.ID, "A"); err != nil {
+		t.Fatalf("CallNextQueue: %v", err)
+	}
+
+	reset, err := d.ResetQueuesToday("A")
+	if err != nil {
+		t.Fatalf("ResetQueuesToday: %v", err)
+	}
+	if len(reset) != 3 {
+		t.Fatalf("reset %d tickets, want 3", len(reset))
+	}
+
+	tests := []struct {
+		ticket *models.Queue
+		want   models.QueueStatus
+		reset  bool
+	}{
+		{tickets[0], models.StatusCompleted, true},
+		{tickets[1], models.StatusCancelled, true},
+		{tickets[2], models.StatusCancelled, true},
+		{tickets[3], models.StatusWaiting, false},
+	}
+	for _, tt := range tests {
+		got, err := d.GetQueue(tt.ticket.ID)
+		if err != nil {
+			t.Fatalf("%s: ticket is gone: %v", tt.ticket.QueueNumber, err)
+		}
+		var isReset bool
+		d.QueryRow(`SELECT reset_at IS NOT NULL FROM queues WHERE id = ?`, tt.ticket.ID).Scan(&isReset)
+		if got.Status != tt.want || isReset != tt.reset {
+			t.Errorf("%s: status %s, reset %v, want %s, %v", got.QueueNumber, got.Status, isReset, tt.want, tt.reset)
+		}
+	}
+
+	c, err := d.GetCounter(counter.ID)
+	if err != nil {
+		t.Fatalf("GetCounter: %v", err)
+	}
+	if c.CurrentQueueID.Valid {
+		t.Errorf("counter still serving ticket %d", c.CurrentQueueID.Int64)
+	}
+
+	// Numbering restarts for the reset type only
+	for _, tt := range []struct{ code, want string }{{"A", "A001"}, {"B", "B002"}} {
+		q, err := d.CreateQueue(tt.code, models.PriorityNormal)
+		if err != nil {
+			t.Fatalf("CreateQueue: %v", err)
+		}
+		if q.QueueNumber != tt.want {
+			t.Errorf("next %s ticket = %s, want %s", tt.code, q.QueueNumber, tt.want)
+		}
+	}
+
+	// A second reset leaves already-reset tickets alone
+	again, err := d.ResetQueuesToday("A")
+	if err != nil {
+		t.Fatalf("ResetQueuesToday: %v", err)
+	}
+	if len(again) != 1 {
+		t.Errorf("second reset cleared %d tickets, want 1", len(again))
+	}
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"queue-system/internal/models"
+)
+
+// Counter routing. A counter may be assigned a list of queue types; calling
+// next without a type then picks among those types according to the
+// counter's routing mode. A counter without assignments serves every type
+// and the operator chooses.
+
+// GetCounterServices returns the queue types assigned to a counter, in
+// priority order.
+func (d *DB) GetCounterServices(counterID int64) ([]models.CounterService, error) {
+	rows, err := d.Query(`
+		SELECT queue_type, weight FROM counter_queue_types
+		WHERE counter_id = ? ORDER BY sort_order
+	`, counterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var services []models.CounterService
+	for rows.Next() {
+		var s models.CounterService
+		if err := rows.Scan(&s.QueueType, &s.Weight); err != nil {
+			return nil, err
+		}
+		services = append(services, s)
+	}
+	return services, rows.Err()
+}
+
+// counterServicesByCounter returns the assignments of every counter that
+// has any.
+func (d *DB) counterServicesByCounter() (map[int64][]models.CounterService, error) {
+	rows, err := d.Query(`SELECT counter_id, queue_type, weight FROM counter_queue_types ORDER BY counter_id, sort_order`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	services := make(map[int64][]models.CounterService)
+	for rows.Next() {
+		var counterID int64
+		var s models.CounterService
+		if err := rows.Scan(&counterID, &s.QueueType, &s.Weight); err != nil {
+			return nil, err
+		}
+		services[counterID] = append(services[counterID], s)
+	}
+	return services, rows.Err()
+}
+
+// CountersForQueueType returns the active counters that can serve a queue
+// type: those assigned to it and those without assignments.
+func (d *DB) CountersForQueueType(queueType string) ([]*models.Counter, error) {
+	counters, err := d.ListCounters()
+	if err != nil {
+		return nil, err
+	}
+	assigned, err := d.counterServicesByCounter()
+	if err != nil {
+		return nil, err
+	}
+
+	var serving []*models.Counter
+	for _, c := range counters {
+		if !c.IsActive {
+			continue
+		}
+		services, ok := assigned[c.ID]
+		if !ok {
+			serving = append(serving, c)
+			continue
+		}
+		for _, s := range services {
+			if s.QueueType == queueType {
+				serving = append(serving, c)
+				break
+			}
+		}
+	}
+	return serving, nil
+}
+
+// SetCounterServices replaces the queue types assigned to a counter and its
+// routing mode. The order of services is the priority order; an empty list
+// lets the counter serve every type again.
+func (d *DB) SetCounterServices(counterID int64, mode models.RoutingMode, services []models.CounterService) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE counters SET routing_mode = ? WHERE id = ?`, mode, counterID); err != nil {
+		return fmt.Errorf("failed to update routing mode: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM counter_queue_types WHERE counter_id = ?`, counterID); err != nil {
+		return fmt.Errorf("failed to clear counter services: %w", err)
+	}
+	for i, s := range services {
+		if _, err := tx.Exec(`
+			INSERT INTO counter_queue_types (counter_id, queue_type, sort_order, weight) VALUES (?, ?, ?, ?)
+		`, counterID, s.QueueType, i+1, s.Weight); err != nil {
+			return fmt.Errorf("failed to assign queue type: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// routeQueueTypesTx returns the queue types CallNextQueue should try, in
+// order, when a counter calls without choosing a type. It returns nil for a
+// counter without assignments.
+//
+// Weighted routing uses smooth weighted round-robin over the assigned types
+// that have waiting tickets: each gains its weight, the highest is chosen
+// and loses the total. current_weight carries the state between calls.
+func routeQueueTypesTx(tx *sql.Tx, counterID int64) ([]string, error) {
+	var mode models.RoutingMode
+	if err := tx.QueryRow(`SELECT routing_mode FROM counters WHERE id = ?`, counterID).Scan(&mode); err != nil {
+		return nil, fmt.Errorf("failed to get routing mode: %w", err)
+	}
+
+	type candidate struct {
+		queueType             string
+		weight, currentWeight int
+		waiting               bool
+	}
+	rows, err := tx.Query(`
+		SELECT cq.queue_type, cq.weight, cq.current_weight,
+			EXISTS (
+				SELECT 1 FROM queues q
+				WHERE q.queue_type = cq.queue_type AND q.status = 'waiting'
+				AND DATE(q.created_at) = DATE('now', 'localtime')
+				AND (q.target_counter_id IS NULL OR q.target_counter_id = cq.counter_id)
+			)
+		FROM counter_queue_types cq
+		WHERE cq.counter_id = ?
+		ORDER BY cq.sort_order
+	`, counterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get counter services: %w", err)
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.queueType, &c.weight, &c.currentWeight, &c.waiting); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+
+	types := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		types = append(types, c.queueType)
+	}
+	if mode != models.RoutingWeighted {
+		return types, nil
+	}
+
+	total, best := 0, -1
+	for i := range candidates {
+		c := &candidates[i]
+		if !c.waiting || c.weight <= 0 {
+			continue
+		}
+		c.currentWeight += c.weight
+		total += c.weight
+		if best < 0 || c.currentWeight > candidates[best].currentWeight {
+			best = i
+		}
+	}
+	if best < 0 {
+		// Nothing waiting; the strict order still finds tickets transferred
+		// to this counter.
+		return types, nil
+	}
+	candidates[best].currentWeight -= total
+
+	for _, c := range candidates {
+		if !c.waiting || c.weight <= 0 {
+			continue
+		}
+		if _, err := tx.Exec(`
+			UPDATE counter_queue_types SET current_weight = ? WHERE counter_id = ? AND queue_type = ?
+		`, c.currentWeight, counterID, c.queueType); err != nil {
+			return nil, fmt.Errorf("failed to update routing state: %w", err)
+		}
+	}
+	return []string{candidates[best].queueType}, nil
+}
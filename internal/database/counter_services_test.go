@@ -0,0 +1,144 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"testing"
+
+	"queue-system/internal/models"
+)
+
+func TestCounterRouting(t *testing.T) {
+	const self = int64(1)
+
+	tests := []struct {
+		name     string
+		mode     models.RoutingMode
+		services []models.CounterService
+		waiting  map[string]int // tickets per queue type
+		extra    []ticket
+		want     []string // queue types in call order
+	}{
+		{
+			name:     "strict serves types in order",
+			mode:     models.RoutingStrict,
+			services: []models.CounterService{{QueueType: "A"}, {QueueType: "B"}},
+			waiting:  map[string]int{"A": 2, "B": 2},
+			want:     []string{"A", "A", "B", "B"},
+		},
+		{
+			name:     "weighted two to one",
+			mode:     models.RoutingWeighted,
+			services: []models.CounterService{{QueueType: "A", Weight: 2}, {QueueType: "B", Weight: 1}},
+			waiting:  map[string]int{"A": 4, "B": 2},
+			want:     []string{"A", "B", "A", "A", "B", "A"},
+		},
+		{
+			name:     "weighted three to one",
+			mode:     models.RoutingWeighted,
+			services: []models.CounterService{{QueueType: "A", Weight: 3}, {QueueType: "B", Weight: 1}},
+			waiting:  map[string]int{"A": 3, "B": 1},
+			want:     []string{"A", "A", "B", "A"},
+		},
+		{
+			name:     "weighted skips a type with nothing waiting",
+			mode:     models.RoutingWeighted,
+			services: []models.CounterService{{QueueType: "A", Weight: 1}, {QueueType: "B", Weight: 5}},
+			waiting:  map[string]int{"A": 3},
+			want:     []string{"A", "A", "A"},
+		},
+		{
+			name:     "weighted falls back to order for weight zero",
+			mode:     models.RoutingWeighted,
+			services: []models.CounterService{{QueueType: "A", Weight: 1}, {QueueType: "B", Weight: 0}},
+			waiting:  map[string]int{"A": 1, "B": 2},
+			want:     []string{"A", "B", "B"},
+		},
+		{
+			name:     "unassigned type is left alone",
+			mode:     models.RoutingStrict,
+			services: []models.CounterService{{QueueType: "A"}},
+			waiting:  map[string]int{"A": 1, "C": 1},
+			want:     []string{"A"},
+		},
+		{
+			name:     "transfer to the counter outside its types",
+			mode:     models.RoutingWeighted,
+			services: []models.CounterService{{QueueType: "A", Weight: 1}},
+			extra:    []ticket{{number: "C001", queueType: "C", ageSeconds: 5, target: self}},
+			want:     []string{"C"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDB(t)
+			counter := mustCreateCounter(t, d, "1")
+			if err := d.SetCounterServices(counter.ID, tt.mode, tt.services); err != nil {
+				t.Fatalf("SetCounterServices: %v", err)
+			}
+
+			var tickets []ticket
+			for queueType, n := range tt.waiting {
+				for i := 1; i <= n; i++ {
+					tickets = append(tickets, ticket{number: fmt.Sprintf("%s%03d", queueType, i), queueType: queueType, ageSeconds: 100 - i})
+				}
+			}
+			addTickets(t, d, append(tickets, tt.extra...))
+
+			var got []string
+			for len(got) <= len(tt.want) {
+				q, err := d.CallNextQueue(counter.ID, "")
+				if err == sql.ErrNoRows {
+					break
+				} else if err != nil {
+					t.Fatalf("CallNextQueue: %v", err)
+				}
+				got = append(got, q.QueueType)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("called %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountersForQueueType(t *testing.T) {
+	d := newTestDB(t)
+	open := mustCreateCounter(t, d, "1")
+	onlyA := mustCreateCounter(t, d, "2")
+	onlyB := mustCreateCounter(t, d, "3")
+	closed := mustCreateCounter(t, d, "4")
+	if err := d.SetCounterServices(onlyA.ID, models.RoutingStrict, []models.CounterService{{QueueType: "A"}}); err != nil {
+		t.Fatalf("SetCounterServices: %v", err)
+	}
+	if err := d.SetCounterServices(onlyB.ID, models.RoutingStrict, []models.CounterService{{QueueType: "B"}}); err != nil {
+		t.Fatalf("SetCounterServices: %v", err)
+	}
+	if err := d.UpdateCounter(closed.ID, closed.CounterName, false); err != nil {
+		t.Fatalf("UpdateCounter: %v", err)
+	}
+
+	tests := []struct {
+		queueType string
+		want      []int64
+	}{
+		{"A", []int64{open.ID, onlyA.ID}},
+		{"B", []int64{open.ID, onlyB.ID}},
+		{"C", []int64{open.ID}},
+	}
+	for _, tt := range tests {
+		counters, err := d.CountersForQueueType(tt.queueType)
+		if err != nil {
+			t.Fatalf("CountersForQueueType(%s): %v", tt.queueType, err)
+		}
+		var got []int64
+		for _, c := range counters {
+			got = append(got, c.ID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("CountersForQueueType(%s) = %v, want %v", tt.queueType, got, tt.want)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package database
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -18,113 +21,42 @@ type DB struct {
 	config *config.Config
 }
 
+// New opens the database and applies any pending schema migrations.
 func New(cfg *config.Config) (*DB, error) {
-	dir := filepath.Dir(cfg.Database.Path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create database directory: %w", err)
-	}
-
-	db, err := sql.Open("sqlite", cfg.Database.Path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous=NORMAL")
+	d, err := Open(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 
-	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
-	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
-
-	d := &DB{DB: db, config: cfg}
-
-	if err := d.migrate(); err != nil {
+	applied, err := d.MigrateUp()
+	if err != nil {
+		d.Close()
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
+	for _, version := range applied {
+		log.Printf("Applied schema migration %d", version)
+	}
 
 	return d, nil
 }
 
-func (d *DB) migrate() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS queues (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		queue_number TEXT NOT NULL,
-		queue_type TEXT NOT NULL DEFAULT 'general',
-		status TEXT NOT NULL DEFAULT 'waiting',
-		counter_id INTEGER,
-		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		called_at DATETIME,
-		completed_at DATETIME,
-		FOREIGN KEY (counter_id) REFERENCES counters(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS counters (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		counter_number TEXT NOT NULL UNIQUE,
-		counter_name TEXT NOT NULL,
-		is_active INTEGER NOT NULL DEFAULT 1,
-		current_queue_id INTEGER,
-		last_call_at DATETIME,
-		FOREIGN KEY (current_queue_id) REFERENCES queues(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS settings (
-		key TEXT PRIMARY KEY,
-		value TEXT NOT NULL,
-		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS call_history (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		queue_id INTEGER NOT NULL,
-		counter_id INTEGER NOT NULL,
-		action TEXT NOT NULL,
-		timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (queue_id) REFERENCES queues(id),
-		FOREIGN KEY (counter_id) REFERENCES counters(id)
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_queues_status ON queues(status);
-	CREATE INDEX IF NOT EXISTS idx_queues_created_at ON queues(created_at);
-	CREATE INDEX IF NOT EXISTS idx_call_history_timestamp ON call_history(timestamp);
-
-	CREATE TABLE IF NOT EXISTS queue_types (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		code TEXT NOT NULL UNIQUE,
-		name TEXT NOT NULL,
-		prefix TEXT NOT NULL,
-		is_active INTEGER NOT NULL DEFAULT 1,
-		sort_order INTEGER NOT NULL DEFAULT 0,
-		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS print_jobs (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		queue_number TEXT NOT NULL,
-		type_name TEXT NOT NULL,
-		date_time TEXT NOT NULL,
-		template_json TEXT NOT NULL,
-		status TEXT NOT NULL DEFAULT 'pending',
-		agent_id TEXT,
-		created_at DATETIME DEFAULT (datetime('now','localtime')),
-		claimed_at DATETIME,
-		completed_at DATETIME,
-		error_message TEXT
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_print_jobs_status ON print_jobs(status);
-	`
+// Open opens the database without touching its schema. Use it for tooling
+// such as the migrate command; the server uses New.
+func Open(cfg *config.Config) (*DB, error) {
+	dir := filepath.Dir(cfg.Database.Path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
 
-	_, err := d.Exec(schema)
+	db, err := sql.Open("sqlite", cfg.Database.Path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous=NORMAL")
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Insert default queue type if none exists
-	var count int
-	d.QueryRow(`SELECT COUNT(*) FROM queue_types`).Scan(&count)
-	if count == 0 {
-		d.Exec(`INSERT INTO queue_types (code, name, prefix, is_active, sort_order) VALUES ('A', 'Umum', 'A', 1, 1)`)
-	}
+	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
 
-	return nil
+	return &DB{DB: db, config: cfg}, nil
 }
 
 // Queue Type operations
@@ -151,6 +83,10 @@ func (d *DB) GetQueueType(id int64) (*models.QueueType, error) {
 		SELECT id, code, name, prefix, is_active, sort_order, created_at
 		FROM queue_types WHERE id = ?
 	`, id).Scan(&qt.ID, &qt.Code, &qt.Name, &qt.Prefix, &qt.IsActive, &qt.SortOrder, &qt.CreatedAt)
+	if err != nil {
+		return qt, err
+	}
+	qt.Steps, err = d.GetJourneySteps(qt.Code)
 	return qt, err
 }
 
@@ -160,6 +96,10 @@ func (d *DB) GetQueueTypeByCode(code string) (*models.QueueType, error) {
 		SELECT id, code, name, prefix, is_active, sort_order, created_at
 		FROM queue_types WHERE code = ?
 	`, code).Scan(&qt.ID, &qt.Code, &qt.Name, &qt.Prefix, &qt.IsActive, &qt.SortOrder, &qt.CreatedAt)
+	if err != nil {
+		return qt, err
+	}
+	qt.Steps, err = d.GetJourneySteps(qt.Code)
 	return qt, err
 }
 
@@ -184,6 +124,15 @@ func (d *DB) ListQueueTypes(activeOnly bool) ([]*models.QueueType, error) {
 		}
 		types = append(types, qt)
 	}
+	rows.Close()
+
+	steps, err := d.journeyStepsByType()
+	if err != nil {
+		return nil, err
+	}
+	for _, qt := range types {
+		qt.Steps = steps[qt.Code]
+	}
 	return types, nil
 }
 
@@ -195,13 +144,19 @@ func (d *DB) UpdateQueueType(id int64, name, prefix string, isActive bool, sortO
 }
 
 func (d *DB) DeleteQueueType(id int64) error {
+	if _, err := d.Exec(`DELETE FROM journey_steps WHERE queue_type = (SELECT code FROM queue_types WHERE id = ?)`, id); err != nil {
+		return err
+	}
+	if _, err := d.Exec(`DELETE FROM counter_queue_types WHERE queue_type = (SELECT code FROM queue_types WHERE id = ?)`, id); err != nil {
+		return err
+	}
 	_, err := d.Exec(`DELETE FROM queue_types WHERE id = ?`, id)
 	return err
 }
 
 // Queue operations
 
-func (d *DB) CreateQueue(queueTypeCode string) (*models.Queue, error) {
+func (d *DB) CreateQueue(queueTypeCode string, priority models.QueuePriority) (*models.Queue, error) {
 	tx, err := d.Begin()
 	if err != nil {
 		return nil, err
@@ -217,30 +172,27 @@ func (d *DB) CreateQueue(queueTypeCode string) (*models.Queue, error) {
 		prefix = d.config.Queue.Prefix
 	}
 
-	var lastNumber int
-	row := tx.QueryRow(`
-		SELECT COALESCE(MAX(CAST(SUBSTR(queue_number, LENGTH(?) + 1) AS INTEGER)), 0)
-		FROM queues
-		WHERE queue_number LIKE ? || '%'
-		AND DATE(created_at) = DATE('now', 'localtime')
-	`, prefix, prefix)
-	row.Scan(&lastNumber)
+	lastNumber := d.lastTicketNumberTx(tx, prefix)
+	queueNumber := models.FormatQueueNumber(prefix, lastNumber+1)
 
-	if d.config.Queue.ResetDaily && lastNumber == 0 {
-		lastNumber = d.config.Queue.StartNumber - 1
+	token, err := newTicketToken()
+	if err != nil {
+		return nil, err
 	}
 
-	queueNumber := fmt.Sprintf("%s%03d", prefix, lastNumber+1)
-
 	result, err := tx.Exec(`
-		INSERT INTO queues (queue_number, queue_type, status, created_at)
-		VALUES (?, ?, 'waiting', datetime('now', 'localtime'))
-	`, queueNumber, queueTypeCode)
+		INSERT INTO queues (queue_number, queue_type, status, priority, token, created_at)
+		VALUES (?, ?, 'waiting', ?, ?, datetime('now', 'localtime'))
+	`, queueNumber, queueTypeCode, priority, token)
 	if err != nil {
 		return nil, err
 	}
 
 	id, _ := result.LastInsertId()
+
+	if err := startVisitTx(tx, id, queueTypeCode); err != nil {
+		return nil, err
+	}
 	
 	if err := tx.Commit(); err != nil {
 		return nil, err
@@ -249,6 +201,42 @@ func (d *DB) CreateQueue(queueTypeCode string) (*models.Queue, error) {
 	return d.GetQueue(id)
 }
 
+// lastTicketNumberTx returns the highest ticket number of the prefix given
+// out today, counting the number blocks leased to print agents. Blocks have
+// an offline prefix of their own, so they only count here when leasing the
+// next block, or when a queue type's prefix happens to equal one.
+func (d *DB) lastTicketNumberTx(tx *sql.Tx, prefix string) int {
+	var lastNumber int
+	row := tx.QueryRow(`
+		SELECT MAX(n) FROM (
+			SELECT COALESCE(MAX(CAST(SUBSTR(queue_number, LENGTH(?1) + 1) AS INTEGER)), 0) AS n
+			FROM queues
+			WHERE queue_number LIKE ?1 || '%'
+			AND DATE(created_at) = DATE('now', 'localtime') AND reset_at IS NULL
+			UNION ALL
+			SELECT COALESCE(MAX(last_number), 0)
+			FROM number_blocks
+			WHERE prefix = ?1 AND day = DATE('now', 'localtime')
+		)
+	`, prefix)
+	row.Scan(&lastNumber)
+
+	if d.config.Queue.ResetDaily && lastNumber == 0 {
+		lastNumber = d.config.Queue.StartNumber - 1
+	}
+	return lastNumber
+}
+
+// newTicketToken returns a random token for a ticket's status page, short
+// enough to keep the printed QR code small.
+func newTicketToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ticket token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 func (d *DB) CallNextQueue(counterID int64, queueType string) (*models.Queue, error) {
 	tx, err := d.Begin()
 	if err != nil {
@@ -264,41 +252,33 @@ func (d *DB) CallNextQueue(counterID int64, queueType string) (*models.Queue, er
 		return nil, fmt.Errorf("counter not found: %w", err)
 	}
 
-	// 2. Complete current queue if exists
+	// 2. Complete current queue if exists (or send it on to its next
+	// journey step)
 	if currentQueueID.Valid {
-		_, err = tx.Exec(`
-			UPDATE queues 
-			SET status = 'completed', completed_at = datetime('now', 'localtime') 
-			WHERE id = ?
-		`, currentQueueID.Int64)
-		if err != nil {
+		if err := completeQueueTx(tx, currentQueueID.Int64, counterID); err != nil {
 			return nil, err
 		}
+	}
 
-		_, err = tx.Exec(`
-			INSERT INTO call_history (queue_id, counter_id, action, timestamp)
-			VALUES (?, ?, ?, datetime('now', 'localtime'))
-		`, currentQueueID.Int64, counterID, models.ActionCompleted)
+	// 3. Find next waiting queue (only from today). Without a type, a
+	// counter with assigned queue types is routed among those.
+	queueTypes := []string{queueType}
+	if queueType == "" {
+		routed, err := routeQueueTypesTx(tx, counterID)
 		if err != nil {
 			return nil, err
 		}
+		if len(routed) > 0 {
+			queueTypes = routed
+		}
 	}
 
-	// 3. Find next waiting queue (only from today)
 	var nextQueueID int64
-	query := `
-		SELECT id FROM queues
-		WHERE status = 'waiting'
-		AND DATE(created_at) = DATE('now', 'localtime')
-	`
-	args := []interface{}{}
-	if queueType != "" {
-		query += ` AND queue_type = ?`
-		args = append(args, queueType)
+	for _, t := range queueTypes {
+		if nextQueueID, err = d.nextWaitingQueueTx(tx, counterID, t); err != sql.ErrNoRows {
+			break
+		}
 	}
-	query += ` ORDER BY created_at ASC LIMIT 1`
-
-	err = tx.QueryRow(query, args...).Scan(&nextQueueID)
 	if err == sql.ErrNoRows {
 		// No waiting queues
 		_, err = tx.Exec(`UPDATE counters SET current_queue_id = NULL, last_call_at = NULL WHERE id = ?`, counterID)
@@ -316,13 +296,28 @@ func (d *DB) CallNextQueue(counterID int64, queueType string) (*models.Queue, er
 	// 4. Update next queue status
 	_, err = tx.Exec(`
 		UPDATE queues 
-		SET status = 'called', counter_id = ?, called_at = datetime('now', 'localtime')
+		SET status = 'called', counter_id = ?, called_at = datetime('now', 'localtime'),
+			requeue_after = NULL, target_counter_id = NULL
 		WHERE id = ?
 	`, counterID, nextQueueID)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := markStepCalledTx(tx, nextQueueID, counterID); err != nil {
+		return nil, err
+	}
+
+	// Returned tickets of the same type move one step closer to the front
+	_, err = tx.Exec(`
+		UPDATE queues SET requeue_after = requeue_after - 1
+		WHERE status = 'waiting' AND requeue_after > 0
+		AND queue_type = (SELECT queue_type FROM queues WHERE id = ?)
+	`, nextQueueID)
+	if err != nil {
+		return nil, err
+	}
+
 	// 5. Update counter
 	_, err = tx.Exec(`
 		UPDATE counters 
@@ -349,34 +344,91 @@ func (d *DB) CallNextQueue(counterID int64, queueType string) (*models.Queue, er
 	return d.GetQueue(nextQueueID)
 }
 
-func (d *DB) GetQueue(id int64) (*models.Queue, error) {
-	q := &models.Queue{}
-	err := d.QueryRow(`
-		SELECT id, queue_number, queue_type, status, counter_id, created_at, called_at, completed_at
-		FROM queues WHERE id = ?
-	`, id).Scan(&q.ID, &q.QueueNumber, &q.QueueType, &q.Status, &q.CounterID, &q.CreatedAt, &q.CalledAt, &q.CompletedAt)
-	if err != nil {
-		return nil, err
+// nextWaitingQueueTx returns the ID of the next waiting ticket from today of
+// queueType (any type if empty) for counterID, priority first. Tickets
+// transferred to this counter are taken regardless of type; tickets
+// transferred to another counter are left alone.
+func (d *DB) nextWaitingQueueTx(tx *sql.Tx, counterID int64, queueType string) (int64, error) {
+	query := `
+		SELECT id FROM queues
+		WHERE status = 'waiting'
+		AND DATE(created_at) = DATE('now', 'localtime')
+		AND (target_counter_id IS NULL OR target_counter_id = ?)
+	`
+	args := []interface{}{counterID}
+	if queueType != "" {
+		query += ` AND (queue_type = ? OR target_counter_id = ?)`
+		args = append(args, queueType, counterID)
 	}
-	q.PrepareJSON()
-	return q, nil
+	order, orderArgs := d.waitingOrder()
+	query += order + ` LIMIT 1`
+	args = append(args, orderArgs...)
+
+	var id int64
+	err := tx.QueryRow(query, args...).Scan(&id)
+	return id, err
 }
 
-func (d *DB) GetQueueByNumber(number string) (*models.Queue, error) {
+// queueColumns is the column list read by scanQueue.
+const queueColumns = `id, queue_number, queue_type, status, counter_id, created_at, called_at, completed_at, priority,
+	skip_count, requeue_after, target_counter_id, token`
+
+func scanQueue(row rowScanner) (*models.Queue, error) {
 	q := &models.Queue{}
-	err := d.QueryRow(`
-		SELECT id, queue_number, queue_type, status, counter_id, created_at, called_at, completed_at
-		FROM queues WHERE queue_number = ?
-	`, number).Scan(&q.ID, &q.QueueNumber, &q.QueueType, &q.Status, &q.CounterID, &q.CreatedAt, &q.CalledAt, &q.CompletedAt)
+	var token sql.NullString
+	err := row.Scan(&q.ID, &q.QueueNumber, &q.QueueType, &q.Status, &q.CounterID, &q.CreatedAt, &q.CalledAt, &q.CompletedAt, &q.Priority,
+		&q.SkipCount, &q.RequeueAfter, &q.TargetCounterID, &token)
 	if err != nil {
 		return nil, err
 	}
+	q.Token = token.String
 	q.PrepareJSON()
 	return q, nil
 }
 
+// waitingOrder returns the ORDER BY clause used to pick the next waiting
+// queue: higher priority first, then oldest first. When aging is enabled a
+// normal ticket that has waited at least PriorityAgingMinutes is ranked like
+// a priority ticket, so a steady stream of priority tickets cannot starve it.
+//
+// Tickets transferred to a specific counter come first for that counter.
+// Returned no-show tickets are placed explicitly: requeue_after = 0 goes
+// before everything else, requeue_after > 0 waits behind the regular queue
+// until CallNextQueue has counted it down.
+func (d *DB) waitingOrder() (string, []interface{}) {
+	const requeued = ` ORDER BY target_counter_id IS NULL ASC,
+		CASE WHEN requeue_after = 0 THEN 0 WHEN requeue_after > 0 THEN 2 ELSE 1 END ASC,`
+	aging := d.config.Queue.PriorityAgingMinutes
+	if aging <= 0 {
+		return requeued + ` priority DESC, created_at ASC, id ASC`, nil
+	}
+	return requeued + ` CASE
+			WHEN priority > 0 THEN priority
+			WHEN created_at <= datetime('now', 'localtime', ? || ' minutes') THEN 1
+			ELSE 0
+		END DESC, created_at ASC, id ASC`, []interface{}{fmt.Sprintf("-%d", aging)}
+}
+
+func (d *DB) GetQueue(id int64) (*models.Queue, error) {
+	return scanQueue(d.QueryRow(`SELECT `+queueColumns+` FROM queues WHERE id = ?`, id))
+}
+
+// GetQueueByNumber returns the most recent ticket with the given number;
+// numbers repeat when they are reset daily.
+func (d *DB) GetQueueByNumber(number string) (*models.Queue, error) {
+	return scanQueue(d.QueryRow(`
+		SELECT `+queueColumns+` FROM queues WHERE queue_number = ?
+		ORDER BY created_at DESC, id DESC LIMIT 1
+	`, number))
+}
+
+// GetQueueByToken returns the ticket with the given status page token.
+func (d *DB) GetQueueByToken(token string) (*models.Queue, error) {
+	return scanQueue(d.QueryRow(`SELECT `+queueColumns+` FROM queues WHERE token = ?`, token))
+}
+
 func (d *DB) ListQueues(status string, limit int) ([]*models.Queue, error) {
-	query := `SELECT id, queue_number, queue_type, status, counter_id, created_at, called_at, completed_at FROM queues`
+	query := `SELECT ` + queueColumns + ` FROM queues`
 	args := []interface{}{}
 
 	if status != "" {
@@ -399,11 +451,10 @@ func (d *DB) ListQueues(status string, limit int) ([]*models.Queue, error) {
 
 	var queues []*models.Queue
 	for rows.Next() {
-		q := &models.Queue{}
-		if err := rows.Scan(&q.ID, &q.QueueNumber, &q.QueueType, &q.Status, &q.CounterID, &q.CreatedAt, &q.CalledAt, &q.CompletedAt); err != nil {
+		q, err := scanQueue(rows)
+		if err != nil {
 			return nil, err
 		}
-		q.PrepareJSON()
 		queues = append(queues, q)
 	}
 	return queues, nil
@@ -457,7 +508,7 @@ func (d *DB) ListQueuesWithPagination(status, queueType, date string, page, perP
 	}
 
 	// Get queues
-	query := `SELECT id, queue_number, queue_type, status, counter_id, created_at, called_at, completed_at FROM queues` + whereClause + ` ORDER BY ` + orderBy + ` LIMIT ? OFFSET ?`
+	query := `SELECT ` + queueColumns + ` FROM queues` + whereClause + ` ORDER BY ` + orderBy + ` LIMIT ? OFFSET ?`
 	args = append(args, perPage, offset)
 
 	rows, err := d.Query(query, args...)
@@ -468,11 +519,10 @@ func (d *DB) ListQueuesWithPagination(status, queueType, date string, page, perP
 
 	var queues []*models.Queue
 	for rows.Next() {
-		q := &models.Queue{}
-		if err := rows.Scan(&q.ID, &q.QueueNumber, &q.QueueType, &q.Status, &q.CounterID, &q.CreatedAt, &q.CalledAt, &q.CompletedAt); err != nil {
+		q, err := scanQueue(rows)
+		if err != nil {
 			return nil, err
 		}
-		q.PrepareJSON()
 		queues = append(queues, q)
 	}
 
@@ -490,37 +540,26 @@ func (d *DB) ListQueuesWithPagination(status, queueType, date string, page, perP
 }
 
 func (d *DB) GetNextWaitingQueue() (*models.Queue, error) {
-	q := &models.Queue{}
-	err := d.QueryRow(`
-		SELECT id, queue_number, queue_type, status, counter_id, created_at, called_at, completed_at
-		FROM queues
-		WHERE status = 'waiting'
-		AND DATE(created_at) = DATE('now', 'localtime')
-		ORDER BY created_at ASC
-		LIMIT 1
-	`).Scan(&q.ID, &q.QueueNumber, &q.QueueType, &q.Status, &q.CounterID, &q.CreatedAt, &q.CalledAt, &q.CompletedAt)
-	if err != nil {
-		return nil, err
-	}
-	q.PrepareJSON()
-	return q, nil
+	return d.GetNextWaitingQueueByType("")
 }
 
+// GetNextWaitingQueueByType returns the queue CallNextQueue would pick next
+// (queueType kosong = semua jenis).
 func (d *DB) GetNextWaitingQueueByType(queueType string) (*models.Queue, error) {
-	q := &models.Queue{}
-	err := d.QueryRow(`
-		SELECT id, queue_number, queue_type, status, counter_id, created_at, called_at, completed_at
-		FROM queues
-		WHERE status = 'waiting' AND queue_type = ?
+	query := `SELECT ` + queueColumns + ` FROM queues
+		WHERE status = 'waiting'
 		AND DATE(created_at) = DATE('now', 'localtime')
-		ORDER BY created_at ASC
-		LIMIT 1
-	`, queueType).Scan(&q.ID, &q.QueueNumber, &q.QueueType, &q.Status, &q.CounterID, &q.CreatedAt, &q.CalledAt, &q.CompletedAt)
-	if err != nil {
-		return nil, err
+		AND target_counter_id IS NULL`
+	args := []interface{}{}
+	if queueType != "" {
+		query += ` AND queue_type = ?`
+		args = append(args, queueType)
 	}
-	q.PrepareJSON()
-	return q, nil
+	order, orderArgs := d.waitingOrder()
+	query += order + ` LIMIT 1`
+	args = append(args, orderArgs...)
+
+	return scanQueue(d.QueryRow(query, args...))
 }
 
 func (d *DB) GetWaitingCountByType() (map[string]int, error) {
@@ -548,6 +587,20 @@ func (d *DB) GetWaitingCountByType() (map[string]int, error) {
 	return counts, nil
 }
 
+// SetQueuePriority changes the priority of a queue that is still waiting.
+// Returns sql.ErrNoRows if the queue does not exist or is no longer waiting.
+func (d *DB) SetQueuePriority(id int64, priority models.QueuePriority) error {
+	result, err := d.Exec(`UPDATE queues SET priority = ? WHERE id = ? AND status = 'waiting'`, priority, id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 func (d *DB) UpdateQueueStatus(id int64, status models.QueueStatus, counterID *int64) error {
 	now := time.Now()
 
@@ -595,8 +648,8 @@ func (d *DB) GetCounter(id int64) (*models.Counter, error) {
 	// Join with queues and filter: only show current_queue if it was CALLED today
 	query := `
 		SELECT
-			c.id, c.counter_number, c.counter_name, c.is_active, c.current_queue_id, c.last_call_at,
-			q.id, q.queue_number, q.queue_type, q.status, q.counter_id, q.created_at, q.called_at, q.completed_at
+			c.id, c.counter_number, c.counter_name, c.is_active, c.current_queue_id, c.last_call_at, c.routing_mode,
+			q.id, q.queue_number, q.queue_type, q.status, q.counter_id, q.created_at, q.called_at, q.completed_at, q.priority
 		FROM counters c
 		LEFT JOIN queues q ON c.current_queue_id = q.id
 			AND DATE(q.called_at) = ?
@@ -604,13 +657,13 @@ func (d *DB) GetCounter(id int64) (*models.Counter, error) {
 	`
 
 	c := &models.Counter{}
-	var qID, qCounterID sql.NullInt64
+	var qID, qCounterID, qPriority sql.NullInt64
 	var qNumber, qType, qStatus sql.NullString
 	var qCreated, qCalled, qCompleted sql.NullTime
 
 	err := d.QueryRow(query, today, id).Scan(
-		&c.ID, &c.CounterNumber, &c.CounterName, &c.IsActive, &c.CurrentQueueID, &c.LastCallAt,
-		&qID, &qNumber, &qType, &qStatus, &qCounterID, &qCreated, &qCalled, &qCompleted,
+		&c.ID, &c.CounterNumber, &c.CounterName, &c.IsActive, &c.CurrentQueueID, &c.LastCallAt, &c.RoutingMode,
+		&qID, &qNumber, &qType, &qStatus, &qCounterID, &qCreated, &qCalled, &qCompleted, &qPriority,
 	)
 	if err != nil {
 		return nil, err
@@ -628,6 +681,7 @@ func (d *DB) GetCounter(id int64) (*models.Counter, error) {
 			CreatedAt:   qCreated.Time,
 			CalledAt:    qCalled,
 			CompletedAt: qCompleted,
+			Priority:    models.QueuePriority(qPriority.Int64),
 		}
 		c.CurrentQueue.PrepareJSON()
 	} else {
@@ -635,6 +689,11 @@ func (d *DB) GetCounter(id int64) (*models.Counter, error) {
 		c.CurrentQueueID = sql.NullInt64{Valid: false}
 	}
 
+	c.Services, err = d.GetCounterServices(c.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	return c, nil
 }
 
@@ -645,8 +704,8 @@ func (d *DB) ListCounters() ([]*models.Counter, error) {
 	// Join with queues and filter: only show current_queue if it was CALLED today
 	query := `
 		SELECT
-			c.id, c.counter_number, c.counter_name, c.is_active, c.current_queue_id, c.last_call_at,
-			q.id, q.queue_number, q.queue_type, q.status, q.counter_id, q.created_at, q.called_at, q.completed_at
+			c.id, c.counter_number, c.counter_name, c.is_active, c.current_queue_id, c.last_call_at, c.routing_mode,
+			q.id, q.queue_number, q.queue_type, q.status, q.counter_id, q.created_at, q.called_at, q.completed_at, q.priority
 		FROM counters c
 		LEFT JOIN queues q ON c.current_queue_id = q.id
 			AND DATE(q.called_at) = ?
@@ -662,13 +721,13 @@ func (d *DB) ListCounters() ([]*models.Counter, error) {
 	var counters []*models.Counter
 	for rows.Next() {
 		c := &models.Counter{}
-		var qID, qCounterID sql.NullInt64
+		var qID, qCounterID, qPriority sql.NullInt64
 		var qNumber, qType, qStatus sql.NullString
 		var qCreated, qCalled, qCompleted sql.NullTime
 
 		err := rows.Scan(
-			&c.ID, &c.CounterNumber, &c.CounterName, &c.IsActive, &c.CurrentQueueID, &c.LastCallAt,
-			&qID, &qNumber, &qType, &qStatus, &qCounterID, &qCreated, &qCalled, &qCompleted,
+			&c.ID, &c.CounterNumber, &c.CounterName, &c.IsActive, &c.CurrentQueueID, &c.LastCallAt, &c.RoutingMode,
+			&qID, &qNumber, &qType, &qStatus, &qCounterID, &qCreated, &qCalled, &qCompleted, &qPriority,
 		)
 		if err != nil {
 			return nil, err
@@ -686,6 +745,7 @@ func (d *DB) ListCounters() ([]*models.Counter, error) {
 				CreatedAt:   qCreated.Time,
 				CalledAt:    qCalled,
 				CompletedAt: qCompleted,
+				Priority:    models.QueuePriority(qPriority.Int64),
 			}
 			c.CurrentQueue.PrepareJSON()
 		} else {
@@ -694,6 +754,15 @@ func (d *DB) ListCounters() ([]*models.Counter, error) {
 		}
 		counters = append(counters, c)
 	}
+	rows.Close()
+
+	services, err := d.counterServicesByCounter()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range counters {
+		c.Services = services[c.ID]
+	}
 	return counters, nil
 }
 
@@ -729,10 +798,16 @@ func (d *DB) DeleteCounter(id int64) error {
 		return fmt.Errorf("failed to update queues: %w", err)
 	}
 
-	// Delete call history for this counter
-	_, err = tx.Exec(`DELETE FROM call_history WHERE counter_id = ?`, id)
+	// Remove operator assignments for this counter
+	_, err = tx.Exec(`DELETE FROM user_counters WHERE counter_id = ?`, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete call history: %w", err)
+		return fmt.Errorf("failed to delete counter assignments: %w", err)
+	}
+
+	// Remove queue type assignments for this counter
+	_, err = tx.Exec(`DELETE FROM counter_queue_types WHERE counter_id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete counter services: %w", err)
 	}
 
 	// Delete the counter
@@ -791,6 +866,7 @@ func (d *DB) GetStats() (*models.Stats, error) {
 	d.QueryRow(`SELECT COUNT(*) FROM queues WHERE status = 'called' AND DATE(created_at) = DATE('now', 'localtime')`).Scan(&stats.CalledQueues)
 	d.QueryRow(`SELECT COUNT(*) FROM queues WHERE status = 'completed' AND DATE(created_at) = DATE('now', 'localtime')`).Scan(&stats.CompletedQueues)
 	d.QueryRow(`SELECT COUNT(*) FROM queues WHERE status = 'cancelled' AND DATE(created_at) = DATE('now', 'localtime')`).Scan(&stats.CancelledQueues)
+	d.QueryRow(`SELECT COUNT(*) FROM queues WHERE status = 'no_show' AND DATE(created_at) = DATE('now', 'localtime')`).Scan(&stats.NoShowQueues)
 	d.QueryRow(`SELECT COUNT(*) FROM counters WHERE is_active = 1`).Scan(&stats.ActiveCounters)
 
 	return stats, nil
@@ -813,6 +889,11 @@ func (d *DB) SetSetting(key, value string) error {
 	return err
 }
 
+func (d *DB) DeleteSetting(key string) error {
+	_, err := d.Exec(`DELETE FROM settings WHERE key = ?`, key)
+	return err
+}
+
 func (d *DB) GetAllSettings() (map[string]string, error) {
 	rows, err := d.Query(`SELECT key, value FROM settings`)
 	if err != nil {
@@ -837,9 +918,11 @@ type ReportData struct {
 	Total       int              `json:"total"`
 	Completed   int              `json:"completed"`
 	Cancelled   int              `json:"cancelled"`
+	NoShow      int              `json:"no_show"`
 	AvgWaitTime string           `json:"avg_wait_time"`
 	Daily       []DailyReport    `json:"daily"`
 	ByType      []TypeReport     `json:"by_type"`
+	Steps       []StepReport     `json:"steps"`
 }
 
 type DailyReport struct {
@@ -858,6 +941,33 @@ type TypeReport struct {
 	Cancelled int    `json:"cancelled"`
 }
 
+// StepReport breaks down one journey step: wait time runs from the ticket
+// being enqueued for the step until it is first called, service time from
+// that call until the step is completed.
+type StepReport struct {
+	JourneyType    string `json:"journey_type"`
+	JourneyName    string `json:"journey_name"`
+	StepNo         int    `json:"step_no"`
+	Name           string `json:"name"`
+	Total          int    `json:"total"`
+	Completed      int    `json:"completed"`
+	AvgWaitTime    string `json:"avg_wait_time"`
+	AvgServiceTime string `json:"avg_service_time"`
+}
+
+// formatMinutes renders a duration in minutes for reports, or "-" if there
+// is nothing to average.
+func formatMinutes(avgMinutes float64) string {
+	if avgMinutes <= 0 {
+		return "-"
+	}
+	mins := int(avgMinutes)
+	if mins < 60 {
+		return fmt.Sprintf("%d menit", mins)
+	}
+	return fmt.Sprintf("%d jam %d menit", mins/60, mins%60)
+}
+
 func (d *DB) GetReport(startDate, endDate string) (*ReportData, error) {
 	report := &ReportData{}
 
@@ -877,6 +987,11 @@ func (d *DB) GetReport(startDate, endDate string) (*ReportData, error) {
 		WHERE status = 'cancelled' AND DATE(created_at) BETWEEN ? AND ?
 	`, startDate, endDate).Scan(&report.Cancelled)
 
+	d.QueryRow(`
+		SELECT COUNT(*) FROM queues
+		WHERE status = 'no_show' AND DATE(created_at) BETWEEN ? AND ?
+	`, startDate, endDate).Scan(&report.NoShow)
+
 	// Get average wait time (from created_at to called_at)
 	var avgMinutes float64
 	err := d.QueryRow(`
@@ -884,16 +999,10 @@ func (d *DB) GetReport(startDate, endDate string) (*ReportData, error) {
 		FROM queues
 		WHERE called_at IS NOT NULL AND DATE(created_at) BETWEEN ? AND ?
 	`, startDate, endDate).Scan(&avgMinutes)
-	if err == nil && avgMinutes > 0 {
-		mins := int(avgMinutes)
-		if mins < 60 {
-			report.AvgWaitTime = fmt.Sprintf("%d menit", mins)
-		} else {
-			report.AvgWaitTime = fmt.Sprintf("%d jam %d menit", mins/60, mins%60)
-		}
-	} else {
-		report.AvgWaitTime = "-"
+	if err != nil {
+		avgMinutes = 0
 	}
+	report.AvgWaitTime = formatMinutes(avgMinutes)
 
 	// Get daily breakdown
 	rows, err := d.Query(`
@@ -936,13 +1045,40 @@ func (d *DB) GetReport(startDate, endDate string) (*ReportData, error) {
 		}
 	}
 
+	// Get per-step breakdown of multi-step journeys
+	rows3, err := d.Query(`
+		SELECT v.journey_type, COALESCE(qt.name, v.journey_type), s.step_no, s.name,
+			COUNT(*) as total,
+			SUM(CASE WHEN s.completed_at IS NOT NULL THEN 1 ELSE 0 END) as completed,
+			COALESCE(AVG(CASE WHEN s.called_at IS NOT NULL
+				THEN (julianday(s.called_at) - julianday(s.enqueued_at)) * 24 * 60 END), 0),
+			COALESCE(AVG(CASE WHEN s.called_at IS NOT NULL AND s.completed_at IS NOT NULL
+				THEN (julianday(s.completed_at) - julianday(s.called_at)) * 24 * 60 END), 0)
+		FROM visit_steps s
+		JOIN visits v ON v.id = s.visit_id
+		LEFT JOIN queue_types qt ON v.journey_type = qt.code
+		WHERE DATE(s.enqueued_at) BETWEEN ? AND ?
+		GROUP BY v.journey_type, s.step_no
+		ORDER BY v.journey_type, s.step_no
+	`, startDate, endDate)
+	if err == nil {
+		defer rows3.Close()
+		for rows3.Next() {
+			var sr StepReport
+			var waitMinutes, serviceMinutes float64
+			rows3.Scan(&sr.JourneyType, &sr.JourneyName, &sr.StepNo, &sr.Name, &sr.Total, &sr.Completed, &waitMinutes, &serviceMinutes)
+			sr.AvgWaitTime = formatMinutes(waitMinutes)
+			sr.AvgServiceTime = formatMinutes(serviceMinutes)
+			report.Steps = append(report.Steps, sr)
+		}
+	}
+
 	return report, nil
 }
 
 func (d *DB) GetQueuesForExport(startDate, endDate string) ([]*models.Queue, error) {
 	rows, err := d.Query(`
-		SELECT id, queue_number, queue_type, status, counter_id,
-			created_at, called_at, completed_at
+		SELECT `+queueColumns+`
 		FROM queues
 		WHERE DATE(created_at) BETWEEN ? AND ?
 		ORDER BY created_at
@@ -954,9 +1090,7 @@ func (d *DB) GetQueuesForExport(startDate, endDate string) ([]*models.Queue, err
 
 	var queues []*models.Queue
 	for rows.Next() {
-		q := &models.Queue{}
-		err := rows.Scan(&q.ID, &q.QueueNumber, &q.QueueType, &q.Status, &q.CounterID,
-			&q.CreatedAt, &q.CalledAt, &q.CompletedAt)
+		q, err := scanQueue(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -980,84 +1114,144 @@ func (d *DB) CancelOldQueues(hours int) (int64, error) {
 	return result.RowsAffected()
 }
 
-// ResetQueuesToday menghapus data antrian hari ini berdasarkan jenis antrian
+// ResetQueuesToday mereset antrian hari ini berdasarkan jenis antrian dan
+// mengembalikan antrian yang direset agar dapat dicatat di audit log.
+// Antrian tidak dihapus: yang belum selesai dibatalkan dan semuanya ditandai
+// reset_at, sehingga penomoran dimulai lagi sementara audit log dan
+// call_history tetap merujuk ke baris yang ada.
 // queueType: kode jenis antrian (kosong = semua jenis)
-func (d *DB) ResetQueuesToday(queueType string) (int64, error) {
+func (d *DB) ResetQueuesToday(queueType string) ([]*models.Queue, error) {
 	tx, err := d.Begin()
 	if err != nil {
-		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
 	// Build WHERE clause untuk filter
-	whereQueue := "DATE(created_at) = DATE('now', 'localtime')"
+	whereQueue := "DATE(created_at) = DATE('now', 'localtime') AND reset_at IS NULL"
 	args := []interface{}{}
 	if queueType != "" {
 		whereQueue += " AND queue_type = ?"
 		args = append(args, queueType)
 	}
 
-	// Ambil ID antrian yang akan dihapus
-	query := fmt.Sprintf("SELECT id FROM queues WHERE %s", whereQueue)
+	// Ambil antrian yang akan direset
+	query := fmt.Sprintf(`SELECT %s FROM queues WHERE %s ORDER BY id`, queueColumns, whereQueue)
 	rows, err := tx.Query(query, args...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get queue ids: %w", err)
+		return nil, fmt.Errorf("failed to get queues: %w", err)
 	}
 
-	var queueIDs []int64
+	var queues []*models.Queue
 	for rows.Next() {
-		var id int64
-		if err := rows.Scan(&id); err != nil {
+		q, err := scanQueue(rows)
+		if err != nil {
 			rows.Close()
-			return 0, fmt.Errorf("failed to scan queue id: %w", err)
+			return nil, fmt.Errorf("failed to scan queue: %w", err)
 		}
-		queueIDs = append(queueIDs, id)
+		queues = append(queues, q)
 	}
 	rows.Close()
 
-	if len(queueIDs) == 0 {
-		return 0, nil // Tidak ada antrian untuk dihapus
+	// Blok nomor offline hari ini ikut dilepas agar penomoran dimulai lagi
+	if err := resetNumberBlocksTx(tx, queueType); err != nil {
+		return nil, fmt.Errorf("failed to reset number blocks: %w", err)
 	}
 
-	// Reset counter yang current_queue_id-nya ada di list yang akan dihapus
-	for _, qid := range queueIDs {
-		_, err = tx.Exec(`UPDATE counters SET current_queue_id = NULL, last_call_at = NULL WHERE current_queue_id = ?`, qid)
-		if err != nil {
-			return 0, fmt.Errorf("failed to reset counter: %w", err)
+	if len(queues) == 0 {
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
 		}
+		return nil, nil // Tidak ada antrian untuk direset
 	}
 
-	// Hapus call_history untuk antrian yang akan dihapus
-	for _, qid := range queueIDs {
-		_, err = tx.Exec(`DELETE FROM call_history WHERE queue_id = ?`, qid)
+	// Reset counter yang current_queue_id-nya ada di list yang akan direset
+	for _, q := range queues {
+		_, err = tx.Exec(`UPDATE counters SET current_queue_id = NULL, last_call_at = NULL WHERE current_queue_id = ?`, q.ID)
 		if err != nil {
-			return 0, fmt.Errorf("failed to delete call_history: %w", err)
+			return nil, fmt.Errorf("failed to reset counter: %w", err)
 		}
 	}
 
-	// Hapus antrian hari ini sesuai filter
-	deleteQuery := fmt.Sprintf("DELETE FROM queues WHERE %s", whereQueue)
-	result, err := tx.Exec(deleteQuery, args...)
-	if err != nil {
-		return 0, fmt.Errorf("failed to delete queues: %w", err)
+	// Tutup alur layanan yang masih berjalan
+	visitQuery := fmt.Sprintf(`
+		UPDATE visits SET completed_at = datetime('now', 'localtime')
+		WHERE completed_at IS NULL AND queue_id IN (SELECT id FROM queues WHERE %s)
+	`, whereQueue)
+	if _, err := tx.Exec(visitQuery, args...); err != nil {
+		return nil, fmt.Errorf("failed to close visits: %w", err)
 	}
 
-	affected, _ := result.RowsAffected()
+	// Batalkan antrian yang belum selesai dan tandai semuanya sebagai direset
+	resetQuery := fmt.Sprintf(`
+		UPDATE queues
+		SET status = CASE WHEN status IN ('waiting', 'called', 'no_show') THEN 'cancelled' ELSE status END,
+			reset_at = datetime('now', 'localtime')
+		WHERE %s
+	`, whereQueue)
+	if _, err := tx.Exec(resetQuery, args...); err != nil {
+		return nil, fmt.Errorf("failed to reset queues: %w", err)
+	}
 
 	if err := tx.Commit(); err != nil {
-		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return affected, nil
+	return queues, nil
 }
 
 // Print Job operations
 
-func (d *DB) CreatePrintJob(queueNumber, typeName, dateTime, templateJSON string) (*models.PrintJob, error) {
+// printJobColumns is the column list read by scanPrintJob.
+const printJobColumns = `id, queue_number, type_name, date_time, template_json, priority, position,
+	estimated_wait, status_url, counter, target, status, agent_id, attempts, created_at, claimed_at,
+	lease_expires_at, next_attempt_at, completed_at, error_message`
+
+// Print job retry backoff: the first retry waits printJobRetryBase, each
+// further one twice as long as the one before, up to printJobRetryMax.
+const (
+	printJobRetryBase = 10 * time.Second
+	printJobRetryMax  = 5 * time.Minute
+)
+
+func scanPrintJob(row rowScanner) (*models.PrintJob, error) {
+	pj := &models.PrintJob{}
+	var agentID, errorMsg sql.NullString
+	if err := row.Scan(&pj.ID, &pj.QueueNumber, &pj.TypeName, &pj.DateTime,
+		&pj.TemplateJSON, &pj.Priority, &pj.Position, &pj.EstimatedWait, &pj.StatusURL, &pj.Counter, &pj.Target, &pj.Status, &agentID, &pj.Attempts,
+		&pj.CreatedAt, &pj.ClaimedAt, &pj.LeaseExpiresAt, &pj.NextAttemptAt, &pj.CompletedAt, &errorMsg); err != nil {
+		return nil, err
+	}
+	if agentID.Valid {
+		pj.AgentID = agentID.String
+	}
+	if errorMsg.Valid {
+		pj.ErrorMessage = errorMsg.String
+	}
+	pj.PrepareJSON()
+	return pj, nil
+}
+
+func scanPrintJobs(rows *sql.Rows) ([]*models.PrintJob, error) {
+	defer rows.Close()
+	var jobs []*models.PrintJob
+	for rows.Next() {
+		pj, err := scanPrintJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, pj)
+	}
+	return jobs, rows.Err()
+}
+
+// CreatePrintJob queues a ticket for the print agents. target is the agent
+// ID or printer group that prints it, or empty for any agent.
+func (d *DB) CreatePrintJob(queueNumber, typeName, dateTime, templateJSON string, priority models.QueuePriority, position, estimatedWait int, statusURL, counter, target string) (*models.PrintJob, error) {
 	result, err := d.Exec(`
-		INSERT INTO print_jobs (queue_number, type_name, date_time, template_json, status)
-		VALUES (?, ?, ?, ?, 'pending')
-	`, queueNumber, typeName, dateTime, templateJSON)
+		INSERT INTO print_jobs (queue_number, type_name, date_time, template_json, priority, position, estimated_wait, status_url, counter, target, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'pending')
+	`, queueNumber, typeName, dateTime, templateJSON, priority, position, estimatedWait, statusURL, counter, target)
 	if err != nil {
 		return nil, err
 	}
@@ -1067,37 +1261,69 @@ func (d *DB) CreatePrintJob(queueNumber, typeName, dateTime, templateJSON string
 }
 
 func (d *DB) GetPrintJob(id int64) (*models.PrintJob, error) {
-	pj := &models.PrintJob{}
-	var agentID sql.NullString
-	var errorMsg sql.NullString
-	err := d.QueryRow(`
-		SELECT id, queue_number, type_name, date_time, template_json, status,
-			agent_id, created_at, claimed_at, completed_at, error_message
-		FROM print_jobs WHERE id = ?
-	`, id).Scan(&pj.ID, &pj.QueueNumber, &pj.TypeName, &pj.DateTime,
-		&pj.TemplateJSON, &pj.Status, &agentID, &pj.CreatedAt,
-		&pj.ClaimedAt, &pj.CompletedAt, &errorMsg)
+	return scanPrintJob(d.QueryRow(`SELECT `+printJobColumns+` FROM print_jobs WHERE id = ?`, id))
+}
+
+// ClaimPrintJob atomically claims a pending job for the given agent, a
+// member of group, which holds it for lease. Each claim counts as an
+// attempt. Returns the job if successfully claimed, or sql.ErrNoRows if
+// already claimed or routed to another agent.
+func (d *DB) ClaimPrintJob(id int64, agentID, group string, lease time.Duration) (*models.PrintJob, error) {
+	result, err := d.Exec(`
+		UPDATE print_jobs
+		SET status = 'printing', agent_id = ?, attempts = attempts + 1,
+			claimed_at = datetime('now','localtime'),
+			lease_expires_at = datetime('now','localtime', ? || ' seconds'),
+			next_attempt_at = NULL
+		WHERE id = ? AND status = 'pending' AND (target = '' OR target = ? OR target = ?)
+	`, agentID, fmt.Sprintf("+%d", int(lease.Seconds())), id, agentID, group)
 	if err != nil {
 		return nil, err
 	}
-	if agentID.Valid {
-		pj.AgentID = agentID.String
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return nil, sql.ErrNoRows
 	}
-	if errorMsg.Valid {
-		pj.ErrorMessage = errorMsg.String
+
+	return d.GetPrintJob(id)
+}
+
+// CompletePrintJob marks a job the agent is printing as printed. Returns
+// sql.ErrNoRows if the job is not being printed by that agent, e.g. its
+// lease expired and it went back to pending.
+func (d *DB) CompletePrintJob(id int64, agentID string) error {
+	result, err := d.Exec(`
+		UPDATE print_jobs
+		SET status = 'completed', completed_at = datetime('now','localtime'),
+			lease_expires_at = NULL, next_attempt_at = NULL
+		WHERE id = ? AND status = 'printing' AND agent_id = ?
+	`, id, agentID)
+	if err != nil {
+		return err
 	}
-	pj.PrepareJSON()
-	return pj, nil
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-// ClaimPrintJob atomically claims a pending job for the given agent.
-// Returns the job if successfully claimed, or sql.ErrNoRows if already claimed.
-func (d *DB) ClaimPrintJob(id int64, agentID string) (*models.PrintJob, error) {
+// FailPrintJob records a failed attempt at a job the agent is printing. The
+// job is retried after a backoff, or dead-lettered once it has had
+// maxAttempts. Returns the job, or sql.ErrNoRows if it is not being printed
+// by that agent (e.g. its lease expired and it went back to pending).
+func (d *DB) FailPrintJob(id int64, agentID, errorMessage string, maxAttempts int) (*models.PrintJob, error) {
 	result, err := d.Exec(`
 		UPDATE print_jobs
-		SET status = 'printing', agent_id = ?, claimed_at = datetime('now','localtime')
-		WHERE id = ? AND status = 'pending'
-	`, agentID, id)
+		SET status = CASE WHEN attempts >= ?1 THEN 'dead' ELSE 'failed' END,
+			next_attempt_at = CASE WHEN attempts >= ?1 THEN NULL
+				ELSE datetime('now','localtime', '+' || min(?2 << min(attempts - 1, 16), ?3) || ' seconds') END,
+			completed_at = CASE WHEN attempts >= ?1 THEN datetime('now','localtime') END,
+			lease_expires_at = NULL, error_message = ?4
+		WHERE id = ?5 AND status = 'printing' AND agent_id = ?6
+	`, maxAttempts, int(printJobRetryBase.Seconds()), int(printJobRetryMax.Seconds()), errorMessage, id, agentID)
 	if err != nil {
 		return nil, err
 	}
@@ -1110,28 +1336,97 @@ func (d *DB) ClaimPrintJob(id int64, agentID string) (*models.PrintJob, error) {
 	return d.GetPrintJob(id)
 }
 
-func (d *DB) CompletePrintJob(id int64) error {
-	_, err := d.Exec(`
+// ExpirePrintJobLeases takes back jobs whose agent did not report within
+// its lease, e.g. because it crashed mid-print: they go back to pending, or
+// are dead-lettered once they have had maxAttempts.
+func (d *DB) ExpirePrintJobLeases(maxAttempts int) (int64, error) {
+	result, err := d.Exec(`
 		UPDATE print_jobs
-		SET status = 'completed', completed_at = datetime('now','localtime')
-		WHERE id = ?
-	`, id)
-	return err
+		SET status = CASE WHEN attempts >= ? THEN 'dead' ELSE 'pending' END,
+			completed_at = CASE WHEN attempts >= ? THEN datetime('now','localtime') END,
+			lease_expires_at = NULL,
+			error_message = 'print agent ' || COALESCE(agent_id, '') || ' did not report back before its lease expired'
+		WHERE status = 'printing' AND lease_expires_at < datetime('now','localtime')
+	`, maxAttempts, maxAttempts)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
-func (d *DB) FailPrintJob(id int64, errorMessage string) error {
-	_, err := d.Exec(`
+// RetryDuePrintJobs moves failed jobs whose backoff has passed back to
+// pending.
+func (d *DB) RetryDuePrintJobs() (int64, error) {
+	result, err := d.Exec(`
 		UPDATE print_jobs
-		SET status = 'failed', completed_at = datetime('now','localtime'), error_message = ?
-		WHERE id = ?
-	`, errorMessage, id)
-	return err
+		SET status = 'pending', next_attempt_at = NULL
+		WHERE status = 'failed' AND next_attempt_at <= datetime('now','localtime')
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ReissuePrintJob puts a failed or dead-lettered job back to pending with
+// its attempts reset. Returns sql.ErrNoRows if the job is in another state.
+func (d *DB) ReissuePrintJob(id int64) (*models.PrintJob, error) {
+	result, err := d.Exec(`
+		UPDATE print_jobs
+		SET status = 'pending', attempts = 0, agent_id = NULL, claimed_at = NULL,
+			lease_expires_at = NULL, next_attempt_at = NULL, completed_at = NULL
+		WHERE id = ? AND status IN ('failed', 'dead')
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return d.GetPrintJob(id)
+}
+
+// DismissPrintJob gives up on a dead-lettered job for good, leaving it to
+// be cleaned up. Returns sql.ErrNoRows if the job is not dead.
+func (d *DB) DismissPrintJob(id int64) (*models.PrintJob, error) {
+	result, err := d.Exec(`
+		UPDATE print_jobs SET status = 'dismissed' WHERE id = ? AND status = 'dead'
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return d.GetPrintJob(id)
+}
+
+// ListPendingPrintJobs returns the pending jobs agentID may print, oldest
+// first: those routed to it, to its group, or to any agent.
+func (d *DB) ListPendingPrintJobs(agentID, group string) ([]*models.PrintJob, error) {
+	rows, err := d.Query(`
+		SELECT `+printJobColumns+`
+		FROM print_jobs
+		WHERE status = 'pending' AND (target = '' OR target = ?1 OR target = ?2)
+		ORDER BY created_at ASC, id ASC
+	`, agentID, group)
+	if err != nil {
+		return nil, err
+	}
+	return scanPrintJobs(rows)
 }
 
-func (d *DB) ListPendingPrintJobs() ([]*models.PrintJob, error) {
+// ListAllPendingPrintJobs returns every pending job whatever its target,
+// oldest first, for the server to announce again.
+func (d *DB) ListAllPendingPrintJobs() ([]*models.PrintJob, error) {
 	rows, err := d.Query(`
-		SELECT id, queue_number, type_name, date_time, template_json, status,
-			agent_id, created_at, claimed_at, completed_at, error_message
+		SELECT `+printJobColumns+`
 		FROM print_jobs
 		WHERE status = 'pending'
 		ORDER BY created_at ASC
@@ -1139,35 +1434,42 @@ func (d *DB) ListPendingPrintJobs() ([]*models.PrintJob, error) {
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return scanPrintJobs(rows)
+}
 
-	var jobs []*models.PrintJob
-	for rows.Next() {
-		pj := &models.PrintJob{}
-		var agentID, errorMsg sql.NullString
-		if err := rows.Scan(&pj.ID, &pj.QueueNumber, &pj.TypeName, &pj.DateTime,
-			&pj.TemplateJSON, &pj.Status, &agentID, &pj.CreatedAt,
-			&pj.ClaimedAt, &pj.CompletedAt, &errorMsg); err != nil {
-			return nil, err
-		}
-		if agentID.Valid {
-			pj.AgentID = agentID.String
-		}
-		if errorMsg.Valid {
-			pj.ErrorMessage = errorMsg.String
-		}
-		pj.PrepareJSON()
-		jobs = append(jobs, pj)
+// ListPrintJobs returns the most recent jobs in any of the given states,
+// newest first, at most limit of them.
+func (d *DB) ListPrintJobs(statuses []models.PrintJobStatus, limit int) ([]*models.PrintJob, error) {
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(statuses)), ", ")
+	args := make([]interface{}, 0, len(statuses)+1)
+	for _, s := range statuses {
+		args = append(args, s)
+	}
+	args = append(args, limit)
+
+	rows, err := d.Query(`
+		SELECT `+printJobColumns+`
+		FROM print_jobs
+		WHERE status IN (`+placeholders+`)
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
 	}
-	return jobs, nil
+	return scanPrintJobs(rows)
 }
 
-// CleanupOldPrintJobs removes completed/failed print jobs older than the given hours.
+// CleanupOldPrintJobs removes completed and dismissed print jobs older than
+// the given hours. Dead-lettered jobs are kept until an admin reissues or
+// dismisses them.
 func (d *DB) CleanupOldPrintJobs(hours int) (int64, error) {
 	result, err := d.Exec(`
 		DELETE FROM print_jobs
-		WHERE status IN ('completed', 'failed')
-		AND created_at < datetime('now', 'localtime', ? || ' hours')
+		WHERE status IN ('completed', 'dismissed') AND created_at < datetime('now', 'localtime', ? || ' hours')
 	`, fmt.Sprintf("-%d", hours))
 	if err != nil {
 		return 0, err
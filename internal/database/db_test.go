@@ -0,0 +1,80 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"queue-system/internal/config"
+	"queue-system/internal/models"
+)
+
+// newTestDB returns a fully migrated database in a temporary directory.
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Database.Path = filepath.Join(t.TempDir(), "queue.db")
+	d, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// openTestDB returns an unmigrated database in a temporary directory.
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Database.Path = filepath.Join(t.TempDir(), "queue.db")
+	d, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// mustExec runs a statement that sets up test data.
+func mustExec(t *testing.T, d *DB, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := d.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+// ticket is a waiting ticket inserted directly, so tests control its age
+// and placement.
+type ticket struct {
+	number       string
+	queueType    string
+	priority     models.QueuePriority
+	ageSeconds   int
+	requeueAfter interface{} // nil or the number of calls to wait
+	target       interface{} // nil or the counter it was transferred to
+}
+
+// addTickets inserts waiting tickets created ageSeconds ago.
+func addTickets(t *testing.T, d *DB, tickets []ticket) {
+	t.Helper()
+	for _, tk := range tickets {
+		queueType := tk.queueType
+		if queueType == "" {
+			queueType = "A"
+		}
+		mustExec(t, d, `
+			INSERT INTO queues (queue_number, queue_type, status, priority, requeue_after, target_counter_id, created_at)
+			VALUES (?, ?, 'waiting', ?, ?, ?, datetime('now', 'localtime', ?))
+		`, tk.number, queueType, tk.priority, tk.requeueAfter, tk.target, fmt.Sprintf("-%d seconds", tk.ageSeconds))
+	}
+}
+
+// mustCreateCounter creates an active counter.
+func mustCreateCounter(t *testing.T, d *DB, number string) *models.Counter {
+	t.Helper()
+	c, err := d.CreateCounter(number, "Loket "+number)
+	if err != nil {
+		t.Fatalf("CreateCounter: %v", err)
+	}
+	return c
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+
+	"queue-system/internal/models"
+)
+
+// Position in line and estimated waiting time. The estimate is the ticket's
+// position times the average service time of its queue type, divided by the
+// number of active counters serving that type.
+
+// serviceTimeSample is the number of recently completed tickets, or journey
+// steps, of a type the average service time is taken over.
+const serviceTimeSample = 20
+
+// GetTicketStatus returns a ticket with the name of its queue type and its
+// position in line and estimated wait, or the counter it was called to.
+func (d *DB) GetTicketStatus(q *models.Queue) (*models.TicketStatus, error) {
+	ts := &models.TicketStatus{Queue: q}
+
+	if err := d.QueryRow(`SELECT name FROM queue_types WHERE code = ?`, q.QueueType).Scan(&ts.TypeName); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	switch q.Status {
+	case models.StatusWaiting:
+		position, err := d.queuePosition(q)
+		if err != nil {
+			return nil, err
+		}
+		ts.Position = position
+
+		minutes, err := d.avgServiceMinutes(q.QueueType)
+		if err != nil {
+			return nil, err
+		}
+		counters := 1
+		if !q.TargetCounterID.Valid {
+			if counters, err = d.servingCounters(q.QueueType); err != nil {
+				return nil, err
+			}
+			if counters == 0 {
+				counters = 1
+			}
+		}
+		ts.EstimatedWaitMinutes = int(math.Ceil(float64(position) * minutes / float64(counters)))
+
+	case models.StatusCalled:
+		if q.CounterID.Valid {
+			if err := d.QueryRow(`SELECT counter_number, counter_name FROM counters WHERE id = ?`, q.CounterID.Int64).
+				Scan(&ts.CounterNumber, &ts.CounterName); err != nil && err != sql.ErrNoRows {
+				return nil, err
+			}
+		}
+	}
+
+	return ts, nil
+}
+
+// queuePosition returns the place of a waiting ticket among today's waiting
+// tickets of its type, in the order CallNextQueue calls them. A ticket
+// transferred to a counter is only compared with others for that counter.
+func (d *DB) queuePosition(q *models.Queue) (int, error) {
+	query := `
+		SELECT id FROM queues
+		WHERE status = 'waiting'
+		AND DATE(created_at) = DATE('now', 'localtime')
+		AND queue_type = ?
+	`
+	args := []interface{}{q.QueueType}
+	if q.TargetCounterID.Valid {
+		query += ` AND target_counter_id = ?`
+		args = append(args, q.TargetCounterID.Int64)
+	} else {
+		query += ` AND target_counter_id IS NULL`
+	}
+	order, orderArgs := d.waitingOrder()
+	query += order
+	args = append(args, orderArgs...)
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get waiting queues: %w", err)
+	}
+	defer rows.Close()
+
+	position := 0
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		position++
+		if id == q.ID {
+			return position, nil
+		}
+	}
+	return 0, rows.Err()
+}
+
+// avgServiceMinutes returns the rolling average service time of a queue
+// type, falling back to the configured default while there is no history.
+// Tickets on a journey are timed per step from visit_steps, so a step is
+// not credited with the other steps and the waits in between.
+func (d *DB) avgServiceMinutes(queueType string) (float64, error) {
+	var avg sql.NullFloat64
+	err := d.QueryRow(`
+		SELECT AVG((julianday(completed_at) - julianday(called_at)) * 24 * 60)
+		FROM (
+			SELECT called_at, completed_at FROM queues q
+			WHERE q.queue_type = ?1 AND q.status = 'completed'
+			AND q.called_at IS NOT NULL AND q.completed_at >= q.called_at
+			AND NOT EXISTS (SELECT 1 FROM visits v WHERE v.queue_id = q.id)
+			UNION ALL
+			SELECT called_at, completed_at FROM visit_steps
+			WHERE queue_type = ?1
+			AND called_at IS NOT NULL AND completed_at >= called_at
+			ORDER BY completed_at DESC
+			LIMIT ?2
+		)
+	`, queueType, serviceTimeSample).Scan(&avg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get service time: %w", err)
+	}
+	if !avg.Valid || avg.Float64 <= 0 {
+		return float64(d.config.Queue.DefaultServiceMinutes), nil
+	}
+	return avg.Float64, nil
+}
+
+// servingCounters returns the number of active counters that may call
+// tickets of queueType.
+func (d *DB) servingCounters(queueType string) (int, error) {
+	var n int
+	err := d.QueryRow(`
+		SELECT COUNT(*) FROM counters c
+		WHERE c.is_active = 1 AND (
+			NOT EXISTS (SELECT 1 FROM counter_queue_types cq WHERE cq.counter_id = c.id)
+			OR EXISTS (SELECT 1 FROM counter_queue_types cq WHERE cq.counter_id = c.id AND cq.queue_type = ?)
+		)
+	`, queueType).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count counters: %w", err)
+	}
+	return n, nil
+}
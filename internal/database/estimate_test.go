@@ -0,0 +1,145 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+)
+
+// served is a ticket or journey step served for the given minutes, an
+// hour ago.
+type served struct {
+	queueType string
+	minutes   int
+	journey   bool // timed in visit_steps
+}
+
+func addServed(t *testing.T, d *DB, list []served) {
+	t.Helper()
+	for i, s := range list {
+		called := "-60 minutes"
+		completed := fmt.Sprintf("-%d minutes", 60-s.minutes)
+		if !s.journey {
+			mustExec(t, d, `
+				INSERT INTO queues (queue_number, queue_type, status, created_at, called_at, completed_at)
+				VALUES (?, ?, 'completed', datetime('now', 'localtime', '-90 minutes'),
+					datetime('now', 'localtime', ?), datetime('now', 'localtime', ?))
+			`, fmt.Sprintf("S%03d", i+1), s.queueType, called, completed)
+			continue
+		}
+
+		// The ticket's own times span the whole journey, including the
+		// wait for the step
+		result, err := d.Exec(`
+			INSERT INTO queues (queue_number, queue_type, status, created_at, called_at, completed_at)
+			VALUES (?, ?, 'completed', datetime('now', 'localtime', '-90 minutes'),
+				datetime('now', 'localtime', '-90 minutes'), datetime('now', 'localtime', ?))
+		`, fmt.Sprintf("S%03d", i+1), s.queueType, completed)
+		if err != nil {
+			t.Fatalf("failed to insert ticket: %v", err)
+		}
+		queueID, _ := result.LastInsertId()
+		result, err = d.Exec(`
+			INSERT INTO visits (queue_id, journey_type, current_step, created_at, completed_at)
+			VALUES (?, 'J', 1, datetime('now', 'localtime', '-90 minutes'), datetime('now', 'localtime', ?))
+		`, queueID, completed)
+		if err != nil {
+			t.Fatalf("failed to insert visit: %v", err)
+		}
+		visitID, _ := result.LastInsertId()
+		mustExec(t, d, `
+			INSERT INTO visit_steps (visit_id, step_no, name, queue_type, enqueued_at, called_at, completed_at)
+			VALUES (?, 1, 'Langkah', ?, datetime('now', 'localtime', '-90 minutes'),
+				datetime('now', 'localtime', ?), datetime('now', 'localtime', ?))
+		`, visitID, s.queueType, called, completed)
+	}
+}
+
+func TestAvgServiceMinutes(t *testing.T) {
+	tests := []struct {
+		name   string
+		served []served
+		want   float64
+	}{
+		{"no history uses the default", nil, 5},
+		{"completed tickets", []served{{"A", 2, false}, {"A", 4, false}}, 3},
+		{"other types are ignored", []served{{"A", 2, false}, {"B", 30, false}}, 2},
+		{"journey steps are timed per step", []served{{"A", 3, true}, {"A", 3, true}}, 3},
+		{"tickets and journey steps together", []served{{"A", 2, false}, {"A", 6, true}}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDB(t)
+			addServed(t, d, tt.served)
+
+			got, err := d.avgServiceMinutes("A")
+			if err != nil {
+				t.Fatalf("avgServiceMinutes: %v", err)
+			}
+			if diff := got - tt.want; diff < -0.01 || diff > 0.01 {
+				t.Errorf("avgServiceMinutes = %.2f, want %.2f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAvgServiceMinutesSample(t *testing.T) {
+	d := newTestDB(t)
+
+	// Only the most recent serviceTimeSample services count
+	var list []served
+	for i := 0; i < serviceTimeSample; i++ {
+		list = append(list, served{"A", 2, false})
+	}
+	addServed(t, d, list)
+	mustExec(t, d, `
+		INSERT INTO queues (queue_number, queue_type, status, created_at, called_at, completed_at)
+		VALUES ('OLD', 'A', 'completed', datetime('now', 'localtime', '-5 hours'),
+			datetime('now', 'localtime', '-5 hours'), datetime('now', 'localtime', '-3 hours'))
+	`)
+
+	got, err := d.avgServiceMinutes("A")
+	if err != nil {
+		t.Fatalf("avgServiceMinutes: %v", err)
+	}
+	if got < 1.99 || got > 2.01 {
+		t.Errorf("avgServiceMinutes = %.2f, want 2", got)
+	}
+}
+
+func TestGetTicketStatusEstimate(t *testing.T) {
+	d := newTestDB(t)
+	first := mustCreateCounter(t, d, "1")
+	mustCreateCounter(t, d, "2")
+	addTickets(t, d, []ticket{
+		{number: "A001", ageSeconds: 50},
+		{number: "A002", ageSeconds: 40},
+		{number: "A003", ageSeconds: 30},
+		{number: "A004", ageSeconds: 20, target: first.ID},
+		{number: "B001", queueType: "B", ageSeconds: 60},
+	})
+
+	tests := []struct {
+		number       string
+		wantPosition int
+		wantMinutes  int
+	}{
+		{"A001", 1, 3}, // 1 * 5 / 2 counters
+		{"A003", 3, 8}, // 3 * 5 / 2 counters
+		{"A004", 1, 5}, // only the counter it was transferred to
+		{"B001", 1, 3},
+	}
+	for _, tt := range tests {
+		q, err := d.GetQueueByNumber(tt.number)
+		if err != nil {
+			t.Fatalf("GetQueueByNumber(%s): %v", tt.number, err)
+		}
+		ts, err := d.GetTicketStatus(q)
+		if err != nil {
+			t.Fatalf("GetTicketStatus(%s): %v", tt.number, err)
+		}
+		if ts.Position != tt.wantPosition || ts.EstimatedWaitMinutes != tt.wantMinutes {
+			t.Errorf("%s: position %d, wait %d minutes, want %d, %d",
+				tt.number, ts.Position, ts.EstimatedWaitMinutes, tt.wantPosition, tt.wantMinutes)
+		}
+	}
+}
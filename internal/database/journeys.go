@@ -0,0 +1,262 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"queue-system/internal/models"
+)
+
+// Multi-step service journeys. A queue type may declare an ordered list of
+// steps, each served under a queue type of its own. A ticket taken for such
+// a type gets a visit; completing a step puts the ticket back in the waiting
+// queue for the next step instead of closing it. visit_steps keeps the
+// enqueue, call and completion time of every step for the reports.
+
+// GetJourneySteps returns the steps declared for a queue type, in order.
+func (d *DB) GetJourneySteps(queueType string) ([]models.JourneyStep, error) {
+	rows, err := d.Query(`
+		SELECT step_no, name, step_type FROM journey_steps
+		WHERE queue_type = ? ORDER BY step_no
+	`, queueType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var steps []models.JourneyStep
+	for rows.Next() {
+		var s models.JourneyStep
+		if err := rows.Scan(&s.StepNo, &s.Name, &s.QueueType); err != nil {
+			return nil, err
+		}
+		steps = append(steps, s)
+	}
+	return steps, rows.Err()
+}
+
+// journeyStepsByType returns the steps of every queue type with a journey.
+func (d *DB) journeyStepsByType() (map[string][]models.JourneyStep, error) {
+	rows, err := d.Query(`SELECT queue_type, step_no, name, step_type FROM journey_steps ORDER BY queue_type, step_no`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	steps := make(map[string][]models.JourneyStep)
+	for rows.Next() {
+		var code string
+		var s models.JourneyStep
+		if err := rows.Scan(&code, &s.StepNo, &s.Name, &s.QueueType); err != nil {
+			return nil, err
+		}
+		steps[code] = append(steps[code], s)
+	}
+	return steps, rows.Err()
+}
+
+// SetJourneySteps replaces the steps of a queue type. Steps are numbered in
+// the order given; an empty list removes the journey. Tickets already on the
+// journey follow the new steps from their current step number onwards.
+func (d *DB) SetJourneySteps(queueType string, steps []models.JourneyStep) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM journey_steps WHERE queue_type = ?`, queueType); err != nil {
+		return fmt.Errorf("failed to clear journey steps: %w", err)
+	}
+	for i, s := range steps {
+		if _, err := tx.Exec(`
+			INSERT INTO journey_steps (queue_type, step_no, name, step_type) VALUES (?, ?, ?, ?)
+		`, queueType, i+1, s.Name, s.QueueType); err != nil {
+			return fmt.Errorf("failed to insert journey step: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CompleteQueue finishes the current step of the ticket called at counterID
+// and frees the counter. If the ticket's journey has another step, the
+// ticket goes back to waiting under that step's queue type, keeping its
+// number and created_at; otherwise it is completed. Returns sql.ErrNoRows if
+// the counter has no current queue.
+func (d *DB) CompleteQueue(counterID int64) (*models.Queue, error) {
+	tx, err := d.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var queueID sql.NullInt64
+	if err := tx.QueryRow(`SELECT current_queue_id FROM counters WHERE id = ?`, counterID).Scan(&queueID); err != nil {
+		return nil, err
+	}
+	if !queueID.Valid {
+		return nil, sql.ErrNoRows
+	}
+
+	if err := completeQueueTx(tx, queueID.Int64, counterID); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`UPDATE counters SET current_queue_id = NULL WHERE id = ?`, counterID); err != nil {
+		return nil, fmt.Errorf("failed to reset counter: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return d.GetQueue(queueID.Int64)
+}
+
+// startVisitTx opens a visit for a new ticket if its queue type has a
+// journey, and records the first step as enqueued.
+func startVisitTx(tx *sql.Tx, queueID int64, queueType string) error {
+	var name, stepType string
+	err := tx.QueryRow(`
+		SELECT name, step_type FROM journey_steps WHERE queue_type = ? AND step_no = 1
+	`, queueType).Scan(&name, &stepType)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get journey: %w", err)
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO visits (queue_id, journey_type, current_step, created_at)
+		VALUES (?, ?, 1, datetime('now', 'localtime'))
+	`, queueID, queueType)
+	if err != nil {
+		return fmt.Errorf("failed to create visit: %w", err)
+	}
+	visitID, _ := result.LastInsertId()
+
+	if _, err := tx.Exec(`
+		INSERT INTO visit_steps (visit_id, step_no, name, queue_type, enqueued_at)
+		VALUES (?, 1, ?, ?, datetime('now', 'localtime'))
+	`, visitID, name, stepType); err != nil {
+		return fmt.Errorf("failed to record visit step: %w", err)
+	}
+
+	if stepType != queueType {
+		if _, err := tx.Exec(`UPDATE queues SET queue_type = ? WHERE id = ?`, stepType, queueID); err != nil {
+			return fmt.Errorf("failed to route queue: %w", err)
+		}
+	}
+	return nil
+}
+
+// markStepCalledTx stamps the open step of a ticket's visit as called at
+// counterID. A recall after a skip keeps the first call time, so the step's
+// wait time is not reset.
+func markStepCalledTx(tx *sql.Tx, queueID, counterID int64) error {
+	_, err := tx.Exec(`
+		UPDATE visit_steps
+		SET called_at = COALESCE(called_at, datetime('now', 'localtime')), counter_id = ?
+		WHERE completed_at IS NULL
+		AND visit_id IN (SELECT id FROM visits WHERE queue_id = ?)
+	`, counterID, queueID)
+	if err != nil {
+		return fmt.Errorf("failed to record visit step: %w", err)
+	}
+	return nil
+}
+
+// completeQueueTx completes the current step of a ticket served at
+// counterID, advancing it to the next journey step if there is one, and
+// records the completion in call_history.
+func completeQueueTx(tx *sql.Tx, queueID, counterID int64) error {
+	advanced, err := advanceVisitTx(tx, queueID, counterID)
+	if err != nil {
+		return err
+	}
+
+	if !advanced {
+		if _, err := tx.Exec(`
+			UPDATE queues
+			SET status = 'completed', counter_id = ?, completed_at = datetime('now', 'localtime')
+			WHERE id = ?
+		`, counterID, queueID); err != nil {
+			return fmt.Errorf("failed to complete queue: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO call_history (queue_id, counter_id, action, timestamp)
+		VALUES (?, ?, ?, datetime('now', 'localtime'))
+	`, queueID, counterID, models.ActionCompleted); err != nil {
+		return fmt.Errorf("failed to record history: %w", err)
+	}
+	return nil
+}
+
+// advanceVisitTx closes the open step of a ticket's visit and, if the
+// journey has a next step, requeues the ticket for it. Reports whether the
+// ticket was requeued.
+func advanceVisitTx(tx *sql.Tx, queueID, counterID int64) (bool, error) {
+	var visitID int64
+	var journeyType string
+	var step int
+	err := tx.QueryRow(`
+		SELECT id, journey_type, current_step FROM visits
+		WHERE queue_id = ? AND completed_at IS NULL
+	`, queueID).Scan(&visitID, &journeyType, &step)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get visit: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE visit_steps SET completed_at = datetime('now', 'localtime'), counter_id = ?
+		WHERE visit_id = ? AND step_no = ?
+	`, counterID, visitID, step); err != nil {
+		return false, fmt.Errorf("failed to record visit step: %w", err)
+	}
+
+	var name, stepType string
+	err = tx.QueryRow(`
+		SELECT name, step_type FROM journey_steps WHERE queue_type = ? AND step_no = ?
+	`, journeyType, step+1).Scan(&name, &stepType)
+	if err == sql.ErrNoRows {
+		if _, err := tx.Exec(`
+			UPDATE visits SET completed_at = datetime('now', 'localtime') WHERE id = ?
+		`, visitID); err != nil {
+			return false, fmt.Errorf("failed to complete visit: %w", err)
+		}
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get journey step: %w", err)
+	}
+
+	// The ticket's own call times are those of its current step; the ones
+	// of earlier steps are kept in visit_steps
+	if _, err := tx.Exec(`
+		UPDATE queues
+		SET status = 'waiting', queue_type = ?, counter_id = NULL, target_counter_id = NULL, requeue_after = NULL,
+			called_at = NULL, completed_at = NULL
+		WHERE id = ?
+	`, stepType, queueID); err != nil {
+		return false, fmt.Errorf("failed to requeue for next step: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE visits SET current_step = ? WHERE id = ?`, step+1, visitID); err != nil {
+		return false, fmt.Errorf("failed to advance visit: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO visit_steps (visit_id, step_no, name, queue_type, enqueued_at)
+		VALUES (?, ?, ?, ?, datetime('now', 'localtime'))
+	`, visitID, step+1, name, stepType); err != nil {
+		return false, fmt.Errorf("failed to record visit step: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+
+	"queue-system/internal/models"
+)
+
+func TestJourneyAdvance(t *testing.T) {
+	d := newTestDB(t)
+	if _, err := d.CreateQueueType("J", "Poli", "J"); err != nil {
+		t.Fatalf("CreateQueueType: %v", err)
+	}
+	if err := d.SetJourneySteps("J", []models.JourneyStep{
+		{Name: "Pendaftaran", QueueType: "A"},
+		{Name: "Pemeriksaan", QueueType: "B"},
+	}); err != nil {
+		t.Fatalf("SetJourneySteps: %v", err)
+	}
+	counter := mustCreateCounter(t, d, "1")
+
+	q, err := d.CreateQueue("J", models.PriorityNormal)
+	if err != nil {
+		t.Fatalf("CreateQueue: %v", err)
+	}
+	if q.QueueNumber != "J001" || q.QueueType != "A" {
+		t.Fatalf("ticket %s of type %s, want J001 of type A", q.QueueNumber, q.QueueType)
+	}
+
+	call := func(queueType string) func() error {
+		return func() error {
+			_, err := d.CallNextQueue(counter.ID, queueType)
+			return err
+		}
+	}
+	complete := func() error {
+		_, err := d.CompleteQueue(counter.ID)
+		return err
+	}
+
+	steps := []struct {
+		name          string
+		run           func() error
+		wantStatus    models.QueueStatus
+		wantType      string
+		wantCalled    bool
+		wantCompleted bool
+		wantStep      int
+		wantSteps     int  // rows in visit_steps
+		wantDone      bool // visit completed
+	}{
+		{"call first step", call("A"), models.StatusCalled, "A", true, false, 1, 1, false},
+		{"complete first step", complete, models.StatusWaiting, "B", false, false, 2, 2, false},
+		{"call second step", call("B"), models.StatusCalled, "B", true, false, 2, 2, false},
+		{"complete journey", complete, models.StatusCompleted, "B", true, true, 2, 2, true},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		got, err := d.GetQueue(q.ID)
+		if err != nil {
+			t.Fatalf("%s: GetQueue: %v", step.name, err)
+		}
+		if got.Status != step.wantStatus || got.QueueType != step.wantType {
+			t.Errorf("%s: ticket %s/%s, want %s/%s", step.name, got.Status, got.QueueType, step.wantStatus, step.wantType)
+		}
+		if got.CalledAt.Valid != step.wantCalled || got.CompletedAt.Valid != step.wantCompleted {
+			t.Errorf("%s: called_at set %v, completed_at set %v, want %v, %v",
+				step.name, got.CalledAt.Valid, got.CompletedAt.Valid, step.wantCalled, step.wantCompleted)
+		}
+
+		var current, count int
+		var done sql.NullString
+		if err := d.QueryRow(`
+			SELECT v.current_step, v.completed_at, (SELECT COUNT(*) FROM visit_steps s WHERE s.visit_id = v.id)
+			FROM visits v WHERE v.queue_id = ?
+		`, q.ID).Scan(&current, &done, &count); err != nil {
+			t.Fatalf("%s: failed to read visit: %v", step.name, err)
+		}
+		if current != step.wantStep || count != step.wantSteps || done.Valid != step.wantDone {
+			t.Errorf("%s: visit at step %d with %d steps, done %v, want %d, %d, %v",
+				step.name, current, count, done.Valid, step.wantStep, step.wantSteps, step.wantDone)
+		}
+	}
+
+	// Every step was called and completed at this counter
+	var open int
+	if err := d.QueryRow(`
+		SELECT COUNT(*) FROM visit_steps
+		WHERE called_at IS NULL OR completed_at IS NULL OR counter_id != ?
+	`, counter.ID).Scan(&open); err != nil {
+		t.Fatalf("failed to read visit steps: %v", err)
+	}
+	if open != 0 {
+		t.Errorf("%d visit steps not called and completed at the counter", open)
+	}
+}
+
+func TestTicketWithoutJourney(t *testing.T) {
+	d := newTestDB(t)
+	counter := mustCreateCounter(t, d, "1")
+
+	q, err := d.CreateQueue("A", models.PriorityNormal)
+	if err != nil {
+		t.Fatalf("CreateQueue: %v", err)
+	}
+	if _, err := d.CallNextQueue(counter.ID, "A"); err != nil {
+		t.Fatalf("CallNextQueue: %v", err)
+	}
+	got, err := d.CompleteQueue(counter.ID)
+	if err != nil {
+		t.Fatalf("CompleteQueue: %v", err)
+	}
+	if got.ID != q.ID || got.Status != models.StatusCompleted {
+		t.Errorf("ticket %d is %s, want %d completed", got.ID, got.Status, q.ID)
+	}
+
+	var visits int
+	if err := d.QueryRow(`SELECT COUNT(*) FROM visits`).Scan(&visits); err != nil {
+		t.Fatalf("failed to count visits: %v", err)
+	}
+	if visits != 0 {
+		t.Errorf("%d visits, want 0", visits)
+	}
+}
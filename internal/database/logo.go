@@ -0,0 +1,42 @@
+package database
+
+import (
+	"fmt"
+
+	"queue-system/internal/models"
+)
+
+// GetTicketLogo returns the logo printed on tickets, or sql.ErrNoRows if
+// none has been uploaded.
+func (d *DB) GetTicketLogo() (*models.TicketLogo, error) {
+	logo := &models.TicketLogo{}
+	err := d.QueryRow(`SELECT width, height, data, updated_at FROM ticket_logo WHERE id = 1`).
+		Scan(&logo.Width, &logo.Height, &logo.Data, &logo.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return logo, nil
+}
+
+// SetTicketLogo replaces the logo printed on tickets.
+func (d *DB) SetTicketLogo(width, height int, data []byte) error {
+	_, err := d.Exec(`
+		INSERT INTO ticket_logo (id, width, height, data, updated_at)
+		VALUES (1, ?, ?, ?, datetime('now', 'localtime'))
+		ON CONFLICT(id) DO UPDATE SET
+			width = excluded.width, height = excluded.height,
+			data = excluded.data, updated_at = excluded.updated_at
+	`, width, height, data)
+	if err != nil {
+		return fmt.Errorf("failed to save ticket logo: %w", err)
+	}
+	return nil
+}
+
+// DeleteTicketLogo removes the logo printed on tickets.
+func (d *DB) DeleteTicketLogo() error {
+	if _, err := d.Exec(`DELETE FROM ticket_logo`); err != nil {
+		return fmt.Errorf("failed to delete ticket logo: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema migrations live in migrations/ as NNNN_name.up.sql and
+// NNNN_name.down.sql. Applied versions are recorded in schema_migrations.
+// Never edit a migration that has shipped; add a new one instead.
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes one known migration and whether it is applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// ErrSchemaTooNew is returned when the database has migrations this binary
+// does not know about, i.e. it was last opened by a newer release.
+type ErrSchemaTooNew struct {
+	Current int
+	Latest  int
+}
+
+func (e *ErrSchemaTooNew) Error() string {
+	return fmt.Sprintf("database schema version %d is newer than this binary supports (%d); upgrade the application", e.Current, e.Latest)
+}
+
+var migrations = mustLoadMigrations()
+
+func mustLoadMigrations() []migration {
+	list, err := loadMigrations(migrationsFS)
+	if err != nil {
+		panic(err)
+	}
+	return list
+}
+
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	files, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, file := range files {
+		base := strings.TrimPrefix(file, "migrations/")
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql suffix", base)
+		}
+
+		stem := strings.TrimSuffix(base, "."+direction+".sql")
+		num, name, ok := strings.Cut(stem, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name prefix", base)
+		}
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	list := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+
+	for i, m := range list {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous from 1; found %d at position %d", m.Version, i+1)
+		}
+	}
+	return list, nil
+}
+
+// LatestSchemaVersion returns the highest migration version built into the
+// binary.
+func LatestSchemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+func (d *DB) ensureMigrationsTable() error {
+	_, err := d.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME NOT NULL DEFAULT (datetime('now','localtime'))
+		)
+	`)
+	return err
+}
+
+// SchemaVersion returns the highest applied migration version.
+func (d *DB) SchemaVersion() (int, error) {
+	if err := d.ensureMigrationsTable(); err != nil {
+		return 0, err
+	}
+	var version int
+	err := d.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// MigrationStatus lists every known migration with its applied state.
+func (d *DB) MigrationStatus() ([]MigrationStatus, error) {
+	if err := d.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		at, ok := applied[m.Version]
+		status = append(status, MigrationStatus{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: at})
+	}
+	return status, nil
+}
+
+// MigrateUp applies every pending migration in order, each in its own
+// transaction, and returns the versions applied. It refuses to run against
+// a database that is newer than the binary.
+func (d *DB) MigrateUp() ([]int, error) {
+	current, err := d.SchemaVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if latest := LatestSchemaVersion(); current > latest {
+		return nil, &ErrSchemaTooNew{Current: current, Latest: latest}
+	}
+
+	var applied []int
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		err := d.inTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("failed to apply migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m.Version)
+	}
+	return applied, nil
+}
+
+// MigrateDown rolls back the given number of most recently applied
+// migrations and returns the versions rolled back.
+func (d *DB) MigrateDown(steps int) ([]int, error) {
+	current, err := d.SchemaVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if latest := LatestSchemaVersion(); current > latest {
+		return nil, &ErrSchemaTooNew{Current: current, Latest: latest}
+	}
+
+	var reverted []int
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := migrations[i]
+		if m.Version > current {
+			continue
+		}
+		if m.Down == "" {
+			return reverted, fmt.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+		err := d.inTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+			return err
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("failed to roll back migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		reverted = append(reverted, m.Version)
+	}
+	return reverted, nil
+}
+
+func (d *DB) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
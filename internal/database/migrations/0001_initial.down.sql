@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS print_jobs;
+DROP TABLE IF EXISTS queue_types;
+DROP TABLE IF EXISTS call_history;
+DROP TABLE IF EXISTS settings;
+DROP TABLE IF EXISTS counters;
+DROP TABLE IF EXISTS queues;
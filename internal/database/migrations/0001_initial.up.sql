@@ -0,0 +1,74 @@
+-- Baseline schema. Uses IF NOT EXISTS so databases created before
+-- versioned migrations are adopted without changes.
+
+CREATE TABLE IF NOT EXISTS queues (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	queue_number TEXT NOT NULL,
+	queue_type TEXT NOT NULL DEFAULT 'general',
+	status TEXT NOT NULL DEFAULT 'waiting',
+	counter_id INTEGER,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	called_at DATETIME,
+	completed_at DATETIME,
+	FOREIGN KEY (counter_id) REFERENCES counters(id)
+);
+
+CREATE TABLE IF NOT EXISTS counters (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	counter_number TEXT NOT NULL UNIQUE,
+	counter_name TEXT NOT NULL,
+	is_active INTEGER NOT NULL DEFAULT 1,
+	current_queue_id INTEGER,
+	last_call_at DATETIME,
+	FOREIGN KEY (current_queue_id) REFERENCES queues(id)
+);
+
+CREATE TABLE IF NOT EXISTS settings (
+	key TEXT PRIMARY KEY,
+	value TEXT NOT NULL,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS call_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	queue_id INTEGER NOT NULL,
+	counter_id INTEGER NOT NULL,
+	action TEXT NOT NULL,
+	timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (queue_id) REFERENCES queues(id),
+	FOREIGN KEY (counter_id) REFERENCES counters(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_queues_status ON queues(status);
+CREATE INDEX IF NOT EXISTS idx_queues_created_at ON queues(created_at);
+CREATE INDEX IF NOT EXISTS idx_call_history_timestamp ON call_history(timestamp);
+
+CREATE TABLE IF NOT EXISTS queue_types (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	code TEXT NOT NULL UNIQUE,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	is_active INTEGER NOT NULL DEFAULT 1,
+	sort_order INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS print_jobs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	queue_number TEXT NOT NULL,
+	type_name TEXT NOT NULL,
+	date_time TEXT NOT NULL,
+	template_json TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	agent_id TEXT,
+	created_at DATETIME DEFAULT (datetime('now','localtime')),
+	claimed_at DATETIME,
+	completed_at DATETIME,
+	error_message TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_print_jobs_status ON print_jobs(status);
+
+INSERT INTO queue_types (code, name, prefix, is_active, sort_order)
+SELECT 'A', 'Umum', 'A', 1, 1
+WHERE NOT EXISTS (SELECT 1 FROM queue_types);
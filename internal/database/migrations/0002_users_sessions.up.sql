@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT NOT NULL UNIQUE,
+	full_name TEXT NOT NULL DEFAULT '',
+	role TEXT NOT NULL,
+	password_hash TEXT NOT NULL,
+	is_active INTEGER NOT NULL DEFAULT 1,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_counters (
+	user_id INTEGER NOT NULL,
+	counter_id INTEGER NOT NULL,
+	PRIMARY KEY (user_id, counter_id),
+	FOREIGN KEY (user_id) REFERENCES users(id),
+	FOREIGN KEY (counter_id) REFERENCES counters(id)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	token_hash TEXT NOT NULL UNIQUE,
+	user_id INTEGER NOT NULL DEFAULT 0,
+	username TEXT NOT NULL,
+	role TEXT NOT NULL,
+	counter_id INTEGER NOT NULL DEFAULT 0,
+	ip TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	last_seen_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
@@ -0,0 +1,2 @@
+ALTER TABLE queues DROP COLUMN reset_at;
+DROP TABLE IF EXISTS audit_log;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp DATETIME NOT NULL DEFAULT (datetime('now','localtime')),
+	actor_id INTEGER NOT NULL DEFAULT 0,
+	actor TEXT NOT NULL,
+	actor_role TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL,
+	target_type TEXT NOT NULL DEFAULT '',
+	target_id TEXT NOT NULL DEFAULT '',
+	before_json TEXT,
+	after_json TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_timestamp ON audit_log(timestamp);
+CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log(action);
+
+-- audit_log is append-only
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+-- Queue resets cancel and stamp today's tickets instead of deleting them,
+-- so the audit log and call_history keep pointing at existing rows
+ALTER TABLE queues ADD COLUMN reset_at DATETIME;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_queues_waiting;
+
+ALTER TABLE print_jobs DROP COLUMN priority;
+ALTER TABLE queues DROP COLUMN priority;
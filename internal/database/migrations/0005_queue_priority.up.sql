@@ -0,0 +1,4 @@
+ALTER TABLE queues ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE print_jobs ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_queues_waiting ON queues(status, priority, created_at);
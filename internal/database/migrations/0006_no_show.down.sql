@@ -0,0 +1,4 @@
+UPDATE queues SET status = 'cancelled' WHERE status = 'no_show';
+
+ALTER TABLE queues DROP COLUMN requeue_after;
+ALTER TABLE queues DROP COLUMN skip_count;
@@ -0,0 +1,2 @@
+ALTER TABLE queues ADD COLUMN skip_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE queues ADD COLUMN requeue_after INTEGER;
@@ -0,0 +1 @@
+ALTER TABLE queues ADD COLUMN target_counter_id INTEGER;
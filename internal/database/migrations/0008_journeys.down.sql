@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS visit_steps;
+DROP TABLE IF EXISTS visits;
+DROP TABLE IF EXISTS journey_steps;
@@ -0,0 +1,38 @@
+-- Multi-step service journeys. journey_steps declares the steps of a queue
+-- type; visits and visit_steps track a ticket through those steps.
+
+CREATE TABLE IF NOT EXISTS journey_steps (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	queue_type TEXT NOT NULL,
+	step_no INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	step_type TEXT NOT NULL,
+	UNIQUE (queue_type, step_no)
+);
+
+CREATE TABLE IF NOT EXISTS visits (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	queue_id INTEGER NOT NULL UNIQUE,
+	journey_type TEXT NOT NULL,
+	current_step INTEGER NOT NULL DEFAULT 1,
+	created_at DATETIME NOT NULL,
+	completed_at DATETIME,
+	FOREIGN KEY (queue_id) REFERENCES queues(id)
+);
+
+CREATE TABLE IF NOT EXISTS visit_steps (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	visit_id INTEGER NOT NULL,
+	step_no INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	queue_type TEXT NOT NULL,
+	counter_id INTEGER,
+	enqueued_at DATETIME NOT NULL,
+	called_at DATETIME,
+	completed_at DATETIME,
+	UNIQUE (visit_id, step_no),
+	FOREIGN KEY (visit_id) REFERENCES visits(id),
+	FOREIGN KEY (counter_id) REFERENCES counters(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_visit_steps_enqueued ON visit_steps(enqueued_at);
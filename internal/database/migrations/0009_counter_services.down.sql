@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS counter_queue_types;
+
+ALTER TABLE counters DROP COLUMN routing_mode;
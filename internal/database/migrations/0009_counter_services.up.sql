@@ -0,0 +1,14 @@
+-- Queue types served by each counter. With no rows a counter serves every
+-- type; otherwise call-next without a type is routed among these.
+
+ALTER TABLE counters ADD COLUMN routing_mode TEXT NOT NULL DEFAULT 'strict';
+
+CREATE TABLE IF NOT EXISTS counter_queue_types (
+	counter_id INTEGER NOT NULL,
+	queue_type TEXT NOT NULL,
+	sort_order INTEGER NOT NULL,
+	weight INTEGER NOT NULL DEFAULT 1,
+	current_weight INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (counter_id, queue_type),
+	FOREIGN KEY (counter_id) REFERENCES counters(id)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE print_jobs DROP COLUMN estimated_wait;
+ALTER TABLE print_jobs DROP COLUMN position;
@@ -0,0 +1,2 @@
+ALTER TABLE print_jobs ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE print_jobs ADD COLUMN estimated_wait INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+ALTER TABLE print_jobs DROP COLUMN status_url;
+
+DROP INDEX IF EXISTS idx_queues_token;
+ALTER TABLE queues DROP COLUMN token;
@@ -0,0 +1,5 @@
+-- Unguessable token identifying a ticket on the public status page
+ALTER TABLE queues ADD COLUMN token TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_queues_token ON queues(token);
+
+ALTER TABLE print_jobs ADD COLUMN status_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- Logo printed on tickets as a dithered 1-bit raster; at most one row
+CREATE TABLE IF NOT EXISTS ticket_logo (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	data BLOB NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
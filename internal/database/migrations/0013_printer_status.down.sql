@@ -0,0 +1 @@
+DROP TABLE IF EXISTS printer_status;
@@ -0,0 +1,11 @@
+-- Last hardware status reported by each print agent's printer
+CREATE TABLE IF NOT EXISTS printer_status (
+	agent_id TEXT PRIMARY KEY,
+	printer TEXT NOT NULL DEFAULT '',
+	online INTEGER NOT NULL DEFAULT 0,
+	paper_near_end INTEGER NOT NULL DEFAULT 0,
+	paper_out INTEGER NOT NULL DEFAULT 0,
+	cover_open INTEGER NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	reported_at DATETIME NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE print_jobs DROP COLUMN counter;
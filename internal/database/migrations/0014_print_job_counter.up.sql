@@ -0,0 +1,2 @@
+-- Counters serving the ticket's queue type, printed by ticket layouts
+ALTER TABLE print_jobs ADD COLUMN counter TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+UPDATE print_jobs SET status = 'failed' WHERE status = 'dead';
+
+ALTER TABLE print_jobs DROP COLUMN next_attempt_at;
+ALTER TABLE print_jobs DROP COLUMN lease_expires_at;
+ALTER TABLE print_jobs DROP COLUMN attempts;
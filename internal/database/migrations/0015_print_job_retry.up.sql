@@ -0,0 +1,9 @@
+-- Claim leases and retries. A claimed job belongs to its agent until
+-- lease_expires_at; a failed attempt waits until next_attempt_at. Jobs that
+-- use up their attempts are dead-lettered ('dead') until an admin reissues
+-- them, so failures recorded before retries existed move there too.
+ALTER TABLE print_jobs ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE print_jobs ADD COLUMN lease_expires_at DATETIME;
+ALTER TABLE print_jobs ADD COLUMN next_attempt_at DATETIME;
+
+UPDATE print_jobs SET status = 'dead' WHERE status = 'failed';
@@ -0,0 +1,2 @@
+ALTER TABLE api_tokens DROP COLUMN print_group;
+ALTER TABLE print_jobs DROP COLUMN target;
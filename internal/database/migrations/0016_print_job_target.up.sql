@@ -0,0 +1,6 @@
+-- Print agent ID or printer group a job is routed to; empty = any agent
+ALTER TABLE print_jobs ADD COLUMN target TEXT NOT NULL DEFAULT '';
+
+-- The printer group a print-agent token's agent belongs to. It is set by an
+-- admin with the token, so an agent cannot name another group's jobs.
+ALTER TABLE api_tokens ADD COLUMN print_group TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+-- Print agents known to the server, kept up to date by their heartbeats
+CREATE TABLE IF NOT EXISTS print_agents (
+	id TEXT PRIMARY KEY,
+	agent_group TEXT NOT NULL DEFAULT '',
+	hostname TEXT NOT NULL DEFAULT '',
+	version TEXT NOT NULL DEFAULT '',
+	printer TEXT NOT NULL DEFAULT '',
+	backend TEXT NOT NULL DEFAULT '',
+	jobs_printed INTEGER NOT NULL DEFAULT 0,
+	jobs_failed INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	first_seen_at DATETIME NOT NULL,
+	last_heartbeat_at DATETIME
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_number_blocks_prefix_day;
+DROP TABLE IF EXISTS number_blocks;
@@ -0,0 +1,14 @@
+-- Ranges of a day's ticket numbers leased to print agents, which hand them
+-- out while they cannot reach the server
+CREATE TABLE IF NOT EXISTS number_blocks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	agent_id TEXT NOT NULL,
+	queue_type TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	day TEXT NOT NULL,
+	first_number INTEGER NOT NULL,
+	last_number INTEGER NOT NULL,
+	created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_number_blocks_prefix_day ON number_blocks(prefix, day);
@@ -0,0 +1,6 @@
+-- Settings managed on the server for each print agent, as JSON
+CREATE TABLE IF NOT EXISTS print_agent_configs (
+	agent_id TEXT PRIMARY KEY,
+	config_json TEXT NOT NULL DEFAULT '{}',
+	updated_at DATETIME NOT NULL
+);
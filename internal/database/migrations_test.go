@@ -0,0 +1,161 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrateUpDown(t *testing.T) {
+	d := openTestDB(t)
+	latest := LatestSchemaVersion()
+
+	applied, err := d.MigrateUp()
+	if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	if len(applied) != latest {
+		t.Fatalf("MigrateUp applied %d migrations, want %d", len(applied), latest)
+	}
+
+	steps := []struct {
+		name        string
+		run         func() ([]int, error)
+		wantVersion int
+		wantCount   int
+	}{
+		{"up is idempotent", d.MigrateUp, latest, 0},
+		{"down one", func() ([]int, error) { return d.MigrateDown(1) }, latest - 1, 1},
+		{"up again", d.MigrateUp, latest, 1},
+		{"down all", func() ([]int, error) { return d.MigrateDown(latest) }, 0, latest},
+		{"down past zero", func() ([]int, error) { return d.MigrateDown(1) }, 0, 0},
+		{"up from scratch", d.MigrateUp, latest, latest},
+	}
+	for _, step := range steps {
+		versions, err := step.run()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if len(versions) != step.wantCount {
+			t.Errorf("%s: %d migrations run, want %d", step.name, len(versions), step.wantCount)
+		}
+		version, err := d.SchemaVersion()
+		if err != nil {
+			t.Fatalf("%s: SchemaVersion: %v", step.name, err)
+		}
+		if version != step.wantVersion {
+			t.Errorf("%s: schema version %d, want %d", step.name, version, step.wantVersion)
+		}
+	}
+}
+
+func TestMigrateDownOrder(t *testing.T) {
+	d := openTestDB(t)
+	if _, err := d.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+
+	latest := LatestSchemaVersion()
+	reverted, err := d.MigrateDown(3)
+	if err != nil {
+		t.Fatalf("MigrateDown: %v", err)
+	}
+	want := []int{latest, latest - 1, latest - 2}
+	if len(reverted) != len(want) {
+		t.Fatalf("MigrateDown reverted %v, want %v", reverted, want)
+	}
+	for i := range want {
+		if reverted[i] != want[i] {
+			t.Errorf("MigrateDown reverted %v, want %v", reverted, want)
+			break
+		}
+	}
+}
+
+func TestSchemaTooNew(t *testing.T) {
+	d := openTestDB(t)
+	if _, err := d.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	latest := LatestSchemaVersion()
+	mustExec(t, d, `INSERT INTO schema_migrations (version, name) VALUES (?, 'from_the_future')`, latest+1)
+
+	tests := []struct {
+		name string
+		run  func() ([]int, error)
+	}{
+		{"up", d.MigrateUp},
+		{"down", func() ([]int, error) { return d.MigrateDown(1) }},
+	}
+	for _, tt := range tests {
+		_, err := tt.run()
+		tooNew, ok := err.(*ErrSchemaTooNew)
+		if !ok {
+			t.Errorf("%s: error = %v, want *ErrSchemaTooNew", tt.name, err)
+			continue
+		}
+		if tooNew.Current != latest+1 || tooNew.Latest != latest {
+			t.Errorf("%s: ErrSchemaTooNew{%d, %d}, want {%d, %d}", tt.name, tooNew.Current, tooNew.Latest, latest+1, latest)
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    int
+		wantErr string
+	}{
+		{"valid", fstest.MapFS{
+			"migrations/0001_init.up.sql":   file("CREATE TABLE a (id INTEGER);"),
+			"migrations/0001_init.down.sql": file("DROP TABLE a;"),
+			"migrations/0002_more.up.sql":   file("CREATE TABLE b (id INTEGER);"),
+			"migrations/0002_more.down.sql": file("DROP TABLE b;"),
+		}, 2, ""},
+		{"bad suffix", fstest.MapFS{
+			"migrations/0001_init.sql": file("SELECT 1;"),
+		}, 0, "expected .up.sql or .down.sql"},
+		{"bad prefix", fstest.MapFS{
+			"migrations/init.up.sql": file("SELECT 1;"),
+		}, 0, "expected NNNN_name prefix"},
+		{"missing up", fstest.MapFS{
+			"migrations/0001_init.down.sql": file("SELECT 1;"),
+		}, 0, "has no up script"},
+		{"conflicting names", fstest.MapFS{
+			"migrations/0001_init.up.sql":    file("SELECT 1;"),
+			"migrations/0001_other.down.sql": file("SELECT 1;"),
+		}, 0, "conflicting names"},
+		{"gap", fstest.MapFS{
+			"migrations/0001_init.up.sql": file("SELECT 1;"),
+			"migrations/0003_more.up.sql": file("SELECT 1;"),
+		}, 0, "contiguous"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := loadMigrations(tt.files)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadMigrations: %v", err)
+			}
+			if len(list) != tt.want {
+				t.Errorf("loaded %d migrations, want %d", len(list), tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrationsHaveDownScripts(t *testing.T) {
+	for _, m := range migrations {
+		if strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+	}
+}
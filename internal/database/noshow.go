@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"queue-system/internal/models"
+)
+
+// No-show handling. A called visitor who does not turn up is skipped: the
+// ticket is parked with status no_show instead of being cancelled, and can be
+// returned to the waiting queue while it still has grace recalls left.
+
+var (
+	// ErrQueueNotParked is returned when returning a ticket that is not a
+	// no-show from today.
+	ErrQueueNotParked = errors.New("queue is not a no-show from today")
+	// ErrNoGraceRecalls is returned when a ticket has been skipped more
+	// often than the configured number of grace recalls.
+	ErrNoGraceRecalls = errors.New("no grace recalls left")
+)
+
+// SkipQueue parks the ticket currently called at counterID as a no-show and
+// frees the counter. Returns sql.ErrNoRows if the counter has no current
+// queue.
+func (d *DB) SkipQueue(counterID int64) (*models.Queue, error) {
+	tx, err := d.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var queueID sql.NullInt64
+	if err := tx.QueryRow(`SELECT current_queue_id FROM counters WHERE id = ?`, counterID).Scan(&queueID); err != nil {
+		return nil, err
+	}
+	if !queueID.Valid {
+		return nil, sql.ErrNoRows
+	}
+
+	result, err := tx.Exec(`
+		UPDATE queues SET status = 'no_show', skip_count = skip_count + 1, requeue_after = NULL
+		WHERE id = ? AND status = 'called'
+	`, queueID.Int64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to park queue: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(`UPDATE counters SET current_queue_id = NULL WHERE id = ?`, counterID); err != nil {
+		return nil, fmt.Errorf("failed to reset counter: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO call_history (queue_id, counter_id, action, timestamp)
+		VALUES (?, ?, ?, datetime('now', 'localtime'))
+	`, queueID.Int64, counterID, models.ActionSkipped); err != nil {
+		return nil, fmt.Errorf("failed to record history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return d.GetQueue(queueID.Int64)
+}
+
+// ReturnQueue puts a parked no-show ticket back into the waiting queue.
+// after is the number of other tickets of the same type to call before it;
+// 0 places it at the head of the queue.
+func (d *DB) ReturnQueue(queueID, counterID int64, after int) (*models.Queue, error) {
+	tx, err := d.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var skipCount int
+	err = tx.QueryRow(`
+		SELECT skip_count FROM queues
+		WHERE id = ? AND status = 'no_show'
+		AND DATE(created_at) = DATE('now', 'localtime')
+	`, queueID).Scan(&skipCount)
+	if err == sql.ErrNoRows {
+		return nil, ErrQueueNotParked
+	} else if err != nil {
+		return nil, err
+	}
+	if skipCount > d.config.Queue.NoShowGraceRecalls {
+		return nil, ErrNoGraceRecalls
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE queues SET status = 'waiting', counter_id = NULL, requeue_after = ?
+		WHERE id = ?
+	`, after, queueID); err != nil {
+		return nil, fmt.Errorf("failed to return queue: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO call_history (queue_id, counter_id, action, timestamp)
+		VALUES (?, ?, ?, datetime('now', 'localtime'))
+	`, queueID, counterID, models.ActionReturned); err != nil {
+		return nil, fmt.Errorf("failed to record history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return d.GetQueue(queueID)
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+
+	"queue-system/internal/models"
+)
+
+func TestSkipAndReturnQueue(t *testing.T) {
+	tests := []struct {
+		name   string
+		grace  int
+		skips  int // times the ticket is skipped and returned before the last skip
+		wantOK bool
+	}{
+		{"no grace recalls", 0, 0, false},
+		{"first skip with one grace recall", 1, 0, true},
+		{"second skip with one grace recall", 1, 1, false},
+		{"second skip with two grace recalls", 2, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDB(t)
+			d.config.Queue.NoShowGraceRecalls = tt.grace
+			counter := mustCreateCounter(t, d, "1")
+			addTickets(t, d, []ticket{{number: "A001", ageSeconds: 10}})
+
+			var q *models.Queue
+			for i := 0; i <= tt.skips; i++ {
+				called, err := d.CallNextQueue(counter.ID, "")
+				if err != nil {
+					t.Fatalf("CallNextQueue: %v", err)
+				}
+				q, err = d.SkipQueue(counter.ID)
+				if err != nil {
+					t.Fatalf("SkipQueue: %v", err)
+				}
+				if q.ID != called.ID || q.Status != models.StatusNoShow {
+					t.Fatalf("skipped %s with status %s, want %s no_show", q.QueueNumber, q.Status, called.QueueNumber)
+				}
+				if i < tt.skips {
+					if _, err := d.ReturnQueue(q.ID, counter.ID, 0); err != nil {
+						t.Fatalf("ReturnQueue: %v", err)
+					}
+				}
+			}
+
+			c, err := d.GetCounter(counter.ID)
+			if err != nil {
+				t.Fatalf("GetCounter: %v", err)
+			}
+			if c.CurrentQueueID.Valid {
+				t.Errorf("counter still serving ticket %d after skip", c.CurrentQueueID.Int64)
+			}
+
+			returned, err := d.ReturnQueue(q.ID, counter.ID, 0)
+			if !tt.wantOK {
+				if err != ErrNoGraceRecalls {
+					t.Errorf("ReturnQueue error = %v, want ErrNoGraceRecalls", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReturnQueue: %v", err)
+			}
+			if returned.Status != models.StatusWaiting {
+				t.Errorf("returned ticket has status %s, want waiting", returned.Status)
+			}
+		})
+	}
+}
+
+func TestSkipAndReturnErrors(t *testing.T) {
+	d := newTestDB(t)
+	d.config.Queue.NoShowGraceRecalls = 1
+	counter := mustCreateCounter(t, d, "1")
+	addTickets(t, d, []ticket{{number: "A001", ageSeconds: 10}})
+
+	if _, err := d.SkipQueue(counter.ID); err != sql.ErrNoRows {
+		t.Errorf("SkipQueue on an idle counter: error = %v, want sql.ErrNoRows", err)
+	}
+
+	waiting, err := d.GetQueueByNumber("A001")
+	if err != nil {
+		t.Fatalf("GetQueueByNumber: %v", err)
+	}
+	if _, err := d.ReturnQueue(waiting.ID, counter.ID, 0); err != ErrQueueNotParked {
+		t.Errorf("ReturnQueue on a waiting ticket: error = %v, want ErrQueueNotParked", err)
+	}
+
+	mustExec(t, d, `
+		INSERT INTO queues (queue_number, queue_type, status, created_at)
+		VALUES ('A000', 'A', 'no_show', datetime('now', 'localtime', '-1 day'))
+	`)
+	old, err := d.GetQueueByNumber("A000")
+	if err != nil {
+		t.Fatalf("GetQueueByNumber: %v", err)
+	}
+	if _, err := d.ReturnQueue(old.ID, counter.ID, 0); err != ErrQueueNotParked {
+		t.Errorf("ReturnQueue on yesterday's no-show: error = %v, want ErrQueueNotParked", err)
+	}
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+var (
+	// ErrNumberNotLeased is returned when an offline ticket's number is not
+	// in a block leased to the agent that issued it.
+	ErrNumberNotLeased = errors.New("ticket number is not in a block leased to this agent")
+	// ErrTicketExists is returned when an offline ticket was synced before.
+	ErrTicketExists = errors.New("ticket already exists")
+	// ErrTicketExpired is returned when an offline ticket is synced after
+	// the day it was issued on, when its queue is over.
+	ErrTicketExpired = errors.New("ticket was issued on a day that is over")
+)
+
+// offlinePrefix returns what is appended to a queue type's prefix to number
+// the tickets issued offline, keeping them apart from the ones the server
+// numbers itself.
+func (d *DB) offlinePrefix() string {
+	if d.config.Printer.OfflinePrefix != "" {
+		return d.config.Printer.OfflinePrefix
+	}
+	return "X"
+}
+
+// LeaseNumberBlock reserves the next size offline numbers of today for a
+// queue type and leases them to a print agent. Offline numbers have their
+// own prefix, so leasing a block leaves no gap in the server's numbering.
+func (d *DB) LeaseNumberBlock(agentID, queueTypeCode string, size int) (*models.NumberBlock, error) {
+	tx, err := d.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	b := &models.NumberBlock{AgentID: agentID, QueueType: queueTypeCode}
+	err = tx.QueryRow(`SELECT name, prefix FROM queue_types WHERE code = ?`, queueTypeCode).Scan(&b.TypeName, &b.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	if b.Prefix == "" {
+		b.Prefix = d.config.Queue.Prefix
+	}
+	b.Prefix += d.offlinePrefix()
+
+	b.FirstNumber = d.lastTicketNumberTx(tx, b.Prefix) + 1
+	b.LastNumber = b.FirstNumber + size - 1
+	result, err := tx.Exec(`
+		INSERT INTO number_blocks (agent_id, queue_type, prefix, day, first_number, last_number, created_at)
+		VALUES (?, ?, ?, DATE('now', 'localtime'), ?, ?, datetime('now', 'localtime'))
+	`, agentID, queueTypeCode, b.Prefix, b.FirstNumber, b.LastNumber)
+	if err != nil {
+		return nil, err
+	}
+	b.ID, _ = result.LastInsertId()
+
+	err = tx.QueryRow(`SELECT day, created_at FROM number_blocks WHERE id = ?`, b.ID).Scan(&b.Day, &b.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// CreateOfflineTicket adds a ticket a print agent issued while offline to
+// the queue, as if it had been taken when it was issued. The number must
+// come from a block leased to the agent on the day it was issued, and that
+// day must be today: a ticket synced after midnight would only land in a
+// queue that is already over.
+func (d *DB) CreateOfflineTicket(agentID string, t *models.OfflineTicket) (*models.Queue, error) {
+	tx, err := d.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var queueType, prefix, day string
+	var first, last int
+	err = tx.QueryRow(`
+		SELECT queue_type, prefix, day, first_number, last_number
+		FROM number_blocks WHERE id = ? AND agent_id = ?
+	`, t.BlockID, agentID).Scan(&queueType, &prefix, &day, &first, &last)
+	if err == sql.ErrNoRows {
+		return nil, ErrNumberNotLeased
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	issuedAt := t.IssuedAt.In(time.Local)
+	n, err := strconv.Atoi(strings.TrimPrefix(t.QueueNumber, prefix))
+	if err != nil || !strings.HasPrefix(t.QueueNumber, prefix) || n < first || n > last ||
+		t.QueueType != queueType || issuedAt.Format("2006-01-02") != day {
+		return nil, ErrNumberNotLeased
+	}
+	if day != time.Now().Format("2006-01-02") {
+		return nil, ErrTicketExpired
+	}
+
+	var exists int
+	tx.QueryRow(`
+		SELECT COUNT(*) FROM queues WHERE queue_number = ? AND DATE(created_at) = ? AND reset_at IS NULL
+	`, t.QueueNumber, day).Scan(&exists)
+	if exists > 0 {
+		return nil, ErrTicketExists
+	}
+
+	token, err := newTicketToken()
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec(`
+		INSERT INTO queues (queue_number, queue_type, status, priority, token, created_at)
+		VALUES (?, ?, 'waiting', ?, ?, ?)
+	`, t.QueueNumber, queueType, t.Priority, token, issuedAt.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+
+	if err := startVisitTx(tx, id, queueType); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return d.GetQueue(id)
+}
+
+// resetNumberBlocksTx drops today's number blocks of a queue type (all
+// types if empty), so numbering restarts after a reset. Tickets agents
+// still hold from them are rejected when synced.
+func resetNumberBlocksTx(tx *sql.Tx, queueType string) error {
+	query := `DELETE FROM number_blocks WHERE day = DATE('now', 'localtime')`
+	args := []interface{}{}
+	if queueType != "" {
+		query += " AND queue_type = ?"
+		args = append(args, queueType)
+	}
+	_, err := tx.Exec(query, args...)
+	return err
+}
+
+// CleanupOldNumberBlocks removes number blocks older than the given days.
+// They are kept a while after their day, so tickets an agent issued from
+// them before going offline overnight are answered as expired.
+func (d *DB) CleanupOldNumberBlocks(days int) (int64, error) {
+	result, err := d.Exec(`
+		DELETE FROM number_blocks WHERE day < DATE('now', 'localtime', ? || ' days')
+	`, fmt.Sprintf("-%d", days))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+func mustLeaseNumberBlock(t *testing.T, d *DB, agentID, queueType string, size int) *models.NumberBlock {
+	t.Helper()
+	b, err := d.LeaseNumberBlock(agentID, queueType, size)
+	if err != nil {
+		t.Fatalf("LeaseNumberBlock: %v", err)
+	}
+	return b
+}
+
+func TestLeaseNumberBlock(t *testing.T) {
+	d := newTestDB(t)
+	if _, err := d.CreateQueueType("B", "Teller", "B"); err != nil {
+		t.Fatalf("CreateQueueType: %v", err)
+	}
+
+	tests := []struct {
+		agent      string
+		queueType  string
+		size       int
+		wantPrefix string
+		wantFirst  int
+		wantLast   int
+	}{
+		{"printer-1", "A", 10, "AX", 1, 10},
+		{"printer-1", "A", 10, "AX", 11, 20},
+		{"printer-2", "A", 5, "AX", 21, 25},
+		{"printer-2", "B", 5, "BX", 1, 5},
+	}
+	for _, tt := range tests {
+		b := mustLeaseNumberBlock(t, d, tt.agent, tt.queueType, tt.size)
+		if b.Prefix != tt.wantPrefix || b.FirstNumber != tt.wantFirst || b.LastNumber != tt.wantLast {
+			t.Errorf("block for %s/%s = %s %d-%d, want %s %d-%d", tt.agent, tt.queueType,
+				b.Prefix, b.FirstNumber, b.LastNumber, tt.wantPrefix, tt.wantFirst, tt.wantLast)
+		}
+		if b.Day != time.Now().Format("2006-01-02") {
+			t.Errorf("block day %s, want today", b.Day)
+		}
+	}
+
+	// Leasing blocks leaves no gap in the numbers the server gives out
+	q, err := d.CreateQueue("A", models.PriorityNormal)
+	if err != nil {
+		t.Fatalf("CreateQueue: %v", err)
+	}
+	if q.QueueNumber != "A001" {
+		t.Errorf("online ticket %s, want A001", q.QueueNumber)
+	}
+}
+
+func TestCreateOfflineTicket(t *testing.T) {
+	d := newTestDB(t)
+	b := mustLeaseNumberBlock(t, d, "printer-1", "A", 10)
+	now := time.Now()
+	offline := func(number string, issuedAt time.Time) *models.OfflineTicket {
+		return &models.OfflineTicket{QueueNumber: number, QueueType: "A", IssuedAt: issuedAt, BlockID: b.ID}
+	}
+
+	tests := []struct {
+		name    string
+		agent   string
+		ticket  *models.OfflineTicket
+		wantErr error
+	}{
+		{"first number", "printer-1", offline("AX001", now.Add(-time.Minute)), nil},
+		{"last number", "printer-1", offline("AX010", now), nil},
+		{"synced twice", "printer-1", offline("AX001", now.Add(-time.Minute)), ErrTicketExists},
+		{"outside the block", "printer-1", offline("AX011", now), ErrNumberNotLeased},
+		{"online prefix", "printer-1", offline("A002", now), ErrNumberNotLeased},
+		{"other agent's block", "printer-2", offline("AX002", now), ErrNumberNotLeased},
+		{"unknown block", "printer-1", &models.OfflineTicket{QueueNumber: "AX002", QueueType: "A", IssuedAt: now, BlockID: b.ID + 1}, ErrNumberNotLeased},
+		{"other queue type", "printer-1", &models.OfflineTicket{QueueNumber: "AX002", QueueType: "B", IssuedAt: now, BlockID: b.ID}, ErrNumberNotLeased},
+		{"issued on another day", "printer-1", offline("AX002", now.AddDate(0, 0, -1)), ErrNumberNotLeased},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := d.CreateOfflineTicket(tt.agent, tt.ticket)
+			if err != tt.wantErr {
+				t.Fatalf("CreateOfflineTicket error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if q.QueueNumber != tt.ticket.QueueNumber || q.Status != models.StatusWaiting || q.Token == "" {
+				t.Errorf("ticket %s is %s with token %q, want %s waiting with a token", q.QueueNumber, q.Status, q.Token, tt.ticket.QueueNumber)
+			}
+			if got, want := q.CreatedAt.Format(time.DateTime), tt.ticket.IssuedAt.Format(time.DateTime); got != want {
+				t.Errorf("ticket created at %s, want %s", got, want)
+			}
+		})
+	}
+
+	// Offline tickets keep their place in line by the time they were issued
+	counter := mustCreateCounter(t, d, "1")
+	if _, err := d.CreateQueue("A", models.PriorityNormal); err != nil {
+		t.Fatalf("CreateQueue: %v", err)
+	}
+	var order []string
+	for range 3 {
+		q, err := d.CallNextQueue(counter.ID, "A")
+		if err != nil {
+			t.Fatalf("CallNextQueue: %v", err)
+		}
+		order = append(order, q.QueueNumber)
+	}
+	if order[0] != "AX001" {
+		t.Errorf("called %v, want AX001 first", order)
+	}
+}
+
+func TestResetQueuesTodayNumbering(t *testing.T) {
+	d := newTestDB(t)
+	old := mustLeaseNumberBlock(t, d, "printer-1", "A", 10)
+	for range 2 {
+		if _, err := d.CreateQueue("A", models.PriorityNormal); err != nil {
+			t.Fatalf("CreateQueue: %v", err)
+		}
+	}
+
+	if _, err := d.ResetQueuesToday("A"); err != nil {
+		t.Fatalf("ResetQueuesToday: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  func() (string, error)
+		want string
+	}{
+		{"online numbering restarts", func() (string, error) {
+			q, err := d.CreateQueue("A", models.PriorityNormal)
+			if err != nil {
+				return "", err
+			}
+			return q.QueueNumber, nil
+		}, "A001"},
+		{"offline numbering restarts", func() (string, error) {
+			b, err := d.LeaseNumberBlock("printer-1", "A", 10)
+			if err != nil {
+				return "", err
+			}
+			return models.FormatQueueNumber(b.Prefix, b.FirstNumber), nil
+		}, "AX001"},
+	}
+	for _, tt := range tests {
+		got, err := tt.got()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// Tickets issued from a block dropped by the reset are rejected
+	_, err := d.CreateOfflineTicket("printer-1", &models.OfflineTicket{
+		QueueNumber: "AX003", QueueType: "A", IssuedAt: time.Now(), BlockID: old.ID,
+	})
+	if err != ErrNumberNotLeased {
+		t.Errorf("CreateOfflineTicket from a reset block: error = %v, want ErrNumberNotLeased", err)
+	}
+
+	// The tickets taken before the reset are kept, cancelled
+	var cancelled int
+	if err := d.QueryRow(`SELECT COUNT(*) FROM queues WHERE status = 'cancelled' AND reset_at IS NOT NULL`).Scan(&cancelled); err != nil {
+		t.Fatalf("failed to count tickets: %v", err)
+	}
+	if cancelled != 2 {
+		t.Errorf("%d cancelled tickets, want 2", cancelled)
+	}
+}
+
+func TestCreateOfflineTicketAfterMidnight(t *testing.T) {
+	d := newTestDB(t)
+	b := mustLeaseNumberBlock(t, d, "printer-1", "A", 10)
+
+	// The block was leased yesterday and a ticket issued from it at 23:58,
+	// but the agent only reached the server again after midnight
+	yesterday := time.Now().AddDate(0, 0, -1)
+	mustExec(t, d, `UPDATE number_blocks SET day = ? WHERE id = ?`, yesterday.Format("2006-01-02"), b.ID)
+	issuedAt := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 23, 58, 0, 0, time.Local)
+
+	_, err := d.CreateOfflineTicket("printer-1", &models.OfflineTicket{
+		QueueNumber: "AX001", QueueType: "A", IssuedAt: issuedAt, BlockID: b.ID,
+	})
+	if err != ErrTicketExpired {
+		t.Fatalf("CreateOfflineTicket after midnight: error = %v, want ErrTicketExpired", err)
+	}
+	var n int
+	if err := d.QueryRow(`SELECT COUNT(*) FROM queues`).Scan(&n); err != nil {
+		t.Fatalf("failed to count tickets: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("%d tickets added, want none", n)
+	}
+}
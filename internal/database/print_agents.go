@@ -0,0 +1,135 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+// RecordPrintAgentHeartbeat registers a print agent or updates what it
+// reports about itself.
+func (d *DB) RecordPrintAgentHeartbeat(a *models.PrintAgent) error {
+	_, err := d.Exec(`
+		INSERT INTO print_agents (id, agent_group, hostname, version, printer, backend, first_seen_at, last_heartbeat_at)
+		VALUES (?, ?, ?, ?, ?, ?, datetime('now', 'localtime'), datetime('now', 'localtime'))
+		ON CONFLICT(id) DO UPDATE SET
+			agent_group = excluded.agent_group, hostname = excluded.hostname,
+			version = excluded.version, printer = excluded.printer, backend = excluded.backend,
+			last_heartbeat_at = excluded.last_heartbeat_at
+	`, a.ID, a.Group, a.Hostname, a.Version, a.Printer, a.Backend)
+	if err != nil {
+		return fmt.Errorf("failed to save print agent heartbeat: %w", err)
+	}
+	return nil
+}
+
+// RecordPrintAgentJob counts a job an agent printed, or failed to print
+// with errorMessage. Agents that never sent a heartbeat are registered.
+func (d *DB) RecordPrintAgentJob(agentID string, printed bool, errorMessage string) error {
+	printedN, failedN := 1, 0
+	if !printed {
+		printedN, failedN = 0, 1
+	}
+	_, err := d.Exec(`
+		INSERT INTO print_agents (id, jobs_printed, jobs_failed, last_error, first_seen_at)
+		VALUES (?1, ?2, ?3, ?4, datetime('now', 'localtime'))
+		ON CONFLICT(id) DO UPDATE SET
+			jobs_printed = jobs_printed + ?2, jobs_failed = jobs_failed + ?3,
+			last_error = CASE WHEN ?3 > 0 THEN ?4 ELSE last_error END
+	`, agentID, printedN, failedN, errorMessage)
+	return err
+}
+
+// ListPrintAgents returns the registered print agents. An agent whose last
+// heartbeat is older than staleAfter is stale, older than offlineAfter
+// offline.
+func (d *DB) ListPrintAgents(staleAfter, offlineAfter time.Duration) ([]*models.PrintAgent, error) {
+	rows, err := d.Query(`
+		SELECT id, agent_group, hostname, version, printer, backend, jobs_printed, jobs_failed,
+			last_error, first_seen_at, last_heartbeat_at,
+			CASE
+				WHEN last_heartbeat_at >= datetime('now', 'localtime', ?) THEN 'online'
+				WHEN last_heartbeat_at >= datetime('now', 'localtime', ?) THEN 'stale'
+				ELSE 'offline'
+			END
+		FROM print_agents ORDER BY id
+	`, fmt.Sprintf("-%d seconds", int(staleAfter.Seconds())), fmt.Sprintf("-%d seconds", int(offlineAfter.Seconds())))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var agents []*models.PrintAgent
+	for rows.Next() {
+		a := &models.PrintAgent{}
+		if err := rows.Scan(&a.ID, &a.Group, &a.Hostname, &a.Version, &a.Printer, &a.Backend,
+			&a.JobsPrinted, &a.JobsFailed, &a.LastError, &a.FirstSeenAt, &a.LastHeartbeatAt, &a.State); err != nil {
+			return nil, err
+		}
+		a.PrepareJSON()
+		agents = append(agents, a)
+	}
+	return agents, rows.Err()
+}
+
+// DeletePrintAgent removes an agent and its settings from the registry,
+// e.g. one that was decommissioned. It reappears if it sends another
+// heartbeat.
+func (d *DB) DeletePrintAgent(id string) (bool, error) {
+	result, err := d.Exec(`DELETE FROM print_agents WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if _, err := d.Exec(`DELETE FROM print_agent_configs WHERE agent_id = ?`, id); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// GetPrintAgentConfig returns the settings managed on the server for an
+// agent, empty if there are none.
+func (d *DB) GetPrintAgentConfig(agentID string) (*models.PrintAgentConfig, error) {
+	var configJSON string
+	var updatedAt time.Time
+	err := d.QueryRow(`
+		SELECT config_json, updated_at FROM print_agent_configs WHERE agent_id = ?
+	`, agentID).Scan(&configJSON, &updatedAt)
+	if err == sql.ErrNoRows {
+		return &models.PrintAgentConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &models.PrintAgentConfig{}
+	if err := json.Unmarshal([]byte(configJSON), cfg); err != nil {
+		return nil, fmt.Errorf("failed to read config of print agent %s: %w", agentID, err)
+	}
+	cfg.UpdatedAt = &updatedAt
+	return cfg, nil
+}
+
+// SavePrintAgentConfig replaces the settings managed on the server for an
+// agent.
+func (d *DB) SavePrintAgentConfig(agentID string, cfg *models.PrintAgentConfig) error {
+	stored := *cfg
+	stored.UpdatedAt = nil
+	configJSON, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	_, err = d.Exec(`
+		INSERT INTO print_agent_configs (agent_id, config_json, updated_at)
+		VALUES (?, ?, datetime('now', 'localtime'))
+		ON CONFLICT(agent_id) DO UPDATE SET
+			config_json = excluded.config_json, updated_at = excluded.updated_at
+	`, agentID, string(configJSON))
+	return err
+}
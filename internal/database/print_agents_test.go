@@ -0,0 +1,109 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+func TestListPrintAgents(t *testing.T) {
+	d := newTestDB(t)
+
+	for _, id := range []string{"printer-1", "printer-2", "printer-3"} {
+		if err := d.RecordPrintAgentHeartbeat(&models.PrintAgent{ID: id, Group: "gedung-a"}); err != nil {
+			t.Fatalf("RecordPrintAgentHeartbeat: %v", err)
+		}
+	}
+	mustExec(t, d, `UPDATE print_agents SET last_heartbeat_at = datetime('now', 'localtime', '-1 minutes') WHERE id = 'printer-2'`)
+	mustExec(t, d, `UPDATE print_agents SET last_heartbeat_at = datetime('now', 'localtime', '-10 minutes') WHERE id = 'printer-3'`)
+	// An agent that reported a job but never a heartbeat
+	if err := d.RecordPrintAgentJob("printer-4", false, "paper out"); err != nil {
+		t.Fatalf("RecordPrintAgentJob: %v", err)
+	}
+	if err := d.RecordPrintAgentJob("printer-1", true, ""); err != nil {
+		t.Fatalf("RecordPrintAgentJob: %v", err)
+	}
+
+	agents, err := d.ListPrintAgents(45*time.Second, 2*time.Minute)
+	if err != nil {
+		t.Fatalf("ListPrintAgents: %v", err)
+	}
+	got := map[string]*models.PrintAgent{}
+	for _, a := range agents {
+		got[a.ID] = a
+	}
+
+	tests := []struct {
+		id      string
+		state   models.PrintAgentState
+		printed int
+		failed  int
+	}{
+		{"printer-1", models.PrintAgentOnline, 1, 0},
+		{"printer-2", models.PrintAgentStale, 0, 0},
+		{"printer-3", models.PrintAgentOffline, 0, 0},
+		{"printer-4", models.PrintAgentOffline, 0, 1},
+	}
+	for _, tt := range tests {
+		a := got[tt.id]
+		if a == nil {
+			t.Errorf("%s is not listed", tt.id)
+			continue
+		}
+		if a.State != tt.state || a.JobsPrinted != tt.printed || a.JobsFailed != tt.failed {
+			t.Errorf("%s: state %s, %d printed, %d failed; want %s, %d, %d",
+				tt.id, a.State, a.JobsPrinted, a.JobsFailed, tt.state, tt.printed, tt.failed)
+		}
+	}
+	if got["printer-4"] != nil && got["printer-4"].LastError != "paper out" {
+		t.Errorf("printer-4 last error %q, want %q", got["printer-4"].LastError, "paper out")
+	}
+
+	if ok, err := d.DeletePrintAgent("printer-3"); err != nil || !ok {
+		t.Fatalf("DeletePrintAgent = %v, %v", ok, err)
+	}
+	if ok, _ := d.DeletePrintAgent("printer-3"); ok {
+		t.Error("deleting a removed agent reported success")
+	}
+}
+
+func TestPrintAgentConfig(t *testing.T) {
+	d := newTestDB(t)
+	if err := d.RecordPrintAgentHeartbeat(&models.PrintAgent{ID: "printer-1"}); err != nil {
+		t.Fatalf("RecordPrintAgentHeartbeat: %v", err)
+	}
+
+	cfg, err := d.GetPrintAgentConfig("printer-1")
+	if err != nil {
+		t.Fatalf("GetPrintAgentConfig: %v", err)
+	}
+	if cfg.UpdatedAt != nil || cfg.Backend != "" {
+		t.Errorf("agent without settings got %+v", cfg)
+	}
+
+	saved := &models.PrintAgentConfig{Backend: "tcp", Address: "10.0.0.6:9100", Template: []byte(`{"Header":"GEDUNG A"}`)}
+	if err := d.SavePrintAgentConfig("printer-1", saved); err != nil {
+		t.Fatalf("SavePrintAgentConfig: %v", err)
+	}
+	saved.Backend = "device" // saving again replaces the settings
+	saved.Address = ""
+	if err := d.SavePrintAgentConfig("printer-1", saved); err != nil {
+		t.Fatalf("SavePrintAgentConfig: %v", err)
+	}
+	cfg, err = d.GetPrintAgentConfig("printer-1")
+	if err != nil {
+		t.Fatalf("GetPrintAgentConfig: %v", err)
+	}
+	if cfg.Backend != "device" || cfg.Address != "" || string(cfg.Template) != `{"Header":"GEDUNG A"}` || cfg.UpdatedAt == nil {
+		t.Errorf("got %+v", cfg)
+	}
+
+	// Removing the agent removes its settings
+	if _, err := d.DeletePrintAgent("printer-1"); err != nil {
+		t.Fatalf("DeletePrintAgent: %v", err)
+	}
+	if cfg, err = d.GetPrintAgentConfig("printer-1"); err != nil || cfg.UpdatedAt != nil {
+		t.Errorf("settings of a removed agent: %+v, %v", cfg, err)
+	}
+}
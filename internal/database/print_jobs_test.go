@@ -0,0 +1,330 @@
+package database
+
+import (
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+func mustCreatePrintJob(t *testing.T, d *DB, target string) *models.PrintJob {
+	t.Helper()
+	pj, err := d.CreatePrintJob("A001", "Umum", "17-10-2026 08:00", "{}", models.PriorityNormal, 1, 5, "", "", target)
+	if err != nil {
+		t.Fatalf("CreatePrintJob: %v", err)
+	}
+	return pj
+}
+
+// claimAttempt claims a job as its attempt'th attempt.
+func claimAttempt(t *testing.T, d *DB, id int64, agentID string, attempt int) {
+	t.Helper()
+	mustExec(t, d, `UPDATE print_jobs SET status = 'pending', attempts = ? WHERE id = ?`, attempt-1, id)
+	if _, err := d.ClaimPrintJob(id, agentID, "", time.Minute); err != nil {
+		t.Fatalf("ClaimPrintJob: %v", err)
+	}
+}
+
+func TestFailPrintJobBackoff(t *testing.T) {
+	const maxAttempts = 8
+
+	tests := []struct {
+		attempt    int
+		wantStatus models.PrintJobStatus
+		wantDelay  int // seconds until the retry
+	}{
+		{1, models.PrintJobFailed, 10},
+		{2, models.PrintJobFailed, 20},
+		{3, models.PrintJobFailed, 40},
+		{5, models.PrintJobFailed, 160},
+		{6, models.PrintJobFailed, 300},
+		{7, models.PrintJobFailed, 300},
+		{8, models.PrintJobDead, 0},
+	}
+	d := newTestDB(t)
+	for _, tt := range tests {
+		pj := mustCreatePrintJob(t, d, "")
+		claimAttempt(t, d, pj.ID, "printer-1", tt.attempt)
+
+		got, err := d.FailPrintJob(pj.ID, "printer-1", "paper out", maxAttempts)
+		if err != nil {
+			t.Fatalf("attempt %d: FailPrintJob: %v", tt.attempt, err)
+		}
+		if got.Status != tt.wantStatus || got.ErrorMessage != "paper out" {
+			t.Errorf("attempt %d: status %s (%q), want %s", tt.attempt, got.Status, got.ErrorMessage, tt.wantStatus)
+		}
+
+		var delay sql.NullInt64
+		if err := d.QueryRow(`
+			SELECT strftime('%s', next_attempt_at) - strftime('%s', 'now', 'localtime') FROM print_jobs WHERE id = ?
+		`, pj.ID).Scan(&delay); err != nil {
+			t.Fatalf("attempt %d: failed to read retry time: %v", tt.attempt, err)
+		}
+		if tt.wantStatus == models.PrintJobDead {
+			if delay.Valid || !got.CompletedAt.Valid {
+				t.Errorf("attempt %d: dead job has retry in %v and completed_at %v", tt.attempt, delay, got.CompletedAt)
+			}
+			continue
+		}
+		if !delay.Valid || delay.Int64 < int64(tt.wantDelay)-2 || delay.Int64 > int64(tt.wantDelay) {
+			t.Errorf("attempt %d: retry in %v seconds, want %d", tt.attempt, delay, tt.wantDelay)
+		}
+	}
+}
+
+func TestPrintJobOwnership(t *testing.T) {
+	d := newTestDB(t)
+	pj := mustCreatePrintJob(t, d, "")
+	if _, err := d.ClaimPrintJob(pj.ID, "printer-1", "", time.Minute); err != nil {
+		t.Fatalf("ClaimPrintJob: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		run     func() error
+		wantErr error
+	}{
+		{"claim a job being printed", func() error {
+			_, err := d.ClaimPrintJob(pj.ID, "printer-2", "", time.Minute)
+			return err
+		}, sql.ErrNoRows},
+		{"fail another agent's job", func() error {
+			_, err := d.FailPrintJob(pj.ID, "printer-2", "jam", 3)
+			return err
+		}, sql.ErrNoRows},
+		{"complete another agent's job", func() error { return d.CompletePrintJob(pj.ID, "printer-2") }, sql.ErrNoRows},
+		{"complete own job", func() error { return d.CompletePrintJob(pj.ID, "printer-1") }, nil},
+		{"complete twice", func() error { return d.CompletePrintJob(pj.ID, "printer-1") }, sql.ErrNoRows},
+		{"fail a completed job", func() error {
+			_, err := d.FailPrintJob(pj.ID, "printer-1", "jam", 3)
+			return err
+		}, sql.ErrNoRows},
+	}
+	for _, tt := range tests {
+		if err := tt.run(); err != tt.wantErr {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	got, err := d.GetPrintJob(pj.ID)
+	if err != nil {
+		t.Fatalf("GetPrintJob: %v", err)
+	}
+	if got.Status != models.PrintJobCompleted || got.AgentID != "printer-1" {
+		t.Errorf("job %s by %s, want completed by printer-1", got.Status, got.AgentID)
+	}
+}
+
+func TestClaimPrintJobTarget(t *testing.T) {
+	d := newTestDB(t)
+
+	tests := []struct {
+		target string
+		agent  string
+		group  string
+		want   error
+	}{
+		{"", "printer-1", "", nil},
+		{"printer-1", "printer-1", "", nil},
+		{"printer-1", "printer-2", "", sql.ErrNoRows},
+		{"gedung-a", "printer-2", "gedung-a", nil},
+		{"gedung-a", "printer-2", "gedung-b", sql.ErrNoRows},
+		{"gedung-a", "printer-2", "", sql.ErrNoRows},
+	}
+	for _, tt := range tests {
+		pj := mustCreatePrintJob(t, d, tt.target)
+		if _, err := d.ClaimPrintJob(pj.ID, tt.agent, tt.group, time.Minute); err != tt.want {
+			t.Errorf("claim of job for %q by %s in %q: error = %v, want %v", tt.target, tt.agent, tt.group, err, tt.want)
+		}
+	}
+}
+
+func TestListPendingPrintJobs(t *testing.T) {
+	d := newTestDB(t)
+	anyAgent := mustCreatePrintJob(t, d, "")
+	printer1 := mustCreatePrintJob(t, d, "printer-1")
+	gedungA := mustCreatePrintJob(t, d, "gedung-a")
+	claimed := mustCreatePrintJob(t, d, "")
+	if _, err := d.ClaimPrintJob(claimed.ID, "printer-2", "", time.Minute); err != nil {
+		t.Fatalf("ClaimPrintJob: %v", err)
+	}
+
+	tests := []struct {
+		agent string
+		group string
+		want  []int64
+	}{
+		{"printer-1", "", []int64{anyAgent.ID, printer1.ID}},
+		{"printer-1", "gedung-a", []int64{anyAgent.ID, printer1.ID, gedungA.ID}},
+		{"printer-2", "gedung-a", []int64{anyAgent.ID, gedungA.ID}},
+		{"printer-3", "gedung-b", []int64{anyAgent.ID}},
+		// An agent without an ID gets no routed jobs
+		{"", "", []int64{anyAgent.ID}},
+	}
+	for _, tt := range tests {
+		jobs, err := d.ListPendingPrintJobs(tt.agent, tt.group)
+		if err != nil {
+			t.Fatalf("ListPendingPrintJobs: %v", err)
+		}
+		if got := printJobIDs(jobs); !slices.Equal(got, tt.want) {
+			t.Errorf("pending jobs of %q in %q = %v, want %v", tt.agent, tt.group, got, tt.want)
+		}
+	}
+
+	all, err := d.ListAllPendingPrintJobs()
+	if err != nil {
+		t.Fatalf("ListAllPendingPrintJobs: %v", err)
+	}
+	if got, want := printJobIDs(all), []int64{anyAgent.ID, printer1.ID, gedungA.ID}; !slices.Equal(got, want) {
+		t.Errorf("all pending jobs = %v, want %v", got, want)
+	}
+}
+
+func printJobIDs(jobs []*models.PrintJob) []int64 {
+	ids := make([]int64, len(jobs))
+	for i, j := range jobs {
+		ids[i] = j.ID
+	}
+	return ids
+}
+
+func TestExpirePrintJobLeases(t *testing.T) {
+	const maxAttempts = 3
+	d := newTestDB(t)
+
+	tests := []struct {
+		name       string
+		attempt    int
+		expired    bool
+		wantStatus models.PrintJobStatus
+	}{
+		{"lease running", 1, false, models.PrintJobPrinting},
+		{"lease expired", 1, true, models.PrintJobPending},
+		{"lease expired on the last attempt", maxAttempts, true, models.PrintJobDead},
+	}
+	ids := make([]int64, len(tests))
+	for i, tt := range tests {
+		pj := mustCreatePrintJob(t, d, "")
+		claimAttempt(t, d, pj.ID, "printer-1", tt.attempt)
+		if tt.expired {
+			mustExec(t, d, `UPDATE print_jobs SET lease_expires_at = datetime('now', 'localtime', '-1 seconds') WHERE id = ?`, pj.ID)
+		}
+		ids[i] = pj.ID
+	}
+
+	n, err := d.ExpirePrintJobLeases(maxAttempts)
+	if err != nil {
+		t.Fatalf("ExpirePrintJobLeases: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expired %d leases, want 2", n)
+	}
+	for i, tt := range tests {
+		got, err := d.GetPrintJob(ids[i])
+		if err != nil {
+			t.Fatalf("GetPrintJob: %v", err)
+		}
+		if got.Status != tt.wantStatus {
+			t.Errorf("%s: status %s, want %s", tt.name, got.Status, tt.wantStatus)
+		}
+		if tt.expired && got.ErrorMessage == "" {
+			t.Errorf("%s: no error message", tt.name)
+		}
+	}
+
+	// The agent that lost the lease can no longer report on the job
+	if err := d.CompletePrintJob(ids[1], "printer-1"); err != sql.ErrNoRows {
+		t.Errorf("CompletePrintJob after expiry: error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestRetryDuePrintJobs(t *testing.T) {
+	d := newTestDB(t)
+	due := mustCreatePrintJob(t, d, "")
+	later := mustCreatePrintJob(t, d, "")
+	for _, id := range []int64{due.ID, later.ID} {
+		claimAttempt(t, d, id, "printer-1", 1)
+		if _, err := d.FailPrintJob(id, "printer-1", "offline", 5); err != nil {
+			t.Fatalf("FailPrintJob: %v", err)
+		}
+	}
+	mustExec(t, d, `UPDATE print_jobs SET next_attempt_at = datetime('now', 'localtime', '-1 seconds') WHERE id = ?`, due.ID)
+
+	n, err := d.RetryDuePrintJobs()
+	if err != nil {
+		t.Fatalf("RetryDuePrintJobs: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("retried %d jobs, want 1", n)
+	}
+	for _, want := range []struct {
+		id     int64
+		status models.PrintJobStatus
+	}{{due.ID, models.PrintJobPending}, {later.ID, models.PrintJobFailed}} {
+		got, err := d.GetPrintJob(want.id)
+		if err != nil {
+			t.Fatalf("GetPrintJob: %v", err)
+		}
+		if got.Status != want.status {
+			t.Errorf("job %d: status %s, want %s", want.id, got.Status, want.status)
+		}
+	}
+}
+
+func TestDeadPrintJobs(t *testing.T) {
+	d := newTestDB(t)
+	newDead := func() int64 {
+		pj := mustCreatePrintJob(t, d, "")
+		claimAttempt(t, d, pj.ID, "printer-1", 1)
+		if _, err := d.FailPrintJob(pj.ID, "printer-1", "offline", 1); err != nil {
+			t.Fatalf("FailPrintJob: %v", err)
+		}
+		mustExec(t, d, `UPDATE print_jobs SET created_at = datetime('now', 'localtime', '-48 hours') WHERE id = ?`, pj.ID)
+		return pj.ID
+	}
+	kept, reissued, dismissed := newDead(), newDead(), newDead()
+
+	got, err := d.ReissuePrintJob(reissued)
+	if err != nil {
+		t.Fatalf("ReissuePrintJob: %v", err)
+	}
+	if got.Status != models.PrintJobPending || got.Attempts != 0 || got.AgentID != "" {
+		t.Errorf("reissued job %s with %d attempts by %q, want pending, 0, none", got.Status, got.Attempts, got.AgentID)
+	}
+	if _, err := d.DismissPrintJob(dismissed); err != nil {
+		t.Fatalf("DismissPrintJob: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		run     func() error
+		wantErr error
+	}{
+		{"dismiss a pending job", func() error { _, err := d.DismissPrintJob(reissued); return err }, sql.ErrNoRows},
+		{"dismiss twice", func() error { _, err := d.DismissPrintJob(dismissed); return err }, sql.ErrNoRows},
+		{"reissue a pending job", func() error { _, err := d.ReissuePrintJob(reissued); return err }, sql.ErrNoRows},
+		{"reissue a dismissed job", func() error { _, err := d.ReissuePrintJob(dismissed); return err }, sql.ErrNoRows},
+	}
+	for _, tt := range tests {
+		if err := tt.run(); err != tt.wantErr {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// Cleanup removes the dismissed job but keeps the dead one for an admin
+	n, err := d.CleanupOldPrintJobs(24)
+	if err != nil {
+		t.Fatalf("CleanupOldPrintJobs: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("cleaned up %d jobs, want 1", n)
+	}
+	if _, err := d.GetPrintJob(dismissed); err != sql.ErrNoRows {
+		t.Errorf("dismissed job still there: %v", err)
+	}
+	if got, err := d.GetPrintJob(kept); err != nil || got.Status != models.PrintJobDead {
+		t.Errorf("dead job not kept: %v, %v", got, err)
+	}
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"fmt"
+
+	"queue-system/internal/models"
+)
+
+// SetPrinterStatus stores the latest status reported by a print agent.
+func (d *DB) SetPrinterStatus(st *models.PrinterStatus) error {
+	_, err := d.Exec(`
+		INSERT INTO printer_status (agent_id, printer, online, paper_near_end, paper_out, cover_open, error, reported_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, datetime('now', 'localtime'))
+		ON CONFLICT(agent_id) DO UPDATE SET
+			printer = excluded.printer, online = excluded.online,
+			paper_near_end = excluded.paper_near_end, paper_out = excluded.paper_out,
+			cover_open = excluded.cover_open, error = excluded.error,
+			reported_at = excluded.reported_at
+	`, st.AgentID, st.Printer, st.Online, st.PaperNearEnd, st.PaperOut, st.CoverOpen, st.Error)
+	if err != nil {
+		return fmt.Errorf("failed to save printer status: %w", err)
+	}
+	return nil
+}
+
+// ListPrinterStatuses returns the latest status of every print agent that
+// has reported one.
+func (d *DB) ListPrinterStatuses() ([]*models.PrinterStatus, error) {
+	rows, err := d.Query(`
+		SELECT agent_id, printer, online, paper_near_end, paper_out, cover_open, error, reported_at
+		FROM printer_status ORDER BY agent_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statuses []*models.PrinterStatus
+	for rows.Next() {
+		st := &models.PrinterStatus{}
+		if err := rows.Scan(&st.AgentID, &st.Printer, &st.Online, &st.PaperNearEnd, &st.PaperOut,
+			&st.CoverOpen, &st.Error, &st.ReportedAt); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, rows.Err()
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"testing"
+
+	"queue-system/internal/models"
+)
+
+func TestSetPrinterStatus(t *testing.T) {
+	d := newTestDB(t)
+
+	reports := []models.PrinterStatus{
+		{AgentID: "printer-lobi", Printer: "tcp:10.0.0.5:9100", Online: true},
+		{AgentID: "printer-poli", Printer: "device:/dev/usb/lp0", Online: true, PaperNearEnd: true},
+		// A later report replaces the agent's earlier one
+		{AgentID: "printer-lobi", Printer: "tcp:10.0.0.5:9100", PaperOut: true, Error: "paper out"},
+	}
+	for i := range reports {
+		if err := d.SetPrinterStatus(&reports[i]); err != nil {
+			t.Fatalf("SetPrinterStatus: %v", err)
+		}
+	}
+
+	got, err := d.ListPrinterStatuses()
+	if err != nil {
+		t.Fatalf("ListPrinterStatuses: %v", err)
+	}
+	want := []models.PrinterStatus{reports[2], reports[1]}
+	if len(got) != len(want) {
+		t.Fatalf("%d statuses, want %d", len(got), len(want))
+	}
+	for i, st := range got {
+		st.ReportedAt = want[i].ReportedAt
+		if *st != want[i] {
+			t.Errorf("status %d = %+v, want %+v", i, *st, want[i])
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"database/sql"
+	"slices"
+	"testing"
+
+	"queue-system/internal/models"
+)
+
+func TestCallNextQueueOrder(t *testing.T) {
+	const self, other = int64(1), int64(2) // counters created by the test
+
+	tests := []struct {
+		name     string
+		aging    int
+		callType string
+		tickets  []ticket
+		want     []string
+	}{
+		{
+			name: "oldest first",
+			tickets: []ticket{
+				{number: "A002", ageSeconds: 20},
+				{number: "A001", ageSeconds: 30},
+				{number: "A003", ageSeconds: 10},
+			},
+			want: []string{"A001", "A002", "A003"},
+		},
+		{
+			name: "priority first",
+			tickets: []ticket{
+				{number: "A001", ageSeconds: 30},
+				{number: "A002", ageSeconds: 20, priority: models.PriorityHigh},
+				{number: "A003", ageSeconds: 10},
+			},
+			want: []string{"A002", "A001", "A003"},
+		},
+		{
+			name: "priority beats a long wait without aging",
+			tickets: []ticket{
+				{number: "A001", ageSeconds: 120},
+				{number: "A002", ageSeconds: 10, priority: models.PriorityHigh},
+			},
+			want: []string{"A002", "A001"},
+		},
+		{
+			name:  "aged ticket ranks like priority",
+			aging: 1,
+			tickets: []ticket{
+				{number: "A001", ageSeconds: 120},
+				{number: "A002", ageSeconds: 10, priority: models.PriorityHigh},
+			},
+			want: []string{"A001", "A002"},
+		},
+		{
+			name:  "ticket not yet aged",
+			aging: 1,
+			tickets: []ticket{
+				{number: "A001", ageSeconds: 30},
+				{number: "A002", ageSeconds: 10, priority: models.PriorityHigh},
+			},
+			want: []string{"A002", "A001"},
+		},
+		{
+			name: "returned to the head of the queue",
+			tickets: []ticket{
+				{number: "A001", ageSeconds: 30},
+				{number: "A002", ageSeconds: 20, requeueAfter: 0},
+				{number: "A003", ageSeconds: 40, priority: models.PriorityHigh},
+			},
+			want: []string{"A002", "A003", "A001"},
+		},
+		{
+			name: "returned behind one other ticket",
+			tickets: []ticket{
+				{number: "A001", ageSeconds: 60, requeueAfter: 1},
+				{number: "A002", ageSeconds: 30},
+				{number: "A003", ageSeconds: 20},
+				{number: "A004", ageSeconds: 10},
+			},
+			want: []string{"A002", "A001", "A003", "A004"},
+		},
+		{
+			name: "returned behind other types only counts its own",
+			tickets: []ticket{
+				{number: "A001", ageSeconds: 60, requeueAfter: 1},
+				{number: "B001", queueType: "B", ageSeconds: 30},
+				{number: "A002", ageSeconds: 20},
+			},
+			want: []string{"B001", "A002", "A001"},
+		},
+		{
+			name: "transferred to this counter first",
+			tickets: []ticket{
+				{number: "A001", ageSeconds: 30, priority: models.PriorityHigh},
+				{number: "A002", ageSeconds: 20, target: self},
+				{number: "A003", ageSeconds: 40, target: other},
+			},
+			want: []string{"A002", "A001"},
+		},
+		{
+			name:     "transferred to this counter under another type",
+			callType: "A",
+			tickets: []ticket{
+				{number: "A001", ageSeconds: 30},
+				{number: "B001", queueType: "B", ageSeconds: 20, target: self},
+				{number: "B002", queueType: "B", ageSeconds: 40},
+			},
+			want: []string{"B001", "A001"},
+		},
+		{
+			name:     "only the requested type",
+			callType: "B",
+			tickets: []ticket{
+				{number: "A001", ageSeconds: 30},
+				{number: "B001", queueType: "B", ageSeconds: 20},
+			},
+			want: []string{"B001"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDB(t)
+			d.config.Queue.PriorityAgingMinutes = tt.aging
+			counter := mustCreateCounter(t, d, "1")
+			mustCreateCounter(t, d, "2")
+			if counter.ID != self {
+				t.Fatalf("counter ID %d, want %d", counter.ID, self)
+			}
+			addTickets(t, d, tt.tickets)
+
+			var got []string
+			for {
+				q, err := d.CallNextQueue(counter.ID, tt.callType)
+				if err == sql.ErrNoRows {
+					break
+				} else if err != nil {
+					t.Fatalf("CallNextQueue: %v", err)
+				}
+				got = append(got, q.QueueNumber)
+				if len(got) > len(tt.tickets) {
+					break
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("called %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallNextQueueSkipsOtherDays(t *testing.T) {
+	d := newTestDB(t)
+	counter := mustCreateCounter(t, d, "1")
+	mustExec(t, d, `
+		INSERT INTO queues (queue_number, queue_type, status, priority, created_at)
+		VALUES ('A001', 'A', 'waiting', 1, datetime('now', 'localtime', '-1 day'))
+	`)
+
+	if _, err := d.CallNextQueue(counter.ID, ""); err != sql.ErrNoRows {
+		t.Errorf("CallNextQueue error = %v, want sql.ErrNoRows", err)
+	}
+}
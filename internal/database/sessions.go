@@ -0,0 +1,107 @@
+package database
+
+import (
+	"time"
+
+	"queue-system/internal/models"
+)
+
+// Session operations. Sessions are looked up by the SHA-256 hash of their
+// cookie token, so a leaked database does not leak usable tokens.
+
+// dbTime formats t for a DATETIME column, in UTC like datetime('now'), so
+// the column compares correctly in SQL. Binding a time.Time directly
+// stores its String() form, zone name and all.
+func dbTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+func (d *DB) CreateSession(s *models.Session) error {
+	result, err := d.Exec(`
+		INSERT INTO sessions (token_hash, user_id, username, role, counter_id, ip, user_agent, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.TokenHash, s.UserID, s.Username, s.Role, s.CounterID, s.IP, s.UserAgent,
+		dbTime(s.CreatedAt), dbTime(s.LastSeenAt), dbTime(s.ExpiresAt))
+	if err != nil {
+		return err
+	}
+	s.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetSession returns the session with the given token hash, or
+// sql.ErrNoRows if it does not exist or has expired.
+func (d *DB) GetSession(tokenHash string) (*models.Session, error) {
+	s := &models.Session{}
+	err := d.QueryRow(`
+		SELECT id, token_hash, user_id, username, role, counter_id, ip, user_agent, created_at, last_seen_at, expires_at
+		FROM sessions WHERE token_hash = ? AND expires_at > datetime('now')
+	`, tokenHash).Scan(&s.ID, &s.TokenHash, &s.UserID, &s.Username, &s.Role, &s.CounterID,
+		&s.IP, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// TouchSession slides a session's expiry forward and records where it was
+// last used from.
+func (d *DB) TouchSession(id int64, expiresAt time.Time, ip, userAgent string) error {
+	_, err := d.Exec(`
+		UPDATE sessions SET last_seen_at = datetime('now'), expires_at = ?, ip = ?, user_agent = ? WHERE id = ?
+	`, dbTime(expiresAt), ip, userAgent, id)
+	return err
+}
+
+func (d *DB) ListSessions() ([]*models.Session, error) {
+	rows, err := d.Query(`
+		SELECT id, token_hash, user_id, username, role, counter_id, ip, user_agent, created_at, last_seen_at, expires_at
+		FROM sessions WHERE expires_at > datetime('now')
+		ORDER BY last_seen_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		s := &models.Session{}
+		if err := rows.Scan(&s.ID, &s.TokenHash, &s.UserID, &s.Username, &s.Role, &s.CounterID,
+			&s.IP, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (d *DB) DeleteSession(id int64) error {
+	_, err := d.Exec(`DELETE FROM sessions WHERE id = ?`, id)
+	return err
+}
+
+// DeleteAllSessions logs out every session except the one with keepID
+// (pass 0 to log out everyone).
+func (d *DB) DeleteAllSessions(keepID int64) (int64, error) {
+	result, err := d.Exec(`DELETE FROM sessions WHERE id != ?`, keepID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteUserSessions logs out every session belonging to a user account.
+func (d *DB) DeleteUserSessions(userID int64) error {
+	_, err := d.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+	return err
+}
+
+// DeleteExpiredSessions removes sessions whose expiry has passed.
+func (d *DB) DeleteExpiredSessions() (int64, error) {
+	result, err := d.Exec(`DELETE FROM sessions WHERE expires_at <= datetime('now')`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
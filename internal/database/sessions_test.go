@@ -0,0 +1,105 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+func TestSessionExpiry(t *testing.T) {
+	d := newTestDB(t)
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		expiresIn time.Duration
+		touchTo   time.Duration
+		wantFound bool
+	}{
+		{"live session", time.Hour, 0, true},
+		{"expired session", -time.Minute, 0, false},
+		{"expired a second ago", -time.Second, 0, false},
+		{"expiring session touched forward", time.Minute, time.Hour, true},
+		{"live session touched into the past", time.Hour, -time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &models.Session{
+				TokenHash: "hash-" + tt.name, UserID: 1, Username: "admin", Role: models.RoleAdmin,
+				CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(tt.expiresIn),
+			}
+			if err := d.CreateSession(s); err != nil {
+				t.Fatalf("CreateSession: %v", err)
+			}
+			if tt.touchTo != 0 {
+				if err := d.TouchSession(s.ID, now.Add(tt.touchTo), "127.0.0.1", "test"); err != nil {
+					t.Fatalf("TouchSession: %v", err)
+				}
+			}
+
+			got, err := d.GetSession(s.TokenHash)
+			if tt.wantFound {
+				if err != nil {
+					t.Fatalf("GetSession: %v", err)
+				}
+				if got.ID != s.ID {
+					t.Errorf("GetSession returned session %d, want %d", got.ID, s.ID)
+				}
+			} else if err != sql.ErrNoRows {
+				t.Errorf("GetSession error = %v, want sql.ErrNoRows", err)
+			}
+		})
+	}
+}
+
+func TestSessionTimesRoundTrip(t *testing.T) {
+	d := newTestDB(t)
+
+	// Times are stored in UTC whatever the zone they are created in
+	zone := time.FixedZone("WIB", 7*60*60)
+	expires := time.Now().In(zone).Add(time.Hour).Truncate(time.Second)
+	s := &models.Session{TokenHash: "round-trip", UserID: 1, Role: models.RoleAdmin,
+		CreatedAt: time.Now().In(zone), LastSeenAt: time.Now().In(zone), ExpiresAt: expires}
+	if err := d.CreateSession(s); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	got, err := d.GetSession("round-trip")
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if !got.ExpiresAt.Equal(expires) {
+		t.Errorf("ExpiresAt = %v, want %v", got.ExpiresAt, expires)
+	}
+}
+
+func TestDeleteExpiredSessions(t *testing.T) {
+	d := newTestDB(t)
+	now := time.Now()
+
+	for i, expiresIn := range []time.Duration{-time.Hour, -time.Second, time.Minute, time.Hour} {
+		s := &models.Session{TokenHash: string(rune('a' + i)), UserID: 1, Role: models.RoleAdmin,
+			CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(expiresIn)}
+		if err := d.CreateSession(s); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+	}
+
+	deleted, err := d.DeleteExpiredSessions()
+	if err != nil {
+		t.Fatalf("DeleteExpiredSessions: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("deleted %d sessions, want 2", deleted)
+	}
+
+	live, err := d.ListSessions()
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(live) != 2 {
+		t.Errorf("%d sessions left, want 2", len(live))
+	}
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+// API token operations. Like sessions, tokens are stored and looked up by
+// the SHA-256 hash of their value.
+
+const apiTokenColumns = `id, name, token_hash, prefix, scopes, agent_id, print_group, created_at, expires_at, last_used_at, revoked_at`
+
+func (d *DB) CreateAPIToken(t *models.APIToken) error {
+	t.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	var expiresAt interface{}
+	if t.ExpiresAt.Valid {
+		expiresAt = dbTime(t.ExpiresAt.Time)
+	}
+	result, err := d.Exec(`
+		INSERT INTO api_tokens (name, token_hash, prefix, scopes, agent_id, print_group, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, t.Name, t.TokenHash, t.Prefix, joinScopes(t.Scopes), t.AgentID, t.Group, dbTime(t.CreatedAt), expiresAt)
+	if err != nil {
+		return err
+	}
+	t.ID, _ = result.LastInsertId()
+	return nil
+}
+
+func (d *DB) GetAPIToken(id int64) (*models.APIToken, error) {
+	return scanAPIToken(d.QueryRow(`SELECT `+apiTokenColumns+` FROM api_tokens WHERE id = ?`, id))
+}
+
+// GetAPITokenByHash returns the token with the given hash, including revoked
+// and expired ones; callers check IsUsable.
+func (d *DB) GetAPITokenByHash(tokenHash string) (*models.APIToken, error) {
+	return scanAPIToken(d.QueryRow(`SELECT `+apiTokenColumns+` FROM api_tokens WHERE token_hash = ?`, tokenHash))
+}
+
+func (d *DB) ListAPITokens() ([]*models.APIToken, error) {
+	rows, err := d.Query(`SELECT ` + apiTokenColumns + ` FROM api_tokens ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*models.APIToken
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (d *DB) TouchAPIToken(id int64) error {
+	_, err := d.Exec(`UPDATE api_tokens SET last_used_at = datetime('now') WHERE id = ?`, id)
+	return err
+}
+
+// RevokeAPIToken marks a token as revoked. The row is kept so the token
+// list still shows who had access.
+func (d *DB) RevokeAPIToken(id int64) error {
+	result, err := d.Exec(`UPDATE api_tokens SET revoked_at = datetime('now') WHERE id = ? AND revoked_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIToken(row rowScanner) (*models.APIToken, error) {
+	t := &models.APIToken{}
+	var scopes string
+	err := row.Scan(&t.ID, &t.Name, &t.TokenHash, &t.Prefix, &scopes, &t.AgentID, &t.Group,
+		&t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	t.Scopes = splitScopes(scopes)
+	t.PrepareJSON()
+	return t, nil
+}
+
+func joinScopes(scopes []models.TokenScope) string {
+	parts := make([]string, len(scopes))
+	for i, s := range scopes {
+		parts[i] = string(s)
+	}
+	return strings.Join(parts, ",")
+}
+
+func splitScopes(s string) []models.TokenScope {
+	scopes := []models.TokenScope{}
+	for _, part := range strings.Split(s, ",") {
+		if part != "" {
+			scopes = append(scopes, models.TokenScope(part))
+		}
+	}
+	return scopes
+}
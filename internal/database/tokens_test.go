@@ -0,0 +1,91 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+func TestAPITokenUsable(t *testing.T) {
+	d := newTestDB(t)
+
+	tests := []struct {
+		name       string
+		expiresIn  time.Duration // 0 for a token that never expires
+		revoke     bool
+		wantUsable bool
+	}{
+		{"no expiry", 0, false, true},
+		{"expires later", time.Hour, false, true},
+		{"expired", -time.Minute, false, false},
+		{"revoked", 0, true, false},
+		{"revoked and expired", -time.Minute, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := &models.APIToken{Name: tt.name, TokenHash: "hash-" + tt.name, Prefix: "qs_test",
+				Scopes: []models.TokenScope{models.ScopePrintAgent}, AgentID: "printer-1", Group: "gedung-a"}
+			if tt.expiresIn != 0 {
+				token.ExpiresAt = sql.NullTime{Time: time.Now().Add(tt.expiresIn), Valid: true}
+			}
+			if err := d.CreateAPIToken(token); err != nil {
+				t.Fatalf("CreateAPIToken: %v", err)
+			}
+			if tt.revoke {
+				if err := d.RevokeAPIToken(token.ID); err != nil {
+					t.Fatalf("RevokeAPIToken: %v", err)
+				}
+			}
+
+			got, err := d.GetAPITokenByHash(token.TokenHash)
+			if err != nil {
+				t.Fatalf("GetAPITokenByHash: %v", err)
+			}
+			if got.IsUsable() != tt.wantUsable {
+				t.Errorf("IsUsable() = %v, want %v", got.IsUsable(), tt.wantUsable)
+			}
+			if got.RevokedAt.Valid != tt.revoke {
+				t.Errorf("RevokedAt.Valid = %v, want %v", got.RevokedAt.Valid, tt.revoke)
+			}
+			if got.AgentID != "printer-1" || got.Group != "gedung-a" {
+				t.Errorf("token bound to %q in %q, want printer-1 in gedung-a", got.AgentID, got.Group)
+			}
+		})
+	}
+}
+
+func TestRevokeAPIToken(t *testing.T) {
+	d := newTestDB(t)
+
+	token := &models.APIToken{Name: "kiosk", TokenHash: "hash", Prefix: "qs_test",
+		Scopes: []models.TokenScope{models.ScopeKiosk}}
+	if err := d.CreateAPIToken(token); err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		id      int64
+		wantErr error
+	}{
+		{"first revoke", token.ID, nil},
+		{"second revoke", token.ID, sql.ErrNoRows},
+		{"unknown token", token.ID + 100, sql.ErrNoRows},
+	}
+	for _, tt := range tests {
+		if err := d.RevokeAPIToken(tt.id); err != tt.wantErr {
+			t.Errorf("%s: RevokeAPIToken error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// A revoked token is kept for the token list
+	got, err := d.GetAPIToken(token.ID)
+	if err != nil {
+		t.Fatalf("GetAPIToken: %v", err)
+	}
+	if !got.RevokedAt.Valid || got.RevokedAt.Time.After(time.Now()) {
+		t.Errorf("RevokedAt = %v, want a time in the past", got.RevokedAt)
+	}
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"queue-system/internal/models"
+)
+
+// TransferQueue moves the ticket currently called at counterID back to the
+// waiting queue under queueType, optionally reserved for toCounterID. The
+// ticket keeps its number and created_at, so it is not sent to the back of
+// the line. Returns sql.ErrNoRows if the counter has no current queue.
+func (d *DB) TransferQueue(counterID int64, queueType string, toCounterID *int64) (*models.Queue, error) {
+	tx, err := d.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var queueID sql.NullInt64
+	if err := tx.QueryRow(`SELECT current_queue_id FROM counters WHERE id = ?`, counterID).Scan(&queueID); err != nil {
+		return nil, err
+	}
+	if !queueID.Valid {
+		return nil, sql.ErrNoRows
+	}
+
+	result, err := tx.Exec(`
+		UPDATE queues
+		SET status = 'waiting', queue_type = ?, counter_id = NULL, target_counter_id = ?, requeue_after = NULL
+		WHERE id = ? AND status = 'called'
+	`, queueType, toCounterID, queueID.Int64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transfer queue: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(`UPDATE counters SET current_queue_id = NULL WHERE id = ?`, counterID); err != nil {
+		return nil, fmt.Errorf("failed to reset counter: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO call_history (queue_id, counter_id, action, timestamp)
+		VALUES (?, ?, ?, datetime('now', 'localtime'))
+	`, queueID.Int64, counterID, models.ActionTransferred); err != nil {
+		return nil, fmt.Errorf("failed to record history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return d.GetQueue(queueID.Int64)
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+
+	"queue-system/internal/models"
+)
+
+func TestTransferQueue(t *testing.T) {
+	tests := []struct {
+		name      string
+		queueType string
+		toCounter bool
+		// wantCalledBy is the counter number that calls the ticket next
+		wantCalledBy string
+	}{
+		{"to another service", "B", false, "3"},
+		{"to another counter", "A", true, "2"},
+		{"to a counter under another service", "B", true, "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDB(t)
+			mustExec(t, d, `INSERT INTO queue_types (code, name, prefix, is_active, sort_order) VALUES ('B', 'Bayar', 'B', 1, 2)`)
+			from := mustCreateCounter(t, d, "1")
+			counters := map[string]*models.Counter{
+				"2": mustCreateCounter(t, d, "2"),
+				"3": mustCreateCounter(t, d, "3"),
+			}
+			addTickets(t, d, []ticket{
+				{number: "A001", ageSeconds: 60},
+				{number: "A002", ageSeconds: 30},
+				{number: "B001", queueType: "B", ageSeconds: 20},
+			})
+
+			called, err := d.CallNextQueue(from.ID, "A")
+			if err != nil {
+				t.Fatalf("CallNextQueue: %v", err)
+			}
+			var target *int64
+			if tt.toCounter {
+				target = &counters["2"].ID
+			}
+			moved, err := d.TransferQueue(from.ID, tt.queueType, target)
+			if err != nil {
+				t.Fatalf("TransferQueue: %v", err)
+			}
+			if moved.ID != called.ID || moved.QueueNumber != "A001" {
+				t.Fatalf("transferred %s, want A001", moved.QueueNumber)
+			}
+			if moved.Status != models.StatusWaiting || moved.QueueType != tt.queueType {
+				t.Errorf("transferred ticket is %s under %s, want waiting under %s", moved.Status, moved.QueueType, tt.queueType)
+			}
+
+			c, err := d.GetCounter(from.ID)
+			if err != nil {
+				t.Fatalf("GetCounter: %v", err)
+			}
+			if c.CurrentQueueID.Valid {
+				t.Errorf("counter 1 still serving ticket %d", c.CurrentQueueID.Int64)
+			}
+
+			// The ticket keeps its place: it is called before younger
+			// tickets of its new type, and only by its target counter.
+			for _, number := range []string{"3", "2"} {
+				next, err := d.CallNextQueue(counters[number].ID, tt.queueType)
+				if err != nil {
+					t.Fatalf("CallNextQueue at counter %s: %v", number, err)
+				}
+				if got := next.QueueNumber == "A001"; got != (number == tt.wantCalledBy) {
+					t.Errorf("counter %s called %s", number, next.QueueNumber)
+				}
+			}
+		})
+	}
+}
+
+func TestTransferQueueIdleCounter(t *testing.T) {
+	d := newTestDB(t)
+	counter := mustCreateCounter(t, d, "1")
+	if _, err := d.TransferQueue(counter.ID, "A", nil); err != sql.ErrNoRows {
+		t.Errorf("TransferQueue error = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,280 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+	"queue-system/internal/models"
+)
+
+// ErrInvalidCredentials is returned by AuthenticateUser when the username is
+// unknown, the account is disabled, or the password does not match.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// ErrUnknownCounter is returned when a user is assigned a counter that does
+// not exist.
+var ErrUnknownCounter = errors.New("unknown counter")
+
+// ErrLastAdmin is returned when a change would demote, deactivate or delete
+// the last active admin account.
+var ErrLastAdmin = errors.New("cannot remove the last active admin")
+
+// User operations
+
+func (d *DB) CreateUser(username, fullName, password string, role models.UserRole, counterIDs []int64) (*models.User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	tx, err := d.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO users (username, full_name, role, password_hash, is_active, created_at)
+		VALUES (?, ?, ?, ?, 1, datetime('now', 'localtime'))
+	`, username, fullName, role, string(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := result.LastInsertId()
+	if err := setUserCountersTx(tx, id, counterIDs); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return d.GetUser(id)
+}
+
+func (d *DB) GetUser(id int64) (*models.User, error) {
+	u := &models.User{}
+	err := d.QueryRow(`
+		SELECT id, username, full_name, role, password_hash, is_active, created_at
+		FROM users WHERE id = ?
+	`, id).Scan(&u.ID, &u.Username, &u.FullName, &u.Role, &u.PasswordHash, &u.IsActive, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if u.CounterIDs, err = d.GetUserCounterIDs(u.ID); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (d *DB) GetUserByUsername(username string) (*models.User, error) {
+	u := &models.User{}
+	err := d.QueryRow(`
+		SELECT id, username, full_name, role, password_hash, is_active, created_at
+		FROM users WHERE username = ?
+	`, username).Scan(&u.ID, &u.Username, &u.FullName, &u.Role, &u.PasswordHash, &u.IsActive, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if u.CounterIDs, err = d.GetUserCounterIDs(u.ID); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (d *DB) ListUsers() ([]*models.User, error) {
+	rows, err := d.Query(`
+		SELECT id, username, full_name, role, password_hash, is_active, created_at
+		FROM users ORDER BY username ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		u := &models.User{}
+		if err := rows.Scan(&u.ID, &u.Username, &u.FullName, &u.Role, &u.PasswordHash, &u.IsActive, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, u := range users {
+		if u.CounterIDs, err = d.GetUserCounterIDs(u.ID); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+func (d *DB) UpdateUser(id int64, fullName string, role models.UserRole, isActive bool, counterIDs []int64) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	wasAdmin, err := isActiveAdminTx(tx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users SET full_name = ?, role = ?, is_active = ? WHERE id = ?
+	`, fullName, role, isActive, id)
+	if err != nil {
+		return err
+	}
+
+	if err := setUserCountersTx(tx, id, counterIDs); err != nil {
+		return err
+	}
+	if wasAdmin {
+		if err := checkActiveAdminTx(tx); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (d *DB) SetUserPassword(id int64, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	_, err = d.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, string(hash), id)
+	return err
+}
+
+func (d *DB) DeleteUser(id int64) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	wasAdmin, err := isActiveAdminTx(tx, id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_counters WHERE user_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete counter assignments: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM users WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if wasAdmin {
+		if err := checkActiveAdminTx(tx); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// AuthenticateUser verifies a username/password pair and returns the active
+// user it belongs to, or ErrInvalidCredentials.
+func (d *DB) AuthenticateUser(username, password string) (*models.User, error) {
+	u, err := d.GetUserByUsername(username)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+	if !u.IsActive {
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+// Counter assignment operations
+
+func (d *DB) GetUserCounterIDs(userID int64) ([]int64, error) {
+	rows, err := d.Query(`SELECT counter_id FROM user_counters WHERE user_id = ? ORDER BY counter_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// IsUserAssignedToCounter reports whether the user may operate the counter.
+func (d *DB) IsUserAssignedToCounter(userID, counterID int64) (bool, error) {
+	var count int
+	err := d.QueryRow(`
+		SELECT COUNT(*) FROM user_counters WHERE user_id = ? AND counter_id = ?
+	`, userID, counterID).Scan(&count)
+	return count > 0, err
+}
+
+func setUserCountersTx(tx *sql.Tx, userID int64, counterIDs []int64) error {
+	if _, err := tx.Exec(`DELETE FROM user_counters WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to clear counter assignments: %w", err)
+	}
+	for _, counterID := range counterIDs {
+		var exists int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM counters WHERE id = ?`, counterID).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check counter: %w", err)
+		}
+		if exists == 0 {
+			return ErrUnknownCounter
+		}
+		if _, err := tx.Exec(`
+			INSERT OR IGNORE INTO user_counters (user_id, counter_id) VALUES (?, ?)
+		`, userID, counterID); err != nil {
+			return fmt.Errorf("failed to assign counter: %w", err)
+		}
+	}
+	return nil
+}
+
+// isActiveAdminTx reports whether the user is an active admin.
+func isActiveAdminTx(tx *sql.Tx, userID int64) (bool, error) {
+	var n int
+	err := tx.QueryRow(`
+		SELECT COUNT(*) FROM users WHERE id = ? AND role = ? AND is_active = 1
+	`, userID, models.RoleAdmin).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check user role: %w", err)
+	}
+	return n > 0, nil
+}
+
+// checkActiveAdminTx returns ErrLastAdmin if no active admin account is
+// left.
+func checkActiveAdminTx(tx *sql.Tx) error {
+	var n int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ? AND is_active = 1`, models.RoleAdmin).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("failed to count admins: %w", err)
+	}
+	if n == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
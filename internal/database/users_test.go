@@ -0,0 +1,135 @@
+package database
+
+import (
+	"slices"
+	"testing"
+
+	"queue-system/internal/models"
+)
+
+func mustCreateUser(t *testing.T, d *DB, username string, role models.UserRole, counterIDs []int64) *models.User {
+	t.Helper()
+	u, err := d.CreateUser(username, "Nama "+username, "rahasia", role, counterIDs)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return u
+}
+
+func TestAuthenticateUser(t *testing.T) {
+	d := newTestDB(t)
+	mustCreateUser(t, d, "budi", models.RoleOperator, nil)
+	disabled := mustCreateUser(t, d, "sari", models.RoleOperator, nil)
+	if err := d.UpdateUser(disabled.ID, disabled.FullName, disabled.Role, false, nil); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  error
+	}{
+		{"right password", "budi", "rahasia", nil},
+		{"wrong password", "budi", "salah", ErrInvalidCredentials},
+		{"unknown user", "joko", "rahasia", ErrInvalidCredentials},
+		{"disabled account", "sari", "rahasia", ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		u, err := d.AuthenticateUser(tt.username, tt.password)
+		if err != tt.wantErr {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && u.Username != tt.username {
+			t.Errorf("%s: authenticated as %s", tt.name, u.Username)
+		}
+	}
+}
+
+func TestUserCounters(t *testing.T) {
+	d := newTestDB(t)
+	first := mustCreateCounter(t, d, "1")
+	second := mustCreateCounter(t, d, "2")
+	u := mustCreateUser(t, d, "budi", models.RoleOperator, []int64{first.ID})
+
+	tests := []struct {
+		name       string
+		counterIDs []int64
+		wantErr    error
+		want       []int64
+	}{
+		{"reassign", []int64{second.ID}, nil, []int64{second.ID}},
+		{"both, with a duplicate", []int64{second.ID, first.ID, first.ID}, nil, []int64{first.ID, second.ID}},
+		{"unknown counter keeps the old assignment", []int64{first.ID, 99}, ErrUnknownCounter, []int64{first.ID, second.ID}},
+		{"none", nil, nil, []int64{}},
+	}
+	for _, tt := range tests {
+		err := d.UpdateUser(u.ID, u.FullName, u.Role, true, tt.counterIDs)
+		if err != tt.wantErr {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		got, err := d.GetUserCounterIDs(u.ID)
+		if err != nil {
+			t.Fatalf("GetUserCounterIDs: %v", err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: counters %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := d.CreateUser("joko", "", "rahasia", models.RoleOperator, []int64{99}); err != ErrUnknownCounter {
+		t.Errorf("CreateUser with an unknown counter: error = %v, want ErrUnknownCounter", err)
+	}
+	if _, err := d.GetUserByUsername("joko"); err == nil {
+		t.Error("user with an unknown counter was created")
+	}
+}
+
+func TestLastActiveAdmin(t *testing.T) {
+	tests := []struct {
+		name    string
+		admins  int
+		change  func(d *DB, u *models.User) error
+		wantErr error
+	}{
+		{"demote the last admin", 1, func(d *DB, u *models.User) error {
+			return d.UpdateUser(u.ID, u.FullName, models.RoleSupervisor, true, nil)
+		}, ErrLastAdmin},
+		{"deactivate the last admin", 1, func(d *DB, u *models.User) error {
+			return d.UpdateUser(u.ID, u.FullName, u.Role, false, nil)
+		}, ErrLastAdmin},
+		{"delete the last admin", 1, func(d *DB, u *models.User) error { return d.DeleteUser(u.ID) }, ErrLastAdmin},
+		{"rename the last admin", 1, func(d *DB, u *models.User) error {
+			return d.UpdateUser(u.ID, "Admin Baru", u.Role, true, nil)
+		}, nil},
+		{"demote one of two admins", 2, func(d *DB, u *models.User) error {
+			return d.UpdateUser(u.ID, u.FullName, models.RoleOperator, true, nil)
+		}, nil},
+		{"delete one of two admins", 2, func(d *DB, u *models.User) error { return d.DeleteUser(u.ID) }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDB(t)
+			mustCreateUser(t, d, "operator", models.RoleOperator, nil)
+			var u *models.User
+			for i := 0; i < tt.admins; i++ {
+				u = mustCreateUser(t, d, string(rune('a'+i))+"dmin", models.RoleAdmin, nil)
+			}
+
+			if err := tt.change(d, u); err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				return
+			}
+			got, err := d.GetUser(u.ID)
+			if err != nil {
+				t.Fatalf("GetUser: %v", err)
+			}
+			if got.Role != models.RoleAdmin || !got.IsActive {
+				t.Errorf("admin changed to %s, active %v", got.Role, got.IsActive)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"queue-system/internal/models"
+)
+
+// Audit action names, grouped by target so they can be filtered by prefix.
+const (
+	auditLogin            = "auth.login"
+	auditLoginFailed      = "auth.login_failed"
+	auditLogout           = "auth.logout"
+	auditSessionRevoke    = "auth.session_revoke"
+	auditLogoutAll        = "auth.logout_all"
+	auditTokenCreate      = "token.create"
+	auditTokenRevoke      = "token.revoke"
+	auditUserCreate       = "user.create"
+	auditUserUpdate       = "user.update"
+	auditUserDelete       = "user.delete"
+	auditCounterCreate    = "counter.create"
+	auditCounterUpdate    = "counter.update"
+	auditCounterDelete    = "counter.delete"
+	auditTypeCreate       = "queue_type.create"
+	auditTypeUpdate       = "queue_type.update"
+	auditTypeDelete       = "queue_type.delete"
+	auditSettingsUpdate   = "settings.update"
+	auditLogoUpdate       = "settings.logo_update"
+	auditLogoDelete       = "settings.logo_delete"
+	auditLayoutUpdate     = "settings.layout_update"
+	auditLayoutReset      = "settings.layout_reset"
+	auditQueueReset       = "queue.reset"
+	auditQueueCallNext    = "queue.call_next"
+	auditQueueRecall      = "queue.recall"
+	auditQueueComplete    = "queue.complete"
+	auditQueueCancel      = "queue.cancel"
+	auditQueuePriority    = "queue.priority"
+	auditQueueSkip        = "queue.skip"
+	auditQueueReturn      = "queue.return"
+	auditQueueTransfer    = "queue.transfer"
+	auditQueueOffline     = "queue.offline_sync"
+	auditPrinterTest      = "printer.test"
+	auditPrintJobClaim    = "print_job.claim"
+	auditPrintJobDone     = "print_job.complete"
+	auditPrintJobFail     = "print_job.fail"
+	auditPrintJobReissue  = "print_job.reissue"
+	auditPrintJobDismiss  = "print_job.dismiss"
+	auditPrintAgentDelete = "print_agent.delete"
+	auditPrintAgentConfig = "print_agent.config"
+)
+
+// audit records an action by the request's session or API token.
+func (h *Handler) audit(r *http.Request, action, targetType, targetID string, before, after interface{}) {
+	h.auditAs(r, nil, action, targetType, targetID, before, after)
+}
+
+// auditAs records an action on behalf of sess, for requests that do not
+// carry the acting session yet (logins). A nil sess uses the request's own
+// session or API token. before and after are stored as JSON; pass nil to
+// leave them empty. Failures are logged and never fail the request.
+func (h *Handler) auditAs(r *http.Request, sess *models.Session, action, targetType, targetID string, before, after interface{}) {
+	entry := &models.AuditEntry{
+		IP:         clientIP(r),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+	}
+
+	if sess == nil {
+		if token := requestToken(r); token != nil {
+			entry.Actor = "token:" + token.Name
+			entry.ActorRole = "api-token"
+		} else {
+			sess = h.currentSession(r)
+		}
+	}
+	if sess != nil {
+		entry.ActorID = sess.UserID
+		entry.Actor = sess.Username
+		entry.ActorRole = string(sess.Role)
+	}
+	if entry.Actor == "" {
+		entry.Actor = "anonymous"
+	}
+
+	if before != nil {
+		entry.Before, _ = json.Marshal(before)
+	}
+	if after != nil {
+		entry.After, _ = json.Marshal(after)
+	}
+
+	if err := h.db.AddAuditEntry(entry); err != nil {
+		log.Printf("Failed to write audit log (%s): %v", action, err)
+	}
+}
+
+// handleAuditLog lists audit entries with optional filters:
+// actor, action, target_type, target_id, from, to, page and per_page.
+func (h *Handler) handleAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := models.AuditFilter{
+		Actor:      q.Get("actor"),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+		From:       q.Get("from"),
+		To:         q.Get("to"),
+	}
+
+	page := 1
+	if p := q.Get("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+
+	perPage := 50
+	if pp := q.Get("per_page"); pp != "" {
+		if parsed, err := strconv.Atoi(pp); err == nil && parsed > 0 && parsed <= 200 {
+			perPage = parsed
+		}
+	}
+
+	result, err := h.db.ListAuditLog(filter, page, perPage)
+	if err != nil {
+		log.Printf("Failed to list audit log: %v", err)
+		h.jsonError(w, "Failed to list audit log", http.StatusInternalServerError)
+		return
+	}
+
+	h.jsonResponse(w, result)
+}
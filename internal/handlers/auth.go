@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+// accessLevel is the minimum identity a request must carry.
+type accessLevel int
+
+const (
+	accessPublic   accessLevel = iota // kiosk, display and anonymous reads
+	accessKiosk                       // kiosks, when security.kiosk_auth is on
+	accessOperator                    // any signed-in staff member
+	accessAdmin                       // administrators (supervisors: read-only)
+)
+
+// routePolicy declares who may call a route. Read applies to GET and HEAD,
+// Write to every other method. Scope, if set, also admits API tokens that
+// carry it, for any method.
+type routePolicy struct {
+	Read  accessLevel
+	Write accessLevel
+	Scope models.TokenScope
+}
+
+var (
+	policyPublic     = routePolicy{Read: accessPublic, Write: accessPublic}
+	policyPublicRead = routePolicy{Read: accessPublic, Write: accessAdmin}
+	policyKiosk      = routePolicy{Read: accessPublic, Write: accessKiosk, Scope: models.ScopeKiosk}
+	policyOperator   = routePolicy{Read: accessOperator, Write: accessOperator}
+	policyAdmin      = routePolicy{Read: accessAdmin, Write: accessAdmin}
+	policyReporting  = routePolicy{Read: accessAdmin, Write: accessAdmin, Scope: models.ScopeReporting}
+	policyPrintAgent = routePolicy{Read: accessAdmin, Write: accessAdmin, Scope: models.ScopePrintAgent}
+)
+
+type contextKey int
+
+const apiTokenKey contextKey = iota
+
+// route registers a handler on the mux behind the given access policy.
+func (h *Handler) route(mux *http.ServeMux, pattern string, p routePolicy, handler http.HandlerFunc) {
+	mux.HandleFunc(pattern, h.authorize(p, handler))
+}
+
+// authorize enforces a route policy, answering with a JSON 401 when the
+// request is anonymous and a JSON 403 when its role or token scope is
+// insufficient.
+func (h *Handler) authorize(p routePolicy, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		level := p.Write
+		if isSafeMethod(r.Method) {
+			level = p.Read
+		}
+		if level == accessKiosk && !h.config.Security.KioskAuth {
+			level = accessPublic
+		}
+		if level == accessPublic {
+			next(w, r)
+			return
+		}
+
+		if raw := bearerToken(r); raw != "" {
+			token := h.authenticateToken(raw)
+			if token == nil {
+				h.jsonError(w, "Invalid API token", http.StatusUnauthorized)
+				return
+			}
+			if p.Scope == "" || !token.HasScope(p.Scope) {
+				h.jsonError(w, "Forbidden: token lacks required scope", http.StatusForbidden)
+				return
+			}
+			next(w, r.WithContext(context.WithValue(r.Context(), apiTokenKey, token)))
+			return
+		}
+
+		sess := h.currentSession(r)
+		if sess == nil {
+			h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !roleSatisfies(sess.Role, level, r.Method) {
+			h.jsonError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// roleSatisfies reports whether a role meets the access level for a method.
+// Supervisors may read everything an admin can, but not change it.
+func roleSatisfies(role models.UserRole, level accessLevel, method string) bool {
+	switch level {
+	case accessPublic:
+		return true
+	case accessKiosk:
+		return role == models.RoleKiosk || role == models.RoleOperator || role == models.RoleSupervisor || role == models.RoleAdmin
+	case accessOperator:
+		return role == models.RoleOperator || role == models.RoleSupervisor || role == models.RoleAdmin
+	case accessAdmin:
+		return role == models.RoleAdmin || (role == models.RoleSupervisor && isSafeMethod(method))
+	}
+	return false
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[7:])
+}
+
+// authenticateToken looks up a raw API token and returns it if it is still
+// usable, or nil otherwise.
+func (h *Handler) authenticateToken(raw string) *models.APIToken {
+	token, err := h.db.GetAPITokenByHash(hashToken(raw))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to load API token: %v", err)
+		}
+		return nil
+	}
+	if !token.IsUsable() {
+		return nil
+	}
+
+	if !token.LastUsedAt.Valid || time.Since(token.LastUsedAt.Time) >= sessionTouchInterval {
+		if err := h.db.TouchAPIToken(token.ID); err != nil {
+			log.Printf("Failed to update API token: %v", err)
+		}
+	}
+	return token
+}
+
+// requestToken returns the API token that authorized the request, if any.
+func requestToken(r *http.Request) *models.APIToken {
+	token, _ := r.Context().Value(apiTokenKey).(*models.APIToken)
+	return token
+}
+
+// resolveAgentID returns the agent ID a print-agent request acts as. A token
+// always acts as the agent it is pinned to and may not claim another; a
+// token pinned to no agent is refused.
+func resolveAgentID(r *http.Request, requested string) (string, bool) {
+	token := requestToken(r)
+	if token == nil {
+		return requested, requested != ""
+	}
+	if token.AgentID == "" || (requested != "" && requested != token.AgentID) {
+		return "", false
+	}
+	return token.AgentID, true
+}
+
+// agentGroup returns the printer group a print-agent request acts for. It
+// comes from the API token, never from the request, so an agent only sees
+// and claims the jobs of the group an admin put it in.
+func agentGroup(r *http.Request) string {
+	if token := requestToken(r); token != nil {
+		return token.Group
+	}
+	return ""
+}
+
+// kioskIdentity returns the name a kiosk is known by for print routing: its
+// API token or kiosk account if it signed in, otherwise the name it gives
+// itself.
+func (h *Handler) kioskIdentity(r *http.Request, claimed string) string {
+	if token := requestToken(r); token != nil {
+		return token.Name
+	}
+	if sess := h.currentSession(r); sess != nil && sess.Role == models.RoleKiosk {
+		return sess.Username
+	}
+	return claimed
+}
+
+// counterAction adapts a counter handler to a /api/counter/{id}/... route and
+// checks that the session may operate that counter.
+func (h *Handler) counterAction(next func(http.ResponseWriter, *http.Request, int64)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		counterID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			h.jsonError(w, "Invalid counter ID", http.StatusBadRequest)
+			return
+		}
+		if !h.canOperateCounter(h.currentSession(r), counterID) {
+			h.jsonError(w, "Forbidden: not assigned to this counter", http.StatusForbidden)
+			return
+		}
+		next(w, r, counterID)
+	}
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+func TestRoleSatisfies(t *testing.T) {
+	tests := []struct {
+		role   models.UserRole
+		level  accessLevel
+		method string
+		want   bool
+	}{
+		{"", accessPublic, http.MethodPost, true},
+		{models.RoleKiosk, accessKiosk, http.MethodPost, true},
+		{models.RoleOperator, accessKiosk, http.MethodPost, true},
+		{models.RoleKiosk, accessOperator, http.MethodGet, false},
+		{models.RoleOperator, accessOperator, http.MethodPost, true},
+		{models.RoleSupervisor, accessOperator, http.MethodPost, true},
+		{models.RoleAdmin, accessOperator, http.MethodPost, true},
+		{models.RoleOperator, accessAdmin, http.MethodGet, false},
+		{models.RoleSupervisor, accessAdmin, http.MethodGet, true},
+		{models.RoleSupervisor, accessAdmin, http.MethodHead, true},
+		{models.RoleSupervisor, accessAdmin, http.MethodPost, false},
+		{models.RoleSupervisor, accessAdmin, http.MethodDelete, false},
+		{models.RoleAdmin, accessAdmin, http.MethodDelete, true},
+		{"unknown", accessOperator, http.MethodGet, false},
+	}
+	for _, tt := range tests {
+		if got := roleSatisfies(tt.role, tt.level, tt.method); got != tt.want {
+			t.Errorf("roleSatisfies(%q, %d, %s) = %v, want %v", tt.role, tt.level, tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	h := newTestHandler(t)
+
+	newSession := func(role models.UserRole, expiresIn time.Duration) string {
+		raw := string(role) + "-" + expiresIn.String()
+		now := time.Now()
+		err := h.db.CreateSession(&models.Session{
+			TokenHash: hashToken(raw), UserID: 1, Username: string(role), Role: role,
+			CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(expiresIn),
+		})
+		if err != nil {
+			t.Fatalf("failed to create session: %v", err)
+		}
+		return raw
+	}
+	newToken := func(raw string, scope models.TokenScope, revoked bool) string {
+		token := &models.APIToken{Name: raw, TokenHash: hashToken(raw), Prefix: raw, Scopes: []models.TokenScope{scope}}
+		if err := h.db.CreateAPIToken(token); err != nil {
+			t.Fatalf("failed to create token: %v", err)
+		}
+		if revoked {
+			if err := h.db.RevokeAPIToken(token.ID); err != nil {
+				t.Fatalf("failed to revoke token: %v", err)
+			}
+		}
+		return raw
+	}
+
+	admin := newSession(models.RoleAdmin, time.Hour)
+	supervisor := newSession(models.RoleSupervisor, time.Hour)
+	operator := newSession(models.RoleOperator, time.Hour)
+	kiosk := newSession(models.RoleKiosk, time.Hour)
+	expired := newSession(models.RoleAdmin, -time.Minute)
+	agentToken := newToken("qs_agent", models.ScopePrintAgent, false)
+	kioskToken := newToken("qs_kiosk", models.ScopeKiosk, false)
+	revokedToken := newToken("qs_revoked", models.ScopePrintAgent, true)
+
+	tests := []struct {
+		name      string
+		policy    routePolicy
+		method    string
+		session   string
+		token     string
+		kioskAuth bool
+		want      int
+	}{
+		{"public write, anonymous", policyPublic, http.MethodPost, "", "", false, http.StatusOK},
+		{"public read, anonymous", policyPublicRead, http.MethodGet, "", "", false, http.StatusOK},
+		{"public read write, anonymous", policyPublicRead, http.MethodPost, "", "", false, http.StatusUnauthorized},
+		{"public read write, supervisor", policyPublicRead, http.MethodPost, supervisor, "", false, http.StatusForbidden},
+		{"admin, anonymous", policyAdmin, http.MethodGet, "", "", false, http.StatusUnauthorized},
+		{"admin, expired session", policyAdmin, http.MethodGet, expired, "", false, http.StatusUnauthorized},
+		{"admin, unknown session", policyAdmin, http.MethodGet, "nope", "", false, http.StatusUnauthorized},
+		{"admin read, supervisor", policyAdmin, http.MethodGet, supervisor, "", false, http.StatusOK},
+		{"admin write, supervisor", policyAdmin, http.MethodPost, supervisor, "", false, http.StatusForbidden},
+		{"admin write, admin", policyAdmin, http.MethodPost, admin, "", false, http.StatusOK},
+		{"admin read, operator", policyAdmin, http.MethodGet, operator, "", false, http.StatusForbidden},
+		{"operator, operator", policyOperator, http.MethodPost, operator, "", false, http.StatusOK},
+		{"operator, kiosk", policyOperator, http.MethodPost, kiosk, "", false, http.StatusForbidden},
+		{"kiosk, anonymous without kiosk_auth", policyKiosk, http.MethodPost, "", "", false, http.StatusOK},
+		{"kiosk, anonymous with kiosk_auth", policyKiosk, http.MethodPost, "", "", true, http.StatusUnauthorized},
+		{"kiosk, kiosk account", policyKiosk, http.MethodPost, kiosk, "", true, http.StatusOK},
+		{"kiosk, kiosk token", policyKiosk, http.MethodPost, "", kioskToken, true, http.StatusOK},
+		{"kiosk, print-agent token", policyKiosk, http.MethodPost, "", agentToken, true, http.StatusForbidden},
+		{"print agent, print-agent token", policyPrintAgent, http.MethodPost, "", agentToken, false, http.StatusOK},
+		{"print agent, kiosk token", policyPrintAgent, http.MethodGet, "", kioskToken, false, http.StatusForbidden},
+		{"print agent, revoked token", policyPrintAgent, http.MethodPost, "", revokedToken, false, http.StatusUnauthorized},
+		{"print agent, unknown token", policyPrintAgent, http.MethodPost, "", "qs_nope", false, http.StatusUnauthorized},
+		{"print agent, admin", policyPrintAgent, http.MethodPost, admin, "", false, http.StatusOK},
+		{"admin, print-agent token", policyAdmin, http.MethodGet, "", agentToken, false, http.StatusForbidden},
+		{"reporting, admin", policyReporting, http.MethodGet, admin, "", false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.config.Security.KioskAuth = tt.kioskAuth
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.session != "" {
+				req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: tt.session})
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			h.authorize(tt.policy, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveAgentID(t *testing.T) {
+	pinned := &models.APIToken{AgentID: "printer-lobi"}
+	unpinned := &models.APIToken{}
+	tests := []struct {
+		name      string
+		token     *models.APIToken
+		requested string
+		want      string
+		wantOK    bool
+	}{
+		{"no token, named", nil, "printer-1", "printer-1", true},
+		{"no token, unnamed", nil, "", "", false},
+		{"unpinned token, named", unpinned, "printer-1", "", false},
+		{"unpinned token, unnamed", unpinned, "", "", false},
+		{"pinned token, unnamed", pinned, "", "printer-lobi", true},
+		{"pinned token, same agent", pinned, "printer-lobi", "printer-lobi", true},
+		{"pinned token, other agent", pinned, "printer-1", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.token != nil {
+				req = req.WithContext(context.WithValue(req.Context(), apiTokenKey, tt.token))
+			}
+			got, ok := resolveAgentID(req, tt.requested)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("resolveAgentID(%q) = %q, %v, want %q, %v", tt.requested, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// access is who may call a route with a given method.
+type access int
+
+const (
+	anyone  access = iota
+	staff          // operators, supervisors and admins
+	readers        // supervisors and admins
+	admins
+)
+
+// routeTests lists every route with the access each method needs. Routes
+// are called with IDs that do not exist, so allowed calls change nothing.
+var routeTests = []struct {
+	method string
+	path   string
+	want   access
+}{
+	{http.MethodGet, "/", anyone},
+	{http.MethodGet, "/admin", anyone},
+	{http.MethodGet, "/admin/login", anyone},
+	{http.MethodGet, "/admin/logout", anyone},
+	{http.MethodGet, "/display", anyone},
+	{http.MethodGet, "/ticket", anyone},
+	{http.MethodGet, "/ticket/login", anyone},
+	{http.MethodGet, "/t/tidakada", anyone},
+	{http.MethodGet, "/counters", anyone},
+	{http.MethodGet, "/counter/999", anyone},
+	{http.MethodGet, "/health", anyone},
+	{http.MethodGet, "/api/queues", anyone},
+	{http.MethodPost, "/api/queues/take", anyone},
+	{http.MethodGet, "/api/queues/Z999/status", anyone},
+	{http.MethodPut, "/api/queue/999/priority", staff},
+	{http.MethodGet, "/api/queue-types", anyone},
+	{http.MethodPost, "/api/queue-types", admins},
+	{http.MethodGet, "/api/queue-type/999", anyone},
+	{http.MethodPut, "/api/queue-type/999", admins},
+	{http.MethodDelete, "/api/queue-type/999", admins},
+	{http.MethodGet, "/api/counters", anyone},
+	{http.MethodPost, "/api/counters", admins},
+	{http.MethodGet, "/api/counter/999", anyone},
+	{http.MethodPut, "/api/counter/999", admins},
+	{http.MethodDelete, "/api/counter/999", admins},
+	{http.MethodPost, "/api/counter/1/call-next", staff},
+	{http.MethodPost, "/api/counter/1/recall", staff},
+	{http.MethodPost, "/api/counter/1/complete", staff},
+	{http.MethodPost, "/api/counter/1/cancel", staff},
+	{http.MethodPost, "/api/counter/1/skip", staff},
+	{http.MethodPost, "/api/counter/1/transfer", staff},
+	{http.MethodPost, "/api/counter/1/return", staff},
+	{http.MethodGet, "/api/stats", anyone},
+	{http.MethodGet, "/api/stats/by-type", anyone},
+	{http.MethodGet, "/api/settings", anyone},
+	{http.MethodPost, "/api/settings", admins},
+	{http.MethodGet, "/api/settings/logo", anyone},
+	{http.MethodDelete, "/api/settings/logo", admins},
+	{http.MethodGet, "/api/settings/ticket-layout", readers},
+	{http.MethodPut, "/api/settings/ticket-layout", admins},
+	{http.MethodGet, "/api/printer/preview", readers},
+	{http.MethodPost, "/api/printer/preview", admins},
+	{http.MethodPost, "/api/admin/reset-queues", admins},
+	{http.MethodGet, "/api/users", readers},
+	{http.MethodPost, "/api/users", admins},
+	{http.MethodGet, "/api/user/999", readers},
+	{http.MethodPut, "/api/user/999", admins},
+	{http.MethodDelete, "/api/user/999", admins},
+	{http.MethodGet, "/api/admin/sessions", readers},
+	{http.MethodPost, "/api/admin/sessions/logout-all", admins},
+	{http.MethodDelete, "/api/admin/session/999", admins},
+	{http.MethodGet, "/api/admin/audit", readers},
+	{http.MethodPost, "/api/admin/audit", admins},
+	{http.MethodGet, "/api/admin/tokens", readers},
+	{http.MethodPost, "/api/admin/tokens", admins},
+	{http.MethodDelete, "/api/admin/token/999", admins},
+	{http.MethodGet, "/api/admin/print-jobs", readers},
+	{http.MethodPost, "/api/admin/print-job/999/reissue", admins},
+	{http.MethodPost, "/api/admin/print-job/999/dismiss", admins},
+	{http.MethodGet, "/api/admin/print-agents", readers},
+	{http.MethodDelete, "/api/admin/print-agents/tidakada", admins},
+	{http.MethodGet, "/api/admin/print-agents/tidakada/config", readers},
+	{http.MethodPut, "/api/admin/print-agents/tidakada/config", admins},
+	{http.MethodGet, "/api/admin/sse", readers},
+	{http.MethodGet, "/api/report", readers},
+	{http.MethodGet, "/api/report/export", readers},
+	{http.MethodPost, "/api/print-ticket", anyone},
+	{http.MethodPost, "/api/printer/test", admins},
+	{http.MethodGet, "/api/printer/status", readers},
+	{http.MethodGet, "/api/print-agent/sse", readers},
+	{http.MethodPost, "/api/print-agent/status", admins},
+	{http.MethodGet, "/api/print-agent/jobs/pending", readers},
+	{http.MethodPost, "/api/print-agent/job/999/complete", admins},
+	{http.MethodPost, "/api/print-agent/heartbeat", admins},
+	{http.MethodGet, "/api/print-agent/config", readers},
+	{http.MethodPost, "/api/print-agent/number-blocks", admins},
+	{http.MethodPost, "/api/print-agent/offline-tickets", admins},
+	{http.MethodGet, "/api/sse/display", anyone},
+	{http.MethodGet, "/api/sse/ticket/tidakada", anyone},
+	{http.MethodGet, "/api/sse/counter/1", anyone},
+}
+
+func TestRoutePolicies(t *testing.T) {
+	h := newTestHandler(t)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	counter, err := h.db.CreateCounter("1", "Loket 1")
+	if err != nil {
+		t.Fatalf("CreateCounter: %v", err)
+	}
+	operator, err := h.db.CreateUser("budi", "Budi", "rahasia", models.RoleOperator, []int64{counter.ID})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	callers := []struct {
+		name string
+		sess *models.Session
+		may  func(access) bool
+	}{
+		{"anonymous", nil, func(a access) bool { return a == anyone }},
+		{"operator", &models.Session{UserID: operator.ID, Username: "budi", Role: models.RoleOperator, CounterID: counter.ID},
+			func(a access) bool { return a <= staff }},
+		{"supervisor", &models.Session{Username: "sari", Role: models.RoleSupervisor},
+			func(a access) bool { return a <= readers }},
+		{"admin", &models.Session{Username: "admin", Role: models.RoleAdmin},
+			func(access) bool { return true }},
+	}
+	for _, rt := range routeTests {
+		for _, c := range callers {
+			req := httptest.NewRequest(rt.method, rt.path, nil)
+			if c.sess != nil {
+				sess := *c.sess
+				signIn(t, h, req, &sess)
+			}
+			// Event streams return as soon as the client is gone
+			ctx, cancel := context.WithCancel(req.Context())
+			cancel()
+			req = req.WithContext(ctx)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rejected, want := isRejected(rec), !c.may(rt.want); rejected != want {
+				t.Errorf("%s %s as %s: status %d, rejected %v, want %v", rt.method, rt.path, c.name, rec.Code, rejected, want)
+			}
+		}
+	}
+}
+
+// isRejected reports whether authorize turned the request away.
+func isRejected(rec *httptest.ResponseRecorder) bool {
+	if rec.Code != http.StatusUnauthorized && rec.Code != http.StatusForbidden {
+		return false
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	return body.Error == "Unauthorized" || body.Error == "Forbidden"
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"embed"
 	"encoding/hex"
@@ -10,10 +11,10 @@ import (
 	"html/template"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"queue-system/internal/config"
@@ -24,16 +25,43 @@ import (
 )
 
 type Handler struct {
-	db         *database.DB
-	hub        *sse.Hub
-	config     *config.Config
-	tmpl       *template.Template
-	staticFS   fs.FS
-	printer    *printer.Printer
-	sessions   map[string]time.Time
-	sessionsMu sync.RWMutex
+	db       *database.DB
+	hub      *sse.Hub
+	config   *config.Config
+	tmpl     *template.Template
+	staticFS fs.FS
+	printer  *printer.Printer
+	sessions SessionStore
+	agents   agentWatch
+	// ticketsChanged wakes the worker refreshing ticket status pages
+	ticketsChanged chan struct{}
 }
 
+// SessionStore persists browser sessions so they survive restarts and can be
+// shared by several server processes. *database.DB implements it.
+type SessionStore interface {
+	CreateSession(s *models.Session) error
+	GetSession(tokenHash string) (*models.Session, error)
+	TouchSession(id int64, expiresAt time.Time, ip, userAgent string) error
+	ListSessions() ([]*models.Session, error)
+	DeleteSession(id int64) error
+	DeleteAllSessions(keepID int64) (int64, error)
+	DeleteUserSessions(userID int64) error
+	DeleteExpiredSessions() (int64, error)
+}
+
+const (
+	sessionCookieName = "queue_session"
+
+	// sessionCookieMaxAge keeps the cookie around across browser restarts;
+	// the server-side sliding expiry decides whether it is still valid.
+	sessionCookieMaxAge = 30 * 24 * 60 * 60
+
+	// sessionTouchInterval limits how often a session's sliding expiry is
+	// written back to the store.
+	sessionTouchInterval = time.Minute
+)
+
 func New(db *database.DB, hub *sse.Hub, cfg *config.Config, webFS embed.FS) (*Handler, error) {
 	tmpl, err := template.ParseFS(webFS, "web/templates/*.html")
 	if err != nil {
@@ -49,17 +77,31 @@ func New(db *database.DB, hub *sse.Hub, cfg *config.Config, webFS embed.FS) (*Ha
 	printerInstance := printer.New(printer.PrinterConfig{
 		Enabled:     cfg.Printer.Enabled,
 		PrinterName: cfg.Printer.PrinterName,
+		Backend:     cfg.Printer.Backend,
+		Address:     cfg.Printer.Address,
+		PaperWidth:  cfg.Printer.PaperWidth,
+		Columns:     cfg.Printer.Columns,
+		Codepage:    cfg.Printer.Codepage,
 	})
+	if cfg.Printer.Enabled {
+		if err := printerInstance.Err(); err != nil {
+			return nil, fmt.Errorf("invalid printer config: %w", err)
+		}
+		log.Printf("Local printer: %s", printerInstance.Describe())
+	}
 
-	return &Handler{
-		db:       db,
-		hub:      hub,
-		config:   cfg,
-		tmpl:     tmpl,
-		staticFS: staticFS,
-		printer:  printerInstance,
-		sessions: make(map[string]time.Time),
-	}, nil
+	h := &Handler{
+		db:             db,
+		hub:            hub,
+		config:         cfg,
+		tmpl:           tmpl,
+		staticFS:       staticFS,
+		printer:        printerInstance,
+		sessions:       db,
+		ticketsChanged: make(chan struct{}, 1),
+	}
+	go h.ticketStatusWorker()
+	return h, nil
 }
 
 // --- Session helpers ---
@@ -70,53 +112,109 @@ func (h *Handler) generateToken() string {
 	return hex.EncodeToString(b)
 }
 
-func (h *Handler) isAuthenticated(r *http.Request) bool {
-	cookie, err := r.Cookie("admin_session")
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (h *Handler) sessionTimeout() time.Duration {
+	timeout := time.Duration(h.config.Security.SessionTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 3600 * time.Second
+	}
+	return timeout
+}
+
+// currentSession returns the session attached to the request, or nil if the
+// request carries no valid session cookie. Each use slides the expiry forward.
+func (h *Handler) currentSession(r *http.Request) *models.Session {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	sess, err := h.sessions.GetSession(hashToken(cookie.Value))
 	if err != nil {
-		return false
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to load session: %v", err)
+		}
+		return nil
 	}
-	h.sessionsMu.RLock()
-	expiry, ok := h.sessions[cookie.Value]
-	h.sessionsMu.RUnlock()
-	if !ok {
-		return false
+
+	sess.Current = true
+	if time.Since(sess.LastSeenAt) >= sessionTouchInterval {
+		sess.ExpiresAt = time.Now().Add(h.sessionTimeout())
+		sess.IP = clientIP(r)
+		sess.UserAgent = r.UserAgent()
+		if err := h.sessions.TouchSession(sess.ID, sess.ExpiresAt, sess.IP, sess.UserAgent); err != nil {
+			log.Printf("Failed to refresh session: %v", err)
+		}
 	}
-	if time.Now().After(expiry) {
-		h.sessionsMu.Lock()
-		delete(h.sessions, cookie.Value)
-		h.sessionsMu.Unlock()
+	return sess
+}
+
+// isAuthenticated reports whether the request may use the admin panel.
+func (h *Handler) isAuthenticated(r *http.Request) bool {
+	sess := h.currentSession(r)
+	return sess != nil && (sess.Role == models.RoleAdmin || sess.Role == models.RoleSupervisor)
+}
+
+// canOperateCounter reports whether the session may call, recall, complete
+// or cancel tickets at the given counter. Admins and supervisors may operate
+// any counter; operators only the counter they signed into, and only while
+// they are still assigned to it.
+func (h *Handler) canOperateCounter(sess *models.Session, counterID int64) bool {
+	if sess == nil {
 		return false
 	}
-	return true
+	switch sess.Role {
+	case models.RoleAdmin, models.RoleSupervisor:
+		return true
+	case models.RoleOperator:
+		if sess.CounterID != counterID {
+			return false
+		}
+		assigned, err := h.db.IsUserAssignedToCounter(sess.UserID, counterID)
+		if err != nil {
+			log.Printf("Failed to check counter assignment: %v", err)
+			return false
+		}
+		return assigned
+	}
+	return false
 }
 
-func (h *Handler) setAdminSession(w http.ResponseWriter) {
+func (h *Handler) setSession(w http.ResponseWriter, r *http.Request, sess *models.Session) {
 	token := h.generateToken()
-	timeout := time.Duration(h.config.Security.SessionTimeout) * time.Second
-	if timeout <= 0 {
-		timeout = 3600 * time.Second
+	now := time.Now()
+	sess.TokenHash = hashToken(token)
+	sess.IP = clientIP(r)
+	sess.UserAgent = r.UserAgent()
+	sess.CreatedAt = now
+	sess.LastSeenAt = now
+	sess.ExpiresAt = now.Add(h.sessionTimeout())
+	if err := h.sessions.CreateSession(sess); err != nil {
+		log.Printf("Failed to create session: %v", err)
+		return
 	}
-	h.sessionsMu.Lock()
-	h.sessions[token] = time.Now().Add(timeout)
-	h.sessionsMu.Unlock()
 	http.SetCookie(w, &http.Cookie{
-		Name:     "admin_session",
+		Name:     sessionCookieName,
 		Value:    token,
 		Path:     "/",
-		MaxAge:   int(timeout.Seconds()),
+		MaxAge:   sessionCookieMaxAge,
 		HttpOnly: true,
 		SameSite: http.SameSiteStrictMode,
 	})
 }
 
-func (h *Handler) clearAdminSession(w http.ResponseWriter, r *http.Request) {
-	if cookie, err := r.Cookie("admin_session"); err == nil {
-		h.sessionsMu.Lock()
-		delete(h.sessions, cookie.Value)
-		h.sessionsMu.Unlock()
+func (h *Handler) clearSession(w http.ResponseWriter, r *http.Request) {
+	if sess := h.currentSession(r); sess != nil {
+		h.auditAs(r, sess, auditLogout, "session", fmt.Sprint(sess.ID), nil, nil)
+		if err := h.sessions.DeleteSession(sess.ID); err != nil {
+			log.Printf("Failed to delete session: %v", err)
+		}
 	}
 	http.SetCookie(w, &http.Cookie{
-		Name:     "admin_session",
+		Name:     sessionCookieName,
 		Value:    "",
 		Path:     "/",
 		MaxAge:   -1,
@@ -124,15 +222,13 @@ func (h *Handler) clearAdminSession(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// adminAPIAuth wraps an API handler requiring session authentication.
-func (h *Handler) adminAPIAuth(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if !h.isAuthenticated(r) {
-			h.jsonError(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		next(w, r)
+// clientIP returns the remote IP address of a request without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
+	return host
 }
 
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
@@ -140,56 +236,91 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	staticHandler := http.StripPrefix("/static/", http.FileServer(http.FS(h.staticFS)))
 	mux.Handle("/static/", h.cacheMiddleware(staticHandler))
 
-	// Pages
-	mux.HandleFunc("/", h.handleIndex)
-	mux.HandleFunc("/admin", h.handleAdmin)
-	mux.HandleFunc("/admin/login", h.handleAdminLogin)
-	mux.HandleFunc("/admin/logout", h.handleAdminLogout)
-	mux.HandleFunc("/display", h.handleDisplay)
-	mux.HandleFunc("/ticket", h.handleTicket)
-	mux.HandleFunc("/counters", h.handleCountersPage)
-	mux.HandleFunc("/counter/", h.handleCounter)
-	mux.HandleFunc("/health", h.handleHealth)
+	// Pages (each page handles its own login redirect)
+	h.route(mux, "/", policyPublic, h.handleIndex)
+	h.route(mux, "/admin", policyPublic, h.handleAdmin)
+	h.route(mux, "/admin/login", policyPublic, h.handleAdminLogin)
+	h.route(mux, "/admin/logout", policyPublic, h.handleAdminLogout)
+	h.route(mux, "/display", policyPublic, h.handleDisplay)
+	h.route(mux, "/ticket", policyPublic, h.handleTicket)
+	h.route(mux, "/ticket/login", policyPublic, h.handleTicketLogin)
+	h.route(mux, "/counters", policyPublic, h.handleCountersPage)
+	h.route(mux, "/counter/", policyPublic, h.handleCounter)
+	h.route(mux, "/health", policyPublic, h.handleHealth)
+	h.route(mux, "/t/{token}", policyPublic, h.handleTicketStatusPage)
 
 	// API - Queues
-	mux.HandleFunc("/api/queues", h.handleQueues)
-	mux.HandleFunc("/api/queues/take", h.handleTakeQueue)
+	h.route(mux, "/api/queues", policyPublic, h.handleQueues)
+	h.route(mux, "/api/queues/take", policyKiosk, h.handleTakeQueue)
+	h.route(mux, "/api/queues/{number}/status", policyPublic, h.handleQueueStatus)
+	h.route(mux, "/api/queue/{id}/priority", policyOperator, h.handleQueuePriority)
 
 	// API - Queue Types
-	mux.HandleFunc("/api/queue-types", h.handleQueueTypes)
-	mux.HandleFunc("/api/queue-type/", h.handleQueueTypeAPI)
+	h.route(mux, "/api/queue-types", policyPublicRead, h.handleQueueTypes)
+	h.route(mux, "/api/queue-type/", policyPublicRead, h.handleQueueTypeAPI)
 
 	// API - Counters
-	mux.HandleFunc("/api/counters", h.handleCounters)
-	mux.HandleFunc("/api/counter/", h.handleCounterAPI)
+	h.route(mux, "/api/counters", policyPublicRead, h.handleCounters)
+	h.route(mux, "/api/counter/", policyPublicRead, h.handleCounterAPI)
+	h.route(mux, "/api/counter/{id}/call-next", policyOperator, h.counterAction(h.handleCallNext))
+	h.route(mux, "/api/counter/{id}/recall", policyOperator, h.counterAction(h.handleRecall))
+	h.route(mux, "/api/counter/{id}/complete", policyOperator, h.counterAction(h.handleComplete))
+	h.route(mux, "/api/counter/{id}/cancel", policyOperator, h.counterAction(h.handleCancel))
+	h.route(mux, "/api/counter/{id}/skip", policyOperator, h.counterAction(h.handleSkip))
+	h.route(mux, "/api/counter/{id}/transfer", policyOperator, h.counterAction(h.handleTransfer))
+	h.route(mux, "/api/counter/{id}/return", policyOperator, h.counterAction(h.handleReturn))
 
 	// API - Stats
-	mux.HandleFunc("/api/stats", h.handleStats)
-	mux.HandleFunc("/api/stats/by-type", h.handleStatsByType)
+	h.route(mux, "/api/stats", policyPublic, h.handleStats)
+	h.route(mux, "/api/stats/by-type", policyPublic, h.handleStatsByType)
 
 	// API - Settings
-	mux.HandleFunc("/api/settings", h.handleSettings)
-
-	// API - Admin (requires authentication)
-	mux.HandleFunc("/api/admin/reset-queues", h.adminAPIAuth(h.handleResetQueues))
+	h.route(mux, "/api/settings", policyPublicRead, h.handleSettings)
+	h.route(mux, "/api/settings/logo", policyPublicRead, h.handleTicketLogo)
+	h.route(mux, "/api/settings/ticket-layout", policyAdmin, h.handleTicketLayout)
+
+	// API - Admin
+	h.route(mux, "/api/admin/reset-queues", policyAdmin, h.handleResetQueues)
+	h.route(mux, "/api/admin/audit", policyAdmin, h.handleAuditLog)
+	h.route(mux, "/api/users", policyAdmin, h.handleUsers)
+	h.route(mux, "/api/user/", policyAdmin, h.handleUserAPI)
+	h.route(mux, "/api/admin/sessions", policyAdmin, h.handleSessions)
+	h.route(mux, "/api/admin/sessions/logout-all", policyAdmin, h.handleLogoutAllSessions)
+	h.route(mux, "/api/admin/session/", policyAdmin, h.handleSessionAPI)
+	h.route(mux, "/api/admin/tokens", policyAdmin, h.handleAPITokens)
+	h.route(mux, "/api/admin/token/", policyAdmin, h.handleAPITokenAPI)
+	h.route(mux, "/api/admin/print-jobs", policyAdmin, h.handleAdminPrintJobs)
+	h.route(mux, "/api/admin/print-job/{id}/reissue", policyAdmin, h.handleAdminPrintJobReissue)
+	h.route(mux, "/api/admin/print-job/{id}/dismiss", policyAdmin, h.handleAdminPrintJobDismiss)
+	h.route(mux, "/api/admin/print-agents", policyAdmin, h.handlePrintAgents)
+	h.route(mux, "/api/admin/print-agents/{id}", policyAdmin, h.handlePrintAgentDelete)
+	h.route(mux, "/api/admin/print-agents/{id}/config", policyAdmin, h.handlePrintAgentConfig)
+	h.route(mux, "/api/admin/sse", policyAdmin, h.handleAdminSSE)
 
 	// API - Reports
-	mux.HandleFunc("/api/report", h.handleReport)
-	mux.HandleFunc("/api/report/export", h.handleReportExport)
+	h.route(mux, "/api/report", policyReporting, h.handleReport)
+	h.route(mux, "/api/report/export", policyReporting, h.handleReportExport)
 
 	// API - Printer
-	mux.HandleFunc("/api/print-ticket", h.handlePrintTicket)
-	mux.HandleFunc("/api/printer/test", h.handlePrinterTest)
-	mux.HandleFunc("/api/printer/status", h.handlePrinterStatus)
+	h.route(mux, "/api/print-ticket", policyKiosk, h.handlePrintTicket)
+	h.route(mux, "/api/printer/test", policyAdmin, h.handlePrinterTest)
+	h.route(mux, "/api/printer/status", policyAdmin, h.handlePrinterStatus)
+	h.route(mux, "/api/printer/preview", policyAdmin, h.handlePrinterPreview)
 
 	// API - Print Agent (remote printing)
-	mux.HandleFunc("/api/print-agent/sse", h.handlePrintAgentSSE)
-	mux.HandleFunc("/api/print-agent/jobs/pending", h.handlePendingPrintJobs)
-	mux.HandleFunc("/api/print-agent/job/", h.handlePrintJobAPI)
+	h.route(mux, "/api/print-agent/sse", policyPrintAgent, h.handlePrintAgentSSE)
+	h.route(mux, "/api/print-agent/jobs/pending", policyPrintAgent, h.handlePendingPrintJobs)
+	h.route(mux, "/api/print-agent/job/", policyPrintAgent, h.handlePrintJobAPI)
+	h.route(mux, "/api/print-agent/status", policyPrintAgent, h.handleAgentPrinterStatus)
+	h.route(mux, "/api/print-agent/heartbeat", policyPrintAgent, h.handleAgentHeartbeat)
+	h.route(mux, "/api/print-agent/config", policyPrintAgent, h.handleAgentConfig)
+	h.route(mux, "/api/print-agent/number-blocks", policyPrintAgent, h.handleLeaseNumberBlock)
+	h.route(mux, "/api/print-agent/offline-tickets", policyPrintAgent, h.handleSyncOfflineTickets)
 
 	// SSE
-	mux.HandleFunc("/api/sse/display", h.handleDisplaySSE)
-	mux.HandleFunc("/api/sse/counter/", h.handleCounterSSE)
+	h.route(mux, "/api/sse/display", policyPublic, h.handleDisplaySSE)
+	h.route(mux, "/api/sse/counter/", policyPublic, h.handleCounterSSE)
+	h.route(mux, "/api/sse/ticket/{token}", policyPublic, h.handleTicketSSE)
 }
 
 // JSON helpers
@@ -245,14 +376,45 @@ func (h *Handler) handleAdminLogin(w http.ResponseWriter, r *http.Request) {
 			h.tmpl.ExecuteTemplate(w, "admin_login.html", map[string]string{"Error": "Request tidak valid"})
 			return
 		}
+		username := strings.TrimSpace(r.FormValue("username"))
 		password := r.FormValue("password")
-		if h.config.VerifyAdminPassword(password) {
-			h.setAdminSession(w)
-			http.Redirect(w, r, "/admin", http.StatusFound)
+
+		// Without a username, fall back to the built-in admin password
+		if username == "" {
+			if h.config.VerifyAdminPassword(password) {
+				sess := &models.Session{Username: "admin", Role: models.RoleAdmin}
+				h.setSession(w, r, sess)
+				h.auditAs(r, sess, auditLogin, "admin_panel", "", nil, nil)
+				http.Redirect(w, r, "/admin", http.StatusFound)
+				return
+			}
+			h.auditAs(r, &models.Session{Username: "admin"}, auditLoginFailed, "admin_panel", "", nil, nil)
+			log.Printf("Admin login failed: wrong password from %s", r.RemoteAddr)
+			h.tmpl.ExecuteTemplate(w, "admin_login.html", map[string]string{"Error": "Password salah. Silakan coba lagi."})
+			return
+		}
+
+		user, err := h.db.AuthenticateUser(username, password)
+		if err != nil {
+			if err != database.ErrInvalidCredentials {
+				log.Printf("Admin login error: %v", err)
+			}
+			h.auditAs(r, &models.Session{Username: username}, auditLoginFailed, "admin_panel", "", nil, nil)
+			log.Printf("Admin login failed for %q from %s", username, r.RemoteAddr)
+			h.tmpl.ExecuteTemplate(w, "admin_login.html", map[string]string{"Error": "Username atau password salah."})
+			return
+		}
+		if user.Role != models.RoleAdmin && user.Role != models.RoleSupervisor {
+			h.auditAs(r, &models.Session{UserID: user.ID, Username: user.Username, Role: user.Role}, auditLoginFailed, "admin_panel", "", nil, nil)
+			log.Printf("Admin login denied for %q (role %s) from %s", username, user.Role, r.RemoteAddr)
+			h.tmpl.ExecuteTemplate(w, "admin_login.html", map[string]string{"Error": "Akun ini tidak memiliki akses ke panel admin."})
 			return
 		}
-		log.Printf("Admin login failed: wrong password from %s", r.RemoteAddr)
-		h.tmpl.ExecuteTemplate(w, "admin_login.html", map[string]string{"Error": "Password salah. Silakan coba lagi."})
+		sess := &models.Session{UserID: user.ID, Username: user.Username, Role: user.Role}
+		h.setSession(w, r, sess)
+		h.auditAs(r, sess, auditLogin, "admin_panel", "", nil, nil)
+		log.Printf("User %s (%s) logged in to admin panel", user.Username, user.Role)
+		http.Redirect(w, r, "/admin", http.StatusFound)
 
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -260,7 +422,7 @@ func (h *Handler) handleAdminLogin(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleAdminLogout(w http.ResponseWriter, r *http.Request) {
-	h.clearAdminSession(w, r)
+	h.clearSession(w, r)
 	http.Redirect(w, r, "/admin/login", http.StatusFound)
 }
 
@@ -273,6 +435,14 @@ func (h *Handler) handleDisplay(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handleTicket(w http.ResponseWriter, r *http.Request) {
+	if h.config.Security.KioskAuth {
+		sess := h.currentSession(r)
+		if sess == nil || !roleSatisfies(sess.Role, accessKiosk, http.MethodPost) {
+			h.tmpl.ExecuteTemplate(w, "kiosk_login.html", nil)
+			return
+		}
+	}
+
 	queueTypes, _ := h.db.ListQueueTypes(true)
 	data := map[string]interface{}{
 		"QueueTypes": queueTypes,
@@ -280,13 +450,43 @@ func (h *Handler) handleTicket(w http.ResponseWriter, r *http.Request) {
 	h.tmpl.ExecuteTemplate(w, "ticket.html", data)
 }
 
+func (h *Handler) handleTicketLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/ticket", http.StatusFound)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		h.tmpl.ExecuteTemplate(w, "kiosk_login.html", map[string]string{"Error": "Request tidak valid"})
+		return
+	}
+
+	username := strings.TrimSpace(r.FormValue("username"))
+	user, err := h.db.AuthenticateUser(username, r.FormValue("password"))
+	if err != nil {
+		if err != database.ErrInvalidCredentials {
+			log.Printf("Kiosk login error: %v", err)
+		}
+		h.auditAs(r, &models.Session{Username: username}, auditLoginFailed, "kiosk", "", nil, nil)
+		log.Printf("Kiosk login failed for %q from %s", username, r.RemoteAddr)
+		h.tmpl.ExecuteTemplate(w, "kiosk_login.html", map[string]string{"Error": "Username atau password salah."})
+		return
+	}
+
+	sess := &models.Session{UserID: user.ID, Username: user.Username, Role: user.Role}
+	h.setSession(w, r, sess)
+	h.auditAs(r, sess, auditLogin, "kiosk", "", nil, nil)
+	log.Printf("User %s (%s) signed in to kiosk from %s", user.Username, user.Role, r.RemoteAddr)
+	http.Redirect(w, r, "/ticket", http.StatusFound)
+}
+
 func (h *Handler) handleCountersPage(w http.ResponseWriter, r *http.Request) {
 	h.tmpl.ExecuteTemplate(w, "counters.html", nil)
 }
 
 func (h *Handler) handleCounter(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, "/counter/")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	// Parse: /counter/{id}, /counter/{id}/login or /counter/{id}/logout
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/counter/"), "/")
+	id, err := strconv.ParseInt(parts[0], 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid counter ID", http.StatusBadRequest)
 		return
@@ -302,15 +502,107 @@ func (h *Handler) handleCounter(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	action := ""
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+
+	switch action {
+	case "login":
+		h.handleCounterLogin(w, r, counter)
+		return
+	case "logout":
+		h.clearSession(w, r)
+		http.Redirect(w, r, fmt.Sprintf("/counter/%d", counter.ID), http.StatusFound)
+		return
+	case "":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	sess := h.currentSession(r)
+	if !h.canOperateCounter(sess, counter.ID) {
+		h.tmpl.ExecuteTemplate(w, "counter_login.html", map[string]interface{}{
+			"Counter": counter,
+		})
+		return
+	}
+
 	queueTypes, _ := h.db.ListQueueTypes(true)
 
+	// Only offer the types this counter serves, in its priority order;
+	// transfers may still go to any type
+	servedTypes := queueTypes
+	if len(counter.Services) > 0 {
+		byCode := make(map[string]*models.QueueType)
+		for _, qt := range queueTypes {
+			byCode[qt.Code] = qt
+		}
+		servedTypes = nil
+		for _, s := range counter.Services {
+			if qt, ok := byCode[s.QueueType]; ok {
+				servedTypes = append(servedTypes, qt)
+			}
+		}
+	}
+
 	data := map[string]interface{}{
-		"Counter":    counter,
-		"QueueTypes": queueTypes,
+		"Counter":      counter,
+		"QueueTypes":   queueTypes,
+		"ServedTypes":  servedTypes,
+		"Username":     sess.Username,
+		"GraceRecalls": h.config.Queue.NoShowGraceRecalls,
 	}
 	h.tmpl.ExecuteTemplate(w, "counter.html", data)
 }
 
+// handleCounterLogin signs an operator into a specific counter.
+func (h *Handler) handleCounterLogin(w http.ResponseWriter, r *http.Request, counter *models.Counter) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, fmt.Sprintf("/counter/%d", counter.ID), http.StatusFound)
+		return
+	}
+
+	renderError := func(message string) {
+		h.tmpl.ExecuteTemplate(w, "counter_login.html", map[string]interface{}{
+			"Counter": counter,
+			"Error":   message,
+		})
+	}
+
+	if err := r.ParseForm(); err != nil {
+		renderError("Request tidak valid")
+		return
+	}
+	username := strings.TrimSpace(r.FormValue("username"))
+	password := r.FormValue("password")
+
+	user, err := h.db.AuthenticateUser(username, password)
+	if err != nil {
+		if err != database.ErrInvalidCredentials {
+			log.Printf("Counter login error: %v", err)
+		}
+		h.auditAs(r, &models.Session{Username: username}, auditLoginFailed, "counter", fmt.Sprint(counter.ID), nil, nil)
+		log.Printf("Counter %s login failed for %q from %s", counter.CounterNumber, username, r.RemoteAddr)
+		renderError("Username atau password salah.")
+		return
+	}
+
+	sess := &models.Session{UserID: user.ID, Username: user.Username, Role: user.Role, CounterID: counter.ID}
+	if !h.canOperateCounter(sess, counter.ID) {
+		h.auditAs(r, sess, auditLoginFailed, "counter", fmt.Sprint(counter.ID), nil, nil)
+		log.Printf("Counter %s login denied for %q (role %s)", counter.CounterNumber, username, user.Role)
+		renderError("Akun ini tidak ditugaskan ke loket ini.")
+		return
+	}
+
+	h.setSession(w, r, sess)
+	h.auditAs(r, sess, auditLogin, "counter", fmt.Sprint(counter.ID), nil, nil)
+	log.Printf("User %s signed in to counter %s", user.Username, counter.CounterName)
+	http.Redirect(w, r, fmt.Sprintf("/counter/%d", counter.ID), http.StatusFound)
+}
+
 func (h *Handler) handleHealth(w http.ResponseWriter, r *http.Request) {
 	stats, _ := h.db.GetStats()
 	h.jsonResponse(w, map[string]interface{}{
@@ -368,7 +660,17 @@ func (h *Handler) handleTakeQueue(w http.ResponseWriter, r *http.Request) {
 		queueType = "general"
 	}
 
-	queue, err := h.db.CreateQueue(queueType)
+	priority := models.PriorityNormal
+	if val := r.URL.Query().Get("priority"); val != "" {
+		p, err := strconv.Atoi(val)
+		if err != nil || !models.QueuePriority(p).IsValid() {
+			h.jsonError(w, "Invalid priority", http.StatusBadRequest)
+			return
+		}
+		priority = models.QueuePriority(p)
+	}
+
+	queue, err := h.db.CreateQueue(queueType, priority)
 	if err != nil {
 		h.jsonError(w, "Failed to create queue", http.StatusInternalServerError)
 		return
@@ -380,7 +682,93 @@ func (h *Handler) handleTakeQueue(w http.ResponseWriter, r *http.Request) {
 		WaitingCount: waitingCount,
 		Timestamp:    time.Now(),
 	})
+	h.notifyTickets()
+
+	// Include position, estimated wait and the status page link
+	h.jsonResponse(w, h.ticketStatusFor(r, queue))
+}
+
+// handleQueueStatus returns a ticket's position in line and estimated wait,
+// or the counter it was called to.
+func (h *Handler) handleQueueStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	queue, err := h.db.GetQueueByNumber(r.PathValue("number"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.jsonError(w, "Queue not found", http.StatusNotFound)
+			return
+		}
+		h.jsonError(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	status, err := h.db.GetTicketStatus(queue)
+	if err != nil {
+		h.jsonError(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	h.jsonResponse(w, status)
+}
+
+// handleQueuePriority lets an operator raise or lower the priority of a
+// ticket that is still waiting, e.g. for a visitor who did not choose the
+// priority option at the kiosk.
+func (h *Handler) handleQueuePriority(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	queueID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid queue ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Priority models.QueuePriority `json:"priority"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !req.Priority.IsValid() {
+		h.jsonError(w, "Invalid priority", http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.db.GetQueue(queueID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.jsonError(w, "Queue not found", http.StatusNotFound)
+			return
+		}
+		h.jsonError(w, "Database error", http.StatusInternalServerError)
+		return
+	}
 
+	if err := h.db.SetQueuePriority(queueID, req.Priority); err != nil {
+		if err == sql.ErrNoRows {
+			h.jsonError(w, "Queue is no longer waiting", http.StatusConflict)
+			return
+		}
+		h.jsonError(w, "Failed to update priority", http.StatusInternalServerError)
+		return
+	}
+
+	queue, err := h.db.GetQueue(queueID)
+	if err != nil {
+		h.jsonError(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, auditQueuePriority, "queue", fmt.Sprint(queueID), before, queue)
+	h.notifyTickets()
+	log.Printf("Queue %s priority set to %d", queue.QueueNumber, queue.Priority)
 	h.jsonResponse(w, queue)
 }
 
@@ -417,6 +805,7 @@ func (h *Handler) handleCounters(w http.ResponseWriter, r *http.Request) {
 			h.jsonError(w, "Failed to create counter", http.StatusInternalServerError)
 			return
 		}
+		h.audit(r, auditCounterCreate, "counter", fmt.Sprint(counter.ID), nil, counter)
 
 		h.jsonResponse(w, counter)
 
@@ -440,104 +829,144 @@ func (h *Handler) handleCounterAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	action := ""
-	if len(parts) > 1 {
-		action = parts[1]
+	if len(parts) > 1 && parts[1] != "" {
+		h.jsonError(w, "Not found", http.StatusNotFound)
+		return
 	}
 
-	switch action {
-	case "call-next":
-		h.handleCallNext(w, r, counterID)
-	case "recall":
-		h.handleRecall(w, r, counterID)
-	case "complete":
-		h.handleComplete(w, r, counterID)
-	case "cancel":
-		h.handleCancel(w, r, counterID)
-	default:
-		switch r.Method {
-		case http.MethodGet:
-			// Get counter info
-			counter, err := h.db.GetCounter(counterID)
-			if err != nil {
-				if err == sql.ErrNoRows {
-					h.jsonError(w, "Counter not found", http.StatusNotFound)
-					return
-				}
-				h.jsonError(w, "Database error", http.StatusInternalServerError)
+	switch r.Method {
+	case http.MethodGet:
+		// Get counter info
+		counter, err := h.db.GetCounter(counterID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				h.jsonError(w, "Counter not found", http.StatusNotFound)
 				return
 			}
-			h.jsonResponse(w, counter)
+			h.jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		h.jsonResponse(w, counter)
 
-		case http.MethodPut:
-			// Update counter
-			var req struct {
-				CounterName string `json:"counter_name"`
-				IsActive    *bool  `json:"is_active,omitempty"`
-			}
+	case http.MethodPut:
+		// Update counter
+		var req struct {
+			CounterName string             `json:"counter_name"`
+			IsActive    *bool              `json:"is_active,omitempty"`
+			RoutingMode models.RoutingMode `json:"routing_mode,omitempty"`
+			// Services replaces the assigned queue types when present;
+			// [] lets the counter serve every type
+			Services []models.CounterService `json:"services"`
+		}
 
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-				h.jsonError(w, "Invalid request body", http.StatusBadRequest)
-				return
-			}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
 
-			// Get current counter to preserve is_active if not provided
-			currentCounter, err := h.db.GetCounter(counterID)
-			if err != nil {
-				if err == sql.ErrNoRows {
-					h.jsonError(w, "Counter not found", http.StatusNotFound)
-					return
-				}
-				h.jsonError(w, "Database error", http.StatusInternalServerError)
+		// Get current counter to preserve is_active if not provided
+		currentCounter, err := h.db.GetCounter(counterID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				h.jsonError(w, "Counter not found", http.StatusNotFound)
 				return
 			}
+			h.jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
 
-			isActive := currentCounter.IsActive
-			if req.IsActive != nil {
-				isActive = *req.IsActive
-			}
+		isActive := currentCounter.IsActive
+		if req.IsActive != nil {
+			isActive = *req.IsActive
+		}
 
-			if err := h.db.UpdateCounter(counterID, req.CounterName, isActive); err != nil {
-				log.Printf("Failed to update counter: %v", err)
-				h.jsonError(w, "Failed to update counter", http.StatusInternalServerError)
+		mode := currentCounter.RoutingMode
+		if req.RoutingMode != "" {
+			if !req.RoutingMode.IsValid() {
+				h.jsonError(w, "Invalid routing mode", http.StatusBadRequest)
 				return
 			}
+			mode = req.RoutingMode
+		}
+		services := req.Services
+		if services == nil {
+			services = currentCounter.Services
+		} else if msg := h.validateCounterServices(services); msg != "" {
+			h.jsonError(w, msg, http.StatusBadRequest)
+			return
+		}
 
-			// Get updated counter
-			counter, err := h.db.GetCounter(counterID)
-			if err != nil {
-				h.jsonError(w, "Failed to get updated counter", http.StatusInternalServerError)
-				return
-			}
+		if err := h.db.UpdateCounter(counterID, req.CounterName, isActive); err != nil {
+			log.Printf("Failed to update counter: %v", err)
+			h.jsonError(w, "Failed to update counter", http.StatusInternalServerError)
+			return
+		}
+		if err := h.db.SetCounterServices(counterID, mode, services); err != nil {
+			log.Printf("Failed to update counter services: %v", err)
+			h.jsonError(w, "Failed to update counter services", http.StatusInternalServerError)
+			return
+		}
 
-			log.Printf("Counter updated: %s", counter.CounterName)
-			h.jsonResponse(w, counter)
+		// Get updated counter
+		counter, err := h.db.GetCounter(counterID)
+		if err != nil {
+			h.jsonError(w, "Failed to get updated counter", http.StatusInternalServerError)
+			return
+		}
 
-		case http.MethodDelete:
-			// Delete counter
-			counter, err := h.db.GetCounter(counterID)
-			if err != nil {
-				if err == sql.ErrNoRows {
-					h.jsonError(w, "Counter not found", http.StatusNotFound)
-					return
-				}
-				h.jsonError(w, "Database error", http.StatusInternalServerError)
-				return
-			}
+		h.audit(r, auditCounterUpdate, "counter", fmt.Sprint(counterID), currentCounter, counter)
+		log.Printf("Counter updated: %s", counter.CounterName)
+		h.jsonResponse(w, counter)
 
-			if err := h.db.DeleteCounter(counterID); err != nil {
-				log.Printf("Failed to delete counter: %v", err)
-				h.jsonError(w, "Failed to delete counter", http.StatusInternalServerError)
+	case http.MethodDelete:
+		// Delete counter
+		counter, err := h.db.GetCounter(counterID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				h.jsonError(w, "Counter not found", http.StatusNotFound)
 				return
 			}
+			h.jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
 
-			log.Printf("Counter deleted: %s (%s)", counter.CounterName, counter.CounterNumber)
-			h.jsonResponse(w, map[string]string{"status": "deleted"})
+		if err := h.db.DeleteCounter(counterID); err != nil {
+			log.Printf("Failed to delete counter: %v", err)
+			h.jsonError(w, "Failed to delete counter", http.StatusInternalServerError)
+			return
+		}
 
-		default:
-			h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.audit(r, auditCounterDelete, "counter", fmt.Sprint(counterID), counter, nil)
+		log.Printf("Counter deleted: %s (%s)", counter.CounterName, counter.CounterNumber)
+		h.jsonResponse(w, map[string]string{"status": "deleted"})
+
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validateCounterServices checks the queue types assigned to a counter,
+// defaulting missing weights to 1, and returns an error message, or "" if
+// they are valid.
+func (h *Handler) validateCounterServices(services []models.CounterService) string {
+	seen := make(map[string]bool)
+	for i := range services {
+		s := &services[i]
+		if _, err := h.db.GetQueueTypeByCode(s.QueueType); err != nil {
+			return fmt.Sprintf("Unknown queue type: %s", s.QueueType)
+		}
+		if seen[s.QueueType] {
+			return fmt.Sprintf("Queue type %s is assigned twice", s.QueueType)
+		}
+		seen[s.QueueType] = true
+		if s.Weight == 0 {
+			s.Weight = 1
+		}
+		if s.Weight < 0 {
+			return "Weight must be positive"
 		}
 	}
+	return ""
 }
 
 func (h *Handler) handleCallNext(w http.ResponseWriter, r *http.Request, counterID int64) {
@@ -546,8 +975,20 @@ func (h *Handler) handleCallNext(w http.ResponseWriter, r *http.Request, counter
 		return
 	}
 
-	// Get queue type from query parameter
+	// Get queue type from query parameter. Without one, the counter's
+	// assigned queue types decide.
 	queueType := r.URL.Query().Get("type")
+	if queueType != "" {
+		counter, err := h.db.GetCounter(counterID)
+		if err != nil {
+			h.jsonError(w, "Counter not found", http.StatusNotFound)
+			return
+		}
+		if !counter.Serves(queueType) {
+			h.jsonError(w, "Queue type not served by this counter", http.StatusForbidden)
+			return
+		}
+	}
 
 	// Atomic call next queue
 	queue, err := h.db.CallNextQueue(counterID, queueType)
@@ -572,6 +1013,7 @@ func (h *Handler) handleCallNext(w http.ResponseWriter, r *http.Request, counter
 		QueueNumber:   queue.QueueNumber,
 		CounterNumber: counter.CounterNumber,
 		CounterName:   counter.CounterName,
+		Priority:      queue.Priority,
 		Timestamp:     time.Now(),
 	})
 
@@ -582,7 +1024,9 @@ func (h *Handler) handleCallNext(w http.ResponseWriter, r *http.Request, counter
 		WaitingCount: waitingCount,
 		Timestamp:    time.Now(),
 	})
+	h.notifyTickets()
 
+	h.audit(r, auditQueueCallNext, "queue", fmt.Sprint(queue.ID), nil, queue)
 	h.jsonResponse(w, counter)
 
 	log.Printf("Queue %s called to counter %s", queue.QueueNumber, counter.CounterName)
@@ -612,12 +1056,14 @@ func (h *Handler) handleRecall(w http.ResponseWriter, r *http.Request, counterID
 	}
 
 	h.db.AddCallHistory(queue.ID, counterID, models.ActionRecalled)
+	h.audit(r, auditQueueRecall, "queue", fmt.Sprint(queue.ID), nil, queue)
 
 	// Broadcast to display
 	h.hub.BroadcastDisplay("queue_called", models.QueueCalledData{
 		QueueNumber:   queue.QueueNumber,
 		CounterNumber: counter.CounterNumber,
 		CounterName:   counter.CounterName,
+		Priority:      queue.Priority,
 		Timestamp:     time.Now(),
 	})
 
@@ -645,22 +1091,42 @@ func (h *Handler) handleComplete(w http.ResponseWriter, r *http.Request, counter
 
 	queue, _ := h.db.GetQueue(counter.CurrentQueueID.Int64)
 
-	h.db.UpdateQueueStatus(counter.CurrentQueueID.Int64, models.StatusCompleted, &counterID)
-	h.db.SetCounterCurrentQueue(counterID, nil)
-	h.db.AddCallHistory(counter.CurrentQueueID.Int64, counterID, models.ActionCompleted)
+	// A ticket on a multi-step journey comes back waiting for its next step
+	next, err := h.db.CompleteQueue(counterID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.jsonError(w, "No current queue to complete", http.StatusBadRequest)
+			return
+		}
+		h.jsonError(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	advanced := next.Status == models.StatusWaiting
+	if advanced {
+		h.audit(r, auditQueueComplete, "queue", fmt.Sprint(next.ID), queue, next)
+	} else {
+		h.audit(r, auditQueueComplete, "queue", fmt.Sprint(next.ID), queue, nil)
+	}
 
 	// Broadcast update
+	event := "queue_updated"
+	if advanced {
+		event = "queue_added"
+	}
 	waitingCount, _ := h.db.GetWaitingCount()
-	h.hub.BroadcastAllCounters("queue_updated", models.CounterUpdateData{
+	h.hub.BroadcastAllCounters(event, models.CounterUpdateData{
 		WaitingCount: waitingCount,
 		Timestamp:    time.Now(),
 	})
+	h.notifyTickets()
 
 	counter, _ = h.db.GetCounter(counterID)
 	h.jsonResponse(w, counter)
 
-	if queue != nil {
-		log.Printf("Queue %s completed at counter %s", queue.QueueNumber, counter.CounterName)
+	if advanced {
+		log.Printf("Queue %s finished its step at counter %s, now waiting for %s", next.QueueNumber, counter.CounterName, next.QueueType)
+	} else {
+		log.Printf("Queue %s completed at counter %s", next.QueueNumber, counter.CounterName)
 	}
 }
 
@@ -686,6 +1152,7 @@ func (h *Handler) handleCancel(w http.ResponseWriter, r *http.Request, counterID
 	h.db.UpdateQueueStatus(counter.CurrentQueueID.Int64, models.StatusCancelled, &counterID)
 	h.db.SetCounterCurrentQueue(counterID, nil)
 	h.db.AddCallHistory(counter.CurrentQueueID.Int64, counterID, models.ActionCancelled)
+	h.audit(r, auditQueueCancel, "queue", fmt.Sprint(counter.CurrentQueueID.Int64), queue, nil)
 
 	// Broadcast update
 	waitingCount, _ := h.db.GetWaitingCount()
@@ -693,6 +1160,7 @@ func (h *Handler) handleCancel(w http.ResponseWriter, r *http.Request, counterID
 		WaitingCount: waitingCount,
 		Timestamp:    time.Now(),
 	})
+	h.notifyTickets()
 
 	counter, _ = h.db.GetCounter(counterID)
 	h.jsonResponse(w, counter)
@@ -702,6 +1170,189 @@ func (h *Handler) handleCancel(w http.ResponseWriter, r *http.Request, counterID
 	}
 }
 
+// handleTransfer sends the current queue on to another queue type and/or a
+// specific counter, keeping its number and place in line.
+func (h *Handler) handleTransfer(w http.ResponseWriter, r *http.Request, counterID int64) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		QueueType string `json:"queue_type"`
+		CounterID int64  `json:"counter_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.QueueType == "" && req.CounterID == 0 {
+		h.jsonError(w, "queue_type or counter_id is required", http.StatusBadRequest)
+		return
+	}
+
+	counter, err := h.db.GetCounter(counterID)
+	if err != nil {
+		h.jsonError(w, "Counter not found", http.StatusNotFound)
+		return
+	}
+	if counter.CurrentQueue == nil {
+		h.jsonError(w, "No current queue to transfer", http.StatusBadRequest)
+		return
+	}
+	before := counter.CurrentQueue
+
+	queueType := before.QueueType
+	if req.QueueType != "" {
+		qt, err := h.db.GetQueueTypeByCode(req.QueueType)
+		if err != nil || !qt.IsActive {
+			h.jsonError(w, "Unknown or inactive queue type", http.StatusBadRequest)
+			return
+		}
+		queueType = qt.Code
+	}
+
+	var target *models.Counter
+	var targetID *int64
+	if req.CounterID != 0 {
+		if req.CounterID == counterID {
+			h.jsonError(w, "Cannot transfer to the same counter", http.StatusBadRequest)
+			return
+		}
+		target, err = h.db.GetCounter(req.CounterID)
+		if err != nil || !target.IsActive {
+			h.jsonError(w, "Unknown or inactive target counter", http.StatusBadRequest)
+			return
+		}
+		targetID = &target.ID
+	}
+
+	queue, err := h.db.TransferQueue(counterID, queueType, targetID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.jsonError(w, "No current queue to transfer", http.StatusBadRequest)
+			return
+		}
+		h.jsonError(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.audit(r, auditQueueTransfer, "queue", fmt.Sprint(queue.ID), before, queue)
+
+	// Notify the target counter, then refresh everyone's counts
+	if target != nil {
+		h.hub.BroadcastCounter(target.ID, "queue_transferred", models.QueueTransferData{
+			QueueID:         queue.ID,
+			QueueNumber:     queue.QueueNumber,
+			QueueType:       queue.QueueType,
+			FromCounterID:   counter.ID,
+			FromCounterName: counter.CounterName,
+			Timestamp:       time.Now(),
+		})
+	}
+	waitingCount, _ := h.db.GetWaitingCount()
+	h.hub.BroadcastAllCounters("queue_added", models.CounterUpdateData{
+		WaitingCount: waitingCount,
+		Timestamp:    time.Now(),
+	})
+	h.notifyTickets()
+
+	counter, _ = h.db.GetCounter(counterID)
+	h.jsonResponse(w, counter)
+
+	if target != nil {
+		log.Printf("Queue %s transferred from counter %s to counter %s", queue.QueueNumber, counter.CounterName, target.CounterName)
+	} else {
+		log.Printf("Queue %s transferred from counter %s to queue type %s", queue.QueueNumber, counter.CounterName, queueType)
+	}
+}
+
+// handleSkip parks the current queue as a no-show instead of cancelling it,
+// so a late visitor can still be returned to the queue.
+func (h *Handler) handleSkip(w http.ResponseWriter, r *http.Request, counterID int64) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	queue, err := h.db.SkipQueue(counterID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.jsonError(w, "No current queue to skip", http.StatusBadRequest)
+			return
+		}
+		h.jsonError(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.audit(r, auditQueueSkip, "queue", fmt.Sprint(queue.ID), nil, queue)
+
+	// Broadcast update
+	waitingCount, _ := h.db.GetWaitingCount()
+	h.hub.BroadcastAllCounters("queue_updated", models.CounterUpdateData{
+		WaitingCount: waitingCount,
+		Timestamp:    time.Now(),
+	})
+	h.notifyTickets()
+
+	counter, _ := h.db.GetCounter(counterID)
+	h.jsonResponse(w, counter)
+
+	log.Printf("Queue %s skipped (no-show #%d) at counter %s", queue.QueueNumber, queue.SkipCount, counter.CounterName)
+}
+
+// handleReturn puts a parked no-show back into the waiting queue, either at
+// the head or after a given number of tickets.
+func (h *Handler) handleReturn(w http.ResponseWriter, r *http.Request, counterID int64) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		QueueID int64 `json:"queue_id"`
+		After   int   `json:"after"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.After < 0 {
+		h.jsonError(w, "after must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.db.GetQueue(req.QueueID)
+	if err != nil {
+		h.jsonError(w, "Queue not found", http.StatusNotFound)
+		return
+	}
+
+	queue, err := h.db.ReturnQueue(req.QueueID, counterID, req.After)
+	if err != nil {
+		switch err {
+		case database.ErrQueueNotParked:
+			h.jsonError(w, "Queue is not a no-show from today", http.StatusConflict)
+		case database.ErrNoGraceRecalls:
+			h.jsonError(w, "No grace recalls left for this queue", http.StatusConflict)
+		default:
+			h.jsonError(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	h.audit(r, auditQueueReturn, "queue", fmt.Sprint(queue.ID), before, queue)
+
+	// Broadcast update
+	waitingCount, _ := h.db.GetWaitingCount()
+	h.hub.BroadcastAllCounters("queue_added", models.CounterUpdateData{
+		WaitingCount: waitingCount,
+		Timestamp:    time.Now(),
+	})
+	h.notifyTickets()
+
+	h.jsonResponse(w, queue)
+
+	log.Printf("Queue %s returned to the queue after %d tickets", queue.QueueNumber, req.After)
+}
+
 // Stats handler
 
 func (h *Handler) handleStats(w http.ResponseWriter, r *http.Request) {
@@ -757,6 +1408,11 @@ func (h *Handler) handleSettings(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		before := make(map[string]string, len(req))
+		for key := range req {
+			before[key], _ = h.db.GetSetting(key)
+		}
+
 		for key, value := range req {
 			if err := h.db.SetSetting(key, value); err != nil {
 				h.jsonError(w, "Failed to save setting: "+key, http.StatusInternalServerError)
@@ -764,6 +1420,8 @@ func (h *Handler) handleSettings(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		
+		h.audit(r, auditSettingsUpdate, "settings", "", before, req)
+
 		// Broadcast setting update to display
 		h.hub.BroadcastDisplay("settings_updated", req)
 
@@ -784,12 +1442,19 @@ func (h *Handler) handleResetQueues(w http.ResponseWriter, r *http.Request) {
 	// Ambil parameter queue_type dari query string (kosong = semua jenis)
 	queueType := r.URL.Query().Get("type")
 
-	affected, err := h.db.ResetQueuesToday(queueType)
+	reset, err := h.db.ResetQueuesToday(queueType)
 	if err != nil {
 		log.Printf("Failed to reset queues: %v", err)
 		h.jsonError(w, "Failed to reset queues: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	affected := len(reset)
+
+	// Antrian sebelum direset disimpan utuh di audit log
+	if reset == nil {
+		reset = []*models.Queue{}
+	}
+	h.audit(r, auditQueueReset, "queue", queueType, reset, map[string]interface{}{"type": queueType, "affected": affected})
 
 	// Broadcast update ke semua client
 	waitingCount, _ := h.db.GetWaitingCount()
@@ -797,6 +1462,9 @@ func (h *Handler) handleResetQueues(w http.ResponseWriter, r *http.Request) {
 		WaitingCount: waitingCount,
 		Timestamp:    time.Now(),
 	})
+	// Print agents drop the offline numbers they leased before the reset
+	h.hub.BroadcastPrinters("numbers_reset", map[string]string{"queue_type": queueType})
+	h.notifyTickets()
 
 	message := fmt.Sprintf("%d antrian hari ini berhasil direset", affected)
 	if queueType != "" {
@@ -847,6 +1515,7 @@ func (h *Handler) handleQueueTypes(w http.ResponseWriter, r *http.Request) {
 			h.jsonError(w, "Failed to create queue type", http.StatusInternalServerError)
 			return
 		}
+		h.audit(r, auditTypeCreate, "queue_type", fmt.Sprint(qt.ID), nil, qt)
 		h.jsonResponse(w, qt)
 
 	default:
@@ -881,25 +1550,48 @@ func (h *Handler) handleQueueTypeAPI(w http.ResponseWriter, r *http.Request) {
 			Prefix    string `json:"prefix"`
 			IsActive  bool   `json:"is_active"`
 			SortOrder int    `json:"sort_order"`
+			// Steps replaces the journey when present; [] removes it
+			Steps []models.JourneyStep `json:"steps"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			h.jsonError(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
 
+		before, err := h.db.GetQueueType(id)
+		if err != nil {
+			h.jsonError(w, "Queue type not found", http.StatusNotFound)
+			return
+		}
+		if req.Steps != nil {
+			if msg := h.validateJourney(req.Steps); msg != "" {
+				h.jsonError(w, msg, http.StatusBadRequest)
+				return
+			}
+		}
+
 		if err := h.db.UpdateQueueType(id, req.Name, req.Prefix, req.IsActive, req.SortOrder); err != nil {
 			h.jsonError(w, "Failed to update queue type", http.StatusInternalServerError)
 			return
 		}
+		if req.Steps != nil {
+			if err := h.db.SetJourneySteps(before.Code, req.Steps); err != nil {
+				h.jsonError(w, "Failed to update journey", http.StatusInternalServerError)
+				return
+			}
+		}
 
 		qt, _ := h.db.GetQueueType(id)
+		h.audit(r, auditTypeUpdate, "queue_type", fmt.Sprint(id), before, qt)
 		h.jsonResponse(w, qt)
 
 	case http.MethodDelete:
+		before, _ := h.db.GetQueueType(id)
 		if err := h.db.DeleteQueueType(id); err != nil {
 			h.jsonError(w, "Failed to delete queue type", http.StatusInternalServerError)
 			return
 		}
+		h.audit(r, auditTypeDelete, "queue_type", fmt.Sprint(id), before, nil)
 		h.jsonResponse(w, map[string]string{"status": "deleted"})
 
 	default:
@@ -907,6 +1599,23 @@ func (h *Handler) handleQueueTypeAPI(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// validateJourney checks the steps of a journey and returns an error
+// message, or "" if they are valid.
+func (h *Handler) validateJourney(steps []models.JourneyStep) string {
+	if len(steps) == 1 {
+		return "A journey needs at least two steps"
+	}
+	for i, step := range steps {
+		if strings.TrimSpace(step.Name) == "" {
+			return fmt.Sprintf("Journey step %d needs a name", i+1)
+		}
+		if _, err := h.db.GetQueueTypeByCode(step.QueueType); err != nil {
+			return fmt.Sprintf("Journey step %d has an unknown queue type", i+1)
+		}
+	}
+	return ""
+}
+
 // SSE handlers
 
 func (h *Handler) handleDisplaySSE(w http.ResponseWriter, r *http.Request) {
@@ -932,9 +1641,13 @@ func (h *Handler) handlePrintTicket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		QueueNumber string `json:"queue_number"`
-		TypeName    string `json:"type_name"`
-		DateTime    string `json:"date_time"`
+		QueueNumber          string               `json:"queue_number"`
+		TypeName             string               `json:"type_name"`
+		DateTime             string               `json:"date_time"`
+		Priority             models.QueuePriority `json:"priority"`
+		Position             int                  `json:"position"`
+		EstimatedWaitMinutes int                  `json:"estimated_wait_minutes"`
+		KioskID              string               `json:"kiosk_id"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -958,15 +1671,31 @@ func (h *Handler) handlePrintTicket(w http.ResponseWriter, r *http.Request) {
 	// Load ticket template from settings
 	tmpl := h.loadTicketTemplate()
 
+	// Link the QR code to the ticket's status page and name the counters
+	// that serve it
+	statusURL, counter, queueType := "", "", ""
+	if queue, err := h.db.GetQueueByNumber(req.QueueNumber); err == nil {
+		if queue.Token != "" {
+			statusURL = h.ticketStatusURL(r, queue.Token)
+		}
+		counter = h.ticketCounters(queue.QueueType)
+		queueType = queue.QueueType
+	}
+
 	localPrinted := false
 	remoteSent := false
 
 	// Local printing (existing behavior)
 	if h.config.Printer.Enabled {
 		err := h.printer.PrintTicket(printer.TicketData{
-			QueueNumber: req.QueueNumber,
-			TypeName:    req.TypeName,
-			DateTime:    req.DateTime,
+			QueueNumber:   req.QueueNumber,
+			TypeName:      req.TypeName,
+			DateTime:      req.DateTime,
+			Priority:      req.Priority > models.PriorityNormal,
+			Position:      req.Position,
+			EstimatedWait: req.EstimatedWaitMinutes,
+			StatusURL:     statusURL,
+			Counter:       counter,
 		}, tmpl)
 		if err != nil {
 			log.Printf("Local print error: %v", err)
@@ -975,22 +1704,25 @@ func (h *Handler) handlePrintTicket(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Remote printing — create job and broadcast to print agents
+	// Remote printing — create job and broadcast to the print agents it is
+	// routed to
 	if h.config.Printer.RemoteEnabled {
 		templateJSON, err := json.Marshal(tmpl)
 		if err != nil {
 			log.Printf("Failed to marshal template: %v", err)
 		} else {
-			job, err := h.db.CreatePrintJob(req.QueueNumber, req.TypeName, req.DateTime, string(templateJSON))
+			target := h.printJobTarget(h.kioskIdentity(r, req.KioskID), queueType)
+			job, err := h.db.CreatePrintJob(req.QueueNumber, req.TypeName, req.DateTime, string(templateJSON), req.Priority, req.Position, req.EstimatedWaitMinutes, statusURL, counter, target)
 			if err != nil {
 				log.Printf("Failed to create print job: %v", err)
 			} else {
-				h.hub.BroadcastPrinters("print_job", map[string]interface{}{
-					"job_id":       job.ID,
-					"queue_number": job.QueueNumber,
-				})
+				h.broadcastPrintJob(job)
 				remoteSent = true
-				log.Printf("Print job #%d created for remote agents: %s", job.ID, req.QueueNumber)
+				if target != "" {
+					log.Printf("Print job #%d created for remote agent %s: %s", job.ID, target, req.QueueNumber)
+				} else {
+					log.Printf("Print job #%d created for remote agents: %s", job.ID, req.QueueNumber)
+				}
 			}
 		}
 	}
@@ -1050,9 +1782,75 @@ func (h *Handler) loadTicketTemplate() printer.TicketTemplate {
 		template.ShowThanks = false
 	}
 
+	// Load QR code and barcode settings
+	switch val, _ := h.db.GetSetting("ticket_qr_content"); val {
+	case printer.CodeStatusURL, printer.CodeQueueNumber:
+		template.QRContent = val
+	case "none":
+		template.QRContent = ""
+	}
+	if val, _ := h.db.GetSetting("ticket_qr_placement"); isCodePlacement(val) {
+		template.QRPlacement = val
+	}
+	if val, _ := h.db.GetSetting("ticket_qr_size"); val != "" {
+		if size, err := strconv.Atoi(val); err == nil && size >= 1 && size <= 16 {
+			template.QRSize = size
+		}
+	}
+	if val, _ := h.db.GetSetting("ticket_show_barcode"); val == "true" {
+		template.ShowBarcode = true
+	}
+	if val, _ := h.db.GetSetting("ticket_barcode_placement"); isCodePlacement(val) {
+		template.BarcodePlacement = val
+	}
+
+	// Load logo
+	if val, _ := h.db.GetSetting("ticket_show_logo"); val == "false" {
+		template.ShowLogo = false
+	}
+	if logo, err := h.db.GetTicketLogo(); err == nil {
+		template.Logo = &printer.Raster{Width: logo.Width, Height: logo.Height, Data: logo.Data}
+	}
+
+	// Load the layout; without one the fields above are printed
+	if val, _ := h.db.GetSetting("ticket_layout"); val != "" {
+		var layout printer.Layout
+		if err := json.Unmarshal([]byte(val), &layout); err != nil || layout.Validate() != nil {
+			log.Printf("Ignoring invalid ticket layout setting")
+		} else {
+			template.Layout = &layout
+		}
+	}
+
+	// Load paper and code page
+	template.PaperWidth = h.ticketPaperWidth()
+	if val, _ := h.db.GetSetting("ticket_columns"); val != "" {
+		if columns, err := strconv.Atoi(val); err == nil && columns > 0 && columns <= 255 {
+			template.Columns = columns
+		}
+	}
+	if val, _ := h.db.GetSetting("ticket_codepage"); val != "" {
+		if _, ok := printer.LookupCodepage(val); ok {
+			template.Codepage = val
+		}
+	}
+
 	return template
 }
 
+// ticketPaperWidth returns the paper width in dots set for tickets.
+func (h *Handler) ticketPaperWidth() int {
+	if val, _ := h.db.GetSetting("ticket_paper_width"); val == strconv.Itoa(printer.Paper58mmDots) {
+		return printer.Paper58mmDots
+	}
+	return printer.Paper80mmDots
+}
+
+// isCodePlacement reports whether s names a QR code or barcode placement.
+func isCodePlacement(s string) bool {
+	return s == printer.CodeTop || s == printer.CodeMiddle || s == printer.CodeBottom
+}
+
 func (h *Handler) handlePrinterTest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -1060,6 +1858,7 @@ func (h *Handler) handlePrinterTest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err := h.printer.TestPrint()
+	h.audit(r, auditPrinterTest, "printer", h.printer.GetPrinterName(), nil, nil)
 	if err != nil {
 		log.Printf("Test print error: %v", err)
 		h.jsonError(w, "Test print failed: "+err.Error(), http.StatusInternalServerError)
@@ -1073,23 +1872,40 @@ func (h *Handler) handlePrinterTest(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) handlePrinterStatus(w http.ResponseWriter, r *http.Request) {
-	h.jsonResponse(w, map[string]interface{}{
+	resp := map[string]interface{}{
 		"enabled":        h.printer.IsEnabled(),
 		"printer_name":   h.printer.GetPrinterName(),
+		"backend":        h.printer.Describe(),
 		"remote_enabled": h.config.Printer.RemoteEnabled,
 		"agents_online":  h.hub.GetPrinterClientCount(),
-	})
+	}
+	if h.printer.IsEnabled() {
+		st, err := h.printer.Status()
+		resp["hardware"] = printerStatus("", h.printer.Describe(), st, err)
+	}
+
+	agents, err := h.db.ListPrinterStatuses()
+	if err != nil {
+		h.jsonError(w, "Failed to get printer status", http.StatusInternalServerError)
+		return
+	}
+	if agents == nil {
+		agents = []*models.PrinterStatus{}
+	}
+	resp["agents"] = agents
+
+	h.jsonResponse(w, resp)
 }
 
 // Print Agent handlers (remote printing)
 
 func (h *Handler) handlePrintAgentSSE(w http.ResponseWriter, r *http.Request) {
-	agentID := r.URL.Query().Get("agent_id")
-	if agentID == "" {
-		http.Error(w, "agent_id is required", http.StatusBadRequest)
+	agentID, ok := resolveAgentID(r, r.URL.Query().Get("agent_id"))
+	if !ok {
+		http.Error(w, "agent_id is required and must match the token", http.StatusBadRequest)
 		return
 	}
-	h.hub.ServePrinterSSE(w, r, agentID)
+	h.hub.ServePrinterSSE(w, r, agentID, agentGroup(r))
 }
 
 func (h *Handler) handlePendingPrintJobs(w http.ResponseWriter, r *http.Request) {
@@ -1098,7 +1914,14 @@ func (h *Handler) handlePendingPrintJobs(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	jobs, err := h.db.ListPendingPrintJobs()
+	// Agents only see the jobs routed to them or their group
+	agentID, ok := resolveAgentID(r, r.URL.Query().Get("agent_id"))
+	if !ok {
+		h.jsonError(w, "agent_id is required and must match the token", http.StatusBadRequest)
+		return
+	}
+
+	jobs, err := h.db.ListPendingPrintJobs(agentID, agentGroup(r))
 	if err != nil {
 		h.jsonError(w, "Failed to list pending jobs", http.StatusInternalServerError)
 		return
@@ -1139,17 +1962,20 @@ func (h *Handler) handlePrintJobAPI(w http.ResponseWriter, r *http.Request) {
 		var req struct {
 			AgentID string `json:"agent_id"`
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.AgentID == "" {
-			h.jsonError(w, "agent_id is required", http.StatusBadRequest)
+		json.NewDecoder(r.Body).Decode(&req)
+		agentID, ok := resolveAgentID(r, req.AgentID)
+		if !ok {
+			h.jsonError(w, "agent_id is required and must match the token", http.StatusBadRequest)
 			return
 		}
 
-		job, err := h.db.ClaimPrintJob(jobID, req.AgentID)
+		job, err := h.db.ClaimPrintJob(jobID, agentID, agentGroup(r), h.printJobLease())
 		if err != nil {
-			h.jsonError(w, "Failed to claim job (already claimed or not found)", http.StatusConflict)
+			h.jsonError(w, "Failed to claim job (already claimed, routed to another agent or not found)", http.StatusConflict)
 			return
 		}
-		log.Printf("Print job #%d claimed by agent %s", jobID, req.AgentID)
+		h.audit(r, auditPrintJobClaim, "print_job", fmt.Sprint(jobID), nil, map[string]string{"agent_id": agentID})
+		log.Printf("Print job #%d claimed by agent %s", jobID, agentID)
 		h.jsonResponse(w, job)
 
 	case "complete":
@@ -1157,11 +1983,30 @@ func (h *Handler) handlePrintJobAPI(w http.ResponseWriter, r *http.Request) {
 			h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		if err := h.db.CompletePrintJob(jobID); err != nil {
+		var req struct {
+			AgentID string `json:"agent_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		agentID, ok := resolveAgentID(r, req.AgentID)
+		if !ok {
+			h.jsonError(w, "agent_id is required and must match the token", http.StatusBadRequest)
+			return
+		}
+		if err := h.db.CompletePrintJob(jobID, agentID); err != nil {
+			if err == sql.ErrNoRows {
+				h.jsonError(w, "Job is not being printed by this agent (lease expired or not found)", http.StatusConflict)
+				return
+			}
 			h.jsonError(w, "Failed to complete job", http.StatusInternalServerError)
 			return
 		}
-		log.Printf("Print job #%d completed", jobID)
+		// Only a report that moved the job counts, so a retried one is not
+		// counted twice
+		if err := h.db.RecordPrintAgentJob(agentID, true, ""); err != nil {
+			log.Printf("Failed to update print agent %s: %v", agentID, err)
+		}
+		h.audit(r, auditPrintJobDone, "print_job", fmt.Sprint(jobID), nil, map[string]string{"agent_id": agentID})
+		log.Printf("Print job #%d completed by agent %s", jobID, agentID)
 		h.jsonResponse(w, map[string]string{"status": "completed"})
 
 	case "fail":
@@ -1170,15 +2015,35 @@ func (h *Handler) handlePrintJobAPI(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		var req struct {
-			Error string `json:"error"`
+			AgentID string `json:"agent_id"`
+			Error   string `json:"error"`
 		}
 		json.NewDecoder(r.Body).Decode(&req)
-		if err := h.db.FailPrintJob(jobID, req.Error); err != nil {
+		agentID, ok := resolveAgentID(r, req.AgentID)
+		if !ok {
+			h.jsonError(w, "agent_id is required and must match the token", http.StatusBadRequest)
+			return
+		}
+		job, err := h.db.FailPrintJob(jobID, agentID, req.Error, h.printJobMaxAttempts())
+		if err != nil {
+			if err == sql.ErrNoRows {
+				h.jsonError(w, "Job is not being printed by this agent (lease expired or not found)", http.StatusConflict)
+				return
+			}
 			h.jsonError(w, "Failed to update job", http.StatusInternalServerError)
 			return
 		}
-		log.Printf("Print job #%d failed: %s", jobID, req.Error)
-		h.jsonResponse(w, map[string]string{"status": "failed"})
+		if err := h.db.RecordPrintAgentJob(agentID, false, req.Error); err != nil {
+			log.Printf("Failed to update print agent %s: %v", agentID, err)
+		}
+		h.audit(r, auditPrintJobFail, "print_job", fmt.Sprint(jobID), nil,
+			map[string]interface{}{"agent_id": agentID, "error": req.Error, "attempts": job.Attempts, "status": job.Status})
+		if job.Status == models.PrintJobDead {
+			log.Printf("Print job #%d failed after %d attempts, giving up: %s", jobID, job.Attempts, req.Error)
+		} else {
+			log.Printf("Print job #%d failed (attempt %d), will retry: %s", jobID, job.Attempts, req.Error)
+		}
+		h.jsonResponse(w, map[string]interface{}{"status": job.Status, "attempts": job.Attempts})
 
 	default:
 		// GET /api/print-agent/job/{id} — return job details
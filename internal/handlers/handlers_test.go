@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"queue-system/internal/config"
+	"queue-system/internal/database"
+	"queue-system/internal/models"
+	"queue-system/internal/printer"
+	"queue-system/internal/sse"
+)
+
+// newTestHandler returns a handler backed by a fresh database, serving the
+// templates from the source tree.
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Database.Path = filepath.Join(t.TempDir(), "queue.db")
+	db, err := database.New(cfg)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	tmpl, err := template.ParseFS(os.DirFS("../.."), "web/templates/*.html")
+	if err != nil {
+		t.Fatalf("failed to parse templates: %v", err)
+	}
+	return &Handler{
+		db:       db,
+		hub:      sse.NewHub(),
+		config:   cfg,
+		tmpl:     tmpl,
+		printer:  printer.New(printer.PrinterConfig{}),
+		sessions: db,
+	}
+}
+
+// signIn stores a new session and attaches its cookie to the request.
+func signIn(t *testing.T, h *Handler, req *http.Request, sess *models.Session) {
+	t.Helper()
+	token := h.generateToken()
+	now := time.Now()
+	sess.TokenHash = hashToken(token)
+	sess.CreatedAt = now
+	sess.LastSeenAt = now
+	sess.ExpiresAt = now.Add(time.Hour)
+	if err := h.db.CreateSession(sess); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+}
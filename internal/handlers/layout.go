@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"queue-system/internal/printer"
+)
+
+// maxLayoutBody is the largest ticket layout document accepted.
+const maxLayoutBody = 64 << 10
+
+// handleTicketLayout returns the ticket layout (GET), replaces it (PUT) or
+// resets it (DELETE) so tickets follow the legacy design settings again.
+// Without a saved layout, GET returns the one those settings produce, so
+// the editor always starts from what is printed today.
+func (h *Handler) handleTicketLayout(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		template := h.loadTicketTemplate()
+		layout := template.Layout
+		if layout == nil {
+			layout = printer.TemplateLayout(template)
+		}
+		h.jsonResponse(w, layout)
+
+	case http.MethodPut:
+		r.Body = http.MaxBytesReader(w, r.Body, maxLayoutBody)
+		var layout printer.Layout
+		if err := json.NewDecoder(r.Body).Decode(&layout); err != nil {
+			h.jsonError(w, "Invalid layout", http.StatusBadRequest)
+			return
+		}
+		if err := layout.Validate(); err != nil {
+			h.jsonError(w, "Invalid layout: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := json.Marshal(layout)
+		if err != nil {
+			h.jsonError(w, "Invalid layout", http.StatusBadRequest)
+			return
+		}
+
+		before := h.savedLayout()
+		if err := h.db.SetSetting("ticket_layout", string(data)); err != nil {
+			h.jsonError(w, "Failed to save layout", http.StatusInternalServerError)
+			return
+		}
+		h.audit(r, auditLayoutUpdate, "settings", "ticket_layout", before, layout)
+		h.jsonResponse(w, layout)
+
+	case http.MethodDelete:
+		before := h.savedLayout()
+		if err := h.db.DeleteSetting("ticket_layout"); err != nil {
+			h.jsonError(w, "Failed to reset layout", http.StatusInternalServerError)
+			return
+		}
+		h.audit(r, auditLayoutReset, "settings", "ticket_layout", before, nil)
+		h.jsonResponse(w, map[string]string{"status": "reset"})
+
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// savedLayout returns the stored layout document for audit entries, or nil
+// when there is none.
+func (h *Handler) savedLayout() interface{} {
+	if val, _ := h.db.GetSetting("ticket_layout"); val != "" {
+		return json.RawMessage(val)
+	}
+	return nil
+}
+
+// ticketCounters returns the numbers of the counters serving a queue type,
+// for the counter variable of ticket layouts.
+func (h *Handler) ticketCounters(queueType string) string {
+	counters, err := h.db.CountersForQueueType(queueType)
+	if err != nil {
+		return ""
+	}
+	numbers := make([]string, len(counters))
+	for i, c := range counters {
+		numbers[i] = c.CounterNumber
+	}
+	return strings.Join(numbers, ", ")
+}
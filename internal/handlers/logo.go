@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"queue-system/internal/printer"
+)
+
+// maxLogoUpload is the largest logo image accepted for upload.
+const maxLogoUpload = 2 << 20
+
+// handleTicketLogo serves the ticket logo as a PNG preview (GET), replaces
+// it from an uploaded PNG or JPEG (POST, multipart field "logo" and an
+// optional "width" in dots) or removes it (DELETE). Uploads are dithered to
+// black and white once here; tickets and print agents use the result.
+func (h *Handler) handleTicketLogo(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		logo, err := h.db.GetTicketLogo()
+		if err != nil {
+			if err == sql.ErrNoRows {
+				h.jsonError(w, "No logo uploaded", http.StatusNotFound)
+				return
+			}
+			h.jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		raster := &printer.Raster{Width: logo.Width, Height: logo.Height, Data: logo.Data}
+		png, err := raster.PNG()
+		if err != nil {
+			h.jsonError(w, "Failed to render logo", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(png)
+
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxLogoUpload)
+		if err := r.ParseMultipartForm(maxLogoUpload); err != nil {
+			h.jsonError(w, "Logo must be an image of at most 2 MB", http.StatusBadRequest)
+			return
+		}
+		file, _, err := r.FormFile("logo")
+		if err != nil {
+			h.jsonError(w, "Logo file is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			h.jsonError(w, "Failed to read logo", http.StatusBadRequest)
+			return
+		}
+
+		img, err := printer.DecodeImage(data)
+		if err != nil {
+			h.jsonError(w, "Logo must be a PNG or JPEG image", http.StatusBadRequest)
+			return
+		}
+
+		// Keep small logos at their own size; never exceed the paper
+		paperWidth := h.ticketPaperWidth()
+		width := img.Bounds().Dx()
+		if val := r.FormValue("width"); val != "" {
+			if width, err = strconv.Atoi(val); err != nil || width <= 0 {
+				h.jsonError(w, "Invalid width", http.StatusBadRequest)
+				return
+			}
+		}
+		if width > paperWidth {
+			width = paperWidth
+		}
+
+		raster, err := printer.NewRaster(img, width)
+		if err != nil {
+			h.jsonError(w, "Failed to convert logo", http.StatusBadRequest)
+			return
+		}
+		before, _ := h.db.GetTicketLogo()
+		if err := h.db.SetTicketLogo(raster.Width, raster.Height, raster.Data); err != nil {
+			h.jsonError(w, "Failed to save logo", http.StatusInternalServerError)
+			return
+		}
+		logo, err := h.db.GetTicketLogo()
+		if err != nil {
+			h.jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		h.audit(r, auditLogoUpdate, "settings", "ticket_logo", before, logo)
+		log.Printf("Ticket logo updated (%dx%d dots)", logo.Width, logo.Height)
+		h.jsonResponse(w, logo)
+
+	case http.MethodDelete:
+		before, _ := h.db.GetTicketLogo()
+		if err := h.db.DeleteTicketLogo(); err != nil {
+			h.jsonError(w, "Failed to delete logo", http.StatusInternalServerError)
+			return
+		}
+		h.audit(r, auditLogoDelete, "settings", "ticket_logo", before, nil)
+		h.jsonResponse(w, map[string]string{"status": "deleted"})
+
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
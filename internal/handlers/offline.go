@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"queue-system/internal/database"
+	"queue-system/internal/models"
+)
+
+// Offline tickets. A print agent leases blocks of ticket numbers while it
+// can reach the server; when it cannot, a kiosk on its machine takes
+// provisional tickets from the agent, numbered from those blocks. The agent
+// sends them here once the server is reachable again.
+
+// maxOfflineTickets caps the tickets synced in one request.
+const maxOfflineTickets = 500
+
+// offlineBlockSize returns how many numbers are leased to an agent at once.
+func (h *Handler) offlineBlockSize() int {
+	if h.config.Printer.OfflineBlockSize > 0 {
+		return h.config.Printer.OfflineBlockSize
+	}
+	return 20
+}
+
+// handleLeaseNumberBlock leases the next block of today's numbers of a
+// queue type to a print agent, along with the ticket design, so it can
+// print the tickets without the server.
+func (h *Handler) handleLeaseNumberBlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		AgentID   string `json:"agent_id"`
+		QueueType string `json:"queue_type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	agentID, ok := resolveAgentID(r, req.AgentID)
+	if !ok {
+		h.jsonError(w, "agent_id is required and must match the token", http.StatusBadRequest)
+		return
+	}
+	qt, err := h.db.GetQueueTypeByCode(req.QueueType)
+	if err != nil || !qt.IsActive {
+		h.jsonError(w, "Unknown or inactive queue type", http.StatusBadRequest)
+		return
+	}
+
+	block, err := h.db.LeaseNumberBlock(agentID, qt.Code, h.offlineBlockSize())
+	if err != nil {
+		log.Printf("Failed to lease number block to agent %s: %v", agentID, err)
+		h.jsonError(w, "Failed to lease number block", http.StatusInternalServerError)
+		return
+	}
+	templateJSON, err := json.Marshal(h.loadTicketTemplate())
+	if err != nil {
+		h.jsonError(w, "Failed to load ticket template", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Leased %s-%s to print agent %s", models.FormatQueueNumber(block.Prefix, block.FirstNumber),
+		models.FormatQueueNumber(block.Prefix, block.LastNumber), agentID)
+	h.jsonResponse(w, map[string]interface{}{
+		"block":         block,
+		"template_json": string(templateJSON),
+	})
+}
+
+// handleSyncOfflineTickets adds the tickets a print agent issued offline to
+// the queue. Each ticket gets a result: synced, duplicate (synced before,
+// e.g. when the agent missed the response), rejected (not numbered from a
+// block leased to the agent, or issued on a past day) or failed, to be sent
+// again later.
+func (h *Handler) handleSyncOfflineTickets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		AgentID string                  `json:"agent_id"`
+		Tickets []*models.OfflineTicket `json:"tickets"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	agentID, ok := resolveAgentID(r, req.AgentID)
+	if !ok {
+		h.jsonError(w, "agent_id is required and must match the token", http.StatusBadRequest)
+		return
+	}
+	if len(req.Tickets) > maxOfflineTickets {
+		h.jsonError(w, "Too many tickets in one request", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	type result struct {
+		BlockID     int64  `json:"block_id"`
+		QueueNumber string `json:"queue_number"`
+		Status      string `json:"status"`
+		Error       string `json:"error,omitempty"`
+	}
+	results := make([]result, 0, len(req.Tickets))
+	synced := 0
+	for _, t := range req.Tickets {
+		if t == nil {
+			continue
+		}
+		res := result{BlockID: t.BlockID, QueueNumber: t.QueueNumber, Status: "synced"}
+		queue, err := h.db.CreateOfflineTicket(agentID, t)
+		switch {
+		case err == nil:
+			synced++
+			h.audit(r, auditQueueOffline, "queue", fmt.Sprint(queue.ID), nil,
+				map[string]interface{}{"queue_number": queue.QueueNumber, "agent_id": agentID, "issued_at": t.IssuedAt})
+		case err == database.ErrTicketExists:
+			res.Status = "duplicate"
+		case err == database.ErrNumberNotLeased || err == sql.ErrNoRows:
+			res.Status, res.Error = "rejected", database.ErrNumberNotLeased.Error()
+		case err == database.ErrTicketExpired:
+			res.Status, res.Error = "rejected", err.Error()
+		default:
+			log.Printf("Failed to sync offline ticket %s from agent %s: %v", t.QueueNumber, agentID, err)
+			res.Status, res.Error = "failed", "failed to save ticket"
+		}
+		results = append(results, res)
+	}
+
+	if synced > 0 {
+		log.Printf("Synced %d offline tickets from print agent %s", synced, agentID)
+		waitingCount, _ := h.db.GetWaitingCount()
+		h.hub.BroadcastAllCounters("queue_added", models.CounterUpdateData{
+			WaitingCount: waitingCount,
+			Timestamp:    time.Now(),
+		})
+		h.notifyTickets()
+	}
+	h.jsonResponse(w, map[string]interface{}{"results": results})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+func TestSyncOfflineTickets(t *testing.T) {
+	h := newTestHandler(t)
+	block, err := h.db.LeaseNumberBlock("printer-1", "A", 10)
+	if err != nil {
+		t.Fatalf("LeaseNumberBlock: %v", err)
+	}
+	expired, err := h.db.LeaseNumberBlock("printer-1", "A", 10)
+	if err != nil {
+		t.Fatalf("LeaseNumberBlock: %v", err)
+	}
+	yesterday := time.Now().AddDate(0, 0, -1)
+	if _, err := h.db.Exec(`UPDATE number_blocks SET day = ? WHERE id = ?`, yesterday.Format("2006-01-02"), expired.ID); err != nil {
+		t.Fatalf("failed to move the block to yesterday: %v", err)
+	}
+
+	now := time.Now()
+	tickets := []*models.OfflineTicket{
+		{QueueNumber: "AX001", QueueType: "A", IssuedAt: now, BlockID: block.ID},
+		{QueueNumber: "AX001", QueueType: "A", IssuedAt: now, BlockID: block.ID},
+		{QueueNumber: "AX099", QueueType: "A", IssuedAt: now, BlockID: block.ID},
+		{QueueNumber: "AX011", QueueType: "A", BlockID: expired.ID,
+			IssuedAt: time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 23, 58, 0, 0, time.Local)},
+	}
+	want := []struct {
+		blockID int64
+		status  string
+	}{
+		{block.ID, "synced"},
+		{block.ID, "duplicate"},
+		{block.ID, "rejected"},
+		{expired.ID, "rejected"},
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"tickets": tickets})
+	req := httptest.NewRequest(http.MethodPost, "/api/print-agent/offline-tickets", bytes.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), apiTokenKey, &models.APIToken{AgentID: "printer-1"}))
+	rec := httptest.NewRecorder()
+	h.handleSyncOfflineTickets(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+
+	var resp struct {
+		Results []struct {
+			BlockID     int64  `json:"block_id"`
+			QueueNumber string `json:"queue_number"`
+			Status      string `json:"status"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode results: %v", err)
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("%d results, want %d", len(resp.Results), len(want))
+	}
+	for i, r := range resp.Results {
+		if r.BlockID != want[i].blockID || r.QueueNumber != tickets[i].QueueNumber || r.Status != want[i].status {
+			t.Errorf("result %d = %+v, want %s of block %d %s", i, r, tickets[i].QueueNumber, want[i].blockID, want[i].status)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"log"
+	"net/http"
+	"time"
+
+	"queue-system/internal/printer"
+)
+
+// handlePrinterPreview renders a sample ticket exactly as the printer
+// would print it, as a PNG or, with ?format=pdf, a PDF. GET renders the
+// saved ticket design; POST renders an unsaved one, taking the layout and
+// paper settings in the body over the saved ones.
+func (h *Handler) handlePrinterPreview(w http.ResponseWriter, r *http.Request) {
+	template := h.loadTicketTemplate()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxLayoutBody)
+		var req struct {
+			Layout     *printer.Layout `json:"layout"`
+			PaperWidth int             `json:"paper_width"`
+			Columns    int             `json:"columns"`
+			Codepage   string          `json:"codepage"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Layout != nil {
+			if err := req.Layout.Validate(); err != nil {
+				h.jsonError(w, "Invalid layout: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			template.Layout = req.Layout
+		}
+		if req.PaperWidth != 0 {
+			if req.PaperWidth != printer.Paper58mmDots && req.PaperWidth != printer.Paper80mmDots {
+				h.jsonError(w, "paper_width must be 384 or 576", http.StatusBadRequest)
+				return
+			}
+			template.PaperWidth = req.PaperWidth
+		}
+		if req.Columns < 0 || req.Columns > 255 {
+			h.jsonError(w, "columns must be 0-255", http.StatusBadRequest)
+			return
+		}
+		template.Columns = req.Columns
+		if req.Codepage != "" {
+			if _, ok := printer.LookupCodepage(req.Codepage); !ok {
+				h.jsonError(w, "Unknown code page", http.StatusBadRequest)
+				return
+			}
+			template.Codepage = req.Codepage
+		}
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	img, err := h.printer.Preview(h.previewTicket(r), template)
+	if err != nil {
+		log.Printf("Ticket preview error: %v", err)
+		h.jsonError(w, "Failed to render preview", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	contentType := "image/png"
+	if r.URL.Query().Get("format") == "pdf" {
+		contentType = "application/pdf"
+		err = printer.WritePDF(&buf, img)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		h.jsonError(w, "Failed to render preview", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(buf.Bytes())
+}
+
+// previewTicket returns the sample ticket shown in previews. Its status
+// link is as long as a real one, so the QR code has the printed size.
+func (h *Handler) previewTicket(r *http.Request) printer.TicketData {
+	return printer.TicketData{
+		QueueNumber:   "A001",
+		TypeName:      "Umum",
+		DateTime:      time.Now().Format("02/01/2006, 15.04.05"),
+		Position:      3,
+		EstimatedWait: 12,
+		StatusURL:     h.ticketStatusURL(r, "0123456789abcdefghijkl"),
+		Counter:       "1, 2",
+	}
+}
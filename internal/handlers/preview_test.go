@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-system/internal/printer"
+)
+
+func TestPrinterPreview(t *testing.T) {
+	h := newTestHandler(t)
+
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		body        string
+		status      int
+		contentType string
+		width       int // PNG width in dots, 0 skips the check
+	}{
+		{"saved design", http.MethodGet, "/api/printer/preview", "", http.StatusOK, "image/png", printer.Paper80mmDots},
+		{"as PDF", http.MethodGet, "/api/printer/preview?format=pdf", "", http.StatusOK, "application/pdf", 0},
+		{"unsaved layout on 58mm paper", http.MethodPost, "/api/printer/preview",
+			`{"layout":{"version":1,"blocks":[{"type":"variable","variable":"queue_number"}]},"paper_width":384}`,
+			http.StatusOK, "image/png", printer.Paper58mmDots},
+		{"invalid layout", http.MethodPost, "/api/printer/preview", `{"layout":{"version":1,"blocks":[{"type":"table"}]}}`, http.StatusBadRequest, "", 0},
+		{"unsupported paper width", http.MethodPost, "/api/printer/preview", `{"paper_width":500}`, http.StatusBadRequest, "", 0},
+		{"unknown code page", http.MethodPost, "/api/printer/preview", `{"codepage":"utf8"}`, http.StatusBadRequest, "", 0},
+		{"malformed body", http.MethodPost, "/api/printer/preview", `{`, http.StatusBadRequest, "", 0},
+		{"wrong method", http.MethodDelete, "/api/printer/preview", "", http.StatusMethodNotAllowed, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			h.handlePrinterPreview(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.contentType == "" {
+				return
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type %q, want %q", got, tt.contentType)
+			}
+			if tt.width == 0 {
+				return
+			}
+			img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+			if err != nil {
+				t.Fatalf("png.Decode: %v", err)
+			}
+			if w := img.Bounds().Dx(); w != tt.width {
+				t.Errorf("preview is %d dots wide, want %d", w, tt.width)
+			}
+		})
+	}
+}
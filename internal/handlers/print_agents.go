@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"queue-system/internal/models"
+	"queue-system/internal/printer"
+)
+
+// Print agents send a heartbeat every 15 seconds. One that has missed a few
+// is shown as stale, one silent for agentOfflineAfter as offline.
+const (
+	agentStaleAfter   = 45 * time.Second
+	agentOfflineAfter = 2 * time.Minute
+)
+
+// agentWatch remembers the state of each print agent at the last check, so
+// CheckPrintAgents can tell which ones just dropped.
+type agentWatch struct {
+	mu     sync.Mutex
+	states map[string]models.PrintAgentState
+}
+
+// handleAgentHeartbeat registers a print agent and what it reports about
+// itself.
+func (h *Handler) handleAgentHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		AgentID  string `json:"agent_id"`
+		Hostname string `json:"hostname"`
+		Version  string `json:"version"`
+		Printer  string `json:"printer"`
+		Backend  string `json:"backend"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	agentID, ok := resolveAgentID(r, req.AgentID)
+	if !ok {
+		h.jsonError(w, "agent_id is required and must match the token", http.StatusBadRequest)
+		return
+	}
+
+	err := h.db.RecordPrintAgentHeartbeat(&models.PrintAgent{
+		ID:       agentID,
+		Group:    agentGroup(r),
+		Hostname: req.Hostname,
+		Version:  req.Version,
+		Printer:  req.Printer,
+		Backend:  req.Backend,
+	})
+	if err != nil {
+		log.Printf("Failed to record heartbeat of agent %s: %v", agentID, err)
+		h.jsonError(w, "Failed to record heartbeat", http.StatusInternalServerError)
+		return
+	}
+	h.jsonResponse(w, map[string]string{"status": "ok"})
+}
+
+// listPrintAgents returns the registry with each agent's state and whether
+// it is connected for jobs right now.
+func (h *Handler) listPrintAgents() ([]*models.PrintAgent, error) {
+	agents, err := h.db.ListPrintAgents(agentStaleAfter, agentOfflineAfter)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range agents {
+		a.Connected = h.hub.PrinterAgentConnected(a.ID)
+	}
+	return agents, nil
+}
+
+// handlePrintAgents lists the print agents for the admin fleet overview.
+func (h *Handler) handlePrintAgents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	agents, err := h.listPrintAgents()
+	if err != nil {
+		h.jsonError(w, "Failed to list print agents", http.StatusInternalServerError)
+		return
+	}
+	if agents == nil {
+		agents = []*models.PrintAgent{}
+	}
+	h.jsonResponse(w, agents)
+}
+
+// handlePrintAgentDelete removes a decommissioned agent from the registry.
+func (h *Handler) handlePrintAgentDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.PathValue("id")
+	found, err := h.db.DeletePrintAgent(id)
+	if err != nil {
+		h.jsonError(w, "Failed to delete print agent", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		h.jsonError(w, "Print agent not found", http.StatusNotFound)
+		return
+	}
+	h.audit(r, auditPrintAgentDelete, "print_agent", id, nil, nil)
+
+	h.agents.mu.Lock()
+	delete(h.agents.states, id)
+	h.agents.mu.Unlock()
+
+	h.jsonResponse(w, map[string]string{"status": "deleted"})
+}
+
+// handleAgentConfig returns the settings managed on the server for the
+// calling agent, which it applies over its config.yaml.
+func (h *Handler) handleAgentConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	agentID, ok := resolveAgentID(r, r.URL.Query().Get("agent_id"))
+	if !ok {
+		h.jsonError(w, "agent_id is required and must match the token", http.StatusBadRequest)
+		return
+	}
+	cfg, err := h.db.GetPrintAgentConfig(agentID)
+	if err != nil {
+		log.Printf("Failed to get config of agent %s: %v", agentID, err)
+		h.jsonError(w, "Failed to get config", http.StatusInternalServerError)
+		return
+	}
+	h.jsonResponse(w, cfg)
+}
+
+// handlePrintAgentConfig shows or replaces an agent's settings. A change is
+// pushed to the agent with a config_updated event, so it applies it live.
+func (h *Handler) handlePrintAgentConfig(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := h.db.GetPrintAgentConfig(id)
+		if err != nil {
+			h.jsonError(w, "Failed to get config", http.StatusInternalServerError)
+			return
+		}
+		h.jsonResponse(w, cfg)
+
+	case http.MethodPut:
+		var cfg models.PrintAgentConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			h.jsonError(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if err := validatePrintAgentConfig(&cfg); err != nil {
+			h.jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		before, err := h.db.GetPrintAgentConfig(id)
+		if err != nil {
+			h.jsonError(w, "Failed to get config", http.StatusInternalServerError)
+			return
+		}
+		if err := h.db.SavePrintAgentConfig(id, &cfg); err != nil {
+			log.Printf("Failed to save config of agent %s: %v", id, err)
+			h.jsonError(w, "Failed to save config", http.StatusInternalServerError)
+			return
+		}
+		saved, err := h.db.GetPrintAgentConfig(id)
+		if err != nil {
+			h.jsonError(w, "Failed to get config", http.StatusInternalServerError)
+			return
+		}
+		h.audit(r, auditPrintAgentConfig, "print_agent", id, before, saved)
+
+		h.hub.BroadcastPrinterTarget(id, "config_updated", map[string]interface{}{"agent_id": id})
+		log.Printf("Config of print agent %s updated", id)
+		h.jsonResponse(w, saved)
+
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validatePrintAgentConfig checks the settings an agent would fail to
+// apply, so the admin hears about it rather than the agent's log.
+func validatePrintAgentConfig(cfg *models.PrintAgentConfig) error {
+	if cfg.Backend != "" || cfg.Codepage != "" {
+		p := printer.New(printer.PrinterConfig{
+			PrinterName: cfg.PrinterName,
+			Backend:     cfg.Backend,
+			Address:     cfg.Address,
+			Codepage:    cfg.Codepage,
+		})
+		if err := p.Err(); err != nil {
+			return err
+		}
+	}
+	if cfg.PaperWidth < 0 || cfg.Columns < 0 {
+		return fmt.Errorf("paper_width and columns must not be negative")
+	}
+	if len(cfg.Template) > 0 {
+		var tmpl printer.TicketTemplate
+		if err := json.Unmarshal(cfg.Template, &tmpl); err != nil {
+			return fmt.Errorf("template must be an object of ticket design fields")
+		}
+	}
+	switch cfg.LogLevel {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("unknown log_level %q (use debug, info, warn or error)", cfg.LogLevel)
+	}
+	return nil
+}
+
+func (h *Handler) handleAdminSSE(w http.ResponseWriter, r *http.Request) {
+	h.hub.ServeAdminSSE(w, r)
+}
+
+// CheckPrintAgents tells the open admin panels which print agents changed
+// state since the last check, and raises an alert when an agent that went
+// offline was the last one printing for a kiosk. It is run periodically.
+func (h *Handler) CheckPrintAgents() {
+	agents, err := h.listPrintAgents()
+	if err != nil {
+		log.Printf("Failed to check print agents: %v", err)
+		return
+	}
+
+	h.agents.mu.Lock()
+	first := h.agents.states == nil
+	if first {
+		h.agents.states = make(map[string]models.PrintAgentState)
+	}
+	var dropped []*models.PrintAgent
+	for _, a := range agents {
+		prev, known := h.agents.states[a.ID]
+		h.agents.states[a.ID] = a.State
+		if first || prev == a.State {
+			continue
+		}
+		h.hub.BroadcastAdmin("print_agent", map[string]interface{}{"agent_id": a.ID, "state": a.State})
+		if known && a.State == models.PrintAgentOffline {
+			dropped = append(dropped, a)
+		}
+	}
+	h.agents.mu.Unlock()
+
+	for _, a := range dropped {
+		kiosks, last := h.orphanedKiosks(a, agents)
+		log.Printf("Print agent %s went offline", a.ID)
+		if len(kiosks) == 0 && !last {
+			continue
+		}
+		if last {
+			log.Printf("No print agent is online any more")
+		} else {
+			log.Printf("No print agent is online for kiosk %s", strings.Join(kiosks, ", "))
+		}
+		h.hub.BroadcastAdmin("printer_alert", map[string]interface{}{
+			"agent_id":   a.ID,
+			"kiosks":     kiosks,
+			"last_agent": last,
+		})
+	}
+}
+
+// orphanedKiosks returns the kiosks routed to a dropped agent, or its
+// group, that no live agent prints for any more, and whether no agent at
+// all is live, which leaves every kiosk without remote printing.
+func (h *Handler) orphanedKiosks(dropped *models.PrintAgent, agents []*models.PrintAgent) ([]string, bool) {
+	serves := func(target string) bool {
+		for _, a := range agents {
+			if a.State != models.PrintAgentOffline && (target == "" || a.ID == target || a.Group == target) {
+				return true
+			}
+		}
+		return false
+	}
+
+	kiosks := []string{}
+	for kiosk, target := range h.config.Printer.Routing.Kiosks {
+		if target != dropped.ID && (dropped.Group == "" || target != dropped.Group) {
+			continue
+		}
+		if !serves(target) {
+			kiosks = append(kiosks, kiosk)
+		}
+	}
+	sort.Strings(kiosks)
+	return kiosks, !serves("")
+}
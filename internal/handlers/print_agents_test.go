@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-system/internal/config"
+	"queue-system/internal/models"
+)
+
+func TestOrphanedKiosks(t *testing.T) {
+	h := &Handler{config: config.DefaultConfig()}
+	h.config.Printer.Routing.Kiosks = map[string]string{
+		"kiosk-lobi":  "printer-1",
+		"kiosk-loket": "printer-1",
+		"kiosk-a1":    "gedung-a",
+		"kiosk-a2":    "gedung-a",
+		"kiosk-b":     "printer-3",
+	}
+
+	agent := func(id, group string, state models.PrintAgentState) *models.PrintAgent {
+		return &models.PrintAgent{ID: id, Group: group, State: state}
+	}
+
+	tests := []struct {
+		name    string
+		dropped *models.PrintAgent
+		others  []*models.PrintAgent
+		kiosks  []string
+		last    bool
+	}{
+		{"kiosks routed to the agent", agent("printer-1", "", models.PrintAgentOffline),
+			[]*models.PrintAgent{agent("printer-3", "", models.PrintAgentOnline)},
+			[]string{"kiosk-lobi", "kiosk-loket"}, false},
+		{"group still served", agent("printer-2", "gedung-a", models.PrintAgentOffline),
+			[]*models.PrintAgent{agent("printer-4", "gedung-a", models.PrintAgentStale)},
+			[]string{}, false},
+		{"group left without agents", agent("printer-2", "gedung-a", models.PrintAgentOffline),
+			[]*models.PrintAgent{agent("printer-4", "gedung-a", models.PrintAgentOffline), agent("printer-3", "", models.PrintAgentOnline)},
+			[]string{"kiosk-a1", "kiosk-a2"}, false},
+		{"no kiosk routed to the agent", agent("printer-5", "", models.PrintAgentOffline),
+			[]*models.PrintAgent{agent("printer-3", "", models.PrintAgentOnline)},
+			[]string{}, false},
+		{"last agent", agent("printer-3", "", models.PrintAgentOffline),
+			[]*models.PrintAgent{agent("printer-1", "", models.PrintAgentOffline)},
+			[]string{"kiosk-b"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agents := append([]*models.PrintAgent{tt.dropped}, tt.others...)
+			kiosks, last := h.orphanedKiosks(tt.dropped, agents)
+			if !slices.Equal(kiosks, tt.kiosks) {
+				t.Errorf("kiosks = %v, want %v", kiosks, tt.kiosks)
+			}
+			if last != tt.last {
+				t.Errorf("last = %v, want %v", last, tt.last)
+			}
+		})
+	}
+}
+
+func TestCheckPrintAgents(t *testing.T) {
+	h := newTestHandler(t)
+	h.config.Printer.Routing.Kiosks = map[string]string{"kiosk-lobi": "printer-1"}
+
+	for _, id := range []string{"printer-1", "printer-2"} {
+		if err := h.db.RecordPrintAgentHeartbeat(&models.PrintAgent{ID: id}); err != nil {
+			t.Fatalf("RecordPrintAgentHeartbeat: %v", err)
+		}
+	}
+	h.CheckPrintAgents()
+
+	srv := httptest.NewServer(http.HandlerFunc(h.handleAdminSSE))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to open the admin stream: %v", err)
+	}
+	defer resp.Body.Close()
+	events := bufio.NewScanner(resp.Body)
+	next := func() string {
+		for events.Scan() {
+			if data, ok := strings.CutPrefix(events.Text(), "data: "); ok {
+				return data
+			}
+		}
+		t.Fatalf("admin stream ended: %v", events.Err())
+		return ""
+	}
+	next() // connected
+	for h.hub.GetAdminClientCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := h.db.Exec(`UPDATE print_agents SET last_heartbeat_at = datetime('now', 'localtime', '-10 minutes') WHERE id = 'printer-1'`); err != nil {
+		t.Fatalf("failed to age the heartbeat: %v", err)
+	}
+	h.CheckPrintAgents()
+
+	var state struct {
+		Type string `json:"type"`
+		Data struct {
+			AgentID string                 `json:"agent_id"`
+			State   models.PrintAgentState `json:"state"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(next()), &state); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+	if state.Type != "print_agent" || state.Data.AgentID != "printer-1" || state.Data.State != models.PrintAgentOffline {
+		t.Errorf("got %+v, want printer-1 going offline", state)
+	}
+
+	var alert struct {
+		Type string `json:"type"`
+		Data struct {
+			AgentID   string   `json:"agent_id"`
+			Kiosks    []string `json:"kiosks"`
+			LastAgent bool     `json:"last_agent"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(next()), &alert); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+	if alert.Type != "printer_alert" || alert.Data.AgentID != "printer-1" ||
+		!slices.Equal(alert.Data.Kiosks, []string{"kiosk-lobi"}) || alert.Data.LastAgent {
+		t.Errorf("got %+v, want an alert for kiosk-lobi", alert)
+	}
+
+	// Nothing changed, so a new check stays quiet.
+	h.CheckPrintAgents()
+	h.hub.BroadcastAdmin("probe", nil)
+	if data := next(); !strings.Contains(data, `"probe"`) {
+		t.Errorf("unexpected event %s", data)
+	}
+}
+
+func TestPrintAgentConfig(t *testing.T) {
+	h := newTestHandler(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"printer and design", `{"backend":"tcp","address":"10.0.0.6:9100","codepage":"pc858","template":{"Header":"GEDUNG A"},"log_level":"debug"}`, http.StatusOK},
+		{"unknown backend", `{"backend":"serial"}`, http.StatusBadRequest},
+		{"unknown code page", `{"codepage":"utf8"}`, http.StatusBadRequest},
+		{"negative columns", `{"columns":-1}`, http.StatusBadRequest},
+		{"template is not an object", `{"template":["GEDUNG A"]}`, http.StatusBadRequest},
+		{"unknown log level", `{"log_level":"verbose"}`, http.StatusBadRequest},
+		{"malformed body", `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/api/admin/print-agents/printer-1/config", strings.NewReader(tt.body))
+			req.SetPathValue("id", "printer-1")
+			rec := httptest.NewRecorder()
+			h.handlePrintAgentConfig(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+
+	// The agent gets what was saved; refused changes left it alone
+	req := httptest.NewRequest(http.MethodGet, "/api/print-agent/config?agent_id=printer-1", nil)
+	req = req.WithContext(context.WithValue(req.Context(), apiTokenKey, &models.APIToken{AgentID: "printer-1"}))
+	rec := httptest.NewRecorder()
+	h.handleAgentConfig(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var cfg models.PrintAgentConfig
+	if err := json.NewDecoder(rec.Body).Decode(&cfg); err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+	if cfg.Backend != "tcp" || cfg.Address != "10.0.0.6:9100" || cfg.LogLevel != "debug" ||
+		string(cfg.Template) != `{"Header":"GEDUNG A"}` || cfg.UpdatedAt == nil {
+		t.Errorf("agent got %+v", cfg)
+	}
+
+	// Another agent has no settings, and may not read this one's
+	for _, tt := range []struct {
+		token  string
+		query  string
+		status int
+	}{
+		{"printer-2", "?agent_id=printer-2", http.StatusOK},
+		{"printer-2", "?agent_id=printer-1", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/print-agent/config"+tt.query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), apiTokenKey, &models.APIToken{AgentID: tt.token}))
+		rec := httptest.NewRecorder()
+		h.handleAgentConfig(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s reading %s: status = %d, want %d", tt.token, tt.query, rec.Code, tt.status)
+		}
+		if tt.status == http.StatusOK && strings.TrimSpace(rec.Body.String()) != "{}" {
+			t.Errorf("%s got settings %s, want none", tt.token, rec.Body)
+		}
+	}
+}
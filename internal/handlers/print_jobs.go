@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+// Print job recovery. Agents hold a claimed job for printer.job_lease; a
+// job whose agent never reports back goes back to pending, a failed one is
+// retried with a growing backoff, and after printer.job_max_attempts it is
+// dead-lettered until an admin reissues or dismisses it. No ticket is
+// dropped silently.
+
+// maxListedPrintJobs caps the admin print job list.
+const maxListedPrintJobs = 200
+
+// printJobLease returns how long an agent holds a claimed job.
+func (h *Handler) printJobLease() time.Duration {
+	if h.config.Printer.JobLease > 0 {
+		return h.config.Printer.JobLease
+	}
+	return 2 * time.Minute
+}
+
+// printJobMaxAttempts returns how often a job is tried before it is
+// dead-lettered.
+func (h *Handler) printJobMaxAttempts() int {
+	if h.config.Printer.JobMaxAttempts > 0 {
+		return h.config.Printer.JobMaxAttempts
+	}
+	return 5
+}
+
+// printJobTarget returns the print agent or printer group that prints a
+// ticket taken at the given kiosk for the given queue type, or "" for any
+// agent. The kiosk's mapping wins, so a ticket comes out where the visitor
+// is standing.
+func (h *Handler) printJobTarget(kiosk, queueType string) string {
+	routing := h.config.Printer.Routing
+	if target, ok := routing.Kiosks[kiosk]; ok && kiosk != "" {
+		return target
+	}
+	return routing.QueueTypes[queueType]
+}
+
+// broadcastPrintJob tells the print agents a job may go to that it is
+// waiting to be claimed.
+func (h *Handler) broadcastPrintJob(job *models.PrintJob) {
+	h.hub.BroadcastPrinterTarget(job.Target, "print_job", map[string]interface{}{
+		"job_id":       job.ID,
+		"queue_number": job.QueueNumber,
+	})
+}
+
+// RecoverPrintJobs takes back jobs whose lease expired and requeues failed
+// jobs whose retry is due, then announces the pending jobs to the agents
+// again. It is run periodically.
+func (h *Handler) RecoverPrintJobs() {
+	expired, err := h.db.ExpirePrintJobLeases(h.printJobMaxAttempts())
+	if err != nil {
+		log.Printf("Failed to expire print job leases: %v", err)
+	} else if expired > 0 {
+		log.Printf("Took back %d print jobs with an expired lease", expired)
+	}
+
+	due, err := h.db.RetryDuePrintJobs()
+	if err != nil {
+		log.Printf("Failed to retry print jobs: %v", err)
+	} else if due > 0 {
+		log.Printf("Retrying %d failed print jobs", due)
+	}
+
+	if expired == 0 && due == 0 {
+		return
+	}
+	jobs, err := h.db.ListAllPendingPrintJobs()
+	if err != nil {
+		log.Printf("Failed to list pending print jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		h.broadcastPrintJob(job)
+	}
+}
+
+// handleAdminPrintJobs lists print jobs by state, failed and dead-lettered
+// ones unless ?status= names others (comma-separated).
+func (h *Handler) handleAdminPrintJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statuses := []models.PrintJobStatus{models.PrintJobFailed, models.PrintJobDead}
+	if val := r.URL.Query().Get("status"); val != "" {
+		statuses = nil
+		for _, s := range strings.Split(val, ",") {
+			switch status := models.PrintJobStatus(strings.TrimSpace(s)); status {
+			case models.PrintJobPending, models.PrintJobPrinting, models.PrintJobCompleted,
+				models.PrintJobFailed, models.PrintJobDead, models.PrintJobDismissed:
+				statuses = append(statuses, status)
+			default:
+				h.jsonError(w, "Unknown print job status: "+s, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	jobs, err := h.db.ListPrintJobs(statuses, maxListedPrintJobs)
+	if err != nil {
+		h.jsonError(w, "Failed to list print jobs", http.StatusInternalServerError)
+		return
+	}
+	if jobs == nil {
+		jobs = []*models.PrintJob{}
+	}
+	h.jsonResponse(w, jobs)
+}
+
+// handleAdminPrintJobReissue puts a failed or dead-lettered job back in
+// the print queue with a fresh set of attempts.
+func (h *Handler) handleAdminPrintJobReissue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.db.GetPrintJob(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.jsonError(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		h.jsonError(w, "Failed to get job", http.StatusInternalServerError)
+		return
+	}
+	job, err := h.db.ReissuePrintJob(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.jsonError(w, "Only failed or dead jobs can be reissued", http.StatusConflict)
+			return
+		}
+		h.jsonError(w, "Failed to reissue job", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, auditPrintJobReissue, "print_job", fmt.Sprint(id),
+		map[string]interface{}{"status": before.Status, "attempts": before.Attempts, "error": before.ErrorMessage}, nil)
+	log.Printf("Print job #%d reissued", id)
+	h.broadcastPrintJob(job)
+	h.jsonResponse(w, job)
+}
+
+// handleAdminPrintJobDismiss gives up on a dead-lettered job whose ticket
+// is no longer needed. It is recorded in the audit log before the job is
+// cleaned up.
+func (h *Handler) handleAdminPrintJobDismiss(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.db.DismissPrintJob(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.jsonError(w, "Only dead jobs can be dismissed", http.StatusConflict)
+			return
+		}
+		h.jsonError(w, "Failed to dismiss job", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, auditPrintJobDismiss, "print_job", fmt.Sprint(id),
+		map[string]interface{}{"status": models.PrintJobDead, "queue_number": job.QueueNumber,
+			"attempts": job.Attempts, "error": job.ErrorMessage}, map[string]interface{}{"status": job.Status})
+	log.Printf("Print job #%d dismissed", id)
+	h.jsonResponse(w, job)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"queue-system/internal/config"
+	"queue-system/internal/models"
+)
+
+func TestPrintJobTarget(t *testing.T) {
+	h := &Handler{config: config.DefaultConfig()}
+	h.config.Printer.Routing = config.PrintRouting{
+		Kiosks:     map[string]string{"kiosk-lobi": "gedung-a", "kiosk-b": "printer-b1"},
+		QueueTypes: map[string]string{"C": "gedung-b", "D": "printer-d1"},
+	}
+
+	tests := []struct {
+		name      string
+		kiosk     string
+		queueType string
+		want      string
+	}{
+		{"kiosk mapped", "kiosk-b", "A", "printer-b1"},
+		{"kiosk wins over queue type", "kiosk-lobi", "C", "gedung-a"},
+		{"queue type of an unmapped kiosk", "kiosk-x", "C", "gedung-b"},
+		{"queue type without a kiosk", "", "D", "printer-d1"},
+		{"nothing mapped", "kiosk-x", "A", ""},
+		{"nothing given", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.printJobTarget(tt.kiosk, tt.queueType); got != tt.want {
+				t.Errorf("printJobTarget(%q, %q) = %q, want %q", tt.kiosk, tt.queueType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPendingPrintJobs(t *testing.T) {
+	h := newTestHandler(t)
+
+	jobs := map[string]int64{}
+	for _, target := range []string{"", "printer-1", "printer-2", "gedung-a", "gedung-b"} {
+		job, err := h.db.CreatePrintJob("A001", "Umum", "", "{}", models.PriorityNormal, 1, 5, "", "", target)
+		if err != nil {
+			t.Fatalf("CreatePrintJob: %v", err)
+		}
+		jobs[target] = job.ID
+	}
+
+	tests := []struct {
+		name   string
+		token  *models.APIToken
+		query  string
+		status int
+		want   []string // targets of the listed jobs
+	}{
+		{"token agent", &models.APIToken{AgentID: "printer-1"}, "", http.StatusOK, []string{"", "printer-1"}},
+		{"token agent and group", &models.APIToken{AgentID: "printer-1", Group: "gedung-a"}, "?agent_id=printer-1", http.StatusOK,
+			[]string{"", "printer-1", "gedung-a"}},
+		{"group in the query is ignored", &models.APIToken{AgentID: "printer-2"}, "?agent_id=printer-2&group=gedung-b", http.StatusOK,
+			[]string{"", "printer-2"}},
+		{"other agent than the token", &models.APIToken{AgentID: "printer-1"}, "?agent_id=printer-2", http.StatusBadRequest, nil},
+		{"no agent", nil, "", http.StatusBadRequest, nil},
+		{"named agent without a token", nil, "?agent_id=printer-2", http.StatusOK, []string{"", "printer-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/print-agent/jobs/pending"+tt.query, nil)
+			if tt.token != nil {
+				req = req.WithContext(context.WithValue(req.Context(), apiTokenKey, tt.token))
+			}
+			rec := httptest.NewRecorder()
+			h.handlePendingPrintJobs(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var got []*models.PrintJob
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode jobs: %v", err)
+			}
+			var ids, want []int64
+			for _, j := range got {
+				ids = append(ids, j.ID)
+			}
+			for _, target := range tt.want {
+				want = append(want, jobs[target])
+			}
+			if !slices.Equal(ids, want) {
+				t.Errorf("listed jobs %v, want %v", ids, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"queue-system/internal/models"
+	"queue-system/internal/printer"
+)
+
+// handleAgentPrinterStatus stores the printer status a print agent reports.
+// Agents send it periodically and after each job; Status is null when the
+// printer could not be queried.
+func (h *Handler) handleAgentPrinterStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		AgentID string          `json:"agent_id"`
+		Printer string          `json:"printer"`
+		Status  *printer.Status `json:"status"`
+		Error   string          `json:"error"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.jsonError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	agentID, ok := resolveAgentID(r, req.AgentID)
+	if !ok {
+		h.jsonError(w, "agent_id is required and must match the token", http.StatusBadRequest)
+		return
+	}
+	if req.Status == nil && req.Error == "" {
+		h.jsonError(w, "status or error is required", http.StatusBadRequest)
+		return
+	}
+
+	st := printerStatus(agentID, req.Printer, req.Status, nil)
+	st.Error = req.Error
+	if err := h.db.SetPrinterStatus(st); err != nil {
+		log.Printf("Failed to save printer status of agent %s: %v", agentID, err)
+		h.jsonError(w, "Failed to save printer status", http.StatusInternalServerError)
+		return
+	}
+	h.jsonResponse(w, map[string]string{"status": "ok"})
+}
+
+// printerStatus converts the result of a status query into the form stored
+// and shown to admins.
+func printerStatus(agentID, name string, st *printer.Status, err error) *models.PrinterStatus {
+	ps := &models.PrinterStatus{AgentID: agentID, Printer: name, ReportedAt: time.Now()}
+	if err != nil {
+		ps.Error = err.Error()
+	}
+	if st != nil {
+		ps.Online = st.Online
+		ps.PaperNearEnd = st.PaperNearEnd
+		ps.PaperOut = st.PaperOut
+		ps.CoverOpen = st.CoverOpen
+	}
+	return ps
+}
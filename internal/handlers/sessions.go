@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"queue-system/internal/models"
+)
+
+// Session admin API handlers
+
+func (h *Handler) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessions, err := h.sessions.ListSessions()
+	if err != nil {
+		h.jsonError(w, "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+	if sessions == nil {
+		sessions = []*models.Session{}
+	}
+
+	if current := h.currentSession(r); current != nil {
+		for _, s := range sessions {
+			s.Current = s.ID == current.ID
+		}
+	}
+
+	h.jsonResponse(w, sessions)
+}
+
+// handleLogoutAllSessions signs out every session except the caller's own.
+func (h *Handler) handleLogoutAllSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var keepID int64
+	if current := h.currentSession(r); current != nil {
+		keepID = current.ID
+	}
+
+	count, err := h.sessions.DeleteAllSessions(keepID)
+	if err != nil {
+		log.Printf("Failed to log out sessions: %v", err)
+		h.jsonError(w, "Failed to log out sessions", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, auditLogoutAll, "session", "", nil, map[string]int64{"removed": count})
+	log.Printf("Logged out %d sessions", count)
+	h.jsonResponse(w, map[string]interface{}{
+		"status":  "success",
+		"removed": count,
+	})
+}
+
+func (h *Handler) handleSessionAPI(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/admin/session/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := h.sessions.DeleteSession(id); err != nil {
+		log.Printf("Failed to delete session: %v", err)
+		h.jsonError(w, "Failed to delete session", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, auditSessionRevoke, "session", idStr, nil, nil)
+	h.jsonResponse(w, map[string]string{"status": "deleted"})
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+
+	"queue-system/internal/models"
+)
+
+// Public ticket status page. Every ticket carries a random token; the
+// printed QR code links to /t/{token}, where the visitor follows the
+// ticket's position, estimated wait and the counter it is called to. The
+// page is kept up to date over a per-ticket SSE channel.
+
+// ticketStatusEvent is the SSE event carrying a models.TicketStatus.
+const ticketStatusEvent = "ticket_status"
+
+// ticketStatusURL returns the address of a ticket's status page. It is
+// based on server.public_url if set, otherwise on the address the request
+// reached the server at.
+func (h *Handler) ticketStatusURL(r *http.Request, token string) string {
+	base := strings.TrimRight(h.config.Server.PublicURL, "/")
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + "/t/" + token
+}
+
+// handleTicketStatusPage renders the status page of the ticket named by
+// the token in the path.
+func (h *Handler) handleTicketStatusPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	title, _ := h.db.GetSetting("ticket_page_title")
+	if title == "" {
+		title = "Sistem Antrian"
+	}
+	data := map[string]interface{}{
+		"Title": title,
+		"Token": r.PathValue("token"),
+	}
+
+	queue, err := h.db.GetQueueByToken(r.PathValue("token"))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Failed to get ticket: %v", err)
+		}
+		w.WriteHeader(http.StatusNotFound)
+		h.tmpl.ExecuteTemplate(w, "ticket_status.html", data)
+		return
+	}
+
+	status, err := h.db.GetTicketStatus(queue)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	data["Ticket"] = status
+	h.tmpl.ExecuteTemplate(w, "ticket_status.html", data)
+}
+
+// handleTicketSSE streams status updates for the ticket named by the token
+// in the path. The current status is sent on connect.
+func (h *Handler) handleTicketSSE(w http.ResponseWriter, r *http.Request) {
+	queue, err := h.db.GetQueueByToken(r.PathValue("token"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Ticket not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	status, err := h.db.GetTicketStatus(queue)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	h.hub.ServeTicketSSE(w, r, queue.ID, ticketStatusEvent, status)
+}
+
+// notifyTickets asks for the status of every ticket with an open status
+// page to be sent; call it after a queue change. A change to one ticket
+// moves the others of its type, so all of them are refreshed. Changes made
+// while a refresh is running are coalesced into a single next one.
+func (h *Handler) notifyTickets() {
+	select {
+	case h.ticketsChanged <- struct{}{}:
+	default:
+		// A refresh is already due
+	}
+}
+
+// ticketStatusWorker refreshes the ticket status pages each time
+// notifyTickets is called, one refresh at a time.
+func (h *Handler) ticketStatusWorker() {
+	for range h.ticketsChanged {
+		h.sendTicketStatuses()
+	}
+}
+
+// sendTicketStatuses sends the current status to every ticket with an open
+// status page.
+func (h *Handler) sendTicketStatuses() {
+	for _, id := range h.hub.TicketQueueIDs() {
+		queue, err := h.db.GetQueue(id)
+		if err != nil {
+			continue
+		}
+		status, err := h.db.GetTicketStatus(queue)
+		if err != nil {
+			log.Printf("Failed to get status of ticket %s: %v", queue.QueueNumber, err)
+			continue
+		}
+		h.hub.BroadcastTicket(id, ticketStatusEvent, status)
+	}
+}
+
+// ticketStatusFor returns the status of a ticket as returned to the visitor
+// who took it, with the link to its status page.
+func (h *Handler) ticketStatusFor(r *http.Request, queue *models.Queue) *models.TicketStatus {
+	status, err := h.db.GetTicketStatus(queue)
+	if err != nil {
+		log.Printf("Failed to estimate wait for %s: %v", queue.QueueNumber, err)
+		status = &models.TicketStatus{Queue: queue}
+	}
+	if queue.Token != "" {
+		status.StatusURL = h.ticketStatusURL(r, queue.Token)
+	}
+	return status
+}
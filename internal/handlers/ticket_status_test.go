@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"queue-system/internal/config"
+	"queue-system/internal/models"
+)
+
+func TestTicketStatusURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		publicURL string
+		tls       bool
+		proto     string
+		want      string
+	}{
+		{"request address", "", false, "", "http://antrian.local:8080/t/abc"},
+		{"behind TLS", "", true, "", "https://antrian.local:8080/t/abc"},
+		{"behind a TLS proxy", "", false, "https", "https://antrian.local:8080/t/abc"},
+		{"public URL", "https://antrian.example.id/", false, "", "https://antrian.example.id/t/abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{config: config.DefaultConfig()}
+			h.config.Server.PublicURL = tt.publicURL
+			req := httptest.NewRequest(http.MethodGet, "http://antrian.local:8080/api/queues/take", nil)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if got := h.ticketStatusURL(req, "abc"); got != tt.want {
+				t.Errorf("ticketStatusURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTicketStatusPage(t *testing.T) {
+	h := newTestHandler(t)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	queue, err := h.db.CreateQueue("A", models.PriorityNormal)
+	if err != nil {
+		t.Fatalf("CreateQueue: %v", err)
+	}
+	if queue.Token == "" {
+		t.Fatal("ticket has no status page token")
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		want     int
+		wantBody string
+	}{
+		{"known ticket", queue.Token, http.StatusOK, queue.QueueNumber},
+		{"unknown ticket", "tidakada", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/t/"+tt.token, nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("page does not show %s", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestNotifyTicketsCoalesces(t *testing.T) {
+	h := &Handler{ticketsChanged: make(chan struct{}, 1)}
+	for range 3 {
+		h.notifyTickets()
+	}
+	if n := len(h.ticketsChanged); n != 1 {
+		t.Errorf("%d refreshes pending, want 1", n)
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"queue-system/internal/models"
+)
+
+// apiTokenPrefix marks issued tokens so they are easy to spot in configs
+// and logs.
+const apiTokenPrefix = "qs_"
+
+// API token admin handlers
+
+func (h *Handler) handleAPITokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := h.db.ListAPITokens()
+		if err != nil {
+			h.jsonError(w, "Failed to list API tokens", http.StatusInternalServerError)
+			return
+		}
+		if tokens == nil {
+			tokens = []*models.APIToken{}
+		}
+		h.jsonResponse(w, tokens)
+
+	case http.MethodPost:
+		var req struct {
+			Name          string              `json:"name"`
+			Scopes        []models.TokenScope `json:"scopes"`
+			AgentID       string              `json:"agent_id"`
+			Group         string              `json:"group"`
+			ExpiresInDays int                 `json:"expires_in_days"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			h.jsonError(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+		if len(req.Scopes) == 0 {
+			h.jsonError(w, "At least one scope is required", http.StatusBadRequest)
+			return
+		}
+		for _, s := range req.Scopes {
+			if !s.IsValid() {
+				h.jsonError(w, "Invalid scope: "+string(s), http.StatusBadRequest)
+				return
+			}
+		}
+		req.AgentID = strings.TrimSpace(req.AgentID)
+		if req.AgentID == "" && slices.Contains(req.Scopes, models.ScopePrintAgent) {
+			h.jsonError(w, "agent_id is required for print-agent tokens", http.StatusBadRequest)
+			return
+		}
+		if req.ExpiresInDays < 0 {
+			h.jsonError(w, "expires_in_days must not be negative", http.StatusBadRequest)
+			return
+		}
+
+		raw := apiTokenPrefix + h.generateToken()
+		token := &models.APIToken{
+			Name:      req.Name,
+			TokenHash: hashToken(raw),
+			Prefix:    raw[:len(apiTokenPrefix)+8],
+			Scopes:    req.Scopes,
+			AgentID:   req.AgentID,
+			Group:     strings.TrimSpace(req.Group),
+		}
+		if req.ExpiresInDays > 0 {
+			token.ExpiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, req.ExpiresInDays), Valid: true}
+		}
+		if err := h.db.CreateAPIToken(token); err != nil {
+			log.Printf("Failed to create API token: %v", err)
+			h.jsonError(w, "Failed to create API token", http.StatusInternalServerError)
+			return
+		}
+		token.PrepareJSON()
+
+		h.audit(r, auditTokenCreate, "api_token", fmt.Sprint(token.ID), nil, token)
+		log.Printf("API token created: %s (%s)", token.Name, token.Prefix)
+		// The plaintext token is only ever returned here.
+		h.jsonResponse(w, map[string]interface{}{
+			"token":     raw,
+			"api_token": token,
+		})
+
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) handleAPITokenAPI(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/admin/token/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		token, err := h.db.GetAPIToken(id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				h.jsonError(w, "API token not found", http.StatusNotFound)
+				return
+			}
+			h.jsonError(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		h.jsonResponse(w, token)
+
+	case http.MethodDelete:
+		if err := h.db.RevokeAPIToken(id); err != nil {
+			if err == sql.ErrNoRows {
+				h.jsonError(w, "API token not found or already revoked", http.StatusNotFound)
+				return
+			}
+			log.Printf("Failed to revoke API token: %v", err)
+			h.jsonError(w, "Failed to revoke API token", http.StatusInternalServerError)
+			return
+		}
+
+		h.audit(r, auditTokenRevoke, "api_token", idStr, nil, nil)
+		log.Printf("API token #%d revoked", id)
+		h.jsonResponse(w, map[string]string{"status": "revoked"})
+
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
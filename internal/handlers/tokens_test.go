@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateAPIToken(t *testing.T) {
+	h := newTestHandler(t)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"pinned print agent", `{"name": "lobi", "scopes": ["print-agent"], "agent_id": "printer-lobi"}`, http.StatusOK},
+		{"unpinned print agent", `{"name": "lobi", "scopes": ["print-agent"]}`, http.StatusBadRequest},
+		{"blank agent ID", `{"name": "lobi", "scopes": ["print-agent"], "agent_id": "  "}`, http.StatusBadRequest},
+		{"kiosk without agent ID", `{"name": "kiosk", "scopes": ["kiosk"]}`, http.StatusOK},
+		{"no scope", `{"name": "kosong", "scopes": []}`, http.StatusBadRequest},
+		{"unknown scope", `{"name": "x", "scopes": ["root"]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/tokens", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			h.handleAPITokens(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
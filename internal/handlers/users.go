@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"queue-system/internal/database"
+	"queue-system/internal/models"
+)
+
+const minPasswordLength = 6
+
+// User API handlers
+
+func (h *Handler) handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		users, err := h.db.ListUsers()
+		if err != nil {
+			h.jsonError(w, "Failed to list users", http.StatusInternalServerError)
+			return
+		}
+		if users == nil {
+			users = []*models.User{}
+		}
+		h.jsonResponse(w, users)
+
+	case http.MethodPost:
+		var req struct {
+			Username   string          `json:"username"`
+			FullName   string          `json:"full_name"`
+			Password   string          `json:"password"`
+			Role       models.UserRole `json:"role"`
+			CounterIDs []int64         `json:"counter_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Username = strings.TrimSpace(req.Username)
+		if req.Username == "" {
+			h.jsonError(w, "Username is required", http.StatusBadRequest)
+			return
+		}
+		if !req.Role.IsValid() {
+			h.jsonError(w, "Invalid role", http.StatusBadRequest)
+			return
+		}
+		if len(req.Password) < minPasswordLength {
+			h.jsonError(w, "Password must be at least 6 characters", http.StatusBadRequest)
+			return
+		}
+
+		user, err := h.db.CreateUser(req.Username, req.FullName, req.Password, req.Role, req.CounterIDs)
+		if err == database.ErrUnknownCounter {
+			h.jsonError(w, "counter_ids contains a counter that does not exist", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to create user: %v", err)
+			h.jsonError(w, "Failed to create user (username must be unique)", http.StatusInternalServerError)
+			return
+		}
+
+		h.audit(r, auditUserCreate, "user", fmt.Sprint(user.ID), nil, user)
+		log.Printf("User created: %s (%s)", user.Username, user.Role)
+		h.jsonResponse(w, user)
+
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) handleUserAPI(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/user/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		h.jsonError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.db.GetUser(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.jsonError(w, "User not found", http.StatusNotFound)
+			return
+		}
+		h.jsonError(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.jsonResponse(w, user)
+
+	case http.MethodPut:
+		// Fields left out keep their stored value
+		var req struct {
+			FullName   *string         `json:"full_name,omitempty"`
+			Role       models.UserRole `json:"role"`
+			IsActive   *bool           `json:"is_active,omitempty"`
+			Password   string          `json:"password,omitempty"`
+			CounterIDs *[]int64        `json:"counter_ids,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Role == "" {
+			req.Role = user.Role
+		}
+		if !req.Role.IsValid() {
+			h.jsonError(w, "Invalid role", http.StatusBadRequest)
+			return
+		}
+		if req.Password != "" && len(req.Password) < minPasswordLength {
+			h.jsonError(w, "Password must be at least 6 characters", http.StatusBadRequest)
+			return
+		}
+		fullName, isActive, counterIDs := user.FullName, user.IsActive, user.CounterIDs
+		if req.FullName != nil {
+			fullName = *req.FullName
+		}
+		if req.IsActive != nil {
+			isActive = *req.IsActive
+		}
+		if req.CounterIDs != nil {
+			counterIDs = *req.CounterIDs
+		}
+
+		if err := h.db.UpdateUser(id, fullName, req.Role, isActive, counterIDs); err != nil {
+			if err == database.ErrUnknownCounter {
+				h.jsonError(w, "counter_ids contains a counter that does not exist", http.StatusBadRequest)
+				return
+			}
+			if err == database.ErrLastAdmin {
+				h.jsonError(w, "Cannot demote or deactivate the last active admin", http.StatusConflict)
+				return
+			}
+			log.Printf("Failed to update user: %v", err)
+			h.jsonError(w, "Failed to update user", http.StatusInternalServerError)
+			return
+		}
+
+		if req.Password != "" {
+			if err := h.db.SetUserPassword(id, req.Password); err != nil {
+				log.Printf("Failed to set user password: %v", err)
+				h.jsonError(w, "Failed to update password", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Sign the user out everywhere when their access changes.
+		if !isActive || req.Role != user.Role || req.Password != "" {
+			if err := h.sessions.DeleteUserSessions(id); err != nil {
+				log.Printf("Failed to revoke user sessions: %v", err)
+			}
+		}
+
+		before := user
+		user, err = h.db.GetUser(id)
+		if err != nil {
+			h.jsonError(w, "Failed to get updated user", http.StatusInternalServerError)
+			return
+		}
+		h.audit(r, auditUserUpdate, "user", fmt.Sprint(id), before, map[string]interface{}{
+			"user":             user,
+			"password_changed": req.Password != "",
+		})
+
+		log.Printf("User updated: %s", user.Username)
+		h.jsonResponse(w, user)
+
+	case http.MethodDelete:
+		if err := h.db.DeleteUser(id); err != nil {
+			if err == database.ErrLastAdmin {
+				h.jsonError(w, "Cannot delete the last active admin", http.StatusConflict)
+				return
+			}
+			log.Printf("Failed to delete user: %v", err)
+			h.jsonError(w, "Failed to delete user", http.StatusInternalServerError)
+			return
+		}
+		if err := h.sessions.DeleteUserSessions(id); err != nil {
+			log.Printf("Failed to revoke user sessions: %v", err)
+		}
+
+		h.audit(r, auditUserDelete, "user", fmt.Sprint(id), user, nil)
+		log.Printf("User deleted: %s", user.Username)
+		h.jsonResponse(w, map[string]string{"status": "deleted"})
+
+	default:
+		h.jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"queue-system/internal/models"
+)
+
+func TestUpdateUserKeepsOmittedFields(t *testing.T) {
+	h := newTestHandler(t)
+	counter, err := h.db.CreateCounter("1", "Loket 1")
+	if err != nil {
+		t.Fatalf("CreateCounter: %v", err)
+	}
+	if _, err := h.db.CreateUser("admin", "Admin", "rahasia", models.RoleAdmin, nil); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		body         string
+		wantStatus   int
+		wantName     string
+		wantRole     models.UserRole
+		wantActive   bool
+		wantCounters []int64
+	}{
+		{"only is_active", `{"is_active": false}`, http.StatusOK, "Budi", models.RoleOperator, false, []int64{counter.ID}},
+		{"only role", `{"role": "supervisor"}`, http.StatusOK, "Budi", models.RoleSupervisor, true, []int64{counter.ID}},
+		{"only full_name", `{"full_name": "Budi Santoso"}`, http.StatusOK, "Budi Santoso", models.RoleOperator, true, []int64{counter.ID}},
+		{"clear counters", `{"counter_ids": []}`, http.StatusOK, "Budi", models.RoleOperator, true, []int64{}},
+		{"unknown counter", `{"counter_ids": [99]}`, http.StatusBadRequest, "Budi", models.RoleOperator, true, []int64{counter.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := h.db.CreateUser("budi-"+strings.ReplaceAll(tt.name, " ", "-"), "Budi", "rahasia", models.RoleOperator, []int64{counter.ID})
+			if err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/user/%d", u.ID), strings.NewReader(tt.body))
+			h.handleUserAPI(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			got, err := h.db.GetUser(u.ID)
+			if err != nil {
+				t.Fatalf("GetUser: %v", err)
+			}
+			if got.FullName != tt.wantName || got.Role != tt.wantRole || got.IsActive != tt.wantActive {
+				t.Errorf("user %q/%s/active %v, want %q/%s/active %v",
+					got.FullName, got.Role, got.IsActive, tt.wantName, tt.wantRole, tt.wantActive)
+			}
+			if !slices.Equal(got.CounterIDs, tt.wantCounters) {
+				t.Errorf("counters %v, want %v", got.CounterIDs, tt.wantCounters)
+			}
+		})
+	}
+}
+
+func TestLastAdminIsKept(t *testing.T) {
+	h := newTestHandler(t)
+	admin, err := h.db.CreateUser("admin", "Admin", "rahasia", models.RoleAdmin, nil)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+	}{
+		{"demote", http.MethodPut, `{"role": "operator"}`},
+		{"deactivate", http.MethodPut, `{"is_active": false}`},
+		{"delete", http.MethodDelete, ``},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.method, fmt.Sprintf("/api/user/%d", admin.ID), strings.NewReader(tt.body))
+		h.handleUserAPI(rec, req)
+		if rec.Code != http.StatusConflict {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, http.StatusConflict)
+		}
+	}
+
+	got, err := h.db.GetUser(admin.ID)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if got.Role != models.RoleAdmin || !got.IsActive {
+		t.Errorf("last admin changed to %s, active %v", got.Role, got.IsActive)
+	}
+}
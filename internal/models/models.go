@@ -2,6 +2,8 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -12,8 +14,26 @@ const (
 	StatusCalled    QueueStatus = "called"
 	StatusCompleted QueueStatus = "completed"
 	StatusCancelled QueueStatus = "cancelled"
+	// StatusNoShow: dipanggil tapi tidak datang; tiket diparkir dan masih
+	// dapat dikembalikan ke antrian selama jatah panggil ulangnya belum habis
+	StatusNoShow QueueStatus = "no_show"
 )
 
+// QueuePriority menentukan urutan pemanggilan; nilai lebih tinggi dipanggil
+// lebih dulu.
+type QueuePriority int
+
+const (
+	PriorityNormal QueuePriority = 0
+	// PriorityHigh untuk lansia, penyandang disabilitas dan ibu hamil
+	PriorityHigh QueuePriority = 1
+)
+
+// IsValid reports whether p is one of the known priority levels.
+func (p QueuePriority) IsValid() bool {
+	return p >= PriorityNormal && p <= PriorityHigh
+}
+
 type Queue struct {
 	ID          int64          `json:"id"`
 	QueueNumber string         `json:"queue_number"`
@@ -26,6 +46,19 @@ type Queue struct {
 	CalledAtPtr *time.Time     `json:"called_at,omitempty"`
 	CompletedAt sql.NullTime   `json:"-"`
 	CompletedAtPtr *time.Time  `json:"completed_at,omitempty"`
+	Priority    QueuePriority  `json:"priority"`
+	SkipCount   int            `json:"skip_count"`
+	// RequeueAfter is set on a returned ticket: the number of other tickets
+	// of its type still to be called before it (0 = next)
+	RequeueAfter    sql.NullInt64 `json:"-"`
+	RequeueAfterPtr *int64        `json:"requeue_after,omitempty"`
+	// TargetCounterID is set on a ticket transferred to a specific counter;
+	// only that counter will call it
+	TargetCounterID    sql.NullInt64 `json:"-"`
+	TargetCounterIDPtr *int64        `json:"target_counter_id,omitempty"`
+	// Token identifies the ticket on the public status page; it is only
+	// handed to the visitor who took the ticket
+	Token string `json:"-"`
 }
 
 func (q *Queue) PrepareJSON() {
@@ -38,6 +71,28 @@ func (q *Queue) PrepareJSON() {
 	if q.CompletedAt.Valid {
 		q.CompletedAtPtr = &q.CompletedAt.Time
 	}
+	if q.RequeueAfter.Valid {
+		q.RequeueAfterPtr = &q.RequeueAfter.Int64
+	}
+	if q.TargetCounterID.Valid {
+		q.TargetCounterIDPtr = &q.TargetCounterID.Int64
+	}
+}
+
+// TicketStatus is a ticket as shown to the visitor holding it: its place in
+// line while waiting, or the counter it was called to.
+type TicketStatus struct {
+	*Queue
+	TypeName string `json:"type_name,omitempty"`
+	// Position is 1 for the next ticket to be called, 0 once the ticket
+	// is no longer waiting
+	Position             int    `json:"position"`
+	EstimatedWaitMinutes int    `json:"estimated_wait_minutes"`
+	CounterNumber        string `json:"counter_number,omitempty"`
+	CounterName          string `json:"counter_name,omitempty"`
+	// StatusURL is the page the visitor can follow the ticket on; it is
+	// only set in the response to the visitor who took the ticket
+	StatusURL string `json:"status_url,omitempty"`
 }
 
 type Counter struct {
@@ -50,6 +105,46 @@ type Counter struct {
 	CurrentQueue   *Queue        `json:"current_queue,omitempty"`
 	LastCallAt     sql.NullTime  `json:"-"`
 	LastCallAtPtr  *time.Time    `json:"last_call_at,omitempty"`
+	RoutingMode    RoutingMode   `json:"routing_mode"`
+	Services       []CounterService `json:"services,omitempty"`
+}
+
+// Serves reports whether the counter may call tickets of queueType. A
+// counter without assigned queue types serves every type.
+func (c *Counter) Serves(queueType string) bool {
+	if len(c.Services) == 0 {
+		return true
+	}
+	for _, s := range c.Services {
+		if s.QueueType == queueType {
+			return true
+		}
+	}
+	return false
+}
+
+// RoutingMode decides how a counter with assigned queue types picks the
+// next ticket when the operator calls without choosing a type.
+type RoutingMode string
+
+const (
+	// RoutingStrict serves the assigned types in order: a type is only
+	// called when every type before it has no waiting tickets.
+	RoutingStrict RoutingMode = "strict"
+	// RoutingWeighted shares calls between the assigned types that have
+	// waiting tickets in proportion to their weights.
+	RoutingWeighted RoutingMode = "weighted"
+)
+
+func (m RoutingMode) IsValid() bool {
+	return m == RoutingStrict || m == RoutingWeighted
+}
+
+// CounterService assigns a queue type to a counter. Weight only matters in
+// RoutingWeighted mode.
+type CounterService struct {
+	QueueType string `json:"queue_type"`
+	Weight    int    `json:"weight"`
 }
 
 func (c *Counter) PrepareJSON() {
@@ -67,13 +162,121 @@ type Setting struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// PrinterStatus is the hardware state of a printer as last reported. Error
+// is set instead when the printer could not be queried.
+type PrinterStatus struct {
+	AgentID      string    `json:"agent_id,omitempty"`
+	Printer      string    `json:"printer"`
+	Online       bool      `json:"online"`
+	PaperNearEnd bool      `json:"paper_near_end"`
+	PaperOut     bool      `json:"paper_out"`
+	CoverOpen    bool      `json:"cover_open"`
+	Error        string    `json:"error,omitempty"`
+	ReportedAt   time.Time `json:"reported_at"`
+}
+
+// PrintAgentState tells how recently a print agent sent a heartbeat
+type PrintAgentState string
+
+const (
+	PrintAgentOnline  PrintAgentState = "online"
+	PrintAgentStale   PrintAgentState = "stale"   // heartbeats are late
+	PrintAgentOffline PrintAgentState = "offline" // presumed gone
+)
+
+// PrintAgent is a print agent in the server's registry. It is created by
+// the agent's first heartbeat or job and kept up to date by later ones.
+type PrintAgent struct {
+	ID                 string          `json:"id"`
+	Group              string          `json:"group,omitempty"`
+	Hostname           string          `json:"hostname"`
+	Version            string          `json:"version"`
+	Printer            string          `json:"printer"`
+	Backend            string          `json:"backend"`
+	JobsPrinted        int             `json:"jobs_printed"`
+	JobsFailed         int             `json:"jobs_failed"`
+	LastError          string          `json:"last_error,omitempty"`
+	FirstSeenAt        time.Time       `json:"first_seen_at"`
+	LastHeartbeatAt    sql.NullTime    `json:"-"`
+	LastHeartbeatAtPtr *time.Time      `json:"last_heartbeat_at,omitempty"`
+	State              PrintAgentState `json:"state"`
+	Connected          bool            `json:"connected"`
+}
+
+func (a *PrintAgent) PrepareJSON() {
+	if a.LastHeartbeatAt.Valid {
+		a.LastHeartbeatAtPtr = &a.LastHeartbeatAt.Time
+	}
+}
+
+// PrintAgentConfig holds the settings an admin manages for a print agent
+// on the server. The agent pulls them when it connects and again on a
+// config_updated event; empty fields keep the value of its config.yaml.
+type PrintAgentConfig struct {
+	PrinterName string `json:"printer_name,omitempty"`
+	Backend     string `json:"backend,omitempty"`
+	Address     string `json:"address,omitempty"`
+	PaperWidth  int    `json:"paper_width,omitempty"`
+	Columns     int    `json:"columns,omitempty"`
+	Codepage    string `json:"codepage,omitempty"`
+	// Template holds ticket design fields this agent prints differently
+	// from the server's design, e.g. {"Header": "GEDUNG A"}
+	Template json.RawMessage `json:"template,omitempty"`
+	LogLevel string          `json:"log_level,omitempty"`
+	// UpdatedAt is nil while the agent has no settings on the server
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// NumberBlock is a range of one day's ticket numbers of a queue type
+// leased to a print agent. The agent hands them out as provisional tickets
+// while it cannot reach the server; numbers taken online skip the range.
+type NumberBlock struct {
+	ID          int64     `json:"id"`
+	AgentID     string    `json:"agent_id"`
+	QueueType   string    `json:"queue_type"`
+	TypeName    string    `json:"type_name"`
+	Prefix      string    `json:"prefix"`
+	Day         string    `json:"day"` // YYYY-MM-DD
+	FirstNumber int       `json:"first_number"`
+	LastNumber  int       `json:"last_number"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// FormatQueueNumber returns the number of the nth ticket of a prefix, e.g.
+// A001
+func FormatQueueNumber(prefix string, n int) string {
+	return fmt.Sprintf("%s%03d", prefix, n)
+}
+
+// OfflineTicket is a ticket a print agent issued from a number block while
+// offline, sent to the server once it is reachable again
+type OfflineTicket struct {
+	QueueNumber string        `json:"queue_number"`
+	QueueType   string        `json:"queue_type"`
+	Priority    QueuePriority `json:"priority"`
+	IssuedAt    time.Time     `json:"issued_at"`
+	BlockID     int64         `json:"block_id"`
+}
+
+// TicketLogo is the logo printed on tickets, a 1-bit raster as produced by
+// printer.NewRaster
+type TicketLogo struct {
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	Data      []byte    `json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 type CallAction string
 
 const (
-	ActionCalled    CallAction = "called"
-	ActionRecalled  CallAction = "recalled"
-	ActionCompleted CallAction = "completed"
-	ActionCancelled CallAction = "cancelled"
+	ActionCalled      CallAction = "called"
+	ActionRecalled    CallAction = "recalled"
+	ActionCompleted   CallAction = "completed"
+	ActionCancelled   CallAction = "cancelled"
+	ActionSkipped     CallAction = "skipped"
+	ActionReturned    CallAction = "returned"
+	ActionTransferred CallAction = "transferred"
 )
 
 type CallHistory struct {
@@ -90,6 +293,7 @@ type Stats struct {
 	CalledQueues    int `json:"called_queues"`
 	CompletedQueues int `json:"completed_queues"`
 	CancelledQueues int `json:"cancelled_queues"`
+	NoShowQueues    int `json:"no_show_queues"`
 	ActiveCounters  int `json:"active_counters"`
 }
 
@@ -102,6 +306,7 @@ type QueueCalledData struct {
 	QueueNumber   string    `json:"queue_number"`
 	CounterNumber string    `json:"counter_number"`
 	CounterName   string    `json:"counter_name"`
+	Priority      QueuePriority `json:"priority,omitempty"`
 	Timestamp     time.Time `json:"timestamp"`
 }
 
@@ -111,14 +316,34 @@ type CounterUpdateData struct {
 	Timestamp    time.Time `json:"timestamp"`
 }
 
+// QueueTransferData is sent to the target counter when a ticket is
+// transferred to it.
+type QueueTransferData struct {
+	QueueID         int64     `json:"queue_id"`
+	QueueNumber     string    `json:"queue_number"`
+	QueueType       string    `json:"queue_type"`
+	FromCounterID   int64     `json:"from_counter_id"`
+	FromCounterName string    `json:"from_counter_name"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
 type QueueType struct {
-	ID        int64     `json:"id"`
-	Code      string    `json:"code"`
-	Name      string    `json:"name"`
-	Prefix    string    `json:"prefix"`
-	IsActive  bool      `json:"is_active"`
-	SortOrder int       `json:"sort_order"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int64         `json:"id"`
+	Code      string        `json:"code"`
+	Name      string        `json:"name"`
+	Prefix    string        `json:"prefix"`
+	IsActive  bool          `json:"is_active"`
+	SortOrder int           `json:"sort_order"`
+	Steps     []JourneyStep `json:"steps,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// JourneyStep is one step of a multi-step service journey. A ticket taken
+// for a queue type with steps is served under each step's QueueType in turn.
+type JourneyStep struct {
+	StepNo    int    `json:"step_no"`
+	Name      string `json:"name"`
+	QueueType string `json:"queue_type"`
 }
 
 type PaginatedQueues struct {
@@ -133,11 +358,17 @@ type PaginatedQueues struct {
 
 type PrintJobStatus string
 
+// A job waits as pending, is printing while an agent holds its lease, and
+// ends completed. A failed attempt leaves it failed until its retry is
+// due; after the last attempt it is dead until an admin reissues or
+// dismisses it.
 const (
 	PrintJobPending   PrintJobStatus = "pending"
 	PrintJobPrinting  PrintJobStatus = "printing"
 	PrintJobCompleted PrintJobStatus = "completed"
 	PrintJobFailed    PrintJobStatus = "failed"
+	PrintJobDead      PrintJobStatus = "dead"
+	PrintJobDismissed PrintJobStatus = "dismissed"
 )
 
 type PrintJob struct {
@@ -146,11 +377,24 @@ type PrintJob struct {
 	TypeName     string         `json:"type_name"`
 	DateTime     string         `json:"date_time"`
 	TemplateJSON string         `json:"template_json"`
+	Priority     QueuePriority  `json:"priority,omitempty"`
+	Position     int            `json:"position,omitempty"`
+	EstimatedWait int           `json:"estimated_wait_minutes,omitempty"`
+	StatusURL    string         `json:"status_url,omitempty"`
+	Counter      string         `json:"counter,omitempty"`
+	// Target is the print agent ID or printer group that prints the job;
+	// empty means any agent
+	Target       string         `json:"target,omitempty"`
 	Status       PrintJobStatus `json:"status"`
 	AgentID      string         `json:"agent_id,omitempty"`
+	Attempts     int            `json:"attempts"`
 	CreatedAt    time.Time      `json:"created_at"`
 	ClaimedAt    sql.NullTime   `json:"-"`
 	ClaimedAtPtr *time.Time     `json:"claimed_at,omitempty"`
+	LeaseExpiresAt    sql.NullTime `json:"-"`
+	LeaseExpiresAtPtr *time.Time   `json:"lease_expires_at,omitempty"`
+	NextAttemptAt    sql.NullTime  `json:"-"`
+	NextAttemptAtPtr *time.Time    `json:"next_attempt_at,omitempty"`
 	CompletedAt  sql.NullTime   `json:"-"`
 	CompletedAtPtr *time.Time   `json:"completed_at,omitempty"`
 	ErrorMessage string         `json:"error_message,omitempty"`
@@ -160,7 +404,167 @@ func (pj *PrintJob) PrepareJSON() {
 	if pj.ClaimedAt.Valid {
 		pj.ClaimedAtPtr = &pj.ClaimedAt.Time
 	}
+	if pj.LeaseExpiresAt.Valid {
+		pj.LeaseExpiresAtPtr = &pj.LeaseExpiresAt.Time
+	}
+	if pj.NextAttemptAt.Valid {
+		pj.NextAttemptAtPtr = &pj.NextAttemptAt.Time
+	}
 	if pj.CompletedAt.Valid {
 		pj.CompletedAtPtr = &pj.CompletedAt.Time
 	}
 }
+
+// User accounts and roles
+
+type UserRole string
+
+const (
+	RoleAdmin      UserRole = "admin"
+	RoleSupervisor UserRole = "supervisor"
+	RoleOperator   UserRole = "operator"
+	RoleKiosk      UserRole = "kiosk"
+)
+
+// IsValid reports whether r is one of the known roles.
+func (r UserRole) IsValid() bool {
+	switch r {
+	case RoleAdmin, RoleSupervisor, RoleOperator, RoleKiosk:
+		return true
+	}
+	return false
+}
+
+type User struct {
+	ID           int64     `json:"id"`
+	Username     string    `json:"username"`
+	FullName     string    `json:"full_name"`
+	Role         UserRole  `json:"role"`
+	PasswordHash string    `json:"-"`
+	IsActive     bool      `json:"is_active"`
+	CounterIDs   []int64   `json:"counter_ids"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Session is a signed-in browser session. UserID is 0 for the built-in admin
+// account backed by security.admin_password.
+type Session struct {
+	ID         int64     `json:"id"`
+	TokenHash  string    `json:"-"`
+	UserID     int64     `json:"user_id"`
+	Username   string    `json:"username"`
+	Role       UserRole  `json:"role"`
+	CounterID  int64     `json:"counter_id,omitempty"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current,omitempty"`
+}
+
+// API tokens for machine clients
+
+type TokenScope string
+
+const (
+	ScopePrintAgent   TokenScope = "print-agent"
+	ScopeKiosk        TokenScope = "kiosk"
+	ScopeReporting    TokenScope = "reporting"
+	ScopeWebhookAdmin TokenScope = "webhook-admin"
+)
+
+// IsValid reports whether s is one of the known scopes.
+func (s TokenScope) IsValid() bool {
+	switch s {
+	case ScopePrintAgent, ScopeKiosk, ScopeReporting, ScopeWebhookAdmin:
+		return true
+	}
+	return false
+}
+
+// APIToken is an admin-issued bearer token. Only the SHA-256 hash of the
+// token is stored; Prefix keeps its first characters so admins can tell
+// tokens apart. AgentID, when set, pins a print-agent token to one agent;
+// Group is the printer group the agent using it prints for.
+type APIToken struct {
+	ID            int64        `json:"id"`
+	Name          string       `json:"name"`
+	TokenHash     string       `json:"-"`
+	Prefix        string       `json:"prefix"`
+	Scopes        []TokenScope `json:"scopes"`
+	AgentID       string       `json:"agent_id,omitempty"`
+	Group         string       `json:"group,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ExpiresAt     sql.NullTime `json:"-"`
+	ExpiresAtPtr  *time.Time   `json:"expires_at,omitempty"`
+	LastUsedAt    sql.NullTime `json:"-"`
+	LastUsedAtPtr *time.Time   `json:"last_used_at,omitempty"`
+	RevokedAt     sql.NullTime `json:"-"`
+	RevokedAtPtr  *time.Time   `json:"revoked_at,omitempty"`
+}
+
+func (t *APIToken) PrepareJSON() {
+	if t.ExpiresAt.Valid {
+		t.ExpiresAtPtr = &t.ExpiresAt.Time
+	}
+	if t.LastUsedAt.Valid {
+		t.LastUsedAtPtr = &t.LastUsedAt.Time
+	}
+	if t.RevokedAt.Valid {
+		t.RevokedAtPtr = &t.RevokedAt.Time
+	}
+}
+
+// HasScope reports whether the token grants scope s.
+func (t *APIToken) HasScope(s TokenScope) bool {
+	for _, scope := range t.Scopes {
+		if scope == s {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUsable reports whether the token is neither revoked nor expired.
+func (t *APIToken) IsUsable() bool {
+	if t.RevokedAt.Valid {
+		return false
+	}
+	return !t.ExpiresAt.Valid || time.Now().Before(t.ExpiresAt.Time)
+}
+
+// Audit log
+
+// AuditEntry is one row of the append-only audit log. Before and After hold
+// JSON snapshots of the target and are empty when not applicable.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	Timestamp  time.Time       `json:"timestamp"`
+	ActorID    int64           `json:"actor_id,omitempty"`
+	Actor      string          `json:"actor"`
+	ActorRole  string          `json:"actor_role,omitempty"`
+	IP         string          `json:"ip"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+}
+
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       string
+	To         string
+}
+
+type PaginatedAudit struct {
+	Entries    []*AuditEntry `json:"entries"`
+	Total      int           `json:"total"`
+	Page       int           `json:"page"`
+	PerPage    int           `json:"per_page"`
+	TotalPages int           `json:"total_pages"`
+}
@@ -0,0 +1,76 @@
+package printer
+
+import "bytes"
+
+// QR codes and barcodes. Both are printed natively by the printer (GS ( k
+// and GS k), so they stay sharp at any module size.
+
+// QRErrorLevel is the error correction level of a QR code
+type QRErrorLevel byte
+
+const (
+	QRErrorL QRErrorLevel = 48 // ~7% recovery
+	QRErrorM QRErrorLevel = 49 // ~15% recovery
+	QRErrorQ QRErrorLevel = 50 // ~25% recovery
+	QRErrorH QRErrorLevel = 51 // ~30% recovery
+)
+
+// Default QR module size in dots
+const DefaultQRSize = 6
+
+// QRCode returns the commands printing data as a QR code (model 2) with
+// modules of size dots (1-16), followed by a line feed. Printers accept up
+// to about 7000 bytes of data; callers are expected to keep it short.
+func QRCode(data string, size int, level QRErrorLevel) []byte {
+	if size < 1 || size > 16 {
+		size = DefaultQRSize
+	}
+
+	var buf bytes.Buffer
+	n := len(data) + 3
+	buf.Write([]byte{GS, '(', 'k', 4, 0, 49, 65, 50, 0})               // Model 2
+	buf.Write([]byte{GS, '(', 'k', 3, 0, 49, 67, byte(size)})          // Module size
+	buf.Write([]byte{GS, '(', 'k', 3, 0, 49, 69, byte(level)})         // Error correction
+	buf.Write([]byte{GS, '(', 'k', byte(n), byte(n >> 8), 49, 80, 48}) // Store data
+	buf.WriteString(data)
+	buf.Write([]byte{GS, '(', 'k', 3, 0, 49, 81, 48}) // Print
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+// Barcode128 returns the commands printing data as a CODE128 barcode
+// (code set B) of the given height in dots, with the text printed below
+// it. Characters outside code set B are dropped, and data is truncated to
+// the 253 bytes the command can carry.
+func Barcode128(data string, height int) []byte {
+	if height < 1 || height > 255 {
+		height = 80
+	}
+
+	// '{' starts a code set switch, so it is sent twice; an escape pair
+	// is never split by the truncation
+	var code []byte
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c < 0x20 || c > 0x7F {
+			continue
+		}
+		n := 1
+		if c == '{' {
+			n = 2
+		}
+		if len(code)+n > 253 {
+			break
+		}
+		code = append(code, bytes.Repeat([]byte{c}, n)...)
+	}
+
+	var buf bytes.Buffer
+	buf.Write([]byte{GS, 'H', 2})            // Text below the barcode
+	buf.Write([]byte{GS, 'h', byte(height)}) // Height
+	buf.Write([]byte{GS, 'w', 2})            // Module width
+	buf.Write([]byte{GS, 'k', 73, byte(len(code) + 2), '{', 'B'})
+	buf.Write(code)
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
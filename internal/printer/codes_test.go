@@ -0,0 +1,93 @@
+package printer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestQRCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		size  int
+		level QRErrorLevel
+		want  []byte
+	}{
+		{
+			name: "short data", data: "abc", size: 4, level: QRErrorM,
+			want: []byte{
+				0x1D, '(', 'k', 4, 0, 49, 65, 50, 0,
+				0x1D, '(', 'k', 3, 0, 49, 67, 4,
+				0x1D, '(', 'k', 3, 0, 49, 69, 49,
+				0x1D, '(', 'k', 6, 0, 49, 80, 48, 'a', 'b', 'c',
+				0x1D, '(', 'k', 3, 0, 49, 81, 48,
+				'\n',
+			},
+		},
+		{
+			name: "size out of range uses the default", data: "", size: 17, level: QRErrorH,
+			want: []byte{
+				0x1D, '(', 'k', 4, 0, 49, 65, 50, 0,
+				0x1D, '(', 'k', 3, 0, 49, 67, DefaultQRSize,
+				0x1D, '(', 'k', 3, 0, 49, 69, 51,
+				0x1D, '(', 'k', 3, 0, 49, 80, 48,
+				0x1D, '(', 'k', 3, 0, 49, 81, 48,
+				'\n',
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QRCode(tt.data, tt.size, tt.level); !bytes.Equal(got, tt.want) {
+				t.Errorf("QRCode() =\n% x\nwant\n% x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQRCodeLongData(t *testing.T) {
+	// The store command carries its length as two bytes, low byte first
+	data := strings.Repeat("x", 300)
+	got := QRCode(data, 6, QRErrorL)
+	store := []byte{0x1D, '(', 'k', 0x2F, 0x01, 49, 80, 48}
+	i := bytes.Index(got, store)
+	if i < 0 {
+		t.Fatalf("store command % x not found in % x", store, got)
+	}
+	if payload := got[i+len(store) : i+len(store)+len(data)]; string(payload) != data {
+		t.Errorf("stored %q, want %d bytes of data", payload, len(data))
+	}
+}
+
+func TestBarcode128(t *testing.T) {
+	header := func(height byte, n int) []byte {
+		return []byte{0x1D, 'H', 2, 0x1D, 'h', height, 0x1D, 'w', 2, 0x1D, 'k', 73, byte(n + 2), '{', 'B'}
+	}
+	build := func(height byte, code string) []byte {
+		return append(append(header(height, len(code)), code...), '\n')
+	}
+
+	tests := []struct {
+		name   string
+		data   string
+		height int
+		want   []byte
+	}{
+		{"plain", "A001", 60, build(60, "A001")},
+		{"height out of range uses the default", "A001", 0, build(80, "A001")},
+		{"brace is escaped", "A{1", 80, build(80, "A{{1")},
+		{"control and non-ASCII bytes are dropped", "A\n0\x0101é", 80, build(80, "A001")},
+		{"truncated to 253 bytes", strings.Repeat("9", 300), 80, build(80, strings.Repeat("9", 253))},
+		{"escape pair is not split", strings.Repeat("9", 252) + "{", 80, build(80, strings.Repeat("9", 252))},
+		{"escape pair fits", strings.Repeat("9", 251) + "{", 80, build(80, strings.Repeat("9", 251)+"{{")},
+		{"limit counts filtered data", strings.Repeat("\t9", 253) + "9", 80, build(80, strings.Repeat("9", 253))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Barcode128(tt.data, tt.height); !bytes.Equal(got, tt.want) {
+				t.Errorf("Barcode128() =\n% x\nwant\n% x", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // register JPEG for DecodeImage
+	"image/png"
+)
+
+// Raster images (GS v 0). Images are converted once, when uploaded, into a
+// dithered 1-bit Raster; the Raster is what templates carry to print agents.
+
+// DefaultPaperDots is the printable width of 80 mm paper at 203 dpi
+const DefaultPaperDots = 576
+
+// rasterBand is the number of rows sent per GS v 0 command; some printers
+// drop images taller than their receive buffer.
+const rasterBand = 128
+
+// Raster is a monochrome bit image. Each row is Width/8 bytes, most
+// significant bit first; a set bit prints a black dot.
+type Raster struct {
+	Width  int    // in dots, a multiple of 8
+	Height int    // in dots
+	Data   []byte // Width/8 * Height bytes
+}
+
+// maxImageDots bounds the size of images DecodeImage accepts, so a small
+// compressed upload cannot expand into a huge bitmap
+const maxImageDots = 4096
+
+// DecodeImage decodes a PNG or JPEG image
+func DecodeImage(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %w", err)
+	}
+	if cfg.Width > maxImageDots || cfg.Height > maxImageDots {
+		return nil, fmt.Errorf("image is larger than %dx%d", maxImageDots, maxImageDots)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %w", err)
+	}
+	return img, nil
+}
+
+// NewRaster scales img to width dots (rounded up to a multiple of 8),
+// keeping its aspect ratio, and dithers it to black and white with
+// Floyd-Steinberg error diffusion. Transparent areas print as paper.
+func NewRaster(img image.Image, width int) (*Raster, error) {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return nil, fmt.Errorf("image is empty")
+	}
+	if width <= 0 {
+		return nil, fmt.Errorf("invalid width %d", width)
+	}
+	width = (width + 7) / 8 * 8
+	height := (b.Dy()*width + b.Dx()/2) / b.Dx()
+	if height == 0 {
+		height = 1
+	}
+
+	gray := scaleGray(img, width, height)
+
+	r := &Raster{Width: width, Height: height, Data: make([]byte, width/8*height)}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			old := gray[y*width+x]
+			v := float64(255)
+			if old < 128 {
+				v = 0
+				r.Data[y*width/8+x/8] |= 0x80 >> uint(x%8)
+			}
+			e := old - v
+			if x+1 < width {
+				gray[y*width+x+1] += e * 7 / 16
+			}
+			if y+1 < height {
+				if x > 0 {
+					gray[(y+1)*width+x-1] += e * 3 / 16
+				}
+				gray[(y+1)*width+x] += e * 5 / 16
+				if x+1 < width {
+					gray[(y+1)*width+x+1] += e * 1 / 16
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+// scaleGray returns the luminance of img resized to width x height, as
+// 0 (black) to 255 (white). Each target dot averages the source pixels it
+// covers, so downscaled logos keep thin lines as grey instead of dropping
+// them.
+func scaleGray(img image.Image, width, height int) []float64 {
+	b := img.Bounds()
+	gray := make([]float64, width*height)
+	for ty := 0; ty < height; ty++ {
+		y0 := b.Min.Y + ty*b.Dy()/height
+		y1 := b.Min.Y + (ty+1)*b.Dy()/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for tx := 0; tx < width; tx++ {
+			x0 := b.Min.X + tx*b.Dx()/width
+			x1 := b.Min.X + (tx+1)*b.Dx()/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var sum float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					sum += luminance(img.At(x, y))
+				}
+			}
+			gray[ty*width+tx] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+	return gray
+}
+
+// luminance returns the brightness of c composited over white paper
+func luminance(c color.Color) float64 {
+	r, g, b, a := c.RGBA()
+	white := float64(0xffff - a)
+	y := 0.299*(float64(r)+white) + 0.587*(float64(g)+white) + 0.114*(float64(b)+white)
+	return y / 0xffff * 255
+}
+
+// Bytes returns the commands printing the raster at the current
+// justification, in bands of rasterBand rows.
+func (r *Raster) Bytes() []byte {
+	var buf bytes.Buffer
+	rowBytes := r.Width / 8
+	for y := 0; y < r.Height; y += rasterBand {
+		rows := r.Height - y
+		if rows > rasterBand {
+			rows = rasterBand
+		}
+		buf.Write([]byte{GS, 'v', '0', 0,
+			byte(rowBytes), byte(rowBytes >> 8),
+			byte(rows), byte(rows >> 8)})
+		buf.Write(r.Data[y*rowBytes : (y+rows)*rowBytes])
+	}
+	return buf.Bytes()
+}
+
+// PNG encodes the raster as a black and white PNG, for previews
+func (r *Raster) PNG() ([]byte, error) {
+	img := image.NewGray(image.Rect(0, 0, r.Width, r.Height))
+	for y := 0; y < r.Height; y++ {
+		for x := 0; x < r.Width; x++ {
+			c := color.Gray{Y: 255}
+			if r.Data[y*r.Width/8+x/8]&(0x80>>uint(x%8)) != 0 {
+				c.Y = 0
+			}
+			img.SetGray(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Valid reports whether the raster's data matches its size
+func (r *Raster) Valid() bool {
+	return r.Width > 0 && r.Width%8 == 0 && r.Height > 0 && len(r.Data) == r.Width/8*r.Height
+}
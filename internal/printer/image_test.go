@@ -0,0 +1,135 @@
+package printer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// solid returns a w x h image filled with c.
+func solid(w, h int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestNewRaster(t *testing.T) {
+	tests := []struct {
+		name       string
+		img        image.Image
+		width      int
+		wantWidth  int
+		wantHeight int
+		wantBlack  int // dots printed
+	}{
+		{"black square", solid(10, 10, color.Black), 16, 16, 16, 16 * 16},
+		{"white square", solid(10, 10, color.White), 16, 16, 16, 0},
+		{"transparent prints as paper", solid(10, 10, color.Transparent), 16, 16, 16, 0},
+		{"width rounded up to a byte", solid(20, 10, color.Black), 13, 16, 8, 16 * 8},
+		{"aspect ratio kept", solid(100, 25, color.Black), 64, 64, 16, 64 * 16},
+		{"grey is dithered", solid(16, 16, color.Gray{Y: 128}), 16, 16, 16, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRaster(tt.img, tt.width)
+			if err != nil {
+				t.Fatalf("NewRaster: %v", err)
+			}
+			if r.Width != tt.wantWidth || r.Height != tt.wantHeight || !r.Valid() {
+				t.Fatalf("raster %dx%d (valid %v), want %dx%d", r.Width, r.Height, r.Valid(), tt.wantWidth, tt.wantHeight)
+			}
+			black := 0
+			for _, b := range r.Data {
+				for ; b != 0; b &= b - 1 {
+					black++
+				}
+			}
+			if tt.wantBlack >= 0 && black != tt.wantBlack {
+				t.Errorf("%d black dots, want %d", black, tt.wantBlack)
+			}
+			if tt.wantBlack < 0 && (black == 0 || black == r.Width*r.Height) {
+				t.Errorf("%d of %d dots black, want a mix", black, r.Width*r.Height)
+			}
+		})
+	}
+}
+
+func TestNewRasterErrors(t *testing.T) {
+	if _, err := NewRaster(solid(0, 0, color.Black), 16); err == nil {
+		t.Error("NewRaster accepted an empty image")
+	}
+	if _, err := NewRaster(solid(4, 4, color.Black), 0); err == nil {
+		t.Error("NewRaster accepted a zero width")
+	}
+}
+
+func TestRasterBytes(t *testing.T) {
+	r := &Raster{Width: 16, Height: rasterBand + 2, Data: make([]byte, 2*(rasterBand+2))}
+	got := r.Bytes()
+
+	first := []byte{GS, 'v', '0', 0, 2, 0, rasterBand, 0}
+	if !bytes.HasPrefix(got, first) {
+		t.Fatalf("first band header % x, want % x", got[:8], first)
+	}
+	second := []byte{GS, 'v', '0', 0, 2, 0, 2, 0}
+	offset := len(first) + 2*rasterBand
+	if !bytes.Equal(got[offset:offset+8], second) {
+		t.Errorf("second band header % x, want % x", got[offset:offset+8], second)
+	}
+	if want := 2*8 + len(r.Data); len(got) != want {
+		t.Errorf("%d bytes, want %d", len(got), want)
+	}
+}
+
+func TestDecodeImage(t *testing.T) {
+	encode := func(w, h int) []byte {
+		var buf bytes.Buffer
+		png.Encode(&buf, solid(w, h, color.Black))
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"png", encode(8, 8), false},
+		{"too large", encode(maxImageDots+1, 1), true},
+		{"not an image", []byte("bukan gambar"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeImage(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DecodeImage error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRasterPNGRoundTrip(t *testing.T) {
+	r, err := NewRaster(solid(8, 8, color.Black), 8)
+	if err != nil {
+		t.Fatalf("NewRaster: %v", err)
+	}
+	data, err := r.PNG()
+	if err != nil {
+		t.Fatalf("PNG: %v", err)
+	}
+	img, err := DecodeImage(data)
+	if err != nil {
+		t.Fatalf("DecodeImage: %v", err)
+	}
+	back, err := NewRaster(img, 8)
+	if err != nil {
+		t.Fatalf("NewRaster: %v", err)
+	}
+	if !bytes.Equal(back.Data, r.Data) {
+		t.Errorf("round trip changed the raster: % x, want % x", back.Data, r.Data)
+	}
+}
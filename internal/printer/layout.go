@@ -0,0 +1,332 @@
+package printer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Ticket layouts. A layout is an ordered list of blocks rendered top to
+// bottom; it is stored as one JSON document and carried to print agents in
+// the ticket template. Templates without a layout are converted with
+// TemplateLayout, which reproduces the fixed ticket design.
+
+// LayoutVersion is the layout document version this package reads
+const LayoutVersion = 1
+
+// Block types
+const (
+	BlockText      = "text"      // literal Text
+	BlockVariable  = "variable"  // value of Variable between Prefix and Suffix
+	BlockSeparator = "separator" // a line of Char across the paper
+	BlockQR        = "qr"        // Variable as a QR code, Text as caption
+	BlockBarcode   = "barcode"   // Variable as a CODE128 barcode
+	BlockImage     = "image"     // the ticket logo
+	BlockFeed      = "feed"      // Lines blank lines
+)
+
+// Ticket variables
+const (
+	VarQueueNumber   = "queue_number"
+	VarTypeName      = "type_name"
+	VarDateTime      = "date_time"
+	VarPosition      = "position"
+	VarEstimatedWait = "estimated_wait"
+	VarCounter       = "counter"
+	VarStatusURL     = "status_url"
+	VarPriority      = "priority" // "PRIORITAS" on priority tickets
+)
+
+// Block alignments and text sizes
+const (
+	AlignLeft   = "left"
+	AlignCenter = "center"
+	AlignRight  = "right"
+
+	SizeSmall  = "small"  // Font B
+	SizeNormal = "normal" // Font A
+	SizeLarge  = "large"  // Font A, double width and height
+)
+
+// Limits checked by Validate
+const (
+	maxLayoutBlocks = 100
+	maxBlockText    = 256
+	maxFeedLines    = 10
+)
+
+// Layout is a ticket layout document
+type Layout struct {
+	Version int     `json:"version"`
+	Blocks  []Block `json:"blocks"`
+}
+
+// Block is one element of a layout. Fields that do not apply to the block's
+// type are ignored; zero values use the defaults noted.
+type Block struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Variable string `json:"variable,omitempty"`
+	Prefix   string `json:"prefix,omitempty"`
+	Suffix   string `json:"suffix,omitempty"`
+	Align    string `json:"align,omitempty"` // default center
+	Size     string `json:"size,omitempty"`  // default normal
+	Bold     bool   `json:"bold,omitempty"`
+	Invert   bool   `json:"invert,omitempty"` // white on black
+	Char     string `json:"char,omitempty"`   // separator, default "-"
+	Module   int    `json:"module,omitempty"` // QR module size 1-16, default DefaultQRSize
+	Height   int    `json:"height,omitempty"` // barcode height in dots, default 80
+	Lines    int    `json:"lines,omitempty"`  // feed, default 1
+}
+
+var variables = map[string]bool{
+	VarQueueNumber: true, VarTypeName: true, VarDateTime: true, VarPosition: true,
+	VarEstimatedWait: true, VarCounter: true, VarStatusURL: true, VarPriority: true,
+}
+
+// Validate checks that the layout can be rendered
+func (l *Layout) Validate() error {
+	if l.Version != LayoutVersion {
+		return fmt.Errorf("unsupported layout version %d (expected %d)", l.Version, LayoutVersion)
+	}
+	if len(l.Blocks) > maxLayoutBlocks {
+		return fmt.Errorf("layout has more than %d blocks", maxLayoutBlocks)
+	}
+	for i, b := range l.Blocks {
+		if err := b.validate(); err != nil {
+			return fmt.Errorf("block %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (b *Block) validate() error {
+	switch b.Type {
+	case BlockText, BlockSeparator, BlockImage, BlockFeed:
+	case BlockVariable, BlockQR, BlockBarcode:
+		if !variables[b.Variable] {
+			return fmt.Errorf("unknown variable %q", b.Variable)
+		}
+	default:
+		return fmt.Errorf("unknown block type %q", b.Type)
+	}
+	switch b.Align {
+	case "", AlignLeft, AlignCenter, AlignRight:
+	default:
+		return fmt.Errorf("unknown alignment %q", b.Align)
+	}
+	switch b.Size {
+	case "", SizeSmall, SizeNormal, SizeLarge:
+	default:
+		return fmt.Errorf("unknown size %q", b.Size)
+	}
+	if len(b.Text)+len(b.Prefix)+len(b.Suffix) > maxBlockText {
+		return fmt.Errorf("text is longer than %d bytes", maxBlockText)
+	}
+	if len([]rune(b.Char)) > 1 {
+		return fmt.Errorf("separator must be a single character")
+	}
+	if b.Module < 0 || b.Module > 16 {
+		return fmt.Errorf("QR module size must be 1-16")
+	}
+	if b.Height < 0 || b.Height > 255 {
+		return fmt.Errorf("barcode height must be 1-255")
+	}
+	if b.Lines < 0 || b.Lines > maxFeedLines {
+		return fmt.Errorf("feed must be 1-%d lines", maxFeedLines)
+	}
+	return nil
+}
+
+// Value returns the text of a ticket variable, or "" when the ticket has
+// none (position and estimated wait of a ticket not waiting, priority of a
+// normal ticket)
+func (d TicketData) Value(variable string) string {
+	switch variable {
+	case VarQueueNumber:
+		return d.QueueNumber
+	case VarTypeName:
+		return d.TypeName
+	case VarDateTime:
+		return d.DateTime
+	case VarPosition:
+		if d.Position > 0 {
+			return strconv.Itoa(d.Position)
+		}
+	case VarEstimatedWait:
+		if d.Position > 0 {
+			return strconv.Itoa(d.EstimatedWait)
+		}
+	case VarCounter:
+		return d.Counter
+	case VarStatusURL:
+		return d.StatusURL
+	case VarPriority:
+		if d.Priority {
+			return "PRIORITAS"
+		}
+	}
+	return ""
+}
+
+// TemplateLayout converts the fixed fields of a template into the layout
+// that prints the same ticket
+func TemplateLayout(t TicketTemplate) *Layout {
+	l := &Layout{Version: LayoutVersion}
+	add := func(b Block) { l.Blocks = append(l.Blocks, b) }
+	text := func(s, fallback, size string, bold bool) {
+		if s == "" {
+			s = fallback
+		}
+		add(Block{Type: BlockText, Text: s, Size: size, Bold: bold})
+	}
+	codes := func(placement string) {
+		if t.QRPlacement == placement && t.QRContent != "" {
+			qr := Block{Type: BlockQR, Variable: t.QRContent, Module: t.QRSize}
+			if t.QRContent == CodeStatusURL {
+				qr.Text = "Pindai untuk cek posisi antrian"
+			}
+			add(Block{Type: BlockFeed})
+			add(qr)
+		}
+		if t.ShowBarcode && t.BarcodePlacement == placement {
+			add(Block{Type: BlockFeed})
+			add(Block{Type: BlockBarcode, Variable: VarQueueNumber})
+		}
+	}
+
+	if t.ShowLogo {
+		add(Block{Type: BlockImage})
+	}
+	text(t.Header, "SISTEM ANTRIAN", SizeNormal, true)
+	if t.ShowSubheader && t.Subheader != "" {
+		text(t.Subheader, "", SizeSmall, false)
+	}
+	codes(CodeTop)
+	add(Block{Type: BlockSeparator})
+	text(t.Title, "NOMOR ANTRIAN ANDA", SizeSmall, false)
+	add(Block{Type: BlockFeed})
+	add(Block{Type: BlockVariable, Variable: VarQueueNumber, Size: SizeLarge, Bold: true})
+	add(Block{Type: BlockVariable, Variable: VarPriority, Prefix: " ", Suffix: " ", Bold: true, Invert: true})
+	if t.ShowType {
+		add(Block{Type: BlockFeed})
+		add(Block{Type: BlockVariable, Variable: VarTypeName, Bold: true})
+	}
+	add(Block{Type: BlockVariable, Variable: VarPosition, Prefix: "Posisi antrian: ", Size: SizeSmall})
+	add(Block{Type: BlockVariable, Variable: VarEstimatedWait, Prefix: "Perkiraan tunggu: +/- ", Suffix: " menit", Size: SizeSmall})
+	add(Block{Type: BlockSeparator})
+	if t.ShowDatetime {
+		add(Block{Type: BlockVariable, Variable: VarDateTime, Size: SizeSmall})
+	}
+	codes(CodeMiddle)
+	if t.ShowFooter {
+		add(Block{Type: BlockSeparator})
+		text(t.Footer1, "Mohon menunggu hingga", SizeSmall, false)
+		text(t.Footer2, "nomor Anda dipanggil", SizeSmall, false)
+	}
+	if t.ShowThanks {
+		add(Block{Type: BlockFeed})
+		text(t.Thanks, "Terima kasih", SizeSmall, false)
+	}
+	codes(CodeBottom)
+	return l
+}
+
+// Alignment commands
+var alignments = map[string][]byte{
+	AlignLeft:   ALIGN_LEFT,
+	AlignCenter: ALIGN_CENTER,
+	AlignRight:  {ESC, 'a', 2},
+}
+
+// block writes one layout block. Blocks showing a variable the ticket does
+// not have are skipped.
+func (w *ticketWriter) block(b Block, data TicketData, logo *Raster, paperWidth int) {
+	buf := w.buf
+	align, ok := alignments[b.Align]
+	if !ok {
+		align = ALIGN_CENTER
+	}
+
+	switch b.Type {
+	case BlockText, BlockVariable:
+		s := b.Text
+		if b.Type == BlockVariable {
+			value := data.Value(b.Variable)
+			if value == "" {
+				return
+			}
+			s = b.Prefix + value + b.Suffix
+		}
+		on, off, size := textStyle(b)
+		buf.Write(align)
+		buf.Write(on)
+		w.line(s, size)
+		buf.Write(off)
+
+	case BlockSeparator:
+		char := b.Char
+		if char == "" {
+			char = "-"
+		}
+		buf.Write(align)
+		buf.Write(w.codepage.Encode(strings.Repeat(char, w.columns)))
+		buf.WriteString("\n")
+
+	case BlockQR:
+		value := data.Value(b.Variable)
+		if value == "" {
+			return
+		}
+		buf.Write(align)
+		buf.Write(QRCode(value, b.Module, QRErrorM))
+		if b.Text != "" {
+			buf.Write(FONT_B)
+			w.line(b.Text, sizeSmall)
+			buf.Write(FONT_A)
+		}
+
+	case BlockBarcode:
+		value := data.Value(b.Variable)
+		if value == "" {
+			return
+		}
+		buf.Write(align)
+		buf.Write(Barcode128(value, b.Height))
+
+	case BlockImage:
+		// A logo uploaded for wider paper would be cut off, so it is left
+		// out
+		if logo == nil || !logo.Valid() || logo.Width > paperWidth {
+			return
+		}
+		buf.Write(align)
+		buf.Write(logo.Bytes())
+
+	case BlockFeed:
+		lines := b.Lines
+		if lines < 1 {
+			lines = 1
+		}
+		buf.Write([]byte{ESC, 'd', byte(lines)})
+	}
+}
+
+// textStyle returns the commands turning a block's text style on and off,
+// and the size its lines wrap at
+func textStyle(b Block) (on, off []byte, size textSize) {
+	size = sizeNormal
+	switch b.Size {
+	case SizeSmall:
+		on, off, size = append(on, FONT_B...), append(off, FONT_A...), sizeSmall
+	case SizeLarge:
+		on, off, size = append(on, DOUBLE_ON...), append(off, DOUBLE_OFF...), sizeDouble
+	}
+	if b.Bold {
+		on, off = append(on, BOLD_ON...), append(off, BOLD_OFF...)
+	}
+	if b.Invert {
+		on, off = append(on, REVERSE_ON...), append(off, REVERSE_OFF...)
+	}
+	return on, off, size
+}
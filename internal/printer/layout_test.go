@@ -0,0 +1,241 @@
+package printer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLayoutValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		layout  Layout
+		wantErr string
+	}{
+		{"empty", Layout{Version: LayoutVersion}, ""},
+		{"all block types", Layout{Version: LayoutVersion, Blocks: []Block{
+			{Type: BlockText, Text: "Selamat datang", Align: AlignLeft, Size: SizeSmall},
+			{Type: BlockVariable, Variable: VarQueueNumber, Size: SizeLarge, Bold: true},
+			{Type: BlockSeparator, Char: "="},
+			{Type: BlockQR, Variable: VarStatusURL, Module: 8},
+			{Type: BlockBarcode, Variable: VarQueueNumber, Height: 60},
+			{Type: BlockImage},
+			{Type: BlockFeed, Lines: 3},
+		}}, ""},
+		{"wrong version", Layout{Version: 2}, "unsupported layout version 2"},
+		{"unknown type", Layout{Version: LayoutVersion, Blocks: []Block{{Type: "table"}}}, `block 1: unknown block type "table"`},
+		{"unknown variable", Layout{Version: LayoutVersion, Blocks: []Block{
+			{Type: BlockText},
+			{Type: BlockVariable, Variable: "nama"},
+		}}, `block 2: unknown variable "nama"`},
+		{"unknown alignment", Layout{Version: LayoutVersion, Blocks: []Block{{Type: BlockText, Align: "justify"}}}, "unknown alignment"},
+		{"unknown size", Layout{Version: LayoutVersion, Blocks: []Block{{Type: BlockText, Size: "huge"}}}, "unknown size"},
+		{"text too long", Layout{Version: LayoutVersion, Blocks: []Block{{Type: BlockText, Text: strings.Repeat("x", maxBlockText+1)}}}, "text is longer"},
+		{"separator of two characters", Layout{Version: LayoutVersion, Blocks: []Block{{Type: BlockSeparator, Char: "=-"}}}, "single character"},
+		{"QR module too large", Layout{Version: LayoutVersion, Blocks: []Block{{Type: BlockQR, Variable: VarStatusURL, Module: 17}}}, "QR module size"},
+		{"barcode too tall", Layout{Version: LayoutVersion, Blocks: []Block{{Type: BlockBarcode, Variable: VarQueueNumber, Height: 256}}}, "barcode height"},
+		{"feed too long", Layout{Version: LayoutVersion, Blocks: []Block{{Type: BlockFeed, Lines: maxFeedLines + 1}}}, "feed must be"},
+		{"too many blocks", Layout{Version: LayoutVersion, Blocks: make([]Block, maxLayoutBlocks+1)}, "more than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.layout.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTicketDataValue(t *testing.T) {
+	waiting := TicketData{
+		QueueNumber: "A001", TypeName: "Umum", DateTime: "17/10/2026 08:00",
+		Position: 3, EstimatedWait: 12, Counter: "1, 2", StatusURL: "http://antrian/t/abc", Priority: true,
+	}
+	served := TicketData{QueueNumber: "A002"}
+
+	tests := []struct {
+		data     TicketData
+		variable string
+		want     string
+	}{
+		{waiting, VarQueueNumber, "A001"},
+		{waiting, VarTypeName, "Umum"},
+		{waiting, VarDateTime, "17/10/2026 08:00"},
+		{waiting, VarPosition, "3"},
+		{waiting, VarEstimatedWait, "12"},
+		{waiting, VarCounter, "1, 2"},
+		{waiting, VarStatusURL, "http://antrian/t/abc"},
+		{waiting, VarPriority, "PRIORITAS"},
+		{waiting, "nama", ""},
+		{served, VarPosition, ""},
+		{served, VarEstimatedWait, ""},
+		{served, VarPriority, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.data.Value(tt.variable); got != tt.want {
+			t.Errorf("Value(%q) of %s = %q, want %q", tt.variable, tt.data.QueueNumber, got, tt.want)
+		}
+	}
+}
+
+func TestBlockRender(t *testing.T) {
+	data := TicketData{QueueNumber: "A001", Position: 2, EstimatedWait: 10, StatusURL: "http://antrian/t/abc"}
+	logo := &Raster{Width: 8, Height: 1, Data: []byte{0xFF}}
+
+	tests := []struct {
+		name  string
+		block Block
+		want  []byte
+	}{
+		{"text is centered by default", Block{Type: BlockText, Text: "Halo"},
+			join(ALIGN_CENTER, []byte("Halo\n"))},
+		{"small bold right aligned text", Block{Type: BlockText, Text: "Halo", Align: AlignRight, Size: SizeSmall, Bold: true},
+			join([]byte{ESC, 'a', 2}, FONT_B, BOLD_ON, []byte("Halo\n"), FONT_A, BOLD_OFF)},
+		{"large inverted variable", Block{Type: BlockVariable, Variable: VarQueueNumber, Size: SizeLarge, Invert: true},
+			join(ALIGN_CENTER, DOUBLE_ON, REVERSE_ON, []byte("A001\n"), DOUBLE_OFF, REVERSE_OFF)},
+		{"variable with prefix and suffix", Block{Type: BlockVariable, Variable: VarEstimatedWait, Prefix: "Tunggu ", Suffix: " menit", Align: AlignLeft},
+			join(ALIGN_LEFT, []byte("Tunggu 10 menit\n"))},
+		{"empty variable is skipped", Block{Type: BlockVariable, Variable: VarPriority, Prefix: " ", Suffix: " "}, nil},
+		{"long text wraps at large size", Block{Type: BlockText, Text: "Antrian Loket Satu", Size: SizeLarge},
+			join(ALIGN_CENTER, DOUBLE_ON, []byte("Antrian\nLoket\nSatu\n"), DOUBLE_OFF)},
+		{"separator fills the line", Block{Type: BlockSeparator, Char: "="},
+			join(ALIGN_CENTER, []byte(strings.Repeat("=", 16)+"\n"))},
+		{"separator defaults to dashes", Block{Type: BlockSeparator},
+			join(ALIGN_CENTER, []byte(strings.Repeat("-", 16)+"\n"))},
+		{"QR code with caption", Block{Type: BlockQR, Variable: VarStatusURL, Module: 5, Text: "Pindai"},
+			join(ALIGN_CENTER, QRCode(data.StatusURL, 5, QRErrorM), FONT_B, []byte("Pindai\n"), FONT_A)},
+		{"QR code of an empty variable is skipped", Block{Type: BlockQR, Variable: VarCounter}, nil},
+		{"barcode", Block{Type: BlockBarcode, Variable: VarQueueNumber, Align: AlignLeft},
+			join(ALIGN_LEFT, Barcode128("A001", 0))},
+		{"image", Block{Type: BlockImage}, join(ALIGN_CENTER, logo.Bytes())},
+		{"feed defaults to one line", Block{Type: BlockFeed}, FEED_LINE},
+		{"feed of several lines", Block{Type: BlockFeed, Lines: 4}, []byte{ESC, 'd', 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c, _ := LookupCodepage(DefaultCodepage)
+			w := &ticketWriter{buf: &buf, codepage: c, columns: 16}
+			w.block(tt.block, data, logo, Paper58mmDots)
+			if !bytes.Equal(buf.Bytes(), tt.want) {
+				t.Errorf("block() =\n% x\nwant\n% x", buf.Bytes(), tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockRenderSkipsUnusableLogo(t *testing.T) {
+	c, _ := LookupCodepage(DefaultCodepage)
+	tests := []struct {
+		name string
+		logo *Raster
+	}{
+		{"no logo", nil},
+		{"wider than the paper", &Raster{Width: Paper80mmDots, Height: 1, Data: make([]byte, Paper80mmDots/8)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := &ticketWriter{buf: &buf, codepage: c, columns: 32}
+			w.block(Block{Type: BlockImage}, TicketData{}, tt.logo, Paper58mmDots)
+			if buf.Len() != 0 {
+				t.Errorf("block() wrote % x, want nothing", buf.Bytes())
+			}
+		})
+	}
+}
+
+func TestRenderLayout(t *testing.T) {
+	p := New(PrinterConfig{})
+	data := TicketData{QueueNumber: "B007", TypeName: "Pembayaran", DateTime: "17/10/2026 09:30", Position: 1, EstimatedWait: 5}
+	template := DefaultTemplate()
+
+	// A template without a layout prints the layout of its fixed fields
+	want := p.Render(data, withLayout(template, TemplateLayout(template)))
+	if got := p.Render(data, template); !bytes.Equal(got, want) {
+		t.Errorf("Render() without a layout differs from TemplateLayout")
+	}
+	for _, s := range []string{"B007", "Pembayaran", "Posisi antrian: 1", "Perkiraan tunggu: +/- 5 menit"} {
+		if !bytes.Contains(want, []byte(s)) {
+			t.Errorf("default ticket is missing %q", s)
+		}
+	}
+
+	custom := &Layout{Version: LayoutVersion, Blocks: []Block{
+		{Type: BlockText, Text: "Klinik Sehat"},
+		{Type: BlockVariable, Variable: VarQueueNumber},
+	}}
+	got := p.Render(data, withLayout(template, custom))
+	wantCustom := join(INIT, []byte{ESC, 't', 0},
+		ALIGN_CENTER, []byte("Klinik Sehat\n"),
+		ALIGN_CENTER, []byte("B007\n"),
+		FEED_LINES, CUT)
+	if !bytes.Equal(got, wantCustom) {
+		t.Errorf("Render() =\n% x\nwant\n% x", got, wantCustom)
+	}
+	if bytes.Contains(got, []byte("Pembayaran")) {
+		t.Error("a custom layout printed the fixed design")
+	}
+}
+
+func TestTemplateLayout(t *testing.T) {
+	types := func(l *Layout) string {
+		var s []string
+		for _, b := range l.Blocks {
+			s = append(s, b.Type+":"+b.Variable)
+		}
+		return strings.Join(s, " ")
+	}
+
+	tests := []struct {
+		name     string
+		template TicketTemplate
+		has      []string
+		hasNot   []string
+	}{
+		{"minimal", TicketTemplate{},
+			[]string{"variable:queue_number", "variable:priority", "variable:position"},
+			[]string{"image:", "variable:type_name", "variable:date_time", "qr:", "barcode:"}},
+		{"logo, type and date", TicketTemplate{ShowLogo: true, ShowType: true, ShowDatetime: true},
+			[]string{"image:", "variable:type_name", "variable:date_time"}, nil},
+		{"QR and barcode", TicketTemplate{QRPlacement: CodeBottom, QRContent: CodeStatusURL, ShowBarcode: true, BarcodePlacement: CodeTop},
+			[]string{"qr:status_url", "barcode:queue_number"}, nil},
+		{"QR without content", TicketTemplate{QRPlacement: CodeBottom},
+			nil, []string{"qr:"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := TemplateLayout(tt.template)
+			if err := l.Validate(); err != nil {
+				t.Fatalf("TemplateLayout() is invalid: %v", err)
+			}
+			got := types(l)
+			for _, s := range tt.has {
+				if !strings.Contains(got, s) {
+					t.Errorf("layout %q is missing %s", got, s)
+				}
+			}
+			for _, s := range tt.hasNot {
+				if strings.Contains(got, s) {
+					t.Errorf("layout %q has %s", got, s)
+				}
+			}
+		})
+	}
+}
+
+func withLayout(t TicketTemplate, l *Layout) TicketTemplate {
+	t.Layout = l
+	return t
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
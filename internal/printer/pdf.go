@@ -0,0 +1,66 @@
+package printer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// WritePDF writes img as a one-page PDF the size of the printout, taking
+// one pixel as one dot at PrinterDPI
+func WritePDF(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+
+	// Grayscale samples, top row first
+	var pixels bytes.Buffer
+	zw := zlib.NewWriter(&pixels)
+	row := make([]byte, b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			row[x-b.Min.X] = color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+		}
+		zw.Write(row)
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	pt := func(dots int) float64 { return float64(dots) * 72 / PrinterDPI }
+	width, height := pt(b.Dx()), pt(b.Dy())
+	content := fmt.Sprintf("q %.2f 0 0 %.2f 0 0 cm /Im0 Do Q\n", width, height)
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(dict string, stream []byte) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\n", len(offsets), dict)
+		if stream != nil {
+			buf.WriteString("stream\n")
+			buf.Write(stream)
+			buf.WriteString("\nendstream\n")
+		}
+		buf.WriteString("endobj\n")
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	object("<< /Type /Pages /Kids [3 0 R] /Count 1 >>", nil)
+	object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+		"/Resources << /XObject << /Im0 4 0 R >> >> /Contents 5 0 R >>", width, height), nil)
+	object(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray "+
+		"/BitsPerComponent 8 /Filter /FlateDecode /Length %d >>", b.Dx(), b.Dy(), pixels.Len()), pixels.Bytes())
+	object(fmt.Sprintf("<< /Length %d >>", len(content)), []byte(content))
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,687 @@
+package printer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"rsc.io/qr"
+)
+
+// Print previews. RenderImage interprets the ESC/POS commands this package
+// emits and draws the printout dot for dot, so a ticket design can be
+// checked without printing it. Text is drawn in Go Mono at the size of the
+// printer fonts; other commands are rejected.
+
+// PrinterDPI is the resolution of the thermal printers tickets are
+// designed for
+const PrinterDPI = 203
+
+// Preview defaults, the values a printer starts with after ESC @
+const (
+	defaultLineSpacing   = 30  // dots, 1/6 inch
+	defaultBarcodeHeight = 162 // dots
+	defaultBarcodeModule = 3   // dots
+	defaultQRModule      = 3   // dots
+)
+
+// Preview renders a ticket as it would come out of this printer
+func (p *Printer) Preview(data TicketData, template TicketTemplate) (*image.Gray, error) {
+	width, _, _ := p.paper(template)
+	return RenderImage(p.Render(data, template), width)
+}
+
+// RenderImage draws the printout of ESC/POS data on paper paperWidth dots
+// wide. The image is black and white, one pixel per printer dot.
+func RenderImage(data []byte, paperWidth int) (*image.Gray, error) {
+	if paperWidth <= 0 {
+		paperWidth = Paper80mmDots
+	}
+	r := &previewer{data: data, width: paperWidth}
+	r.reset()
+	if err := r.run(); err != nil {
+		return nil, err
+	}
+	r.flush(false)
+
+	height := max(r.y, 1)
+	r.grow(height)
+	img := image.NewGray(image.Rect(0, 0, r.width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for i, black := range r.dots[:r.width*height] {
+		if black {
+			img.Pix[i] = 0
+		}
+	}
+	return img, nil
+}
+
+// previewChar is a character waiting in the line buffer
+type previewChar struct {
+	glyph          *glyph
+	scaleW, scaleH int
+	reverse        bool
+}
+
+func (c previewChar) width() int  { return c.glyph.w * c.scaleW }
+func (c previewChar) height() int { return c.glyph.h * c.scaleH }
+
+// previewer holds the printer state while commands are interpreted
+type previewer struct {
+	data  []byte
+	pos   int
+	width int
+	dots  []bool // width dots per row
+	y     int    // top of the next line
+
+	codepage       *Codepage
+	align          byte // 0 left, 1 center, 2 right
+	bold, reverse  bool
+	fontB          bool
+	scaleW, scaleH int
+	lineSpacing    int
+	line           []previewChar
+
+	barcodeHeight, barcodeModule int
+	hri                          byte // 0 none, 1 above, 2 below, 3 both
+	qrModule                     int
+	qrLevel                      qr.Level
+	qrData                       []byte
+}
+
+// reset restores the power-on state (ESC @)
+func (r *previewer) reset() {
+	r.codepage, _ = LookupCodepage(DefaultCodepage)
+	r.align = 0
+	r.bold, r.reverse, r.fontB = false, false, false
+	r.scaleW, r.scaleH = 1, 1
+	r.lineSpacing = defaultLineSpacing
+	r.barcodeHeight, r.barcodeModule, r.hri = defaultBarcodeHeight, defaultBarcodeModule, 0
+	r.qrModule, r.qrLevel, r.qrData = defaultQRModule, qr.L, nil
+}
+
+// next returns the next n bytes of the command being read
+func (r *previewer) next(n int) ([]byte, error) {
+	if r.pos+n > len(r.data) {
+		return nil, fmt.Errorf("truncated command at byte %d", r.pos)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *previewer) run() error {
+	for r.pos < len(r.data) {
+		start := r.pos
+		c := r.data[r.pos]
+		r.pos++
+
+		var err error
+		switch {
+		case c == '\n':
+			r.flush(true)
+		case c == '\r', c == '\t':
+		case c == ESC:
+			err = r.esc()
+		case c == GS:
+			err = r.gs()
+		case c == DLE:
+			// Real-time requests do not print
+			_, err = r.next(2)
+		case c >= 0x20:
+			r.char(c)
+		default:
+			err = fmt.Errorf("unsupported control character 0x%02x", c)
+		}
+		if err != nil {
+			return fmt.Errorf("byte %d: %w", start, err)
+		}
+	}
+	return nil
+}
+
+func (r *previewer) esc() error {
+	cmd, err := r.next(1)
+	if err != nil {
+		return err
+	}
+	switch cmd[0] {
+	case '@':
+		r.flush(false)
+		r.reset()
+		return nil
+	case '2':
+		r.lineSpacing = defaultLineSpacing
+		return nil
+	}
+
+	arg, err := r.next(1)
+	if err != nil {
+		return err
+	}
+	n := arg[0]
+	switch cmd[0] {
+	case 'a':
+		r.align = n % 48
+	case 'E', 'G':
+		r.bold = n&1 != 0
+	case 'M':
+		r.fontB = n%48 == 1
+	case '!':
+		r.fontB = n&0x01 != 0
+		r.bold = n&0x08 != 0
+		r.scaleH, r.scaleW = 1+int(n>>4&1), 1+int(n>>5&1)
+	case 't':
+		if cp := codepageByTable(n); cp != nil {
+			r.codepage = cp
+		}
+	case 'd':
+		r.flush(false)
+		r.y += int(n) * r.lineSpacing
+	case 'J':
+		r.flush(false)
+		r.y += int(n)
+	case '3':
+		r.lineSpacing = int(n)
+	case '-':
+		// Underline is not drawn
+	default:
+		return fmt.Errorf("unsupported command ESC %q", cmd[0])
+	}
+	return nil
+}
+
+func (r *previewer) gs() error {
+	cmd, err := r.next(1)
+	if err != nil {
+		return err
+	}
+	switch cmd[0] {
+	case 'k':
+		return r.barcode()
+	case '(':
+		return r.qrCommand()
+	case 'v':
+		return r.raster()
+	case 'L', 'W':
+		// Margins and print area are left as they are
+		_, err = r.next(2)
+		return err
+	}
+
+	arg, err := r.next(1)
+	if err != nil {
+		return err
+	}
+	n := arg[0]
+	switch cmd[0] {
+	case '!':
+		r.scaleW, r.scaleH = 1+int(n>>4&7), 1+int(n&7)
+	case 'B':
+		r.reverse = n&1 != 0
+	case 'H':
+		r.hri = n % 48
+	case 'h':
+		r.barcodeHeight = int(n)
+	case 'w':
+		r.barcodeModule = int(n)
+	case 'f':
+		// HRI is always printed in Font A
+	case 'V':
+		if n == 65 || n == 66 {
+			if _, err := r.next(1); err != nil {
+				return err
+			}
+		}
+		r.cut()
+	default:
+		return fmt.Errorf("unsupported command GS %q", cmd[0])
+	}
+	return nil
+}
+
+// codepageByTable returns the code page ESC t n selects, or nil
+func codepageByTable(n byte) *Codepage {
+	for _, c := range codepages {
+		if c.Table == n {
+			return c
+		}
+	}
+	return nil
+}
+
+// char adds a printable byte to the line buffer, printing the line first
+// if the character would not fit
+func (r *previewer) char(b byte) {
+	ch := rune(b)
+	if b == 0x7F {
+		return
+	}
+	if b >= 0x80 {
+		ch = r.codepage.chars[b-0x80]
+		if ch == '\ufffd' {
+			ch = '?'
+		}
+	}
+	c := previewChar{glyph: glyphFor(ch, r.fontB, r.bold), scaleW: r.scaleW, scaleH: r.scaleH, reverse: r.reverse}
+
+	lineWidth := 0
+	for _, lc := range r.line {
+		lineWidth += lc.width()
+	}
+	if lineWidth > 0 && lineWidth+c.width() > r.width {
+		r.flush(false)
+	}
+	r.line = append(r.line, c)
+}
+
+// flush prints the line buffer. An empty buffer feeds one line only when
+// the command is a line feed.
+func (r *previewer) flush(feed bool) {
+	if len(r.line) == 0 {
+		if feed {
+			r.y += r.lineSpacing
+		}
+		return
+	}
+
+	lineWidth, lineHeight := 0, 0
+	for _, c := range r.line {
+		lineWidth += c.width()
+		lineHeight = max(lineHeight, c.height())
+	}
+	r.grow(r.y + lineHeight)
+	x := r.alignX(lineWidth)
+	for _, c := range r.line {
+		// Characters of different heights share the baseline
+		r.drawChar(c, x, r.y+lineHeight-c.height())
+		x += c.width()
+	}
+	r.line = r.line[:0]
+	r.y += max(lineHeight, r.lineSpacing)
+}
+
+// alignX returns where an item w dots wide starts under the current
+// justification
+func (r *previewer) alignX(w int) int {
+	switch r.align {
+	case 1:
+		return max(0, (r.width-w)/2)
+	case 2:
+		return max(0, r.width-w)
+	}
+	return 0
+}
+
+// grow makes room for rows up to height
+func (r *previewer) grow(height int) {
+	if need := r.width * height; need > len(r.dots) {
+		dots := make([]bool, max(need, 2*len(r.dots)))
+		copy(dots, r.dots)
+		r.dots = dots
+	}
+}
+
+// set blackens a dot; dots outside the paper are dropped
+func (r *previewer) set(x, y int, black bool) {
+	if x < 0 || x >= r.width || y < 0 {
+		return
+	}
+	r.grow(y + 1)
+	r.dots[y*r.width+x] = black
+}
+
+func (r *previewer) drawChar(c previewChar, x0, y0 int) {
+	g := c.glyph
+	for y := 0; y < c.height(); y++ {
+		for x := 0; x < c.width(); x++ {
+			black := g.dots[y/c.scaleH*g.w+x/c.scaleW]
+			if c.reverse {
+				black = !black
+			}
+			if black {
+				r.set(x0+x, y0+y, true)
+			}
+		}
+	}
+}
+
+// block prints a w by h bitmap at the current justification; black
+// reports whether a dot of it is black
+func (r *previewer) block(w, h int, black func(x, y int) bool) {
+	r.flush(false)
+	r.grow(r.y + h)
+	x0 := r.alignX(w)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if black(x, y) {
+				r.set(x0+x, r.y+y, true)
+			}
+		}
+	}
+	r.y += h
+}
+
+// cut draws a dashed line where the paper would be cut
+func (r *previewer) cut() {
+	r.flush(false)
+	if r.pos >= len(r.data) {
+		return
+	}
+	r.y += 8
+	for x := 0; x < r.width; x += 8 {
+		for i := 0; i < 4; i++ {
+			r.set(x+i, r.y, true)
+		}
+	}
+	r.y += 16
+}
+
+// raster prints GS v 0 image data
+func (r *previewer) raster() error {
+	head, err := r.next(6)
+	if err != nil {
+		return err
+	}
+	if head[0] != '0' {
+		return fmt.Errorf("unsupported command GS v %q", head[0])
+	}
+	mode := head[1] % 48
+	rowBytes := int(head[2]) | int(head[3])<<8
+	rows := int(head[4]) | int(head[5])<<8
+	bits, err := r.next(rowBytes * rows)
+	if err != nil {
+		return err
+	}
+	sx, sy := 1+int(mode&1), 1+int(mode>>1&1)
+	r.block(rowBytes*8*sx, rows*sy, func(x, y int) bool {
+		x, y = x/sx, y/sy
+		return bits[y*rowBytes+x/8]&(0x80>>uint(x%8)) != 0
+	})
+	return nil
+}
+
+// qrCommand handles GS ( k for QR codes (cn 49); other 2D symbols are
+// rejected
+func (r *previewer) qrCommand() error {
+	head, err := r.next(3)
+	if err != nil {
+		return err
+	}
+	if head[0] != 'k' {
+		return fmt.Errorf("unsupported command GS ( %q", head[0])
+	}
+	n := int(head[1]) | int(head[2])<<8
+	body, err := r.next(n)
+	if err != nil {
+		return err
+	}
+	if n < 2 || body[0] != 49 {
+		return fmt.Errorf("unsupported 2D symbol")
+	}
+
+	switch fn, args := body[1], body[2:]; fn {
+	case 65: // model
+	case 67:
+		if len(args) > 0 {
+			r.qrModule = int(args[0])
+		}
+	case 69:
+		if len(args) > 0 && args[0] >= 48 && args[0] <= 51 {
+			r.qrLevel = qr.Level(args[0] - 48)
+		}
+	case 80:
+		if len(args) > 0 {
+			r.qrData = append([]byte(nil), args[1:]...)
+		}
+	case 81:
+		return r.printQR()
+	}
+	return nil
+}
+
+func (r *previewer) printQR() error {
+	if len(r.qrData) == 0 {
+		return nil
+	}
+	code, err := qr.Encode(string(r.qrData), r.qrLevel)
+	if err != nil {
+		return fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	m := r.qrModule
+	r.block(code.Size*m, code.Size*m, func(x, y int) bool {
+		return code.Black(x/m, y/m)
+	})
+	return nil
+}
+
+// barcode prints GS k. Only CODE128 (m 73) is drawn.
+func (r *previewer) barcode() error {
+	head, err := r.next(2)
+	if err != nil {
+		return err
+	}
+	if head[0] != 73 {
+		return fmt.Errorf("unsupported barcode system %d", head[0])
+	}
+	data, err := r.next(int(head[1]))
+	if err != nil {
+		return err
+	}
+	symbols, text, err := code128Symbols(data)
+	if err != nil {
+		return err
+	}
+
+	// Bars and spaces alternate, starting with a bar
+	var bars []bool
+	for _, s := range symbols {
+		for i, w := range code128Patterns[s] {
+			for j := 0; j < int(w-'0')*r.barcodeModule; j++ {
+				bars = append(bars, i%2 == 0)
+			}
+		}
+	}
+	if r.hri == 1 || r.hri == 3 {
+		r.hriLine(text, len(bars))
+	}
+	r.block(len(bars), r.barcodeHeight, func(x, y int) bool { return bars[x] })
+	if r.hri == 2 || r.hri == 3 {
+		r.hriLine(text, len(bars))
+	}
+	return nil
+}
+
+// hriLine prints a barcode's human readable text in Font A, centered
+// under a barcode w dots wide
+func (r *previewer) hriLine(text string, w int) {
+	var chars []previewChar
+	width := 0
+	for _, ch := range text {
+		c := previewChar{glyph: glyphFor(ch, false, false), scaleW: 1, scaleH: 1}
+		chars = append(chars, c)
+		width += c.width()
+	}
+	x := r.alignX(w) + (w-width)/2
+	r.grow(r.y + fontAHeight)
+	for _, c := range chars {
+		r.drawChar(c, x, r.y)
+		x += c.width()
+	}
+	r.y += fontAHeight
+}
+
+// code128Patterns holds the bar and space widths of the CODE128 symbols,
+// by value; 106 is the stop pattern
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+// code128Symbols converts GS k CODE128 data, which selects code sets with
+// "{A", "{B" and "{C", to symbol values including start, check and stop
+// symbols, and returns the text printed under the barcode
+func code128Symbols(data []byte) ([]int, string, error) {
+	if len(data) < 2 || data[0] != '{' || data[1] < 'A' || data[1] > 'C' {
+		return nil, "", fmt.Errorf("CODE128 data must start with a code set")
+	}
+	set := data[1]
+	symbols := []int{103 + int(set-'A')}
+	var text []byte
+
+	for i := 2; i < len(data); i++ {
+		c := data[i]
+		if c == '{' && i+1 < len(data) && data[i+1] != '{' {
+			i++
+			switch data[i] {
+			case 'A':
+				symbols = append(symbols, 101)
+				set = 'A'
+			case 'B':
+				symbols = append(symbols, 100)
+				set = 'B'
+			case 'C':
+				symbols = append(symbols, 99)
+				set = 'C'
+			case 'S':
+				symbols = append(symbols, 98)
+			case '1':
+				symbols = append(symbols, 102)
+			case '2':
+				symbols = append(symbols, 97)
+			case '3':
+				symbols = append(symbols, 96)
+			case '4':
+				if set == 'C' {
+					return nil, "", fmt.Errorf("FNC4 is not in CODE128 set C")
+				}
+				// FNC4 shares its value with the switch to the other set
+				symbols = append(symbols, 101-int(set-'A'))
+			default:
+				return nil, "", fmt.Errorf("unknown CODE128 function {%c", data[i])
+			}
+			continue
+		}
+		if c == '{' {
+			i++
+		}
+
+		switch set {
+		case 'A':
+			if c >= 96 {
+				return nil, "", fmt.Errorf("character 0x%02x is not in CODE128 set A", c)
+			}
+			if c < 32 {
+				symbols = append(symbols, int(c)+64)
+			} else {
+				symbols = append(symbols, int(c)-32)
+			}
+		case 'B':
+			if c < 32 || c > 127 {
+				return nil, "", fmt.Errorf("character 0x%02x is not in CODE128 set B", c)
+			}
+			symbols = append(symbols, int(c)-32)
+		case 'C':
+			if c > 99 {
+				return nil, "", fmt.Errorf("value %d is not in CODE128 set C", c)
+			}
+			symbols = append(symbols, int(c))
+			text = append(text, '0'+c/10, '0'+c%10)
+			continue
+		}
+		if c >= 32 {
+			text = append(text, c)
+		}
+	}
+
+	check := symbols[0]
+	for i, s := range symbols[1:] {
+		check += (i + 1) * s
+	}
+	symbols = append(symbols, check%103, 106)
+	return symbols, string(text), nil
+}
+
+// Font cells in dots
+const (
+	fontAHeight = 24
+	fontBHeight = 17
+)
+
+// glyph is a character drawn in a font cell
+type glyph struct {
+	w, h int
+	dots []bool
+}
+
+type glyphKey struct {
+	r           rune
+	fontB, bold bool
+}
+
+var (
+	glyphMu    sync.Mutex
+	glyphs     = map[glyphKey]*glyph{}
+	glyphFaces = map[glyphKey]font.Face{} // by font and weight, r unused
+)
+
+// glyphFor returns the character drawn in Font A or Font B, regular or
+// bold. Go Mono is 0.6 em wide, so it fills the 12 and 9 dot cells at 20
+// and 15 pixels.
+func glyphFor(r rune, fontB, bold bool) *glyph {
+	glyphMu.Lock()
+	defer glyphMu.Unlock()
+
+	key := glyphKey{r, fontB, bold}
+	if g, ok := glyphs[key]; ok {
+		return g
+	}
+
+	w, h, size := fontADots, fontAHeight, 20.0
+	if fontB {
+		w, h, size = fontBDots, fontBHeight, 15.0
+	}
+	faceKey := glyphKey{fontB: fontB, bold: bold}
+	face, ok := glyphFaces[faceKey]
+	if !ok {
+		ttf := gomono.TTF
+		if bold {
+			ttf = gomonobold.TTF
+		}
+		// The embedded fonts are known to parse
+		f, _ := opentype.Parse(ttf)
+		face, _ = opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		glyphFaces[faceKey] = face
+	}
+
+	// Center the font's ascent and descent in the cell
+	m := face.Metrics()
+	baseline := (h-(m.Ascent+m.Descent).Ceil())/2 + m.Ascent.Ceil()
+	img := image.NewAlpha(image.Rect(0, 0, w, h))
+	d := font.Drawer{Dst: img, Src: image.NewUniform(color.Alpha{A: 0xFF}), Face: face, Dot: fixed.P(0, baseline)}
+	d.DrawString(string(r))
+
+	g := &glyph{w: w, h: h, dots: make([]bool, w*h)}
+	for i, a := range img.Pix {
+		g.dots[i] = a >= 0x80
+	}
+	glyphs[key] = g
+	return g
+}
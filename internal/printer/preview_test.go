@@ -0,0 +1,195 @@
+package printer
+
+import (
+	"bytes"
+	"image"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// inked returns the bounds of the black dots of img, or an empty rectangle
+func inked(img *image.Gray) image.Rectangle {
+	var r image.Rectangle
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if img.GrayAt(x, y).Y == 0 {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+func TestRenderImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		paperWidth int
+		width      int
+		height     int             // 0 skips the check
+		ink        image.Rectangle // expected bounds of the black dots
+	}{
+		{"empty", nil, Paper58mmDots, Paper58mmDots, 1, image.Rectangle{}},
+		{"default paper", []byte{ESC, '@'}, 0, Paper80mmDots, 1, image.Rectangle{}},
+		{"line feed", []byte("\n\n"), Paper58mmDots, Paper58mmDots, 2 * defaultLineSpacing, image.Rectangle{}},
+		{"feed lines", []byte{ESC, 'd', 3}, Paper58mmDots, Paper58mmDots, 3 * defaultLineSpacing, image.Rectangle{}},
+		{"raster image left", join([]byte{GS, 'v', '0', 0, 1, 0, 2, 0}, []byte{0xF0, 0x0F}),
+			Paper58mmDots, Paper58mmDots, 2, image.Rect(0, 0, 8, 2)},
+		{"raster image centered", join(ALIGN_CENTER, []byte{GS, 'v', '0', 0, 1, 0, 1, 0, 0xFF}),
+			Paper58mmDots, Paper58mmDots, 1, image.Rect(188, 0, 196, 1)},
+		{"raster image right", join([]byte{ESC, 'a', 2}, []byte{GS, 'v', '0', 0, 1, 0, 1, 0, 0xFF}),
+			Paper58mmDots, Paper58mmDots, 1, image.Rect(376, 0, 384, 1)},
+		{"double size raster image", []byte{GS, 'v', '0', 3, 1, 0, 1, 0, 0x80},
+			Paper58mmDots, Paper58mmDots, 2, image.Rect(0, 0, 2, 2)},
+		{"reverse text fills its cell", join(REVERSE_ON, []byte(" \n")),
+			Paper58mmDots, Paper58mmDots, defaultLineSpacing, image.Rect(0, 0, fontADots, fontAHeight)},
+		{"double size text", join(DOUBLE_ON, REVERSE_ON, []byte(" \n")),
+			Paper58mmDots, Paper58mmDots, 2 * fontAHeight, image.Rect(0, 0, 2*fontADots, 2*fontAHeight)},
+		{"font B text", join(FONT_B, REVERSE_ON, []byte(" \n")),
+			Paper58mmDots, Paper58mmDots, defaultLineSpacing, image.Rect(0, 0, fontBDots, fontBHeight)},
+		{"long lines wrap", join(REVERSE_ON, []byte(strings.Repeat(" ", 33)+"\n")),
+			Paper58mmDots, Paper58mmDots, 2 * defaultLineSpacing, image.Rect(0, 0, 32*fontADots, defaultLineSpacing+fontAHeight)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := RenderImage(tt.data, tt.paperWidth)
+			if err != nil {
+				t.Fatalf("RenderImage: %v", err)
+			}
+			b := img.Bounds()
+			if b.Dx() != tt.width || (tt.height > 0 && b.Dy() != tt.height) {
+				t.Errorf("image is %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.width, tt.height)
+			}
+			if got := inked(img); got != tt.ink {
+				t.Errorf("black dots in %v, want %v", got, tt.ink)
+			}
+		})
+	}
+}
+
+func TestRenderImageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"control character", []byte{0x07}, "unsupported control character"},
+		{"unknown ESC command", []byte{ESC, 'p', 0}, "unsupported command ESC"},
+		{"unknown GS command", []byte{GS, 'P', 0}, "unsupported command GS"},
+		{"truncated command", []byte{ESC, 'a'}, "truncated command"},
+		{"truncated raster image", []byte{GS, 'v', '0', 0, 1, 0, 2, 0, 0xFF}, "truncated command"},
+		{"barcode other than CODE128", []byte{GS, 'k', 69, 2, 'A', 'B'}, "unsupported barcode system"},
+		{"CODE128 without a code set", []byte{GS, 'k', 73, 2, 'A', 'B'}, "must start with a code set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RenderImage(tt.data, Paper58mmDots)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("RenderImage() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderImageCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		width  int // width of the symbol in dots
+		height int
+	}{
+		// Version 1 QR codes are 21 modules square
+		{"QR code", QRCode("A001", 4, QRErrorM), 21 * 4, 21 * 4},
+		// Start, A, 0, 0, 1, check: 11 modules each; stop: 13
+		{"CODE128", []byte{GS, 'h', 60, GS, 'w', 2, GS, 'k', 73, 6, '{', 'B', 'A', '0', '0', '1'}, (6*11 + 13) * 2, 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := RenderImage(join(ALIGN_CENTER, tt.data), Paper80mmDots)
+			if err != nil {
+				t.Fatalf("RenderImage: %v", err)
+			}
+			ink := inked(img)
+			if ink.Dx() != tt.width || ink.Dy() != tt.height {
+				t.Errorf("symbol is %dx%d, want %dx%d", ink.Dx(), ink.Dy(), tt.width, tt.height)
+			}
+			if left, right := ink.Min.X, Paper80mmDots-ink.Max.X; left-right > 1 || right-left > 1 {
+				t.Errorf("symbol at %v is not centered", ink)
+			}
+		})
+	}
+}
+
+func TestCode128Symbols(t *testing.T) {
+	tests := []struct {
+		data    string
+		symbols []int
+		text    string
+	}{
+		// Check symbol: (104 + 1*33 + 2*16 + 3*16 + 4*17) % 103 = 79
+		{"{BA001", []int{104, 33, 16, 16, 17, 79, 106}, "A001"},
+		{"{C\x0c\x22", []int{105, 12, 34, (105 + 12 + 2*34) % 103, 106}, "1234"},
+		{"{B{{", []int{104, 91, (104 + 91) % 103, 106}, "{"},
+		{"{BA{C\x01", []int{104, 33, 99, 1, (104 + 33 + 2*99 + 3*1) % 103, 106}, "A01"},
+	}
+	for _, tt := range tests {
+		symbols, text, err := code128Symbols([]byte(tt.data))
+		if err != nil {
+			t.Errorf("code128Symbols(%q): %v", tt.data, err)
+			continue
+		}
+		if !slices.Equal(symbols, tt.symbols) || text != tt.text {
+			t.Errorf("code128Symbols(%q) = %v, %q, want %v, %q", tt.data, symbols, text, tt.symbols, tt.text)
+		}
+	}
+}
+
+func TestPreviewTicket(t *testing.T) {
+	data := TicketData{QueueNumber: "A001", TypeName: "Umum", Position: 3, EstimatedWait: 12, StatusURL: "http://antrian/t/abc"}
+	template := DefaultTemplate()
+	template.ShowLogo = true
+	template.Logo = &Raster{Width: Paper80mmDots, Height: 8, Data: bytes.Repeat([]byte{0xFF}, Paper80mmDots)}
+
+	tests := []struct {
+		name   string
+		config PrinterConfig
+		width  int
+	}{
+		{"template paper", PrinterConfig{}, Paper80mmDots},
+		{"printer paper", PrinterConfig{PaperWidth: Paper58mmDots}, Paper58mmDots},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := New(tt.config).Preview(data, template)
+			if err != nil {
+				t.Fatalf("Preview: %v", err)
+			}
+			if w := img.Bounds().Dx(); w != tt.width {
+				t.Errorf("preview is %d dots wide, want %d", w, tt.width)
+			}
+			if ink := inked(img); ink.Empty() || ink.Max.X > tt.width {
+				t.Errorf("black dots in %v", ink)
+			}
+		})
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	img, err := RenderImage(join(REVERSE_ON, []byte("A001\n")), Paper58mmDots)
+	if err != nil {
+		t.Fatalf("RenderImage: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, img); err != nil {
+		t.Fatalf("WritePDF: %v", err)
+	}
+	pdf := buf.String()
+	// 384 dots at 203 dpi is 136.20 points
+	for _, want := range []string{"%PDF-", "/Width 384", "136.20", "/FlateDecode", "%%EOF"} {
+		if !strings.Contains(pdf, want) {
+			t.Errorf("PDF is missing %q", want)
+		}
+	}
+}
@@ -3,9 +3,6 @@ package printer
 import (
 	"bytes"
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
 	"time"
 )
 
@@ -20,6 +17,8 @@ var (
 	BOLD_OFF     = []byte{ESC, 'E', 0}     // Bold off
 	DOUBLE_ON    = []byte{GS, '!', 0x11}   // Double width & height
 	DOUBLE_OFF   = []byte{GS, '!', 0x00}   // Normal size
+	REVERSE_ON   = []byte{GS, 'B', 1}      // White on black
+	REVERSE_OFF  = []byte{GS, 'B', 0}      // Black on white
 	FONT_B       = []byte{ESC, 'M', 1}     // Small font
 	FONT_A       = []byte{ESC, 'M', 0}     // Normal font
 	CUT          = []byte{GS, 'V', 66, 3}  // Partial cut with feed
@@ -29,8 +28,21 @@ var (
 
 // PrinterConfig holds printer configuration
 type PrinterConfig struct {
-	PrinterName string // Windows printer name (e.g., "ECO80")
+	PrinterName string // Windows or CUPS printer name (e.g., "ECO80")
 	Enabled     bool
+	// Backend selects the transport (BackendWindows, BackendTCP,
+	// BackendCUPS, BackendDevice, BackendFile, BackendPNG or BackendPDF);
+	// empty picks the platform default
+	Backend string
+	// Address is the backend's target: host[:port] for tcp, a device
+	// path for device, a directory for file, png and pdf. windows and
+	// cups use PrinterName unless Address is set
+	Address string
+	// Paper profile of this printer (see TicketTemplate); zero values use
+	// the ticket template's
+	PaperWidth int
+	Columns    int
+	Codepage   string
 }
 
 // TicketTemplate holds the ticket design template
@@ -46,33 +58,84 @@ type TicketTemplate struct {
 	ShowDatetime  bool
 	ShowFooter    bool
 	ShowThanks    bool
+	// QRContent is what the QR code encodes: CodeStatusURL, CodeQueueNumber
+	// or "" for no QR code
+	QRContent   string
+	QRPlacement string // CodeTop, CodeMiddle or CodeBottom
+	QRSize      int    // module size in dots, 1-16
+	// ShowBarcode prints the queue number as a CODE128 barcode, e.g. for a
+	// scanner at the counter
+	ShowBarcode      bool
+	BarcodePlacement string
+	// Logo is printed above the header when ShowLogo is set
+	ShowLogo bool
+	Logo     *Raster `json:",omitempty"`
+	// PaperWidth is the printable width in dots (Paper80mmDots or
+	// Paper58mmDots), Columns the Font A characters per line (0 derives
+	// it from PaperWidth) and Codepage the character table text is
+	// encoded to (see Codepages)
+	PaperWidth int
+	Columns    int
+	Codepage   string
+	// Layout, when set, replaces the fixed design above; see
+	// TemplateLayout
+	Layout *Layout `json:",omitempty"`
 }
 
+// QR code contents
+const (
+	CodeStatusURL   = "status_url"
+	CodeQueueNumber = "queue_number"
+)
+
+// QR code and barcode placements: below the header, between the date and
+// the footer, or at the end of the ticket
+const (
+	CodeTop    = "top"
+	CodeMiddle = "middle"
+	CodeBottom = "bottom"
+)
+
 // DefaultTemplate returns the default ticket template
 func DefaultTemplate() TicketTemplate {
 	return TicketTemplate{
-		Header:        "SISTEM ANTRIAN",
-		Subheader:     "",
-		Title:         "NOMOR ANTRIAN ANDA",
-		Footer1:       "Mohon menunggu hingga",
-		Footer2:       "nomor Anda dipanggil",
-		Thanks:        "Terima kasih",
-		ShowSubheader: true,
-		ShowType:      true,
-		ShowDatetime:  true,
-		ShowFooter:    true,
-		ShowThanks:    true,
+		Header:           "SISTEM ANTRIAN",
+		Subheader:        "",
+		Title:            "NOMOR ANTRIAN ANDA",
+		Footer1:          "Mohon menunggu hingga",
+		Footer2:          "nomor Anda dipanggil",
+		Thanks:           "Terima kasih",
+		ShowSubheader:    true,
+		ShowType:         true,
+		ShowDatetime:     true,
+		ShowFooter:       true,
+		ShowThanks:       true,
+		QRContent:        CodeStatusURL,
+		QRPlacement:      CodeMiddle,
+		QRSize:           DefaultQRSize,
+		ShowBarcode:      false,
+		BarcodePlacement: CodeBottom,
+		ShowLogo:         true,
+		PaperWidth:       Paper80mmDots,
+		Codepage:         DefaultCodepage,
 	}
 }
 
 // Printer handles thermal printing
 type Printer struct {
-	config PrinterConfig
+	config    PrinterConfig
+	transport Transport
+	err       error // reported on every print if the config is invalid
 }
 
 // New creates a new printer instance
 func New(config PrinterConfig) *Printer {
-	return &Printer{config: config}
+	p := &Printer{config: config}
+	p.transport, p.err = NewTransport(config)
+	if _, ok := LookupCodepage(config.Codepage); p.err == nil && config.Codepage != "" && !ok {
+		p.err = fmt.Errorf("unknown code page %q", config.Codepage)
+	}
+	return p
 }
 
 // TicketData holds the data for printing a ticket
@@ -80,113 +143,80 @@ type TicketData struct {
 	QueueNumber string
 	TypeName    string
 	DateTime    string
+	Priority    bool // cetak penanda PRIORITAS di bawah nomor
+	// Position dan EstimatedWait (menit) dicetak di bawah jenis antrian
+	// jika Position > 0
+	Position      int
+	EstimatedWait int
+	// StatusURL dicetak sebagai QR code menuju halaman status tiket
+	StatusURL string
+	// Counter berisi nomor loket yang melayani jenis antrian ini
+	Counter string
 }
 
-// PrintTicket prints a queue ticket to the thermal printer
-func (p *Printer) PrintTicket(data TicketData, template TicketTemplate) error {
-	if !p.config.Enabled {
-		return fmt.Errorf("printer is disabled")
+// paper returns the paper width, Font A columns and code page a ticket is
+// printed with: the printer's own profile where set, otherwise the
+// template's.
+func (p *Printer) paper(template TicketTemplate) (width, columns int, codepage *Codepage) {
+	width, columns = template.PaperWidth, template.Columns
+	name := template.Codepage
+	if p.config.PaperWidth > 0 {
+		// A narrower printer does not inherit the template's columns
+		width, columns = p.config.PaperWidth, 0
 	}
-
-	// Build ESC/POS commands
-	var buf bytes.Buffer
-
-	// Initialize printer
-	buf.Write(INIT)
-
-	// Header - Center aligned, bold
-	buf.Write(ALIGN_CENTER)
-	buf.Write(BOLD_ON)
-	header := template.Header
-	if header == "" {
-		header = "SISTEM ANTRIAN"
+	if p.config.Columns > 0 {
+		columns = p.config.Columns
 	}
-	buf.WriteString(header + "\n")
-	buf.Write(BOLD_OFF)
-
-	// Subheader (optional)
-	if template.ShowSubheader && template.Subheader != "" {
-		buf.Write(FONT_B)
-		buf.WriteString(template.Subheader + "\n")
-		buf.Write(FONT_A)
+	if p.config.Codepage != "" {
+		name = p.config.Codepage
 	}
 
-	// Dashed line
-	buf.WriteString("--------------------------------\n")
-
-	// Title
-	buf.Write(FONT_B)
-	title := template.Title
-	if title == "" {
-		title = "NOMOR ANTRIAN ANDA"
+	if width <= 0 {
+		width = Paper80mmDots
 	}
-	buf.WriteString(title + "\n")
-	buf.Write(FONT_A)
-
-	// Queue number - Large & bold
-	buf.Write(FEED_LINE)
-	buf.Write(DOUBLE_ON)
-	buf.Write(BOLD_ON)
-	buf.WriteString(data.QueueNumber + "\n")
-	buf.Write(BOLD_OFF)
-	buf.Write(DOUBLE_OFF)
-
-	// Type name (optional)
-	if template.ShowType {
-		buf.Write(FEED_LINE)
-		buf.Write(BOLD_ON)
-		buf.WriteString(data.TypeName + "\n")
-		buf.Write(BOLD_OFF)
+	if columns <= 0 {
+		columns = width / fontADots
 	}
+	codepage, ok := LookupCodepage(name)
+	if !ok {
+		codepage, _ = LookupCodepage(DefaultCodepage)
+	}
+	return width, columns, codepage
+}
 
-	// Dashed line
-	buf.WriteString("--------------------------------\n")
-
-	// DateTime (optional)
-	if template.ShowDatetime {
-		buf.Write(FONT_B)
-		buf.WriteString(data.DateTime + "\n")
-		buf.Write(FONT_A)
+// PrintTicket prints a queue ticket to the thermal printer
+func (p *Printer) PrintTicket(data TicketData, template TicketTemplate) error {
+	if !p.config.Enabled {
+		return fmt.Errorf("printer is disabled")
 	}
+	width, _, _ := p.paper(template)
+	return p.sendToPrinter(p.Render(data, template), width)
+}
 
-	// Footer (optional)
-	if template.ShowFooter {
-		// Dashed line
-		buf.WriteString("--------------------------------\n")
+// Render returns the ESC/POS commands for a ticket: the template's layout,
+// or the layout of its fixed fields when it has none
+func (p *Printer) Render(data TicketData, template TicketTemplate) []byte {
+	layout := template.Layout
+	if layout == nil {
+		layout = TemplateLayout(template)
+	}
 
-		buf.Write(FONT_B)
-		footer1 := template.Footer1
-		if footer1 == "" {
-			footer1 = "Mohon menunggu hingga"
-		}
-		buf.WriteString(footer1 + "\n")
+	var buf bytes.Buffer
+	paperWidth, columns, codepage := p.paper(template)
+	w := &ticketWriter{buf: &buf, codepage: codepage, columns: columns}
 
-		footer2 := template.Footer2
-		if footer2 == "" {
-			footer2 = "nomor Anda dipanggil"
-		}
-		buf.WriteString(footer2 + "\n")
-		buf.Write(FONT_A)
-	}
+	// Initialize printer and select the code page
+	buf.Write(INIT)
+	buf.Write(codepage.Select())
 
-	// Thanks message (optional)
-	if template.ShowThanks {
-		buf.WriteString("\n")
-		buf.Write(FONT_B)
-		thanks := template.Thanks
-		if thanks == "" {
-			thanks = "Terima kasih"
-		}
-		buf.WriteString(thanks + "\n")
-		buf.Write(FONT_A)
+	for _, b := range layout.Blocks {
+		w.block(b, data, template.Logo, paperWidth)
 	}
 
 	// Feed and cut
 	buf.Write(FEED_LINES)
 	buf.Write(CUT)
-
-	// Send to printer
-	return p.sendToPrinter(buf.Bytes())
+	return buf.Bytes()
 }
 
 // PrintTicketSimple prints a ticket with default template (for backward compatibility)
@@ -194,159 +224,16 @@ func (p *Printer) PrintTicketSimple(data TicketData) error {
 	return p.PrintTicket(data, DefaultTemplate())
 }
 
-// sendToPrinter sends raw data to the Windows printer using PowerShell
-func (p *Printer) sendToPrinter(data []byte) error {
-	printerName := p.config.PrinterName
-	if printerName == "" {
-		printerName = "ECO80"
-	}
-
-	// Create temp file with raw print data
-	tempDir := os.TempDir()
-	tempFile := filepath.Join(tempDir, fmt.Sprintf("ticket_%d.bin", time.Now().UnixNano()))
-
-	if err := os.WriteFile(tempFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write temp file: %w", err)
-	}
-	defer os.Remove(tempFile)
-
-	// Use PowerShell to send raw data to printer
-	// This is the most reliable method for Windows
-	psScript := fmt.Sprintf(`
-$printerName = '%s'
-$filePath = '%s'
-
-# Get printer
-$printer = Get-WmiObject -Query "SELECT * FROM Win32_Printer WHERE Name='$printerName'" -ErrorAction SilentlyContinue
-
-if ($printer -eq $null) {
-    # Try without exact match
-    $printer = Get-WmiObject -Query "SELECT * FROM Win32_Printer WHERE Name LIKE '%%$printerName%%'" -ErrorAction SilentlyContinue
-}
-
-if ($printer -eq $null) {
-    Write-Error "Printer '$printerName' not found"
-    exit 1
-}
-
-# Get printer port
-$portName = $printer.PortName
-
-# Read file content as bytes
-$bytes = [System.IO.File]::ReadAllBytes($filePath)
-
-# Try direct port write first (works for USB printers)
-try {
-    $port = [System.IO.Ports.SerialPort]::GetPortNames() | Where-Object { $_ -eq $portName }
-    if ($port) {
-        $serialPort = New-Object System.IO.Ports.SerialPort $portName, 9600
-        $serialPort.Open()
-        $serialPort.Write($bytes, 0, $bytes.Length)
-        $serialPort.Close()
-        exit 0
-    }
-} catch {}
-
-# Fallback: Use raw print job via .NET
-Add-Type -AssemblyName System.Drawing
-
-$doc = New-Object System.Drawing.Printing.PrintDocument
-$doc.PrinterSettings.PrinterName = $printerName
-
-# For raw printing, we use RawPrinterHelper
-$helper = @"
-using System;
-using System.Runtime.InteropServices;
-
-public class RawPrinterHelper
-{
-    [StructLayout(LayoutKind.Sequential, CharSet = CharSet.Ansi)]
-    public class DOCINFOA
-    {
-        [MarshalAs(UnmanagedType.LPStr)] public string pDocName;
-        [MarshalAs(UnmanagedType.LPStr)] public string pOutputFile;
-        [MarshalAs(UnmanagedType.LPStr)] public string pDataType;
-    }
-
-    [DllImport("winspool.Drv", EntryPoint = "OpenPrinterA", CharSet = CharSet.Ansi, SetLastError = true)]
-    public static extern bool OpenPrinter([MarshalAs(UnmanagedType.LPStr)] string szPrinter, out IntPtr hPrinter, IntPtr pd);
-
-    [DllImport("winspool.Drv", EntryPoint = "ClosePrinter", SetLastError = true)]
-    public static extern bool ClosePrinter(IntPtr hPrinter);
-
-    [DllImport("winspool.Drv", EntryPoint = "StartDocPrinterA", CharSet = CharSet.Ansi, SetLastError = true)]
-    public static extern bool StartDocPrinter(IntPtr hPrinter, Int32 level, [In, MarshalAs(UnmanagedType.LPStruct)] DOCINFOA di);
-
-    [DllImport("winspool.Drv", EntryPoint = "EndDocPrinter", SetLastError = true)]
-    public static extern bool EndDocPrinter(IntPtr hPrinter);
-
-    [DllImport("winspool.Drv", EntryPoint = "StartPagePrinter", SetLastError = true)]
-    public static extern bool StartPagePrinter(IntPtr hPrinter);
-
-    [DllImport("winspool.Drv", EntryPoint = "EndPagePrinter", SetLastError = true)]
-    public static extern bool EndPagePrinter(IntPtr hPrinter);
-
-    [DllImport("winspool.Drv", EntryPoint = "WritePrinter", SetLastError = true)]
-    public static extern bool WritePrinter(IntPtr hPrinter, IntPtr pBytes, Int32 dwCount, out Int32 dwWritten);
-
-    public static bool SendBytesToPrinter(string szPrinterName, byte[] bytes)
-    {
-        IntPtr hPrinter = IntPtr.Zero;
-        DOCINFOA di = new DOCINFOA();
-        di.pDocName = "Queue Ticket";
-        di.pDataType = "RAW";
-
-        if (OpenPrinter(szPrinterName.Normalize(), out hPrinter, IntPtr.Zero))
-        {
-            if (StartDocPrinter(hPrinter, 1, di))
-            {
-                if (StartPagePrinter(hPrinter))
-                {
-                    IntPtr pUnmanagedBytes = Marshal.AllocCoTaskMem(bytes.Length);
-                    Marshal.Copy(bytes, 0, pUnmanagedBytes, bytes.Length);
-                    int dwWritten;
-                    WritePrinter(hPrinter, pUnmanagedBytes, bytes.Length, out dwWritten);
-                    Marshal.FreeCoTaskMem(pUnmanagedBytes);
-                    EndPagePrinter(hPrinter);
-                }
-                EndDocPrinter(hPrinter);
-            }
-            ClosePrinter(hPrinter);
-            return true;
-        }
-        return false;
-    }
-}
-"@
-
-Add-Type -TypeDefinition $helper -Language CSharp -ErrorAction SilentlyContinue
-
-[RawPrinterHelper]::SendBytesToPrinter($printerName, $bytes)
-`, printerName, escapeForPS(tempFile))
-
-	cmd := exec.Command("powershell", "-NoProfile", "-ExecutionPolicy", "Bypass", "-Command", psScript)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("print failed: %v, output: %s", err, string(output))
+// sendToPrinter sends raw data through the configured transport.
+// Transports saving a picture of the printout draw it paperWidth dots wide.
+func (p *Printer) sendToPrinter(data []byte, paperWidth int) error {
+	if p.err != nil {
+		return p.err
 	}
-
-	return nil
-}
-
-// escapeForPS escapes a string for use in PowerShell
-func escapeForPS(s string) string {
-	// Replace backslashes for PowerShell path
-	result := ""
-	for _, c := range s {
-		if c == '\\' {
-			result += "\\\\"
-		} else if c == '\'' {
-			result += "''"
-		} else {
-			result += string(c)
-		}
+	if s, ok := p.transport.(imageSender); ok {
+		return s.SendImage(data, paperWidth)
 	}
-	return result
+	return p.transport.Send(data)
 }
 
 // TestPrint sends a test print to verify printer connection
@@ -359,7 +246,7 @@ func (p *Printer) TestPrint() error {
 	buf.WriteString("=== TEST PRINT ===\n")
 	buf.Write(BOLD_OFF)
 	buf.WriteString("\n")
-	buf.WriteString("Printer: " + p.config.PrinterName + "\n")
+	buf.WriteString("Printer: " + p.Describe() + "\n")
 	buf.WriteString("Time: " + time.Now().Format("02/01/2006 15:04:05") + "\n")
 	buf.WriteString("\n")
 	buf.WriteString("Jika Anda melihat ini,\n")
@@ -367,7 +254,8 @@ func (p *Printer) TestPrint() error {
 	buf.Write(FEED_LINES)
 	buf.Write(CUT)
 
-	return p.sendToPrinter(buf.Bytes())
+	width, _, _ := p.paper(TicketTemplate{})
+	return p.sendToPrinter(buf.Bytes(), width)
 }
 
 // IsEnabled returns whether printing is enabled
@@ -379,3 +267,16 @@ func (p *Printer) IsEnabled() bool {
 func (p *Printer) GetPrinterName() string {
 	return p.config.PrinterName
 }
+
+// Err returns why the configured backend cannot be used, if it cannot
+func (p *Printer) Err() error {
+	return p.err
+}
+
+// Describe returns the backend and target the printer sends to
+func (p *Printer) Describe() string {
+	if p.err != nil {
+		return p.err.Error()
+	}
+	return p.transport.String()
+}
@@ -0,0 +1,123 @@
+package printer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// Real-time status (DLE EOT). Backends that can read from the printer
+// answer three queries: printer status, offline cause and roll paper
+// sensor.
+
+const (
+	DLE = byte(0x10)
+	EOT = byte(0x04)
+)
+
+// statusTimeout bounds a status query, so a printer that is off does not
+// hold up the caller
+const statusTimeout = 2 * time.Second
+
+// ErrStatusUnsupported is returned by Printer.Status for backends that
+// cannot read from the printer (windows, cups, file, png, pdf)
+var ErrStatusUnsupported = errors.New("printer backend cannot report status")
+
+// Status is the hardware state reported by the printer
+type Status struct {
+	Online       bool `json:"online"`
+	PaperNearEnd bool `json:"paper_near_end"`
+	PaperOut     bool `json:"paper_out"`
+	CoverOpen    bool `json:"cover_open"`
+}
+
+// StatusQuerier is implemented by transports that can query the printer
+type StatusQuerier interface {
+	QueryStatus() (*Status, error)
+}
+
+// Status queries the printer's hardware state
+func (p *Printer) Status() (*Status, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	q, ok := p.transport.(StatusQuerier)
+	if !ok {
+		return nil, ErrStatusUnsupported
+	}
+	return q.QueryStatus()
+}
+
+// queryStatus sends the DLE EOT requests over rw and parses the replies
+func queryStatus(rw io.ReadWriter) (*Status, error) {
+	var replies [3]byte
+	for i, n := range []byte{1, 2, 4} {
+		if _, err := rw.Write([]byte{DLE, EOT, n}); err != nil {
+			return nil, fmt.Errorf("failed to send status request: %w", err)
+		}
+		var b [1]byte
+		if _, err := io.ReadFull(rw, b[:]); err != nil {
+			return nil, fmt.Errorf("printer did not answer status request: %w", err)
+		}
+		// Bits 1 and 4 are always set, bits 0 and 7 always clear
+		if b[0]&0x93 != 0x12 {
+			return nil, fmt.Errorf("unexpected status reply 0x%02x", b[0])
+		}
+		replies[i] = b[0]
+	}
+	return parseStatus(replies[0], replies[1], replies[2]), nil
+}
+
+// parseStatus decodes the replies to DLE EOT 1 (printer), 2 (offline
+// cause) and 4 (roll paper sensor)
+func parseStatus(printer, offline, paper byte) *Status {
+	return &Status{
+		Online:       printer&0x08 == 0,
+		CoverOpen:    offline&0x04 != 0,
+		PaperOut:     offline&0x20 != 0 || paper&0x60 != 0,
+		PaperNearEnd: paper&0x0C != 0,
+	}
+}
+
+// QueryStatus asks a network printer for its status on the raw port
+func (t *tcpTransport) QueryStatus() (*Status, error) {
+	conn, err := net.DialTimeout("tcp", t.addr, tcpTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to printer %s: %w", t.addr, err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(statusTimeout))
+	return queryStatus(conn)
+}
+
+// QueryStatus asks a USB printer for its status through its device file
+func (t *deviceTransport) QueryStatus() (*Status, error) {
+	f, err := os.OpenFile(t.path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open printer device: %w", err)
+	}
+	defer f.Close()
+
+	// Device files that cannot be polled ignore deadlines, so the query
+	// also runs under a timer
+	f.SetDeadline(time.Now().Add(statusTimeout))
+	type result struct {
+		status *Status
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		s, err := queryStatus(f)
+		done <- result{s, err}
+	}()
+	select {
+	case r := <-done:
+		return r.status, r.err
+	case <-time.After(statusTimeout):
+		return nil, fmt.Errorf("printer did not answer status request")
+	}
+}
@@ -0,0 +1,72 @@
+package printer
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+// fakePrinter answers status requests with canned replies and records
+// what it was sent.
+type fakePrinter struct {
+	replies []byte
+	sent    bytes.Buffer
+}
+
+func (f *fakePrinter) Write(p []byte) (int, error) { return f.sent.Write(p) }
+
+func (f *fakePrinter) Read(p []byte) (int, error) {
+	if len(f.replies) == 0 {
+		return 0, net.ErrClosed
+	}
+	n := copy(p[:1], f.replies)
+	f.replies = f.replies[n:]
+	return n, nil
+}
+
+func TestQueryStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		replies []byte
+		want    Status
+		wantErr bool
+	}{
+		{"ready", []byte{0x12, 0x12, 0x12}, Status{Online: true}, false},
+		{"offline", []byte{0x1A, 0x12, 0x12}, Status{}, false},
+		{"cover open", []byte{0x1A, 0x16, 0x12}, Status{CoverOpen: true}, false},
+		{"paper out while printing", []byte{0x1A, 0x32, 0x12}, Status{PaperOut: true}, false},
+		{"paper out at the sensor", []byte{0x12, 0x12, 0x72}, Status{Online: true, PaperOut: true}, false},
+		{"paper near end", []byte{0x12, 0x12, 0x1E}, Status{Online: true, PaperNearEnd: true}, false},
+		{"malformed reply", []byte{0xFF, 0x12, 0x12}, Status{}, true},
+		{"no answer", []byte{0x12}, Status{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakePrinter{replies: tt.replies}
+			got, err := queryStatus(f)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("queryStatus = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("queryStatus: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("queryStatus = %+v, want %+v", *got, tt.want)
+			}
+			want := []byte{DLE, EOT, 1, DLE, EOT, 2, DLE, EOT, 4}
+			if !bytes.Equal(f.sent.Bytes(), want) {
+				t.Errorf("sent % x, want % x", f.sent.Bytes(), want)
+			}
+		})
+	}
+}
+
+func TestStatusUnsupported(t *testing.T) {
+	p := New(PrinterConfig{Backend: BackendFile, Address: t.TempDir()})
+	if _, err := p.Status(); err != ErrStatusUnsupported {
+		t.Errorf("Status error = %v, want ErrStatusUnsupported", err)
+	}
+}
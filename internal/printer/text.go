@@ -0,0 +1,241 @@
+package printer
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// Text encoding and layout. Printers do not understand UTF-8: each byte
+// above 0x7F is a character from the code page selected with ESC t. Text is
+// encoded to that code page, characters it lacks are transliterated, and
+// lines are wrapped to the paper width.
+
+// Paper widths in dots at 203 dpi
+const (
+	Paper58mmDots = 384
+	Paper80mmDots = DefaultPaperDots
+)
+
+// Character widths in dots of the printer fonts
+const (
+	fontADots = 12
+	fontBDots = 9
+)
+
+// DefaultCodepage is the code page printers select after power-on
+const DefaultCodepage = "pc437"
+
+// Codepage is a printer character table
+type Codepage struct {
+	Name  string
+	Table byte // n in ESC t n
+	// chars holds the characters of bytes 0x80-0xFF; U+FFFD marks an
+	// unassigned byte
+	chars  []rune
+	encode map[rune]byte
+}
+
+var codepages = map[string]*Codepage{}
+
+func init() {
+	addCodepage("pc437", 0, ""+
+		"ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜ¢£¥₧ƒ"+
+		"áíóúñÑªº¿⌐¬½¼¡«»░▒▓│┤╡╢╖╕╣║╗╝╜╛┐"+
+		"└┴┬├─┼╞╟╚╔╩╦╠═╬╧╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀"+
+		"αßΓπΣσµτΦΘΩδ∞φε∩≡±≥≤⌠⌡÷≈°∙·√ⁿ²■\u00a0")
+	addCodepage("pc850", 2, ""+
+		"ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜø£Ø×ƒ"+
+		"áíóúñÑªº¿®¬½¼¡«»░▒▓│┤ÁÂÀ©╣║╗╝¢¥┐"+
+		"└┴┬├─┼ãÃ╚╔╩╦╠═╬¤ðÐÊËÈıÍÎÏ┘┌█▄¦Ì▀"+
+		"ÓßÔÒõÕµþÞÚÛÙýÝ¯´\u00ad±‗¾¶§÷¸°¨·¹³²■\u00a0")
+	addCodepage("wpc1252", 16, ""+
+		"€\ufffd‚ƒ„…†‡ˆ‰Š‹Œ\ufffdŽ\ufffd\ufffd‘’“”•–—˜™š›œ\ufffdžŸ"+
+		"\u00a0¡¢£¤¥¦§¨©ª«¬\u00ad®¯°±²³´µ¶·¸¹º»¼½¾¿"+
+		"ÀÁÂÃÄÅÆÇÈÉÊËÌÍÎÏÐÑÒÓÔÕÖ×ØÙÚÛÜÝÞß"+
+		"àáâãäåæçèéêëìíîïðñòóôõö÷øùúûüýþÿ")
+	// PC850 with the euro sign in place of dotless i
+	addCodepage("pc858", 19, ""+
+		"ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜø£Ø×ƒ"+
+		"áíóúñÑªº¿®¬½¼¡«»░▒▓│┤ÁÂÀ©╣║╗╝¢¥┐"+
+		"└┴┬├─┼ãÃ╚╔╩╦╠═╬¤ðÐÊËÈ€ÍÎÏ┘┌█▄¦Ì▀"+
+		"ÓßÔÒõÕµþÞÚÛÙýÝ¯´\u00ad±‗¾¶§÷¸°¨·¹³²■\u00a0")
+}
+
+func addCodepage(name string, table byte, chars string) {
+	c := &Codepage{Name: name, Table: table, chars: []rune(chars), encode: map[rune]byte{}}
+	if len(c.chars) != 128 {
+		panic("printer: code page " + name + " must have 128 characters")
+	}
+	for i, r := range c.chars {
+		if r != '\ufffd' {
+			c.encode[r] = byte(0x80 + i)
+		}
+	}
+	codepages[name] = c
+}
+
+// LookupCodepage returns the code page with the given name
+func LookupCodepage(name string) (*Codepage, bool) {
+	c, ok := codepages[name]
+	return c, ok
+}
+
+// Codepages returns the names of the supported code pages
+func Codepages() []string {
+	names := make([]string, 0, len(codepages))
+	for name := range codepages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select returns the command selecting the code page
+func (c *Codepage) Select() []byte {
+	return []byte{ESC, 't', c.Table}
+}
+
+// Encode converts s to the code page. Characters the code page lacks are
+// transliterated (é to e, “ to ", € to EUR) or printed as '?'. Control
+// characters other than newline are dropped.
+func (c *Codepage) Encode(s string) []byte {
+	var buf bytes.Buffer
+	for _, r := range s {
+		if b, ok := c.encodeRune(r); ok {
+			if b >= 0x20 || b == '\n' {
+				buf.WriteByte(b)
+			}
+			continue
+		}
+		sub, ok := transliterations[r]
+		if !ok {
+			buf.WriteByte('?')
+			continue
+		}
+		for _, r := range sub {
+			if b, ok := c.encodeRune(r); ok {
+				buf.WriteByte(b)
+			} else {
+				buf.WriteByte('?')
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+func (c *Codepage) encodeRune(r rune) (byte, bool) {
+	if r < 0x80 {
+		return byte(r), true
+	}
+	b, ok := c.encode[r]
+	return b, ok
+}
+
+// transliterations maps characters to ASCII stand-ins, used when the
+// selected code page lacks them
+var transliterations = map[rune]string{
+	'\u00a0': " ", '\u00ad': "-",
+	'‘': "'", '’': "'", '‚': "'", '‛': "'", '′': "'",
+	'“': `"`, '”': `"`, '„': `"`, '″': `"`, '«': "<<", '»': ">>",
+	'‹': "<", '›': ">",
+	'‐': "-", '‑': "-", '‒': "-", '–': "-", '—': "-", '―': "-",
+	'…': "...", '•': "*", '·': ".", '×': "x", '÷': "/",
+	'©': "(C)", '®': "(R)", '™': "TM", '°': "o",
+	'€': "EUR", '£': "GBP", '¥': "JPY", '¢': "c",
+	// Indonesian text sometimes uses the generic rupee sign for rupiah
+	'₨': "Rp", '₹': "Rs",
+	'Æ': "AE", 'æ': "ae", 'Œ': "OE", 'œ': "oe", 'ß': "ss",
+	'Þ': "Th", 'þ': "th", 'Ð': "D", 'ð': "d",
+}
+
+func init() {
+	// Accented Latin letters fall back to the base letter
+	for base, accented := range map[rune]string{
+		'A': "ÀÁÂÃÄÅĀĂĄ", 'a': "àáâãäåāăą",
+		'C': "ÇĆĈĊČ", 'c': "çćĉċč",
+		'D': "ĎĐ", 'd': "ďđ",
+		'E': "ÈÉÊËĒĔĖĘĚ", 'e': "èéêëēĕėęě",
+		'G': "ĜĞĠĢ", 'g': "ĝğġģ",
+		'H': "ĤĦ", 'h': "ĥħ",
+		'I': "ÌÍÎÏĨĪĬĮİ", 'i': "ìíîïĩīĭįı",
+		'J': "Ĵ", 'j': "ĵ",
+		'K': "Ķ", 'k': "ķ",
+		'L': "ĹĻĽĿŁ", 'l': "ĺļľŀł",
+		'N': "ÑŃŅŇ", 'n': "ñńņň",
+		'O': "ÒÓÔÕÖØŌŎŐ", 'o': "òóôõöøōŏő",
+		'R': "ŔŖŘ", 'r': "ŕŗř",
+		'S': "ŚŜŞŠ", 's': "śŝşš",
+		'T': "ŢŤŦ", 't': "ţťŧ",
+		'U': "ÙÚÛÜŨŪŬŮŰŲ", 'u': "ùúûüũūŭůűų",
+		'W': "Ŵ", 'w': "ŵ",
+		'Y': "ÝŸŶ", 'y': "ýÿŷ",
+		'Z': "ŹŻŽ", 'z': "źżž",
+	} {
+		for _, r := range accented {
+			transliterations[r] = string(base)
+		}
+	}
+}
+
+// wrap splits encoded text into lines of at most width bytes, breaking at
+// spaces where possible. Each byte is one character on the printer.
+func wrap(text []byte, width int) [][]byte {
+	var lines [][]byte
+	for _, para := range bytes.Split(text, []byte{'\n'}) {
+		for len(para) > width {
+			cut := bytes.LastIndexByte(para[:width+1], ' ')
+			if cut <= 0 {
+				// A word longer than the line is split
+				lines = append(lines, para[:width])
+				para = para[width:]
+				continue
+			}
+			lines = append(lines, bytes.TrimRight(para[:cut], " "))
+			para = bytes.TrimLeft(para[cut+1:], " ")
+		}
+		lines = append(lines, para)
+	}
+	return lines
+}
+
+// Text sizes, in characters per line relative to Font A
+type textSize int
+
+const (
+	sizeNormal textSize = iota // Font A
+	sizeSmall                  // Font B
+	sizeDouble                 // Font A, double width and height
+)
+
+// ticketWriter writes text to a ticket in the ticket's code page, wrapped
+// to the paper
+type ticketWriter struct {
+	buf      *bytes.Buffer
+	codepage *Codepage
+	columns  int // Font A characters per line
+}
+
+// line writes s, wrapped to the characters per line of size, and ends
+// each line with a newline. The caller selects the font.
+func (w *ticketWriter) line(s string, size textSize) {
+	cols := w.columns
+	switch size {
+	case sizeSmall:
+		cols = w.columns * fontADots / fontBDots
+	case sizeDouble:
+		cols = w.columns / 2
+	}
+	if cols < 1 {
+		cols = 1
+	}
+	for _, l := range wrap(w.codepage.Encode(s), cols) {
+		w.buf.Write(l)
+		w.buf.WriteByte('\n')
+	}
+}
+
+// separator writes a dashed line across the paper
+func (w *ticketWriter) separator() {
+	w.buf.WriteString(strings.Repeat("-", w.columns) + "\n")
+}
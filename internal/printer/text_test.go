@@ -0,0 +1,109 @@
+package printer
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCodepageEncode(t *testing.T) {
+	tests := []struct {
+		codepage string
+		text     string
+		want     []byte
+	}{
+		{"pc437", "Antrian A001", []byte("Antrian A001")},
+		{"pc437", "café", []byte{'c', 'a', 'f', 0x82}},
+		{"pc850", "Ø", []byte{0x9D}},
+		{"pc437", "Ø", []byte("O")},
+		{"wpc1252", "€ 5", []byte{0x80, ' ', '5'}},
+		{"pc850", "€ 5", []byte("EUR 5")},
+		{"pc858", "€ 5", []byte{0xD5, ' ', '5'}},
+		{"pc437", "“Loket” — 1…", []byte(`"Loket" - 1...`)},
+		{"pc437", "Šiauliai", []byte("Siauliai")},
+		{"pc437", "₨ 5.000", []byte("Rp 5.000")},
+		{"pc437", "Œuvre", []byte("OEuvre")},
+		{"pc437", "日本", []byte("??")},
+		{"pc437", "a\tb\nc\x1bd", []byte("ab\ncd")},
+	}
+	for _, tt := range tests {
+		c, ok := LookupCodepage(tt.codepage)
+		if !ok {
+			t.Fatalf("code page %s not found", tt.codepage)
+		}
+		if got := c.Encode(tt.text); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s.Encode(%q) = %q, want %q", tt.codepage, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCodepages(t *testing.T) {
+	want := []string{"pc437", "pc850", "pc858", "wpc1252"}
+	if got := Codepages(); !slices.Equal(got, want) {
+		t.Errorf("Codepages() = %v, want %v", got, want)
+	}
+	c, _ := LookupCodepage("pc858")
+	if got := c.Select(); !bytes.Equal(got, []byte{ESC, 't', 19}) {
+		t.Errorf("Select() = % x", got)
+	}
+	if _, ok := LookupCodepage("utf8"); ok {
+		t.Error("LookupCodepage accepted an unknown code page")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		width int
+		want  []string
+	}{
+		{"fits", "Loket 1", 10, []string{"Loket 1"}},
+		{"exactly the width", "Loket 1234", 10, []string{"Loket 1234"}},
+		{"breaks at a space", "Silakan menunggu panggilan", 10, []string{"Silakan", "menunggu", "panggilan"}},
+		{"collapses spaces at the break", "Loket    satu", 6, []string{"Loket", "satu"}},
+		{"splits a long word", "Administrasi", 5, []string{"Admin", "istra", "si"}},
+		{"keeps newlines", "A001\nLoket 2", 10, []string{"A001", "Loket 2"}},
+		{"keeps empty lines", "A001\n\nTerima kasih", 20, []string{"A001", "", "Terima kasih"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, l := range wrap([]byte(tt.text), tt.width) {
+				got = append(got, string(l))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("wrap = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTicketWriterLine(t *testing.T) {
+	c, _ := LookupCodepage(DefaultCodepage)
+	text := strings.Repeat("x", 40)
+
+	tests := []struct {
+		name      string
+		columns   int
+		size      textSize
+		wantLines int
+	}{
+		{"normal on 80 mm", 48, sizeNormal, 1},
+		{"small on 80 mm", 48, sizeSmall, 1},
+		{"double on 80 mm", 48, sizeDouble, 2},
+		{"normal on 58 mm", 32, sizeNormal, 2},
+		{"small on 58 mm", 32, sizeSmall, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := &ticketWriter{buf: &buf, codepage: c, columns: tt.columns}
+			w.line(text, tt.size)
+			if got := strings.Count(buf.String(), "\n"); got != tt.wantLines {
+				t.Errorf("%d lines, want %d:\n%s", got, tt.wantLines, buf.String())
+			}
+		})
+	}
+}
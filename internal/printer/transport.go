@@ -0,0 +1,214 @@
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// Printer backends
+const (
+	BackendWindows = "windows" // winspool via PowerShell
+	BackendTCP     = "tcp"     // raw TCP, JetDirect port 9100
+	BackendCUPS    = "cups"    // lp -o raw
+	BackendDevice  = "device"  // character device such as /dev/usb/lp0
+	BackendFile    = "file"    // one .bin file per ticket, for testing
+	BackendPNG     = "png"     // one picture of the printout per ticket
+	BackendPDF     = "pdf"     // one PDF of the printout per ticket
+)
+
+// Backend defaults
+const (
+	defaultTCPPort    = "9100"
+	defaultDevicePath = "/dev/usb/lp0"
+	defaultDumpDir    = "print-dump"
+	tcpTimeout        = 5 * time.Second
+)
+
+// Transport delivers raw ESC/POS data to a printer
+type Transport interface {
+	Send(data []byte) error
+	// String describes the backend and target, for logs and test prints
+	String() string
+}
+
+// imageSender is implemented by transports that save a picture of the
+// printout, which needs the paper width the commands were written for
+type imageSender interface {
+	SendImage(data []byte, paperWidth int) error
+}
+
+// DefaultBackend returns the backend used when none is configured: the
+// Windows spooler on Windows, CUPS elsewhere.
+func DefaultBackend() string {
+	if runtime.GOOS == "windows" {
+		return BackendWindows
+	}
+	return BackendCUPS
+}
+
+// NewTransport returns the transport selected by config.Backend.
+func NewTransport(config PrinterConfig) (Transport, error) {
+	backend := config.Backend
+	if backend == "" {
+		backend = DefaultBackend()
+	}
+	name := config.PrinterName
+	if config.Address != "" {
+		name = config.Address
+	}
+
+	switch backend {
+	case BackendWindows:
+		if name == "" {
+			name = "ECO80"
+		}
+		return &windowsTransport{printerName: name}, nil
+	case BackendTCP:
+		if config.Address == "" {
+			return nil, fmt.Errorf("printer backend tcp needs an address")
+		}
+		addr := config.Address
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, defaultTCPPort)
+		}
+		return &tcpTransport{addr: addr}, nil
+	case BackendCUPS:
+		return &cupsTransport{printerName: name}, nil
+	case BackendDevice:
+		path := config.Address
+		if path == "" {
+			path = defaultDevicePath
+		}
+		return &deviceTransport{path: path}, nil
+	case BackendFile, BackendPNG, BackendPDF:
+		dir := config.Address
+		if dir == "" {
+			dir = defaultDumpDir
+		}
+		return &fileTransport{dir: dir, format: backend}, nil
+	}
+	return nil, fmt.Errorf("unknown printer backend %q", backend)
+}
+
+// tcpTransport sends to a network printer's raw port
+type tcpTransport struct {
+	addr string
+}
+
+func (t *tcpTransport) String() string {
+	return BackendTCP + ":" + t.addr
+}
+
+func (t *tcpTransport) Send(data []byte) error {
+	conn, err := net.DialTimeout("tcp", t.addr, tcpTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to printer %s: %w", t.addr, err)
+	}
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Now().Add(tcpTimeout))
+	if _, err := conn.Write(data); err != nil {
+		return fmt.Errorf("failed to send to printer %s: %w", t.addr, err)
+	}
+	return nil
+}
+
+// cupsTransport submits a raw job to a CUPS queue with lp. An empty
+// printer name uses the CUPS default printer.
+type cupsTransport struct {
+	printerName string
+}
+
+func (t *cupsTransport) String() string {
+	if t.printerName == "" {
+		return BackendCUPS + ":(default)"
+	}
+	return BackendCUPS + ":" + t.printerName
+}
+
+func (t *cupsTransport) Send(data []byte) error {
+	args := []string{"-o", "raw"}
+	if t.printerName != "" {
+		args = append(args, "-d", t.printerName)
+	}
+	cmd := exec.Command("lp", args...)
+	cmd.Stdin = bytes.NewReader(data)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("lp failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// deviceTransport writes to a printer device file
+type deviceTransport struct {
+	path string
+}
+
+func (t *deviceTransport) String() string {
+	return BackendDevice + ":" + t.path
+}
+
+func (t *deviceTransport) Send(data []byte) error {
+	f, err := os.OpenFile(t.path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open printer device: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write to printer device: %w", err)
+	}
+	return f.Close()
+}
+
+// fileTransport writes each ticket to its own file in a directory, so
+// output can be inspected without a printer: the raw commands (file), or
+// the printout rendered by RenderImage (png, pdf)
+type fileTransport struct {
+	dir    string
+	format string // BackendFile, BackendPNG or BackendPDF
+}
+
+func (t *fileTransport) String() string {
+	return t.format + ":" + t.dir
+}
+
+func (t *fileTransport) Send(data []byte) error {
+	return t.SendImage(data, Paper80mmDots)
+}
+
+func (t *fileTransport) SendImage(data []byte, paperWidth int) error {
+	ext := "bin"
+	if t.format != BackendFile {
+		img, err := RenderImage(data, paperWidth)
+		if err != nil {
+			return fmt.Errorf("failed to render ticket: %w", err)
+		}
+		var buf bytes.Buffer
+		if t.format == BackendPDF {
+			err = WritePDF(&buf, img)
+		} else {
+			err = png.Encode(&buf, img)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode ticket: %w", err)
+		}
+		data, ext = buf.Bytes(), t.format
+	}
+
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create dump directory: %w", err)
+	}
+	path := filepath.Join(t.dir, fmt.Sprintf("ticket_%d.%s", time.Now().UnixNano(), ext))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write print dump: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package printer
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewTransport(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  PrinterConfig
+		want    string
+		wantErr bool
+	}{
+		{"windows default printer", PrinterConfig{Backend: BackendWindows}, "windows:ECO80", false},
+		{"windows named printer", PrinterConfig{Backend: BackendWindows, PrinterName: "POS-80"}, "windows:POS-80", false},
+		{"tcp with port", PrinterConfig{Backend: BackendTCP, Address: "10.0.0.5:9101"}, "tcp:10.0.0.5:9101", false},
+		{"tcp default port", PrinterConfig{Backend: BackendTCP, Address: "10.0.0.5"}, "tcp:10.0.0.5:9100", false},
+		{"tcp without address", PrinterConfig{Backend: BackendTCP}, "", true},
+		{"cups default printer", PrinterConfig{Backend: BackendCUPS}, "cups:(default)", false},
+		{"cups named printer", PrinterConfig{Backend: BackendCUPS, PrinterName: "thermal"}, "cups:thermal", false},
+		{"device default path", PrinterConfig{Backend: BackendDevice}, "device:/dev/usb/lp0", false},
+		{"device path", PrinterConfig{Backend: BackendDevice, Address: "/dev/usb/lp1"}, "device:/dev/usb/lp1", false},
+		{"file default directory", PrinterConfig{Backend: BackendFile}, "file:print-dump", false},
+		{"png directory", PrinterConfig{Backend: BackendPNG, Address: "previews"}, "png:previews", false},
+		{"pdf default directory", PrinterConfig{Backend: BackendPDF}, "pdf:print-dump", false},
+		{"unknown backend", PrinterConfig{Backend: "serial"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, err := NewTransport(tt.config)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("NewTransport returned %s, want an error", transport)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewTransport: %v", err)
+			}
+			if got := transport.String(); got != tt.want {
+				t.Errorf("transport = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTCPTransportSend(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	transport, err := NewTransport(PrinterConfig{Backend: BackendTCP, Address: ln.Addr().String()})
+	if err != nil {
+		t.Fatalf("NewTransport: %v", err)
+	}
+	data := []byte{ESC, '@', 'A', '0', '0', '1'}
+	if err := transport.Send(data); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := <-received; !bytes.Equal(got, data) {
+		t.Errorf("printer received % x, want % x", got, data)
+	}
+}
+
+func TestFileTransportSend(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dump")
+	transport, err := NewTransport(PrinterConfig{Backend: BackendFile, Address: dir})
+	if err != nil {
+		t.Fatalf("NewTransport: %v", err)
+	}
+	data := []byte("A001\n")
+	if err := transport.Send(data); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "ticket_*.bin"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("dump files %v, want one", files)
+	}
+	if got, _ := os.ReadFile(files[0]); !bytes.Equal(got, data) {
+		t.Errorf("dump holds %q, want %q", got, data)
+	}
+}
+
+func TestImageTransportSend(t *testing.T) {
+	tests := []struct {
+		backend string
+		magic   string
+	}{
+		{BackendPNG, "\x89PNG"},
+		{BackendPDF, "%PDF-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			dir := t.TempDir()
+			p := New(PrinterConfig{Enabled: true, Backend: tt.backend, Address: dir})
+			if err := p.PrintTicket(TicketData{QueueNumber: "A001"}, DefaultTemplate()); err != nil {
+				t.Fatalf("PrintTicket: %v", err)
+			}
+			files, _ := filepath.Glob(filepath.Join(dir, "ticket_*."+tt.backend))
+			if len(files) != 1 {
+				t.Fatalf("dump files %v, want one", files)
+			}
+			if got, _ := os.ReadFile(files[0]); !bytes.HasPrefix(got, []byte(tt.magic)) {
+				t.Errorf("dump starts with %q, want %q", got[:min(len(got), 8)], tt.magic)
+			}
+		})
+	}
+}
+
+func TestDeviceTransportSend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lp0")
+	transport, err := NewTransport(PrinterConfig{Backend: BackendDevice, Address: path})
+	if err != nil {
+		t.Fatalf("NewTransport: %v", err)
+	}
+	if err := transport.Send([]byte("A001")); err == nil {
+		t.Error("Send succeeded with no device present")
+	}
+
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := transport.Send([]byte("A001")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "A001" {
+		t.Errorf("device received %q, want A001", got)
+	}
+}
@@ -0,0 +1,172 @@
+package printer
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// windowsTransport sends raw data to a Windows printer through winspool,
+// driven from PowerShell.
+type windowsTransport struct {
+	printerName string
+}
+
+func (t *windowsTransport) String() string {
+	return BackendWindows + ":" + t.printerName
+}
+
+// Send writes data to a temp file and has PowerShell pass it to the
+// printer as a RAW job
+func (t *windowsTransport) Send(data []byte) error {
+	printerName := t.printerName
+
+	// Create temp file with raw print data
+	tempDir := os.TempDir()
+	tempFile := filepath.Join(tempDir, fmt.Sprintf("ticket_%d.bin", time.Now().UnixNano()))
+
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	defer os.Remove(tempFile)
+
+	// Use PowerShell to send raw data to printer
+	// This is the most reliable method for Windows
+	psScript := fmt.Sprintf(`
+$printerName = '%s'
+$filePath = '%s'
+
+# Get printer
+$printer = Get-WmiObject -Query "SELECT * FROM Win32_Printer WHERE Name='$printerName'" -ErrorAction SilentlyContinue
+
+if ($printer -eq $null) {
+    # Try without exact match
+    $printer = Get-WmiObject -Query "SELECT * FROM Win32_Printer WHERE Name LIKE '%%$printerName%%'" -ErrorAction SilentlyContinue
+}
+
+if ($printer -eq $null) {
+    Write-Error "Printer '$printerName' not found"
+    exit 1
+}
+
+# Get printer port
+$portName = $printer.PortName
+
+# Read file content as bytes
+$bytes = [System.IO.File]::ReadAllBytes($filePath)
+
+# Try direct port write first (works for USB printers)
+try {
+    $port = [System.IO.Ports.SerialPort]::GetPortNames() | Where-Object { $_ -eq $portName }
+    if ($port) {
+        $serialPort = New-Object System.IO.Ports.SerialPort $portName, 9600
+        $serialPort.Open()
+        $serialPort.Write($bytes, 0, $bytes.Length)
+        $serialPort.Close()
+        exit 0
+    }
+} catch {}
+
+# Fallback: Use raw print job via .NET
+Add-Type -AssemblyName System.Drawing
+
+$doc = New-Object System.Drawing.Printing.PrintDocument
+$doc.PrinterSettings.PrinterName = $printerName
+
+# For raw printing, we use RawPrinterHelper
+$helper = @"
+using System;
+using System.Runtime.InteropServices;
+
+public class RawPrinterHelper
+{
+    [StructLayout(LayoutKind.Sequential, CharSet = CharSet.Ansi)]
+    public class DOCINFOA
+    {
+        [MarshalAs(UnmanagedType.LPStr)] public string pDocName;
+        [MarshalAs(UnmanagedType.LPStr)] public string pOutputFile;
+        [MarshalAs(UnmanagedType.LPStr)] public string pDataType;
+    }
+
+    [DllImport("winspool.Drv", EntryPoint = "OpenPrinterA", CharSet = CharSet.Ansi, SetLastError = true)]
+    public static extern bool OpenPrinter([MarshalAs(UnmanagedType.LPStr)] string szPrinter, out IntPtr hPrinter, IntPtr pd);
+
+    [DllImport("winspool.Drv", EntryPoint = "ClosePrinter", SetLastError = true)]
+    public static extern bool ClosePrinter(IntPtr hPrinter);
+
+    [DllImport("winspool.Drv", EntryPoint = "StartDocPrinterA", CharSet = CharSet.Ansi, SetLastError = true)]
+    public static extern bool StartDocPrinter(IntPtr hPrinter, Int32 level, [In, MarshalAs(UnmanagedType.LPStruct)] DOCINFOA di);
+
+    [DllImport("winspool.Drv", EntryPoint = "EndDocPrinter", SetLastError = true)]
+    public static extern bool EndDocPrinter(IntPtr hPrinter);
+
+    [DllImport("winspool.Drv", EntryPoint = "StartPagePrinter", SetLastError = true)]
+    public static extern bool StartPagePrinter(IntPtr hPrinter);
+
+    [DllImport("winspool.Drv", EntryPoint = "EndPagePrinter", SetLastError = true)]
+    public static extern bool EndPagePrinter(IntPtr hPrinter);
+
+    [DllImport("winspool.Drv", EntryPoint = "WritePrinter", SetLastError = true)]
+    public static extern bool WritePrinter(IntPtr hPrinter, IntPtr pBytes, Int32 dwCount, out Int32 dwWritten);
+
+    public static bool SendBytesToPrinter(string szPrinterName, byte[] bytes)
+    {
+        IntPtr hPrinter = IntPtr.Zero;
+        DOCINFOA di = new DOCINFOA();
+        di.pDocName = "Queue Ticket";
+        di.pDataType = "RAW";
+
+        if (OpenPrinter(szPrinterName.Normalize(), out hPrinter, IntPtr.Zero))
+        {
+            if (StartDocPrinter(hPrinter, 1, di))
+            {
+                if (StartPagePrinter(hPrinter))
+                {
+                    IntPtr pUnmanagedBytes = Marshal.AllocCoTaskMem(bytes.Length);
+                    Marshal.Copy(bytes, 0, pUnmanagedBytes, bytes.Length);
+                    int dwWritten;
+                    WritePrinter(hPrinter, pUnmanagedBytes, bytes.Length, out dwWritten);
+                    Marshal.FreeCoTaskMem(pUnmanagedBytes);
+                    EndPagePrinter(hPrinter);
+                }
+                EndDocPrinter(hPrinter);
+            }
+            ClosePrinter(hPrinter);
+            return true;
+        }
+        return false;
+    }
+}
+"@
+
+Add-Type -TypeDefinition $helper -Language CSharp -ErrorAction SilentlyContinue
+
+[RawPrinterHelper]::SendBytesToPrinter($printerName, $bytes)
+`, printerName, escapeForPS(tempFile))
+
+	cmd := exec.Command("powershell", "-NoProfile", "-ExecutionPolicy", "Bypass", "-Command", psScript)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("print failed: %v, output: %s", err, string(output))
+	}
+
+	return nil
+}
+
+// escapeForPS escapes a string for use in PowerShell
+func escapeForPS(s string) string {
+	// Replace backslashes for PowerShell path
+	result := ""
+	for _, c := range s {
+		if c == '\\' {
+			result += "\\\\"
+		} else if c == '\'' {
+			result += "''"
+		} else {
+			result += string(c)
+		}
+	}
+	return result
+}
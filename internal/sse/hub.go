@@ -15,6 +15,8 @@ const (
 	ClientTypeDisplay ClientType = iota
 	ClientTypeCounter
 	ClientTypePrinter
+	ClientTypeTicket
+	ClientTypeAdmin
 )
 
 type Client struct {
@@ -23,12 +25,16 @@ type Client struct {
 	CounterID  int64
 	ClientType ClientType
 	AgentID    string
+	Group      string
+	QueueID    int64
 }
 
 type Hub struct {
 	displayClients  map[string]*Client
 	counterClients  map[int64]map[string]*Client
 	printerClients  map[string]*Client
+	ticketClients   map[int64]map[string]*Client
+	adminClients    map[string]*Client
 	mu              sync.RWMutex
 	register        chan *Client
 	unregister      chan *Client
@@ -39,6 +45,8 @@ func NewHub() *Hub {
 		displayClients: make(map[string]*Client),
 		counterClients: make(map[int64]map[string]*Client),
 		printerClients: make(map[string]*Client),
+		ticketClients:  make(map[int64]map[string]*Client),
+		adminClients:   make(map[string]*Client),
 		register:       make(chan *Client),
 		unregister:     make(chan *Client),
 	}
@@ -59,11 +67,18 @@ func (h *Hub) run() {
 					h.counterClients[client.CounterID] = make(map[string]*Client)
 				}
 				h.counterClients[client.CounterID][client.ID] = client
+			case ClientTypeTicket:
+				if h.ticketClients[client.QueueID] == nil {
+					h.ticketClients[client.QueueID] = make(map[string]*Client)
+				}
+				h.ticketClients[client.QueueID][client.ID] = client
+			case ClientTypeAdmin:
+				h.adminClients[client.ID] = client
 			default:
 				h.displayClients[client.ID] = client
 			}
 			h.mu.Unlock()
-			log.Printf("SSE client connected: %s (type: %d, agent: %s)", client.ID, client.ClientType, client.AgentID)
+			log.Printf("SSE client connected: %s (type: %d, agent: %s, group: %s)", client.ID, client.ClientType, client.AgentID, client.Group)
 
 		case client := <-h.unregister:
 			h.mu.Lock()
@@ -80,6 +95,21 @@ func (h *Hub) run() {
 						close(client.Channel)
 					}
 				}
+			case ClientTypeTicket:
+				if clients, ok := h.ticketClients[client.QueueID]; ok {
+					if _, ok := clients[client.ID]; ok {
+						delete(clients, client.ID)
+						close(client.Channel)
+					}
+					if len(clients) == 0 {
+						delete(h.ticketClients, client.QueueID)
+					}
+				}
+			case ClientTypeAdmin:
+				if _, ok := h.adminClients[client.ID]; ok {
+					delete(h.adminClients, client.ID)
+					close(client.Channel)
+				}
 			default:
 				if _, ok := h.displayClients[client.ID]; ok {
 					delete(h.displayClients, client.ID)
@@ -168,15 +198,44 @@ func (h *Hub) BroadcastAllCounters(eventType string, data interface{}) {
 	}
 }
 
+// BroadcastAdmin sends an event to the open admin panels
+func (h *Hub) BroadcastAdmin(eventType string, data interface{}) {
+	event := map[string]interface{}{
+		"type": eventType,
+		"data": data,
+	}
+
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling SSE admin data: %v", err)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, client := range h.adminClients {
+		select {
+		case client.Channel <- jsonData:
+		default:
+			log.Printf("SSE admin client buffer full: %s", client.ID)
+		}
+	}
+}
+
+func (h *Hub) ServeAdminSSE(w http.ResponseWriter, r *http.Request) {
+	h.serveSSE(w, r, ClientTypeAdmin, 0)
+}
+
 func (h *Hub) ServeDisplaySSE(w http.ResponseWriter, r *http.Request) {
-	h.serveSSE(w, r, 0)
+	h.serveSSE(w, r, ClientTypeDisplay, 0)
 }
 
 func (h *Hub) ServeCounterSSE(w http.ResponseWriter, r *http.Request, counterID int64) {
-	h.serveSSE(w, r, counterID)
+	h.serveSSE(w, r, ClientTypeCounter, counterID)
 }
 
-func (h *Hub) serveSSE(w http.ResponseWriter, r *http.Request, counterID int64) {
+func (h *Hub) serveSSE(w http.ResponseWriter, r *http.Request, clientType ClientType, counterID int64) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "SSE not supported", http.StatusInternalServerError)
@@ -190,9 +249,10 @@ func (h *Hub) serveSSE(w http.ResponseWriter, r *http.Request, counterID int64)
 
 	clientID := fmt.Sprintf("%d-%d", time.Now().UnixNano(), counterID)
 	client := &Client{
-		ID:        clientID,
-		Channel:   make(chan []byte, 100),
-		CounterID: counterID,
+		ID:         clientID,
+		Channel:    make(chan []byte, 100),
+		CounterID:  counterID,
+		ClientType: clientType,
 	}
 
 	h.register <- client
@@ -229,6 +289,12 @@ func (h *Hub) GetDisplayClientCount() int {
 	return len(h.displayClients)
 }
 
+func (h *Hub) GetAdminClientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.adminClients)
+}
+
 func (h *Hub) GetCounterClientCount(counterID int64) int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -263,8 +329,39 @@ func (h *Hub) BroadcastPrinters(eventType string, data interface{}) {
 	}
 }
 
-// ServePrinterSSE serves SSE connection for print agent clients
-func (h *Hub) ServePrinterSSE(w http.ResponseWriter, r *http.Request, agentID string) {
+// BroadcastPrinterTarget sends an event to the printer agents a print job
+// is routed to: the agent whose ID is target, or the agents in the group
+// named target. An empty target reaches all of them.
+func (h *Hub) BroadcastPrinterTarget(target, eventType string, data interface{}) {
+	event := map[string]interface{}{
+		"type": eventType,
+		"data": data,
+	}
+
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling SSE printer data: %v", err)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, client := range h.printerClients {
+		if target != "" && client.AgentID != target && client.Group != target {
+			continue
+		}
+		select {
+		case client.Channel <- jsonData:
+		default:
+			log.Printf("SSE printer client buffer full: %s", client.ID)
+		}
+	}
+}
+
+// ServePrinterSSE serves SSE connection for print agent clients. group is
+// the printer group the agent belongs to, if any.
+func (h *Hub) ServePrinterSSE(w http.ResponseWriter, r *http.Request, agentID, group string) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "SSE not supported", http.StatusInternalServerError)
@@ -282,6 +379,7 @@ func (h *Hub) ServePrinterSSE(w http.ResponseWriter, r *http.Request, agentID st
 		Channel:    make(chan []byte, 100),
 		ClientType: ClientTypePrinter,
 		AgentID:    agentID,
+		Group:      group,
 	}
 
 	h.register <- client
@@ -315,3 +413,109 @@ func (h *Hub) GetPrinterClientCount() int {
 	defer h.mu.RUnlock()
 	return len(h.printerClients)
 }
+
+// PrinterAgentConnected reports whether the agent has an SSE connection open
+func (h *Hub) PrinterAgentConnected(agentID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, client := range h.printerClients {
+		if client.AgentID == agentID {
+			return true
+		}
+	}
+	return false
+}
+
+// BroadcastTicket sends an event to the status pages open for a ticket
+func (h *Hub) BroadcastTicket(queueID int64, eventType string, data interface{}) {
+	event := map[string]interface{}{
+		"type": eventType,
+		"data": data,
+	}
+
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling SSE ticket data: %v", err)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, client := range h.ticketClients[queueID] {
+		select {
+		case client.Channel <- jsonData:
+		default:
+			log.Printf("SSE ticket client buffer full: %s", client.ID)
+		}
+	}
+}
+
+// TicketQueueIDs returns the tickets that have a status page connected
+func (h *Hub) TicketQueueIDs() []int64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]int64, 0, len(h.ticketClients))
+	for id := range h.ticketClients {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// ServeTicketSSE serves SSE connection for a ticket's status page. initial
+// is sent as the first message, so a page that reconnects is brought up to
+// date.
+func (h *Hub) ServeTicketSSE(w http.ResponseWriter, r *http.Request, queueID int64, eventType string, initial interface{}) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "SSE not supported", http.StatusInternalServerError)
+		return
+	}
+
+	initialData, err := json.Marshal(map[string]interface{}{
+		"type": eventType,
+		"data": initial,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode ticket status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	clientID := fmt.Sprintf("ticket-%d-%d", queueID, time.Now().UnixNano())
+	client := &Client{
+		ID:         clientID,
+		Channel:    make(chan []byte, 100),
+		ClientType: ClientTypeTicket,
+		QueueID:    queueID,
+	}
+
+	h.register <- client
+
+	defer func() {
+		h.unregister <- client
+	}()
+
+	fmt.Fprintf(w, "event: connected\ndata: {\"client_id\":\"%s\"}\n\n", clientID)
+	fmt.Fprintf(w, "event: message\ndata: %s\n\n", initialData)
+	flusher.Flush()
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprintf(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case data := <-client.Channel:
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
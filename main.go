@@ -12,6 +12,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -34,6 +35,11 @@ var jsFS embed.FS
 var webFS embed.FS
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	configPath := flag.String("config", "config.yaml", "Path to config file")
 	flag.Parse()
 
@@ -141,13 +147,56 @@ func main() {
 				}
 			}
 
-			// Cleanup old print jobs (completed/failed older than 24 hours)
+			// Cleanup old print jobs (completed or dismissed, older than 24 hours)
 			affected, err := db.CleanupOldPrintJobs(24)
 			if err != nil {
 				log.Printf("Failed to cleanup old print jobs: %v", err)
 			} else if affected > 0 {
 				log.Printf("Cleaned up %d old print jobs", affected)
 			}
+
+			// Number blocks leased to print agents, a week after their day
+			affected, err = db.CleanupOldNumberBlocks(7)
+			if err != nil {
+				log.Printf("Failed to cleanup old number blocks: %v", err)
+			} else if affected > 0 {
+				log.Printf("Cleaned up %d old number blocks", affected)
+			}
+		}
+	}()
+
+	// Take back print jobs with an expired lease and retry failed ones
+	go func() {
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			h.RecoverPrintJobs()
+		}
+	}()
+
+	// Watch print agent heartbeats and alert admins when one drops
+	go func() {
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			h.CheckPrintAgents()
+		}
+	}()
+
+	// Sweep expired sessions
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			affected, err := db.DeleteExpiredSessions()
+			if err != nil {
+				log.Printf("Failed to delete expired sessions: %v", err)
+			} else if affected > 0 {
+				log.Printf("Removed %d expired sessions", affected)
+			}
 		}
 	}()
 
@@ -186,6 +235,88 @@ func openBrowser(url string) {
 	}
 }
 
+// runMigrate implements "queue-system migrate [-config path] status|up|down [n]".
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "Path to config file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: queue-system migrate [-config path] status|up|down [n]")
+		fmt.Fprintln(fs.Output(), "  status   list migrations and whether they are applied")
+		fmt.Fprintln(fs.Output(), "  up       apply all pending migrations")
+		fmt.Fprintln(fs.Output(), "  down [n] roll back the last n migrations (default 1)")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Printf("Warning: Failed to load config from %s: %v", *configPath, err)
+		log.Println("Using default configuration")
+		cfg = config.DefaultConfig()
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	switch fs.Arg(0) {
+	case "status":
+		status, err := db.MigrationStatus()
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		current, _ := db.SchemaVersion()
+		fmt.Printf("Database: %s\n", cfg.Database.Path)
+		fmt.Printf("Schema version: %d (binary supports %d)\n\n", current, database.LatestSchemaVersion())
+		for _, m := range status {
+			state := "pending"
+			if m.Applied {
+				state = "applied " + m.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("  %04d  %-24s %s\n", m.Version, m.Name, state)
+		}
+		if current > database.LatestSchemaVersion() {
+			fmt.Println("\nWarning: the database is newer than this binary.")
+		}
+
+	case "up":
+		applied, err := db.MigrateUp()
+		for _, version := range applied {
+			fmt.Printf("Applied migration %04d\n", version)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date.")
+		}
+
+	case "down":
+		steps := 1
+		if n := fs.Arg(1); n != "" {
+			if steps, err = strconv.Atoi(n); err != nil || steps < 1 {
+				log.Fatalf("Invalid number of migrations: %s", n)
+			}
+		}
+		reverted, err := db.MigrateDown(steps)
+		for _, version := range reverted {
+			fmt.Printf("Rolled back migration %04d\n", version)
+		}
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No migrations to roll back.")
+		}
+
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
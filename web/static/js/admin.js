@@ -13,7 +13,9 @@ const pageTitles = {
     'display-settings': 'Pengaturan Display',
     'ticket-settings': 'Pengaturan Tiket',
     'system-settings': 'Pengaturan Sistem',
-    'reports': 'Laporan & Statistik'
+    'users': 'Pengguna',
+    'reports': 'Laporan & Statistik',
+    'audit': 'Audit Log'
 };
 
 // Show specific page
@@ -116,6 +118,14 @@ document.addEventListener('DOMContentLoaded', function() {
     loadCounters();
     loadQueues();
     loadSettings();
+    loadUsers();
+    loadSessions();
+    loadTokens();
+    loadAuditLog();
+    loadPrinterStatus();
+    loadPrintAgents();
+    loadFailedPrintJobs();
+    connectAdminSSE();
 
     // Restore sidebar and page state
     restoreSidebarState();
@@ -177,10 +187,14 @@ async function loadStats() {
 }
 
 // Load queue types
+// Queue types as last loaded, used for the journey step selects
+let queueTypesCache = [];
+
 async function loadQueueTypes() {
     try {
         const response = await fetch('/api/queue-types');
         const types = await response.json();
+        queueTypesCache = types;
 
         const container = document.getElementById('queue-types-list');
 
@@ -195,6 +209,7 @@ async function loadQueueTypes() {
                 <div class="queue-type-info">
                     <h3>${type.name}</h3>
                     <p>Kode: ${type.code}</p>
+                    ${type.steps ? `<p class="journey-summary">Alur: ${type.steps.map(s => s.name).join(' → ')}</p>` : ''}
                 </div>
                 <span class="queue-type-status ${type.is_active ? 'active' : 'inactive'}">
                     ${type.is_active ? 'Aktif' : 'Nonaktif'}
@@ -333,12 +348,13 @@ async function loadQueues() {
                 'waiting': 'Menunggu',
                 'called': 'Dipanggil',
                 'completed': 'Selesai',
-                'cancelled': 'Dibatalkan'
+                'cancelled': 'Dibatalkan',
+                'no_show': 'Tidak Hadir'
             }[queue.status] || queue.status;
 
             return `
                 <tr>
-                    <td><strong>${queue.queue_number}</strong></td>
+                    <td><strong>${queue.queue_number}</strong>${queue.priority > 0 ? '<span class="status-badge priority-badge">Prioritas</span>' : ''}</td>
                     <td>${queue.queue_type}</td>
                     <td><span class="status-badge ${statusClass}">${statusText}</span></td>
                     <td>${queue.counter_id ? `Loket ${queue.counter_id}` : '-'}</td>
@@ -449,6 +465,7 @@ async function showEditQueueTypeModal(id) {
         document.getElementById('edit-queue-type-name').value = type.name;
         document.getElementById('edit-queue-type-prefix').value = type.prefix;
         document.getElementById('edit-queue-type-active').checked = type.is_active;
+        renderJourneySteps(type.steps || []);
 
         document.getElementById('edit-queue-type-modal').classList.add('show');
     } catch (error) {
@@ -492,16 +509,18 @@ async function updateQueueType(event) {
     const name = document.getElementById('edit-queue-type-name').value;
     const prefix = document.getElementById('edit-queue-type-prefix').value.toUpperCase();
     const isActive = document.getElementById('edit-queue-type-active').checked;
+    const steps = collectJourneySteps();
 
     try {
         const response = await fetch(`/api/queue-type/${id}`, {
             method: 'PUT',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ name, prefix, is_active: isActive, sort_order: 0 })
+            body: JSON.stringify({ name, prefix, is_active: isActive, sort_order: 0, steps })
         });
 
         if (!response.ok) {
-            throw new Error('Failed to update queue type');
+            const data = await response.json().catch(() => ({}));
+            throw new Error(data.error || 'Failed to update queue type');
         }
 
         closeModal('edit-queue-type-modal');
@@ -509,8 +528,53 @@ async function updateQueueType(event) {
         loadQueueTypesFilter();
     } catch (error) {
         console.error('Failed to update queue type:', error);
-        alert('Gagal mengupdate jenis antrian.');
+        alert('Gagal mengupdate jenis antrian: ' + error.message);
+    }
+}
+
+// Journey step editor in the edit queue type modal
+function renderJourneySteps(steps) {
+    const container = document.getElementById('journey-steps');
+    container.innerHTML = '';
+    steps.forEach(step => addJourneyStep(step));
+}
+
+function addJourneyStep(step = {}) {
+    const container = document.getElementById('journey-steps');
+    const row = document.createElement('div');
+    row.className = 'journey-step';
+    row.innerHTML = `
+        <span class="journey-step-no"></span>
+        <input type="text" class="journey-step-name" placeholder="Nama langkah" required>
+        <select class="journey-step-type filter-input">
+            ${queueTypesCache.map(t => `<option value="${t.code}">${t.prefix} - ${t.name}</option>`).join('')}
+        </select>
+        <button type="button" class="btn btn-sm btn-danger" onclick="removeJourneyStep(this)">&times;</button>
+    `;
+    row.querySelector('.journey-step-name').value = step.name || '';
+    if (step.queue_type) {
+        row.querySelector('.journey-step-type').value = step.queue_type;
     }
+    container.appendChild(row);
+    numberJourneySteps();
+}
+
+function removeJourneyStep(button) {
+    button.closest('.journey-step').remove();
+    numberJourneySteps();
+}
+
+function numberJourneySteps() {
+    document.querySelectorAll('#journey-steps .journey-step-no').forEach((el, i) => {
+        el.textContent = i + 1;
+    });
+}
+
+function collectJourneySteps() {
+    return Array.from(document.querySelectorAll('#journey-steps .journey-step')).map(row => ({
+        name: row.querySelector('.journey-step-name').value.trim(),
+        queue_type: row.querySelector('.journey-step-type').value
+    }));
 }
 
 // Delete queue type
@@ -638,6 +702,8 @@ async function showEditCounterModal(id) {
         document.getElementById('edit-counter-number').value = counter.counter_number;
         document.getElementById('edit-counter-name').value = counter.counter_name;
         document.getElementById('edit-counter-active').checked = counter.is_active;
+        document.getElementById('edit-counter-routing').value = counter.routing_mode || 'strict';
+        renderCounterServices(counter.services || []);
 
         showModal('edit-counter-modal');
     } catch (error) {
@@ -667,12 +733,15 @@ async function updateCounter(event) {
             },
             body: JSON.stringify({
                 counter_name: counterName,
-                is_active: isActive
+                is_active: isActive,
+                routing_mode: document.getElementById('edit-counter-routing').value,
+                services: collectCounterServices()
             })
         });
 
         if (!response.ok) {
-            throw new Error('Failed to update counter');
+            const data = await response.json().catch(() => ({}));
+            throw new Error(data.error || 'Failed to update counter');
         }
 
         closeModal('edit-counter-modal');
@@ -680,8 +749,61 @@ async function updateCounter(event) {
         loadStats();
     } catch (error) {
         console.error('Failed to update counter:', error);
-        alert('Gagal memperbarui loket.');
+        alert('Gagal memperbarui loket: ' + error.message);
+    }
+}
+
+// Queue types served by a counter, in the edit counter modal
+function renderCounterServices(services) {
+    document.getElementById('counter-services').innerHTML = '';
+    services.forEach(service => addCounterService(service));
+    toggleServiceWeights();
+}
+
+function addCounterService(service = {}) {
+    const container = document.getElementById('counter-services');
+    const row = document.createElement('div');
+    row.className = 'journey-step';
+    row.innerHTML = `
+        <span class="journey-step-no"></span>
+        <select class="journey-step-type filter-input">
+            ${queueTypesCache.map(t => `<option value="${t.code}">${t.prefix} - ${t.name}</option>`).join('')}
+        </select>
+        <input type="number" class="service-weight" min="1" value="1" title="Bobot">
+        <button type="button" class="btn btn-sm btn-danger" onclick="removeCounterService(this)">&times;</button>
+    `;
+    if (service.queue_type) {
+        row.querySelector('.journey-step-type').value = service.queue_type;
     }
+    row.querySelector('.service-weight').value = service.weight || 1;
+    container.appendChild(row);
+    numberCounterServices();
+    toggleServiceWeights();
+}
+
+function removeCounterService(button) {
+    button.closest('.journey-step').remove();
+    numberCounterServices();
+}
+
+function numberCounterServices() {
+    document.querySelectorAll('#counter-services .journey-step-no').forEach((el, i) => {
+        el.textContent = i + 1;
+    });
+}
+
+function toggleServiceWeights() {
+    const weighted = document.getElementById('edit-counter-routing').value === 'weighted';
+    document.querySelectorAll('#counter-services .service-weight').forEach(el => {
+        el.style.display = weighted ? '' : 'none';
+    });
+}
+
+function collectCounterServices() {
+    return Array.from(document.querySelectorAll('#counter-services .journey-step')).map(row => ({
+        queue_type: row.querySelector('.journey-step-type').value,
+        weight: parseInt(row.querySelector('.service-weight').value, 10) || 1
+    }));
 }
 
 // Confirm delete from edit modal
@@ -844,102 +966,250 @@ async function resetQueues() {
 // Ticket Design Functions
 // ===================================
 
+// Blocks of the ticket layout being edited
+let layoutBlocks = [];
+
+const layoutBlockLabels = {
+    text: 'Teks',
+    variable: 'Data tiket',
+    separator: 'Garis pemisah',
+    qr: 'QR code',
+    barcode: 'Barcode',
+    image: 'Logo',
+    feed: 'Baris kosong'
+};
+
+const layoutVariableLabels = {
+    queue_number: 'Nomor antrian',
+    type_name: 'Jenis layanan',
+    date_time: 'Tanggal & waktu',
+    position: 'Posisi antrian',
+    estimated_wait: 'Perkiraan tunggu (menit)',
+    counter: 'Loket yang melayani',
+    status_url: 'Link status tiket',
+    priority: 'Penanda prioritas'
+};
+
+// Sample ticket shown in the preview
+const layoutSample = {
+    queue_number: 'A001',
+    type_name: 'Umum',
+    date_time: '14/01/2026, 12:00:00',
+    position: '3',
+    estimated_wait: '12',
+    counter: '1, 2',
+    status_url: 'http://server/t/contoh',
+    priority: ''
+};
+
 // Initialize ticket design on page load
 document.addEventListener('DOMContentLoaded', function() {
     loadTicketDesign();
-    setupTicketPreview();
+    ['ticket-paper-width', 'ticket-codepage'].forEach(id => {
+        document.getElementById(id).addEventListener('change', updateTicketPreview);
+    });
+    document.getElementById('ticket-columns').addEventListener('input', updateTicketPreview);
 });
 
-// Setup live preview for ticket design
-function setupTicketPreview() {
-    // Text inputs
-    const textInputs = [
-        'ticket-header',
-        'ticket-subheader',
-        'ticket-title',
-        'ticket-footer1',
-        'ticket-footer2',
-        'ticket-thanks'
-    ];
-
-    textInputs.forEach(id => {
-        const input = document.getElementById(id);
-        if (input) {
-            input.addEventListener('input', updateTicketPreview);
-        }
-    });
+function escapeHtml(s) {
+    return String(s).replace(/[&<>"']/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' }[c]));
+}
+
+function layoutSelect(i, field, value, options) {
+    return `<select class="form-control" data-index="${i}" data-field="${field}">` +
+        Object.entries(options).map(([v, label]) =>
+            `<option value="${v}"${v === value ? ' selected' : ''}>${label}</option>`).join('') +
+        '</select>';
+}
+
+function layoutInput(i, field, value, attrs) {
+    return `<input class="form-control" data-index="${i}" data-field="${field}" value="${escapeHtml(value ?? '')}" ${attrs || ''}>`;
+}
 
-    // Checkboxes
-    const checkboxes = [
-        'ticket-show-subheader',
-        'ticket-show-type',
-        'ticket-show-datetime',
-        'ticket-show-footer',
-        'ticket-show-thanks'
-    ];
-
-    checkboxes.forEach(id => {
-        const checkbox = document.getElementById(id);
-        if (checkbox) {
-            checkbox.addEventListener('change', updateTicketPreview);
+function layoutCheckbox(i, field, checked, label) {
+    return `<label class="checkbox-label"><input type="checkbox" data-index="${i}" data-field="${field}"${checked ? ' checked' : ''}> ${label}</label>`;
+}
+
+// Render the block editor from layoutBlocks
+function renderLayoutEditor() {
+    const aligns = { center: 'Tengah', left: 'Kiri', right: 'Kanan' };
+    const sizes = { normal: 'Normal', small: 'Kecil', large: 'Besar' };
+    const style = (b, i) =>
+        layoutSelect(i, 'align', b.align || 'center', aligns) +
+        layoutSelect(i, 'size', b.size || 'normal', sizes) +
+        layoutCheckbox(i, 'bold', b.bold, 'Tebal') +
+        layoutCheckbox(i, 'invert', b.invert, 'Terbalik');
+
+    const fields = (b, i) => {
+        switch (b.type) {
+        case 'text':
+            return layoutInput(i, 'text', b.text, 'type="text" maxlength="256" placeholder="Teks"') + style(b, i);
+        case 'variable':
+            return layoutSelect(i, 'variable', b.variable, layoutVariableLabels) +
+                layoutInput(i, 'prefix', b.prefix, 'type="text" placeholder="Awalan"') +
+                layoutInput(i, 'suffix', b.suffix, 'type="text" placeholder="Akhiran"') + style(b, i);
+        case 'separator':
+            return layoutInput(i, 'char', b.char, 'type="text" maxlength="1" placeholder="-"');
+        case 'qr':
+            return layoutSelect(i, 'variable', b.variable, layoutVariableLabels) +
+                layoutInput(i, 'module', b.module, 'type="number" min="1" max="16" placeholder="Ukuran 1-16"') +
+                layoutInput(i, 'text', b.text, 'type="text" placeholder="Keterangan di bawah QR"') +
+                layoutSelect(i, 'align', b.align || 'center', aligns);
+        case 'barcode':
+            return layoutSelect(i, 'variable', b.variable, layoutVariableLabels) +
+                layoutInput(i, 'height', b.height, 'type="number" min="1" max="255" placeholder="Tinggi (dot)"') +
+                layoutSelect(i, 'align', b.align || 'center', aligns);
+        case 'image':
+            return layoutSelect(i, 'align', b.align || 'center', aligns);
+        case 'feed':
+            return layoutInput(i, 'lines', b.lines, 'type="number" min="1" max="10" placeholder="Jumlah baris"');
         }
+        return '';
+    };
+
+    document.getElementById('layout-blocks').innerHTML = layoutBlocks.map((b, i) => `
+        <div class="layout-block">
+            <div class="layout-block-head">
+                <strong>${layoutBlockLabels[b.type] || b.type}</strong>
+                <div class="layout-block-actions">
+                    <button type="button" class="btn btn-sm" onclick="moveLayoutBlock(${i}, -1)" title="Naik"${i === 0 ? ' disabled' : ''}>&uarr;</button>
+                    <button type="button" class="btn btn-sm" onclick="moveLayoutBlock(${i}, 1)" title="Turun"${i === layoutBlocks.length - 1 ? ' disabled' : ''}>&darr;</button>
+                    <button type="button" class="btn btn-danger btn-sm" onclick="removeLayoutBlock(${i})" title="Hapus">&times;</button>
+                </div>
+            </div>
+            <div class="layout-block-fields">${fields(b, i)}</div>
+        </div>
+    `).join('');
+
+    document.querySelectorAll('#layout-blocks [data-field]').forEach(el => {
+        el.addEventListener(el.tagName === 'SELECT' || el.type === 'checkbox' ? 'change' : 'input', updateLayoutBlock);
     });
+    updateTicketPreview();
+}
+
+// Copy an edited field into layoutBlocks
+function updateLayoutBlock(event) {
+    const el = event.target;
+    const block = layoutBlocks[parseInt(el.dataset.index, 10)];
+    const field = el.dataset.field;
+    if (el.type === 'checkbox') {
+        block[field] = el.checked;
+    } else if (el.type === 'number') {
+        block[field] = el.value ? parseInt(el.value, 10) : 0;
+    } else {
+        block[field] = el.value;
+    }
+    updateTicketPreview();
+}
+
+function addLayoutBlock() {
+    const type = document.getElementById('layout-add-type').value;
+    const block = { type: type };
+    if (type === 'variable' || type === 'barcode') block.variable = 'queue_number';
+    if (type === 'qr') block.variable = 'status_url';
+    layoutBlocks.push(block);
+    renderLayoutEditor();
+}
+
+function moveLayoutBlock(i, delta) {
+    const j = i + delta;
+    if (j < 0 || j >= layoutBlocks.length) return;
+    [layoutBlocks[i], layoutBlocks[j]] = [layoutBlocks[j], layoutBlocks[i]];
+    renderLayoutEditor();
+}
+
+function removeLayoutBlock(i) {
+    layoutBlocks.splice(i, 1);
+    renderLayoutEditor();
 }
 
-// Update ticket preview
+// Update ticket preview from the layout, with a sample ticket
 function updateTicketPreview() {
-    // Update text content
-    const header = document.getElementById('ticket-header').value || 'SISTEM ANTRIAN';
-    const subheader = document.getElementById('ticket-subheader').value || 'KPP PRATAMA';
-    const title = document.getElementById('ticket-title').value || 'NOMOR ANTRIAN ANDA';
-    const footer1 = document.getElementById('ticket-footer1').value || 'Mohon menunggu hingga';
-    const footer2 = document.getElementById('ticket-footer2').value || 'nomor Anda dipanggil';
-    const thanks = document.getElementById('ticket-thanks').value || 'Terima kasih';
-
-    document.getElementById('preview-header').textContent = header;
-    document.getElementById('preview-subheader').textContent = subheader;
-    document.getElementById('preview-title').textContent = title;
-    document.getElementById('preview-footer1').textContent = footer1;
-    document.getElementById('preview-footer2').textContent = footer2;
-    document.getElementById('preview-thanks').textContent = thanks;
-
-    // Update visibility
-    const showSubheader = document.getElementById('ticket-show-subheader').checked;
-    const showType = document.getElementById('ticket-show-type').checked;
-    const showDatetime = document.getElementById('ticket-show-datetime').checked;
-    const showFooter = document.getElementById('ticket-show-footer').checked;
-    const showThanks = document.getElementById('ticket-show-thanks').checked;
-
-    document.getElementById('preview-subheader').classList.toggle('hidden', !showSubheader);
-    document.getElementById('preview-type-label').classList.toggle('hidden', !showType);
-    document.getElementById('preview-datetime').classList.toggle('hidden', !showDatetime);
-    document.getElementById('preview-footer').classList.toggle('hidden', !showFooter);
-    document.getElementById('preview-thanks').classList.toggle('hidden', !showThanks);
+    const preview = document.getElementById('ticket-preview');
+    const paperDots = parseInt(document.getElementById('ticket-paper-width').value, 10);
+    const columns = parseInt(document.getElementById('ticket-columns').value, 10) || Math.floor(paperDots / 12);
+    preview.classList.toggle('paper-58', paperDots === 384);
+    preview.innerHTML = '';
+
+    layoutBlocks.forEach(b => {
+        const el = document.createElement('div');
+        el.style.textAlign = b.align || 'center';
+        switch (b.type) {
+        case 'text':
+        case 'variable': {
+            const value = b.type === 'text' ? b.text : layoutSample[b.variable];
+            if (!value) return;
+            const span = document.createElement('span');
+            span.textContent = b.type === 'text' ? value : (b.prefix || '') + value + (b.suffix || '');
+            span.className = 'preview-text preview-' + (b.size || 'normal') +
+                (b.bold ? ' preview-bold' : '') + (b.invert ? ' preview-invert' : '');
+            el.appendChild(span);
+            break;
+        }
+        case 'separator':
+            el.className = 'preview-separator';
+            el.textContent = (b.char || '-').repeat(columns);
+            break;
+        case 'qr': {
+            if (!layoutSample[b.variable]) return;
+            const qr = document.createElement('div');
+            qr.className = 'preview-qr';
+            el.appendChild(qr);
+            if (b.text) {
+                const caption = document.createElement('div');
+                caption.className = 'preview-small';
+                caption.textContent = b.text;
+                el.appendChild(caption);
+            }
+            break;
+        }
+        case 'barcode': {
+            const value = layoutSample[b.variable];
+            if (!value) return;
+            const barcode = document.createElement('div');
+            barcode.className = 'preview-barcode';
+            barcode.textContent = value;
+            el.appendChild(barcode);
+            break;
+        }
+        case 'image': {
+            if (!ticketLogo) return;
+            const img = document.createElement('img');
+            img.className = 'preview-logo';
+            img.alt = '';
+            // Scaled like the paper once loaded
+            img.onload = () => { img.style.width = Math.min(100, img.naturalWidth / paperDots * 100) + '%'; };
+            img.src = ticketLogo;
+            el.appendChild(img);
+            break;
+        }
+        case 'feed':
+            el.style.height = (1.4 * (b.lines || 1)) + 'em';
+            break;
+        }
+        preview.appendChild(el);
+    });
 }
 
 // Load ticket design settings
 async function loadTicketDesign() {
     try {
-        const response = await fetch('/api/settings?keys=ticket_header,ticket_subheader,ticket_title,ticket_footer1,ticket_footer2,ticket_thanks,ticket_show_subheader,ticket_show_type,ticket_show_datetime,ticket_show_footer,ticket_show_thanks');
-        const settings = await response.json();
-
-        // Set text values
-        if (settings.ticket_header) document.getElementById('ticket-header').value = settings.ticket_header;
-        if (settings.ticket_subheader) document.getElementById('ticket-subheader').value = settings.ticket_subheader;
-        if (settings.ticket_title) document.getElementById('ticket-title').value = settings.ticket_title;
-        if (settings.ticket_footer1) document.getElementById('ticket-footer1').value = settings.ticket_footer1;
-        if (settings.ticket_footer2) document.getElementById('ticket-footer2').value = settings.ticket_footer2;
-        if (settings.ticket_thanks) document.getElementById('ticket-thanks').value = settings.ticket_thanks;
-
-        // Set checkbox values (default to true if not set)
-        document.getElementById('ticket-show-subheader').checked = settings.ticket_show_subheader !== 'false';
-        document.getElementById('ticket-show-type').checked = settings.ticket_show_type !== 'false';
-        document.getElementById('ticket-show-datetime').checked = settings.ticket_show_datetime !== 'false';
-        document.getElementById('ticket-show-footer').checked = settings.ticket_show_footer !== 'false';
-        document.getElementById('ticket-show-thanks').checked = settings.ticket_show_thanks !== 'false';
-
-        // Update preview
-        updateTicketPreview();
+        const [settingsResponse, layoutResponse] = await Promise.all([
+            fetch('/api/settings?keys=ticket_paper_width,ticket_columns,ticket_codepage'),
+            fetch('/api/settings/ticket-layout')
+        ]);
+        const settings = await settingsResponse.json();
+        if (!layoutResponse.ok) throw new Error('Failed to load ticket layout');
+        const layout = await layoutResponse.json();
+
+        // Paper and code page
+        if (settings.ticket_paper_width) document.getElementById('ticket-paper-width').value = settings.ticket_paper_width;
+        document.getElementById('ticket-columns').value = settings.ticket_columns || '';
+        if (settings.ticket_codepage) document.getElementById('ticket-codepage').value = settings.ticket_codepage;
+
+        layoutBlocks = layout.blocks || [];
+        await loadTicketLogo();
+        renderLayoutEditor();
     } catch (error) {
         console.error('Failed to load ticket design:', error);
     }
@@ -950,17 +1220,9 @@ async function saveTicketDesign(event) {
     event.preventDefault();
 
     const settings = {
-        ticket_header: document.getElementById('ticket-header').value,
-        ticket_subheader: document.getElementById('ticket-subheader').value,
-        ticket_title: document.getElementById('ticket-title').value,
-        ticket_footer1: document.getElementById('ticket-footer1').value,
-        ticket_footer2: document.getElementById('ticket-footer2').value,
-        ticket_thanks: document.getElementById('ticket-thanks').value,
-        ticket_show_subheader: document.getElementById('ticket-show-subheader').checked.toString(),
-        ticket_show_type: document.getElementById('ticket-show-type').checked.toString(),
-        ticket_show_datetime: document.getElementById('ticket-show-datetime').checked.toString(),
-        ticket_show_footer: document.getElementById('ticket-show-footer').checked.toString(),
-        ticket_show_thanks: document.getElementById('ticket-show-thanks').checked.toString()
+        ticket_paper_width: document.getElementById('ticket-paper-width').value,
+        ticket_columns: document.getElementById('ticket-columns').value,
+        ticket_codepage: document.getElementById('ticket-codepage').value
     };
 
     try {
@@ -976,10 +1238,435 @@ async function saveTicketDesign(event) {
             throw new Error('Failed to save ticket design');
         }
 
+        const layoutResponse = await fetch('/api/settings/ticket-layout', {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ version: 1, blocks: layoutBlocks })
+        });
+
+        if (!layoutResponse.ok) {
+            const error = await layoutResponse.json();
+            throw new Error(error.error || 'Failed to save ticket layout');
+        }
+
         showToast('Desain tiket berhasil disimpan!');
     } catch (error) {
         console.error('Failed to save ticket design:', error);
-        alert('Gagal menyimpan desain tiket.');
+        alert('Gagal menyimpan desain tiket: ' + error.message);
+    }
+}
+
+// Discard the saved layout and go back to the default ticket
+async function resetTicketLayout() {
+    if (!confirm('Kembalikan susunan tiket ke bawaan? Susunan yang tersimpan akan dihapus.')) return;
+
+    try {
+        const response = await fetch('/api/settings/ticket-layout', { method: 'DELETE' });
+        if (!response.ok) {
+            throw new Error('Failed to reset layout');
+        }
+        await loadTicketDesign();
+        showToast('Susunan tiket dikembalikan ke bawaan');
+    } catch (error) {
+        console.error('Failed to reset ticket layout:', error);
+        alert('Gagal mengembalikan susunan tiket.');
+    }
+}
+
+// Render the design being edited on the server, dot for dot as the
+// printer will print it
+async function fetchPrintPreview(format) {
+    const response = await fetch('/api/printer/preview' + (format ? '?format=' + format : ''), {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({
+            layout: { version: 1, blocks: layoutBlocks },
+            paper_width: parseInt(document.getElementById('ticket-paper-width').value, 10),
+            columns: parseInt(document.getElementById('ticket-columns').value, 10) || 0,
+            codepage: document.getElementById('ticket-codepage').value
+        })
+    });
+    if (!response.ok) {
+        const error = await response.json();
+        throw new Error(error.error || 'Failed to render preview');
+    }
+    return response.blob();
+}
+
+async function loadPrintPreview() {
+    const img = document.getElementById('ticket-print-preview');
+    try {
+        const blob = await fetchPrintPreview();
+        if (img.src) URL.revokeObjectURL(img.src);
+        // Shown at the scale of the HTML preview: 280px for 576 dots
+        img.onload = () => { img.style.width = Math.round(img.naturalWidth * 280 / 576) + 'px'; };
+        img.src = URL.createObjectURL(blob);
+        img.classList.remove('hidden');
+    } catch (error) {
+        console.error('Failed to load print preview:', error);
+        alert('Gagal membuat hasil cetak: ' + error.message);
+    }
+}
+
+async function downloadPrintPreview() {
+    try {
+        const blob = await fetchPrintPreview('pdf');
+        const link = document.createElement('a');
+        link.href = URL.createObjectURL(blob);
+        link.download = 'tiket.pdf';
+        link.click();
+        setTimeout(() => URL.revokeObjectURL(link.href), 1000);
+    } catch (error) {
+        console.error('Failed to download print preview:', error);
+        alert('Gagal membuat PDF: ' + error.message);
+    }
+}
+
+// Ticket logo, null until one is uploaded
+let ticketLogo = null;
+
+// Load the ticket logo preview
+async function loadTicketLogo() {
+    const current = document.getElementById('ticket-logo-current');
+    try {
+        const response = await fetch('/api/settings/logo');
+        if (!response.ok) {
+            ticketLogo = null;
+        } else {
+            const blob = await response.blob();
+            ticketLogo = URL.createObjectURL(blob);
+            current.src = ticketLogo;
+        }
+    } catch (error) {
+        console.error('Failed to load ticket logo:', error);
+        ticketLogo = null;
+    }
+    current.classList.toggle('hidden', !ticketLogo);
+    document.getElementById('ticket-logo-delete').classList.toggle('hidden', !ticketLogo);
+    updateTicketPreview();
+}
+
+// Upload a new ticket logo
+async function uploadTicketLogo() {
+    const file = document.getElementById('ticket-logo-file').files[0];
+    if (!file) {
+        alert('Pilih file logo terlebih dahulu.');
+        return;
+    }
+
+    const form = new FormData();
+    form.append('logo', file);
+    const width = document.getElementById('ticket-logo-width').value;
+    if (width) form.append('width', width);
+
+    try {
+        const response = await fetch('/api/settings/logo', {
+            method: 'POST',
+            body: form
+        });
+
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Upload failed');
+        }
+
+        document.getElementById('ticket-logo-file').value = '';
+        await loadTicketLogo();
+        showToast('Logo tiket berhasil diunggah!');
+    } catch (error) {
+        console.error('Failed to upload ticket logo:', error);
+        alert('Gagal mengunggah logo: ' + error.message);
+    }
+}
+
+// Remove the ticket logo
+async function deleteTicketLogo() {
+    if (!confirm('Hapus logo tiket?')) return;
+
+    try {
+        const response = await fetch('/api/settings/logo', { method: 'DELETE' });
+        if (!response.ok) {
+            throw new Error('Failed to delete logo');
+        }
+        await loadTicketLogo();
+        showToast('Logo tiket dihapus');
+    } catch (error) {
+        console.error('Failed to delete ticket logo:', error);
+        alert('Gagal menghapus logo.');
+    }
+}
+
+// Printer status: the local printer and the last report of each print agent
+async function loadPrinterStatus() {
+    try {
+        const response = await fetch('/api/printer/status');
+        if (!response.ok) throw new Error('Failed to fetch printer status');
+        const data = await response.json();
+
+        const rows = [];
+        if (data.hardware) {
+            rows.push({ ...data.hardware, agent_id: 'Server (lokal)' });
+        }
+        rows.push(...data.agents);
+
+        const tbody = document.getElementById('printer-status-list');
+        if (rows.length === 0) {
+            tbody.innerHTML = '<tr><td colspan="4" style="text-align: center; color: #6b7280;">Belum ada printer yang melaporkan status</td></tr>';
+            return;
+        }
+
+        tbody.innerHTML = rows.map(p => `
+            <tr>
+                <td><strong>${p.agent_id}</strong></td>
+                <td>${p.printer || '-'}</td>
+                <td>${printerStatusBadges(p)}</td>
+                <td>${formatDateTime(p.reported_at)}</td>
+            </tr>
+        `).join('');
+    } catch (error) {
+        console.error('Failed to load printer status:', error);
+    }
+}
+
+function printerStatusBadges(p) {
+    if (p.error) {
+        return `<span class="counter-status-badge inactive" title="${p.error}">Status tidak tersedia</span>`;
+    }
+    const problems = [];
+    if (!p.online) problems.push('Offline');
+    if (p.cover_open) problems.push('Tutup terbuka');
+    if (p.paper_out) problems.push('Kertas habis');
+    else if (p.paper_near_end) problems.push('Kertas hampir habis');
+    if (problems.length === 0) {
+        return '<span class="counter-status-badge active">Online</span>';
+    }
+    return problems.map(label => `<span class="counter-status-badge warning">${label}</span>`).join(' ');
+}
+
+// Print agents registered by their heartbeats
+async function loadPrintAgents() {
+    try {
+        const response = await fetch('/api/admin/print-agents');
+        if (!response.ok) throw new Error('Failed to fetch print agents');
+        const agents = await response.json();
+
+        const tbody = document.getElementById('print-agents-list');
+        if (agents.length === 0) {
+            tbody.innerHTML = '<tr><td colspan="8" style="text-align: center; color: #6b7280;">Belum ada print agent yang terdaftar</td></tr>';
+            return;
+        }
+
+        tbody.innerHTML = agents.map(a => `
+            <tr>
+                <td><strong>${escapeHtml(a.id)}</strong>${a.group ? `<br><small>Grup: ${escapeHtml(a.group)}</small>` : ''}</td>
+                <td>${escapeHtml(a.hostname || '-')}${a.version ? `<br><small>Versi ${escapeHtml(a.version)}</small>` : ''}</td>
+                <td>${escapeHtml(a.printer || '-')}${a.backend ? `<br><small>${escapeHtml(a.backend)}</small>` : ''}</td>
+                <td>${printAgentStateBadge(a)}</td>
+                <td>${formatDateTime(a.last_heartbeat_at)}</td>
+                <td>${a.jobs_printed} / ${a.jobs_failed}</td>
+                <td>${escapeHtml(a.last_error || '-')}</td>
+                <td>
+                    <button type="button" class="btn btn-sm" data-agent="${escapeHtml(a.id)}" onclick="openPrintAgentConfig(this.dataset.agent)">Pengaturan</button>
+                    <button type="button" class="btn btn-sm btn-danger" data-agent="${escapeHtml(a.id)}" onclick="deletePrintAgent(this.dataset.agent)">Hapus</button>
+                </td>
+            </tr>
+        `).join('');
+    } catch (error) {
+        console.error('Failed to load print agents:', error);
+    }
+}
+
+function printAgentStateBadge(agent) {
+    switch (agent.state) {
+        case 'online':
+            return `<span class="counter-status-badge active">${agent.connected ? 'Online' : 'Online (tanpa SSE)'}</span>`;
+        case 'stale':
+            return '<span class="counter-status-badge warning">Terlambat</span>';
+        default:
+            return '<span class="counter-status-badge inactive">Offline</span>';
+    }
+}
+
+async function deletePrintAgent(id) {
+    if (!confirm(`Hapus print agent ${id} dari daftar? Agent akan muncul lagi jika masih mengirim heartbeat.`)) return;
+    try {
+        const response = await fetch(`/api/admin/print-agents/${encodeURIComponent(id)}`, { method: 'DELETE' });
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Delete failed');
+        }
+        loadPrintAgents();
+    } catch (error) {
+        console.error('Failed to delete print agent:', error);
+        alert('Gagal menghapus print agent: ' + error.message);
+    }
+}
+
+// Settings of a print agent managed on the server
+async function openPrintAgentConfig(id) {
+    try {
+        const response = await fetch(`/api/admin/print-agents/${encodeURIComponent(id)}/config`);
+        if (!response.ok) throw new Error('Failed to fetch print agent config');
+        const config = await response.json();
+
+        document.getElementById('agent-config-id').value = id;
+        document.getElementById('agent-config-title').textContent = id;
+        document.getElementById('agent-config-backend').value = config.backend || '';
+        document.getElementById('agent-config-address').value = config.address || '';
+        document.getElementById('agent-config-printer').value = config.printer_name || '';
+        document.getElementById('agent-config-paper-width').value = config.paper_width || '';
+        document.getElementById('agent-config-columns').value = config.columns || '';
+        document.getElementById('agent-config-codepage').value = config.codepage || '';
+        document.getElementById('agent-config-template').value = config.template ? JSON.stringify(config.template, null, 2) : '';
+        document.getElementById('agent-config-log-level').value = config.log_level || '';
+        showModal('print-agent-config-modal');
+    } catch (error) {
+        console.error('Failed to load print agent config:', error);
+        alert('Gagal memuat pengaturan print agent: ' + error.message);
+    }
+}
+
+async function savePrintAgentConfig(event) {
+    event.preventDefault();
+
+    const id = document.getElementById('agent-config-id').value;
+    const config = {
+        backend: document.getElementById('agent-config-backend').value,
+        address: document.getElementById('agent-config-address').value.trim(),
+        printer_name: document.getElementById('agent-config-printer').value.trim(),
+        paper_width: parseInt(document.getElementById('agent-config-paper-width').value) || 0,
+        columns: parseInt(document.getElementById('agent-config-columns').value) || 0,
+        codepage: document.getElementById('agent-config-codepage').value,
+        log_level: document.getElementById('agent-config-log-level').value
+    };
+    const template = document.getElementById('agent-config-template').value.trim();
+    if (template) {
+        try {
+            config.template = JSON.parse(template);
+        } catch (e) {
+            alert('Ubahan desain tiket bukan JSON yang valid.');
+            return;
+        }
+    }
+
+    try {
+        const response = await fetch(`/api/admin/print-agents/${encodeURIComponent(id)}/config`, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify(config)
+        });
+        if (!response.ok) {
+            const data = await response.json().catch(() => ({}));
+            throw new Error(data.error || 'Failed to save print agent config');
+        }
+        closeModal('print-agent-config-modal');
+    } catch (error) {
+        console.error('Failed to save print agent config:', error);
+        alert('Gagal menyimpan pengaturan print agent: ' + error.message);
+    }
+}
+
+// Admin events: print agents changing state and kiosks left without one
+function connectAdminSSE() {
+    const eventSource = new EventSource('/api/admin/sse');
+    eventSource.onmessage = function(event) {
+        const message = JSON.parse(event.data);
+        switch (message.type) {
+            case 'print_agent':
+                loadPrintAgents();
+                loadPrinterStatus();
+                break;
+            case 'printer_alert':
+                showPrinterAlert(message.data);
+                break;
+        }
+    };
+}
+
+function showPrinterAlert(alertData) {
+    let text = `Print agent ${alertData.agent_id} offline. `;
+    if (alertData.last_agent) {
+        text += 'Tidak ada print agent yang aktif; tiket tidak tercetak di semua kiosk.';
+    } else {
+        text += `Kiosk ${alertData.kiosks.join(', ')} tidak lagi memiliki printer yang aktif.`;
+    }
+    document.getElementById('printer-alert-message').textContent = text;
+    document.getElementById('printer-alert').classList.remove('hidden');
+}
+
+function dismissPrinterAlert() {
+    document.getElementById('printer-alert').classList.add('hidden');
+}
+
+// Failed print jobs: retried automatically until they run out of
+// attempts, then kept here to be reissued or dismissed
+async function loadFailedPrintJobs() {
+    try {
+        const response = await fetch('/api/admin/print-jobs');
+        if (!response.ok) throw new Error('Failed to fetch print jobs');
+        const jobs = await response.json();
+
+        const tbody = document.getElementById('failed-print-jobs-list');
+        if (jobs.length === 0) {
+            tbody.innerHTML = '<tr><td colspan="7" style="text-align: center; color: #6b7280;">Tidak ada job cetak yang gagal</td></tr>';
+            return;
+        }
+
+        tbody.innerHTML = jobs.map(job => `
+            <tr>
+                <td><strong>${job.queue_number}</strong></td>
+                <td>${job.status === 'dead'
+                    ? '<span class="counter-status-badge inactive">Berhenti</span>'
+                    : `<span class="counter-status-badge warning" title="Dicoba lagi ${formatDateTime(job.next_attempt_at)}">Menunggu ulang</span>`}</td>
+                <td>${job.attempts}</td>
+                <td>${escapeHtml(job.target || 'Semua agent')}</td>
+                <td>${escapeHtml(job.error_message || '-')}</td>
+                <td>${formatDateTime(job.created_at)}</td>
+                <td>
+                    <button type="button" class="btn btn-sm" onclick="reissuePrintJob(${job.id})">Cetak Ulang</button>
+                    ${job.status === 'dead'
+                        ? `<button type="button" class="btn btn-sm btn-danger" onclick="dismissPrintJob(${job.id})">Abaikan</button>`
+                        : ''}
+                </td>
+            </tr>
+        `).join('');
+    } catch (error) {
+        console.error('Failed to load print jobs:', error);
+    }
+}
+
+async function reissuePrintJob(id) {
+    try {
+        const response = await fetch(`/api/admin/print-job/${id}/reissue`, { method: 'POST' });
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Reissue failed');
+        }
+        loadFailedPrintJobs();
+    } catch (error) {
+        console.error('Failed to reissue print job:', error);
+        alert('Gagal mencetak ulang: ' + error.message);
+    }
+}
+
+async function dismissPrintJob(id) {
+    if (!confirm('Abaikan job cetak ini? Tiketnya tidak akan dicetak.')) return;
+    try {
+        const response = await fetch(`/api/admin/print-job/${id}/dismiss`, { method: 'POST' });
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Dismiss failed');
+        }
+        loadFailedPrintJobs();
+    } catch (error) {
+        console.error('Failed to dismiss print job:', error);
+        alert('Gagal mengabaikan job: ' + error.message);
     }
 }
 
@@ -1228,6 +1915,7 @@ async function loadReport() {
         document.getElementById('report-total').textContent = report.total || 0;
         document.getElementById('report-completed').textContent = report.completed || 0;
         document.getElementById('report-cancelled').textContent = report.cancelled || 0;
+        document.getElementById('report-no-show').textContent = report.no_show || 0;
         document.getElementById('report-avg-time').textContent = report.avg_wait_time || '-';
 
         // Render chart
@@ -1235,6 +1923,9 @@ async function loadReport() {
 
         // Render by type
         renderReportByType(report.by_type || []);
+
+        // Render journey steps
+        renderReportSteps(report.steps || []);
     } catch (error) {
         console.error('Failed to load report:', error);
         alert('Gagal memuat laporan.');
@@ -1288,6 +1979,43 @@ function renderReportByType(byTypeData) {
     `).join('');
 }
 
+function renderReportSteps(stepData) {
+    const container = document.getElementById('report-steps');
+
+    if (!stepData || stepData.length === 0) {
+        container.innerHTML = '';
+        return;
+    }
+
+    container.innerHTML = `
+        <h4>Waktu per Langkah Layanan</h4>
+        <table class="queues-table">
+            <thead>
+                <tr>
+                    <th>Alur</th>
+                    <th>Langkah</th>
+                    <th>Total</th>
+                    <th>Selesai</th>
+                    <th>Rata-rata Tunggu</th>
+                    <th>Rata-rata Layanan</th>
+                </tr>
+            </thead>
+            <tbody>
+                ${stepData.map(step => `
+                    <tr>
+                        <td>${step.journey_name}</td>
+                        <td>${step.step_no}. ${step.name}</td>
+                        <td>${step.total}</td>
+                        <td>${step.completed}</td>
+                        <td>${step.avg_wait_time}</td>
+                        <td>${step.avg_service_time}</td>
+                    </tr>
+                `).join('')}
+            </tbody>
+        </table>
+    `;
+}
+
 async function exportReport() {
     const startDate = document.getElementById('report-start-date').value;
     const endDate = document.getElementById('report-end-date').value;
@@ -1388,6 +2116,393 @@ async function saveQueueLimits() {
     }
 }
 
+// ===================================
+// Users
+// ===================================
+
+const roleLabels = {
+    'admin': 'Admin',
+    'supervisor': 'Supervisor',
+    'operator': 'Petugas Loket',
+    'kiosk': 'Kiosk'
+};
+
+let userCounters = [];
+
+// Load users
+async function loadUsers() {
+    try {
+        const [usersResponse, countersResponse] = await Promise.all([
+            fetch('/api/users'),
+            fetch('/api/counters')
+        ]);
+        if (!usersResponse.ok) throw new Error('Failed to fetch users');
+        const users = await usersResponse.json();
+        userCounters = await countersResponse.json();
+
+        const counterNames = {};
+        userCounters.forEach(c => { counterNames[c.id] = c.counter_name; });
+
+        const tbody = document.getElementById('users-list');
+        if (users.length === 0) {
+            tbody.innerHTML = '<tr><td colspan="6" style="text-align: center; color: #6b7280;">Belum ada pengguna. Admin utama tetap dapat masuk dengan password di config.</td></tr>';
+            return;
+        }
+
+        tbody.innerHTML = users.map(user => `
+            <tr>
+                <td><strong>${user.username}</strong></td>
+                <td>${user.full_name || '-'}</td>
+                <td>${roleLabels[user.role] || user.role}</td>
+                <td>${user.counter_ids.length ? user.counter_ids.map(id => counterNames[id] || `#${id}`).join(', ') : '-'}</td>
+                <td><span class="counter-status-badge ${user.is_active ? 'active' : 'inactive'}">${user.is_active ? 'Aktif' : 'Nonaktif'}</span></td>
+                <td><button class="btn btn-sm" onclick="showEditUserModal(${user.id})">Edit</button></td>
+            </tr>
+        `).join('');
+    } catch (error) {
+        console.error('Failed to load users:', error);
+    }
+}
+
+function renderUserCounterOptions(selectedIds) {
+    const container = document.getElementById('user-counters');
+    if (userCounters.length === 0) {
+        container.innerHTML = '<small>Belum ada loket</small>';
+        return;
+    }
+    container.innerHTML = userCounters.map(c => `
+        <label class="checkbox-label">
+            <input type="checkbox" value="${c.id}" ${selectedIds.includes(c.id) ? 'checked' : ''}> ${c.counter_name}
+        </label>
+    `).join('');
+}
+
+function showAddUserModal() {
+    document.getElementById('user-form').reset();
+    document.getElementById('user-modal-title').textContent = 'Tambah Pengguna';
+    document.getElementById('user-id').value = '';
+    document.getElementById('user-username').disabled = false;
+    document.getElementById('user-password').required = true;
+    document.getElementById('user-password-hint').textContent = 'Minimal 6 karakter';
+    document.getElementById('user-delete-btn').style.display = 'none';
+    document.getElementById('user-active').checked = true;
+    renderUserCounterOptions([]);
+    showModal('user-modal');
+}
+
+async function showEditUserModal(id) {
+    try {
+        const response = await fetch(`/api/user/${id}`);
+        if (!response.ok) throw new Error('Failed to fetch user');
+        const user = await response.json();
+
+        document.getElementById('user-modal-title').textContent = 'Edit Pengguna';
+        document.getElementById('user-id').value = user.id;
+        document.getElementById('user-username').value = user.username;
+        document.getElementById('user-username').disabled = true;
+        document.getElementById('user-fullname').value = user.full_name;
+        document.getElementById('user-role').value = user.role;
+        document.getElementById('user-password').value = '';
+        document.getElementById('user-password').required = false;
+        document.getElementById('user-password-hint').textContent = 'Kosongkan jika tidak ingin mengubah password';
+        document.getElementById('user-active').checked = user.is_active;
+        document.getElementById('user-delete-btn').style.display = '';
+        renderUserCounterOptions(user.counter_ids);
+        showModal('user-modal');
+    } catch (error) {
+        console.error('Failed to load user:', error);
+        alert('Gagal memuat data pengguna.');
+    }
+}
+
+async function saveUser(event) {
+    event.preventDefault();
+
+    const id = document.getElementById('user-id').value;
+    const counterIds = Array.from(document.querySelectorAll('#user-counters input:checked'))
+        .map(input => parseInt(input.value, 10));
+
+    const body = {
+        full_name: document.getElementById('user-fullname').value.trim(),
+        role: document.getElementById('user-role').value,
+        password: document.getElementById('user-password').value,
+        is_active: document.getElementById('user-active').checked,
+        counter_ids: counterIds
+    };
+    if (!id) {
+        body.username = document.getElementById('user-username').value.trim();
+    }
+
+    try {
+        const response = await fetch(id ? `/api/user/${id}` : '/api/users', {
+            method: id ? 'PUT' : 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify(body)
+        });
+
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to save user');
+        }
+
+        closeModal('user-modal');
+        loadUsers();
+        showToast('Pengguna berhasil disimpan');
+    } catch (error) {
+        console.error('Failed to save user:', error);
+        alert('Gagal menyimpan pengguna: ' + error.message);
+    }
+}
+
+async function deleteUser() {
+    const id = document.getElementById('user-id').value;
+    const username = document.getElementById('user-username').value;
+    if (!id || !confirm(`Yakin ingin menghapus pengguna "${username}"?`)) {
+        return;
+    }
+
+    try {
+        const response = await fetch(`/api/user/${id}`, {
+            method: 'DELETE'
+        });
+        if (!response.ok) {
+            throw new Error('Failed to delete user');
+        }
+
+        closeModal('user-modal');
+        loadUsers();
+        showToast('Pengguna berhasil dihapus');
+    } catch (error) {
+        console.error('Failed to delete user:', error);
+        alert('Gagal menghapus pengguna.');
+    }
+}
+
+async function loadSessions() {
+    try {
+        const response = await fetch('/api/admin/sessions');
+        if (!response.ok) throw new Error('Failed to fetch sessions');
+        const sessions = await response.json();
+
+        const tbody = document.getElementById('sessions-list');
+        if (sessions.length === 0) {
+            tbody.innerHTML = '<tr><td colspan="6" style="text-align: center; color: #6b7280;">Tidak ada sesi aktif</td></tr>';
+            return;
+        }
+
+        tbody.innerHTML = sessions.map(s => `
+            <tr>
+                <td><strong>${s.username}</strong>${s.counter_id ? ` <small>(loket #${s.counter_id})</small>` : ''}</td>
+                <td>${roleLabels[s.role] || s.role}</td>
+                <td>${s.ip || '-'}</td>
+                <td title="${s.user_agent}">${s.user_agent ? s.user_agent.substring(0, 40) : '-'}</td>
+                <td>${formatDateTime(s.last_seen_at)}</td>
+                <td>${s.current ? '<span class="counter-status-badge active">Sesi ini</span>' : `<button class="btn btn-sm" onclick="revokeSession(${s.id})">Keluarkan</button>`}</td>
+            </tr>
+        `).join('');
+    } catch (error) {
+        console.error('Failed to load sessions:', error);
+    }
+}
+
+async function revokeSession(id) {
+    try {
+        const response = await fetch(`/api/admin/session/${id}`, {
+            method: 'DELETE'
+        });
+        if (!response.ok) throw new Error('Failed to revoke session');
+
+        loadSessions();
+        showToast('Sesi berhasil dikeluarkan');
+    } catch (error) {
+        console.error('Failed to revoke session:', error);
+        alert('Gagal mengeluarkan sesi.');
+    }
+}
+
+async function logoutAllSessions() {
+    if (!confirm('Keluarkan semua sesi lain? Semua petugas harus masuk kembali.')) {
+        return;
+    }
+
+    try {
+        const response = await fetch('/api/admin/sessions/logout-all', {
+            method: 'POST'
+        });
+        if (!response.ok) throw new Error('Failed to log out sessions');
+        const result = await response.json();
+
+        loadSessions();
+        showToast(`${result.removed} sesi dikeluarkan`);
+    } catch (error) {
+        console.error('Failed to log out sessions:', error);
+        alert('Gagal mengeluarkan sesi.');
+    }
+}
+
+async function loadTokens() {
+    try {
+        const response = await fetch('/api/admin/tokens');
+        if (!response.ok) throw new Error('Failed to fetch tokens');
+        const tokens = await response.json();
+
+        const tbody = document.getElementById('tokens-list');
+        if (tokens.length === 0) {
+            tbody.innerHTML = '<tr><td colspan="7" style="text-align: center; color: #6b7280;">Belum ada token</td></tr>';
+            return;
+        }
+
+        tbody.innerHTML = tokens.map(t => `
+            <tr>
+                <td><strong>${t.name}</strong></td>
+                <td><code>${t.prefix}&hellip;</code></td>
+                <td>${t.scopes.join(', ')}</td>
+                <td>${t.agent_id || '-'}${t.group ? ` (${escapeHtml(t.group)})` : ''}</td>
+                <td>${t.expires_at ? formatDateTime(t.expires_at) : '-'}</td>
+                <td>${t.last_used_at ? formatDateTime(t.last_used_at) : '-'}</td>
+                <td>${t.revoked_at ? '<span class="counter-status-badge inactive">Dicabut</span>' : `<button class="btn btn-sm" onclick="revokeToken(${t.id}, '${t.name}')">Cabut</button>`}</td>
+            </tr>
+        `).join('');
+    } catch (error) {
+        console.error('Failed to load tokens:', error);
+    }
+}
+
+function showAddTokenModal() {
+    document.getElementById('token-form').reset();
+    document.getElementById('token-result').style.display = 'none';
+    document.getElementById('token-submit-btn').disabled = false;
+    showModal('token-modal');
+}
+
+async function saveToken(event) {
+    event.preventDefault();
+
+    const scopes = Array.from(document.querySelectorAll('#token-scopes input:checked')).map(el => el.value);
+    if (scopes.length === 0) {
+        alert('Pilih minimal satu scope.');
+        return;
+    }
+
+    try {
+        const response = await fetch('/api/admin/tokens', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                name: document.getElementById('token-name').value,
+                scopes: scopes,
+                agent_id: document.getElementById('token-agent-id').value,
+                group: document.getElementById('token-group').value,
+                expires_in_days: parseInt(document.getElementById('token-expires').value) || 0
+            })
+        });
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to create token');
+        }
+        const result = await response.json();
+
+        document.getElementById('token-value').value = result.token;
+        document.getElementById('token-result').style.display = '';
+        document.getElementById('token-submit-btn').disabled = true;
+        loadTokens();
+    } catch (error) {
+        console.error('Failed to create token:', error);
+        alert('Gagal membuat token: ' + error.message);
+    }
+}
+
+async function revokeToken(id, name) {
+    if (!confirm(`Cabut token "${name}"? Perangkat yang memakainya tidak dapat terhubung lagi.`)) {
+        return;
+    }
+
+    try {
+        const response = await fetch(`/api/admin/token/${id}`, {
+            method: 'DELETE'
+        });
+        if (!response.ok) throw new Error('Failed to revoke token');
+
+        loadTokens();
+        showToast('Token berhasil dicabut');
+    } catch (error) {
+        console.error('Failed to revoke token:', error);
+        alert('Gagal mencabut token.');
+    }
+}
+
+// Audit log
+let auditPage = 1;
+
+function applyAuditFilters() {
+    auditPage = 1;
+    loadAuditLog();
+}
+
+function goToAuditPage(page) {
+    auditPage = page;
+    loadAuditLog();
+}
+
+async function loadAuditLog() {
+    const params = new URLSearchParams({ page: auditPage });
+    const filters = {
+        actor: document.getElementById('audit-actor').value.trim(),
+        action: document.getElementById('audit-action').value,
+        from: document.getElementById('audit-from').value,
+        to: document.getElementById('audit-to').value
+    };
+    Object.entries(filters).forEach(([key, value]) => {
+        if (value) params.set(key, value);
+    });
+
+    try {
+        const response = await fetch(`/api/admin/audit?${params}`);
+        if (!response.ok) throw new Error('Failed to fetch audit log');
+        const result = await response.json();
+
+        const tbody = document.getElementById('audit-list');
+        if (result.entries.length === 0) {
+            tbody.innerHTML = '<tr><td colspan="6" style="text-align: center; color: #6b7280;">Tidak ada catatan</td></tr>';
+        } else {
+            tbody.innerHTML = result.entries.map(e => `
+                <tr>
+                    <td>${formatDateTime(e.timestamp)}</td>
+                    <td><strong>${e.actor}</strong>${e.actor_role ? ` <small>(${roleLabels[e.actor_role] || e.actor_role})</small>` : ''}</td>
+                    <td>${e.ip || '-'}</td>
+                    <td><code>${e.action}</code></td>
+                    <td>${e.target_type ? `${e.target_type}${e.target_id ? ' #' + e.target_id : ''}` : '-'}</td>
+                    <td>${renderAuditDetail(e)}</td>
+                </tr>
+            `).join('');
+        }
+
+        const container = document.getElementById('audit-pagination');
+        let html = '';
+        if (result.total_pages > 1) {
+            html += '<div class="pagination-controls">';
+            html += `<button class="btn btn-sm" ${result.page <= 1 ? 'disabled' : ''} onclick="goToAuditPage(${result.page - 1})">&#8592; Prev</button>`;
+            html += `<button class="btn btn-sm" ${result.page >= result.total_pages ? 'disabled' : ''} onclick="goToAuditPage(${result.page + 1})">Next &#8594;</button>`;
+            html += '</div>';
+        }
+        html += `<div class="pagination-info">Halaman ${result.page || 1} dari ${result.total_pages || 1} (${result.total} catatan)</div>`;
+        container.innerHTML = html;
+    } catch (error) {
+        console.error('Failed to load audit log:', error);
+    }
+}
+
+function renderAuditDetail(entry) {
+    if (!entry.before && !entry.after) return '-';
+    const escape = value => JSON.stringify(value, null, 2).replace(/&/g, '&amp;').replace(/</g, '&lt;');
+    let html = '<details><summary>Lihat</summary>';
+    if (entry.before) html += `<div><small>Sebelum</small><pre>${escape(entry.before)}</pre></div>`;
+    if (entry.after) html += `<div><small>Sesudah</small><pre>${escape(entry.after)}</pre></div>`;
+    return html + '</details>';
+}
+
 // Toast notification helper
 function showToast(message) {
     // Remove existing toast
@@ -19,8 +19,12 @@ function isToday(dateStr) {
 document.addEventListener('DOMContentLoaded', function() {
     loadCounterData();
     loadStatsByType();
+    loadParkedQueues();
     connectSSE();
 
+    // Counters with assigned queue types call automatically by default
+    if (AUTO_ROUTE) selectQueueType('');
+
     // Polling fallback - update every 3 seconds if SSE is disconnected
     setInterval(() => {
         if (!sseConnected) loadCounterData();
@@ -29,6 +33,10 @@ document.addEventListener('DOMContentLoaded', function() {
     setInterval(() => {
         if (!sseConnected) loadStatsByType();
     }, 3000);
+
+    setInterval(() => {
+        if (!sseConnected) loadParkedQueues();
+    }, 3000);
 });
 
 // Select queue type
@@ -76,9 +84,12 @@ async function loadCounterData() {
 function updateCounterUI(counter) {
     const currentQueue = document.getElementById('current-queue');
     const queueStatus = document.getElementById('queue-status');
+    const queuePriority = document.getElementById('queue-priority');
     const btnRecall = document.getElementById('btn-recall');
     const btnComplete = document.getElementById('btn-complete');
     const btnCancel = document.getElementById('btn-cancel');
+    const btnSkip = document.getElementById('btn-skip');
+    const btnTransfer = document.getElementById('btn-transfer');
 
     // Check if current_queue exists (backend already handles the logic)
     if (counter.current_queue && counter.current_queue.queue_number) {
@@ -86,19 +97,25 @@ function updateCounterUI(counter) {
         currentQueue.textContent = counter.current_queue.queue_number;
         queueStatus.textContent = 'Sedang Dilayani';
         queueStatus.classList.add('active');
+        queuePriority.style.display = counter.current_queue.priority > 0 ? 'inline-block' : 'none';
 
         btnRecall.disabled = false;
         btnComplete.disabled = false;
         btnCancel.disabled = false;
+        btnSkip.disabled = false;
+        btnTransfer.disabled = false;
     } else {
         hasCurrentQueue = false;
         currentQueue.textContent = '---';
         queueStatus.textContent = 'Tidak Ada Antrian';
         queueStatus.classList.remove('active');
+        queuePriority.style.display = 'none';
 
         btnRecall.disabled = true;
         btnComplete.disabled = true;
         btnCancel.disabled = true;
+        btnSkip.disabled = true;
+        btnTransfer.disabled = true;
     }
 }
 
@@ -167,13 +184,29 @@ function handleEvent(event) {
         case 'queue_added':
             loadStatsByType();
             loadCounterData();
+            loadParkedQueues();
             break;
+        case 'queue_transferred':
+            showTransferNotice(event.data);
+            loadStatsByType();
+            break;
+    }
+}
+
+// Reload the page when the operator session has expired or was revoked,
+// so the server can show the counter login form again.
+function checkSession(response) {
+    if (response.status === 401 || response.status === 403) {
+        alert('Sesi Anda telah berakhir. Silakan masuk kembali.');
+        window.location.reload();
+        return false;
     }
+    return true;
 }
 
 // Call next queue
 async function callNext() {
-    if (!selectedQueueType) {
+    if (selectedQueueType === null) {
         alert('Silakan pilih jenis antrian terlebih dahulu.');
         return;
     }
@@ -186,8 +219,12 @@ async function callNext() {
             method: 'POST'
         });
 
+        if (!checkSession(response)) return;
+
         if (response.status === 404) {
-            alert(`Tidak ada antrian jenis ${selectedQueueType} yang menunggu.`);
+            alert(selectedQueueType
+                ? `Tidak ada antrian jenis ${selectedQueueType} yang menunggu.`
+                : 'Tidak ada antrian yang menunggu untuk loket ini.');
             loadCounterData();
             loadStatsByType();
             return;
@@ -227,6 +264,8 @@ async function recall() {
             method: 'POST'
         });
 
+        if (!checkSession(response)) return;
+
         if (!response.ok) {
             throw new Error('Failed to recall');
         }
@@ -256,6 +295,8 @@ async function complete() {
             method: 'POST'
         });
 
+        if (!checkSession(response)) return;
+
         if (!response.ok) {
             throw new Error('Failed to complete');
         }
@@ -277,7 +318,7 @@ async function complete() {
 async function cancel() {
     if (!hasCurrentQueue) return;
 
-    if (!confirm('Yakin ingin melewati antrian ini?')) {
+    if (!confirm('Yakin ingin membatalkan antrian ini? Nomor tidak dapat dikembalikan.')) {
         return;
     }
 
@@ -289,6 +330,8 @@ async function cancel() {
             method: 'POST'
         });
 
+        if (!checkSession(response)) return;
+
         if (!response.ok) {
             throw new Error('Failed to cancel');
         }
@@ -306,6 +349,260 @@ async function cancel() {
     }
 }
 
+// Show transfer modal for the current queue
+async function showTransferModal() {
+    if (!hasCurrentQueue) return;
+
+    document.getElementById('transfer-queue-number').textContent =
+        document.getElementById('current-queue').textContent.trim();
+    document.getElementById('transfer-type').value = '';
+
+    const select = document.getElementById('transfer-counter');
+    select.innerHTML = '<option value="">Loket mana saja</option>';
+    try {
+        const response = await fetch('/api/counters');
+        const counters = await response.json();
+        counters
+            .filter(c => c.is_active && c.id !== COUNTER_ID)
+            .forEach(c => {
+                const option = document.createElement('option');
+                option.value = c.id;
+                option.textContent = `Loket ${c.counter_number} - ${c.counter_name}`;
+                select.appendChild(option);
+            });
+    } catch (error) {
+        console.error('Failed to load counters:', error);
+    }
+
+    document.getElementById('transfer-modal').classList.add('show');
+}
+
+function closeTransferModal() {
+    document.getElementById('transfer-modal').classList.remove('show');
+}
+
+document.addEventListener('keydown', function(e) {
+    if (e.key === 'Escape') closeTransferModal();
+});
+
+// Transfer current queue to another service and/or counter
+async function transfer() {
+    const queueType = document.getElementById('transfer-type').value;
+    const counterId = parseInt(document.getElementById('transfer-counter').value, 10) || 0;
+
+    if (!queueType && !counterId) {
+        alert('Pilih jenis layanan atau loket tujuan.');
+        return;
+    }
+
+    const btn = document.getElementById('transfer-submit');
+    btn.disabled = true;
+
+    try {
+        const response = await fetch(`/api/counter/${COUNTER_ID}/transfer`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ queue_type: queueType, counter_id: counterId })
+        });
+
+        if (!checkSession(response)) return;
+
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to transfer');
+        }
+
+        const counter = await response.json();
+        updateCounterUI(counter);
+        closeTransferModal();
+    } catch (error) {
+        console.error('Failed to transfer:', error);
+        alert('Gagal mengalihkan antrian. Silakan coba lagi.');
+    } finally {
+        btn.disabled = false;
+        loadCounterData();
+        loadStatsByType();
+    }
+}
+
+// Notify the operator that a ticket was transferred to this counter
+function showTransferNotice(data) {
+    const notice = document.getElementById('transfer-notice');
+    notice.textContent = `Antrian ${data.queue_number} dialihkan dari ${data.from_counter_name}. Tekan Panggil Berikutnya untuk memanggil.`;
+    notice.style.display = '';
+    notice.onclick = () => { notice.style.display = 'none'; };
+    // Transferred tickets are called regardless of the selected type, but
+    // call-next needs some type selected
+    if (selectedQueueType === null) {
+        const btn = document.querySelector(`.queue-type-btn[data-type="${data.queue_type}"]`) ||
+            document.querySelector('.queue-type-btn');
+        if (btn) selectQueueType(btn.dataset.type);
+    }
+}
+
+// Park current queue as no-show
+async function skip() {
+    if (!hasCurrentQueue) return;
+
+    const btn = document.getElementById('btn-skip');
+    btn.disabled = true;
+
+    try {
+        const response = await fetch(`/api/counter/${COUNTER_ID}/skip`, {
+            method: 'POST'
+        });
+
+        if (!checkSession(response)) return;
+
+        if (!response.ok) {
+            throw new Error('Failed to skip');
+        }
+
+        const counter = await response.json();
+        updateCounterUI(counter);
+
+    } catch (error) {
+        console.error('Failed to skip:', error);
+        alert('Gagal melewati antrian. Silakan coba lagi.');
+    } finally {
+        btn.disabled = false;
+        loadCounterData();
+        loadStatsByType();
+        loadParkedQueues();
+    }
+}
+
+// Load today's no-show tickets
+async function loadParkedQueues() {
+    try {
+        const today = new Date().toISOString().split('T')[0];
+        const response = await fetch(`/api/queues?status=no_show&date=${today}&per_page=100`);
+        const result = await response.json();
+        renderParkedQueues(result.queues || []);
+    } catch (error) {
+        console.error('Failed to load no-show queues:', error);
+    }
+}
+
+function renderParkedQueues(queues) {
+    const section = document.getElementById('parked-section');
+    const list = document.getElementById('parked-list');
+
+    if (queues.length === 0) {
+        section.style.display = 'none';
+        list.innerHTML = '';
+        return;
+    }
+
+    section.style.display = '';
+    list.innerHTML = queues.map(q => {
+        const exhausted = q.skip_count > GRACE_RECALLS;
+        return `
+            <div class="parked-item">
+                <span class="parked-number">${q.queue_number}</span>
+                <span class="parked-info">Tidak hadir ${q.skip_count}x</span>
+                <button onclick="returnQueue(${q.id}, 0)" ${exhausted ? 'disabled' : ''}>Paling depan</button>
+                <button onclick="returnQueueAfter(${q.id})" ${exhausted ? 'disabled' : ''}>Setelah...</button>
+            </div>
+        `;
+    }).join('');
+}
+
+function returnQueueAfter(queueId) {
+    const input = prompt('Kembalikan setelah berapa nomor antrian?', '3');
+    if (input === null) return;
+
+    const after = parseInt(input, 10);
+    if (isNaN(after) || after < 0) {
+        alert('Masukkan angka 0 atau lebih.');
+        return;
+    }
+    returnQueue(queueId, after);
+}
+
+// Return a no-show ticket to the waiting queue
+async function returnQueue(queueId, after) {
+    try {
+        const response = await fetch(`/api/counter/${COUNTER_ID}/return`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ queue_id: queueId, after: after })
+        });
+
+        if (!checkSession(response)) return;
+
+        if (response.status === 409) {
+            const error = await response.json();
+            if (error.error && error.error.startsWith('No grace recalls')) {
+                alert('Batas panggil ulang untuk nomor ini sudah habis.');
+            } else {
+                alert('Nomor ini sudah tidak dapat dikembalikan.');
+            }
+            return;
+        }
+
+        if (!response.ok) {
+            throw new Error('Failed to return queue');
+        }
+    } catch (error) {
+        console.error('Failed to return queue:', error);
+        alert('Gagal mengembalikan antrian. Silakan coba lagi.');
+    } finally {
+        loadParkedQueues();
+        loadStatsByType();
+    }
+}
+
+// Mark a waiting ticket as priority (lansia, disabilitas, ibu hamil)
+async function markPriority(e) {
+    e.preventDefault();
+
+    const input = document.getElementById('priority-number');
+    const number = input.value.trim().toUpperCase();
+    if (!number) return;
+
+    const btn = document.getElementById('btn-priority');
+    btn.disabled = true;
+
+    try {
+        // Find today's waiting ticket with this number
+        const today = new Date().toISOString().split('T')[0];
+        const listResponse = await fetch(`/api/queues?status=waiting&date=${today}&per_page=100`);
+        const result = await listResponse.json();
+        const queue = (result.queues || []).find(q => q.queue_number === number);
+
+        if (!queue) {
+            alert(`Antrian ${number} tidak ditemukan atau sudah dipanggil.`);
+            return;
+        }
+        if (queue.priority > 0) {
+            alert(`Antrian ${number} sudah prioritas.`);
+            return;
+        }
+
+        const response = await fetch(`/api/queue/${queue.id}/priority`, {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ priority: 1 })
+        });
+
+        if (!checkSession(response)) return;
+
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to set priority');
+        }
+
+        input.value = '';
+        alert(`Antrian ${number} sekarang prioritas.`);
+    } catch (error) {
+        console.error('Failed to set priority:', error);
+        alert('Gagal mengubah prioritas. Silakan coba lagi.');
+    } finally {
+        btn.disabled = false;
+    }
+}
+
 // Add pulse animation
 const style = document.createElement('style');
 style.textContent = `
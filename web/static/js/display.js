@@ -146,6 +146,7 @@ async function loadCalledQueues() {
                 counterStatus[q.counter_id] = {
                     queue_number: q.queue_number,
                     queue_type: q.queue_type,
+                    priority: q.priority,
                     called_at: q.called_at
                 };
             }
@@ -190,9 +191,10 @@ function renderCounterGrid() {
         const statusClass = hasStatus ? 'active' : 'idle';
         const queueNumber = hasStatus ? status.queue_number : '---';
         const statusText = hasStatus ? 'Melayani' : 'Tidak Aktif';
+        const priorityClass = hasStatus && status.priority > 0 ? 'priority' : '';
 
         return `
-            <div class="counter-card ${statusClass}" data-counter-id="${counter.id}">
+            <div class="counter-card ${statusClass} ${priorityClass}" data-counter-id="${counter.id}">
                 <div class="counter-name">${counter.counter_name}</div>
                 <div class="counter-number">${queueNumber}</div>
                 <div class="counter-status">${statusText}</div>
@@ -215,6 +217,7 @@ function updateCounterGridStatus() {
 
         // Update classes
         card.classList.remove('active', 'calling', 'idle');
+        card.classList.toggle('priority', !!(hasStatus && status.priority > 0));
 
         if (hasStatus) {
             card.classList.add('active');
@@ -640,6 +643,7 @@ async function pollForUpdates() {
                         counter_id: latestCalled.counter_id,
                         counter_number: counter.counter_number,
                         counter_name: counter.counter_name,
+                        priority: latestCalled.priority,
                     });
                 }
             }
@@ -677,6 +681,7 @@ function handleQueueCalled(data) {
         counterStatus[data.counter_id] = {
             queue_number: data.queue_number,
             queue_type: data.queue_type,
+            priority: data.priority,
             called_at: timestamp
         };
         highlightCounter(data.counter_id);
@@ -689,6 +694,7 @@ function handleQueueCalled(data) {
         counter_name: data.counter_name,
         counter_id: data.counter_id,
         queue_type: data.queue_type,
+        priority: data.priority,
         timestamp: timestamp
     });
 
@@ -743,8 +749,9 @@ function renderRecentCalls() {
         const timeAgo = getTimeAgo(call.timestamp);
 
         return `
-            <div class="call-card ${isLatest ? 'latest' : ''}">
+            <div class="call-card ${isLatest ? 'latest' : ''} ${call.priority > 0 ? 'priority' : ''}">
                 <div class="call-number">${call.queue_number}</div>
+                ${call.priority > 0 ? '<div class="call-priority">Prioritas</div>' : ''}
                 <div class="call-counter">${call.counter_name}</div>
                 <div class="call-time">${timeAgo}</div>
             </div>